@@ -0,0 +1,65 @@
+package graph
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/moeen/redisearch-shopping/internal/auth"
+	"github.com/moeen/redisearch-shopping/internal/mailer"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+)
+
+// actionEmail is the email which delivers an action token of a purpose
+type actionEmail struct {
+	// expiration is how long the token can be used after it's sent
+	expiration time.Duration
+
+	subject string
+
+	// body is formatted with the customer name, the token and the expiration time
+	body string
+}
+
+// actionEmails are the emails of each action token purpose
+var actionEmails = map[string]actionEmail{
+	models.PurposePasswordReset: {
+		expiration: time.Hour,
+		subject:    "Reset your password",
+		body: "Hi %s,\n\nUse the token below to reset your password:\n\n%s\n\n" +
+			"It expires in %s. If you didn't ask for a password reset, you can ignore this email.",
+	},
+	models.PurposeEmailVerification: {
+		expiration: 48 * time.Hour,
+		subject:    "Verify your email",
+		body:       "Hi %s,\n\nUse the token below to verify your email:\n\n%s\n\nIt expires in %s.",
+	},
+}
+
+// sendActionToken creates an action token of the purpose for the customer and emails it
+func (r *Resolver) sendActionToken(c *models.Customer, purpose string) error {
+	email, ok := actionEmails[purpose]
+	if !ok {
+		return fmt.Errorf("unknown action token purpose: %s", purpose)
+	}
+
+	token, hash, err := auth.NewSecretToken()
+	if err != nil {
+		return fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	err = r.Storage.CreateActionToken(&models.ActionToken{
+		CustomerID: int(c.ID),
+		Purpose:    purpose,
+		TokenHash:  hash,
+		ExpiresAt:  time.Now().Add(email.expiration),
+	})
+	if err != nil {
+		return err
+	}
+
+	return r.Mailer.Send(mailer.Message{
+		To:      c.Email,
+		Subject: email.subject,
+		Body:    fmt.Sprintf(email.body, c.Name, token, email.expiration),
+	})
+}
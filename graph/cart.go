@@ -0,0 +1,96 @@
+package graph
+
+import (
+	"fmt"
+	"github.com/moeen/redisearch-shopping/graph/model"
+	"github.com/moeen/redisearch-shopping/internal/apperr"
+	"github.com/moeen/redisearch-shopping/internal/pricing"
+	"github.com/moeen/redisearch-shopping/internal/storage"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+)
+
+// cartModel converts the stored cart items to the GraphQL cart priced by the pricing service
+func (r *Resolver) cartModel(items []*models.CartItem) *model.Cart {
+	lines := pricing.CartLines(items)
+	b := r.Pricing.Price(lines)
+
+	cart := &model.Cart{
+		Products:      make([]*model.ProductInCart, len(items)),
+		ItemCount:     b.ItemCount,
+		Subtotal:      b.Subtotal,
+		DiscountTotal: b.DiscountTotal,
+		TaxTotal:      b.TaxTotal,
+		GrandTotal:    b.GrandTotal,
+	}
+
+	for i, ci := range items {
+		cart.Products[i] = &model.ProductInCart{
+			Product: &model.Product{
+				ID:      fmt.Sprintf("%d", ci.ProductID),
+				Name:    ci.Product.Name,
+				Price:   ci.Product.Price,
+				Stock:   ci.Product.Stock,
+				InStock: ci.Product.Stock > 0,
+			},
+			Quantity:  ci.Quantity,
+			LineTotal: lines[i].Total(),
+		}
+	}
+
+	return cart
+}
+
+// checkCartProduct makes sure the product which is put in a cart exists and returns it, the storage
+// checks it again when the cart is written in case the product is deleted meanwhile
+func (r *Resolver) checkCartProduct(field string, productID int) (*models.Product, error) {
+	p, err := r.Storage.GetProduct(productID)
+	if err != nil {
+		return nil, cartProductError(field, err)
+	}
+
+	return p, nil
+}
+
+// cartProductError converts the not found error of a product which is put in a cart to a validation error
+func cartProductError(field string, err error) error {
+	if apperr.CodeOf(err) == apperr.CodeNotFound {
+		return apperr.Validation("product does not exist").With("field", field)
+	}
+
+	return err
+}
+
+// checkStock makes sure the product has the quantity which ends up in a cart in stock
+func checkStock(p *models.Product, quantity int) error {
+	if quantity > p.Stock {
+		return storage.OutOfStockError(int(p.ID), p.Stock)
+	}
+
+	return nil
+}
+
+// cartQuantity returns the quantity of the product which is in the customer cart
+func (r *Resolver) cartQuantity(customerID, productID int) (int, error) {
+	items, err := r.Storage.GetCartItems(customerID)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, ci := range items {
+		if ci.ProductID == productID {
+			return ci.Quantity, nil
+		}
+	}
+
+	return 0, nil
+}
+
+// customerCart returns the current cart of the customer
+func (r *Resolver) customerCart(customerID int) (*model.Cart, error) {
+	cartItems, err := r.Storage.GetCartItems(customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.cartModel(cartItems), nil
+}
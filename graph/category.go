@@ -0,0 +1,100 @@
+package graph
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/moeen/redisearch-shopping/graph/model"
+	"github.com/moeen/redisearch-shopping/internal/apperr"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+)
+
+const (
+	// maxCategoryNameLength is the maximum length of category names in characters
+	maxCategoryNameLength = 100
+
+	// maxSlugLength is the maximum length of category slugs
+	maxSlugLength = 64
+)
+
+// slugPattern matches slugs made of lowercase words joined by hyphens
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// validateSlug checks the slug given in the field of the input
+func validateSlug(field, slug string) error {
+	if len(slug) > maxSlugLength || !slugPattern.MatchString(slug) {
+		return apperr.Validation(fmt.Sprintf(
+			"slug must be at most %d lowercase letters, digits and single hyphens between them", maxSlugLength,
+		)).With("field", field)
+	}
+
+	return nil
+}
+
+// newCategory validates the input and converts it to the category which is stored
+func newCategory(input model.NewCategory) (*models.Category, error) {
+	name := strings.TrimSpace(input.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxCategoryNameLength {
+		return nil, apperr.Validation(fmt.Sprintf("category name must be between 1 and %d characters", maxCategoryNameLength)).
+			With("field", "name")
+	}
+
+	if err := validateSlug("slug", input.Slug); err != nil {
+		return nil, err
+	}
+
+	c := &models.Category{Name: name, Slug: input.Slug}
+	if input.ParentID != nil {
+		id, err := parseID("parentId", *input.ParentID)
+		if err != nil {
+			return nil, err
+		}
+
+		parentID := uint(id)
+		c.ParentID = &parentID
+	}
+
+	return c, nil
+}
+
+// categoryFilter validates the slug of the category products are filtered by, nil means no filter
+func categoryFilter(slug *string) (*string, error) {
+	if slug == nil {
+		return nil, nil
+	}
+
+	if err := validateSlug("category", *slug); err != nil {
+		return nil, err
+	}
+
+	return slug, nil
+}
+
+// categoryModel converts the stored category to the GraphQL one
+func categoryModel(c *models.Category) *model.Category {
+	res := &model.Category{
+		ID:   fmt.Sprintf("%d", c.ID),
+		Name: c.Name,
+		Slug: c.Slug,
+		Path: c.Path,
+	}
+
+	if c.ParentID != nil {
+		parentID := fmt.Sprintf("%d", *c.ParentID)
+		res.ParentID = &parentID
+	}
+
+	return res
+}
+
+// categoryModels converts the stored categories to the GraphQL ones, the result is never nil
+func categoryModels(categories []*models.Category) []*model.Category {
+	res := make([]*model.Category, len(categories))
+	for i, c := range categories {
+		res[i] = categoryModel(c)
+	}
+
+	return res
+}
@@ -0,0 +1,21 @@
+package graph
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/moeen/redisearch-shopping/graph/model"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+)
+
+// customerModel converts the stored customer to the GraphQL one, which never carries the password
+func customerModel(c *models.Customer) *model.Customer {
+	return &model.Customer{
+		ID:            fmt.Sprintf("%d", c.ID),
+		Email:         c.Email,
+		Name:          c.Name,
+		Role:          model.Role(strings.ToUpper(string(c.Role))),
+		EmailVerified: c.EmailVerifiedAt != nil,
+		TotpEnabled:   c.TotpEnabled(),
+	}
+}
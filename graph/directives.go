@@ -0,0 +1,36 @@
+package graph
+
+import (
+	"context"
+	"strings"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/moeen/redisearch-shopping/graph/model"
+	"github.com/moeen/redisearch-shopping/internal/apperr"
+	"github.com/moeen/redisearch-shopping/internal/auth"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+)
+
+// HasRole is the implementation of @hasRole directive, it only resolves the field
+// if the customer in context has the given role or a role above it, roles requiring
+// two-factor authentication also need a session started by a second factor
+func HasRole(ctx context.Context, obj interface{}, next graphql.Resolver, role model.Role) (interface{}, error) {
+	customer, ok := auth.CustomerFromContext(ctx)
+	if !ok {
+		return nil, errUnauthenticated
+	}
+
+	required := models.Role(strings.ToLower(role.String()))
+	if !customer.Role.Includes(required) {
+		return nil, apperr.Forbidden("access denied")
+	}
+
+	if required.RequiresMFA() {
+		claims, ok := auth.ClaimsFromContext(ctx)
+		if !ok || !claims.MFA {
+			return nil, apperr.Forbidden("two-factor authentication required")
+		}
+	}
+
+	return next(ctx)
+}
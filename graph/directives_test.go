@@ -0,0 +1,66 @@
+package graph
+
+import (
+	"context"
+	"testing"
+
+	"github.com/moeen/redisearch-shopping/graph/model"
+	"github.com/moeen/redisearch-shopping/internal/apperr"
+	"github.com/moeen/redisearch-shopping/internal/auth"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestHasRole(t *testing.T) {
+	next := func(ctx context.Context) (interface{}, error) {
+		return "resolved", nil
+	}
+
+	withRole := func(role models.Role, mfa bool) context.Context {
+		customer := &models.Customer{
+			Model: gorm.Model{
+				ID: 1,
+			},
+			Email: "test@test.com",
+			Name:  "test",
+			Role:  role,
+		}
+
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+		return context.WithValue(ctx, auth.ClaimsContextKey{}, &auth.Claims{CustomerID: 1, Role: role, MFA: mfa})
+	}
+
+	t.Run("test with no customer in ctx", func(t *testing.T) {
+		res, err := HasRole(context.Background(), nil, next, model.RoleAdmin)
+		assert.Equal(t, apperr.CodeUnauthenticated, apperr.CodeOf(err))
+		assert.Nil(t, res)
+	})
+
+	t.Run("test with lower role", func(t *testing.T) {
+		for _, role := range []models.Role{models.RoleCustomer, models.RoleStaff, ""} {
+			res, err := HasRole(withRole(role, true), nil, next, model.RoleAdmin)
+			assert.Equal(t, apperr.CodeForbidden, apperr.CodeOf(err))
+			assert.Nil(t, res)
+		}
+	})
+
+	t.Run("test with required role", func(t *testing.T) {
+		res, err := HasRole(withRole(models.RoleAdmin, true), nil, next, model.RoleAdmin)
+		assert.NoError(t, err)
+		assert.Equal(t, "resolved", res)
+	})
+
+	t.Run("test with required role and no second factor", func(t *testing.T) {
+		res, err := HasRole(withRole(models.RoleAdmin, false), nil, next, model.RoleAdmin)
+		assert.EqualError(t, err, "two-factor authentication required")
+		assert.Equal(t, apperr.CodeForbidden, apperr.CodeOf(err))
+		assert.Nil(t, res)
+	})
+
+	t.Run("test with higher role", func(t *testing.T) {
+		res, err := HasRole(withRole(models.RoleAdmin, false), nil, next, model.RoleStaff)
+		assert.NoError(t, err)
+		assert.Equal(t, "resolved", res)
+	})
+}
@@ -0,0 +1,37 @@
+package graph
+
+import (
+	"math"
+
+	"github.com/moeen/redisearch-shopping/internal/apperr"
+	"github.com/moeen/redisearch-shopping/internal/auth"
+)
+
+const (
+	// loginLockedErrorCode is the error code returned when login attempts are locked
+	loginLockedErrorCode apperr.Code = "LOGIN_LOCKED"
+
+	// emailTakenErrorCode is the error code returned when an email is already registered
+	emailTakenErrorCode apperr.Code = "EMAIL_TAKEN"
+)
+
+var (
+	// errUnauthenticated is returned when a resolver needs a customer and the request has none
+	errUnauthenticated = apperr.Unauthenticated("access denied")
+
+	// errInvalidRefreshToken is returned for every refresh token which can't be exchanged,
+	// so clients can't tell unknown tokens from revoked or expired ones
+	errInvalidRefreshToken = apperr.Unauthenticated("invalid refresh token")
+)
+
+// loginLockedError creates the error telling the client how many seconds
+// it must wait before trying to login again
+func loginLockedError(err *auth.LockedError) *apperr.Error {
+	return apperr.Wrap(loginLockedErrorCode, err.Error(), err).
+		With("retryAfter", int(math.Ceil(err.RetryAfter.Seconds())))
+}
+
+// emailTakenError creates the error returned when registering an email which already has an account
+func emailTakenError() *apperr.Error {
+	return apperr.New(emailTakenErrorCode, "email is already taken")
+}
@@ -0,0 +1,12 @@
+package model
+
+// Customer is the GraphQL customer, it has no cart field so the cart is
+// only resolved when it's requested
+type Customer struct {
+	ID            string `json:"id"`
+	Email         string `json:"email"`
+	Name          string `json:"name"`
+	Role          Role   `json:"role"`
+	EmailVerified bool   `json:"emailVerified"`
+	TotpEnabled   bool   `json:"totpEnabled"`
+}
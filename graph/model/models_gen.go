@@ -2,21 +2,38 @@
 
 package model
 
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
 type AddToCard struct {
 	ProductID string `json:"product_id"`
 	Quantity  int    `json:"quantity"`
 }
 
+type AuthPayload struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresAt    int    `json:"expiresAt"`
+}
+
 type Cart struct {
-	Products []*ProductInCart `json:"products"`
+	Products      []*ProductInCart `json:"products"`
+	ItemCount     int              `json:"itemCount"`
+	Subtotal      int              `json:"subtotal"`
+	DiscountTotal int              `json:"discountTotal"`
+	TaxTotal      int              `json:"taxTotal"`
+	GrandTotal    int              `json:"grandTotal"`
 }
 
-type Customer struct {
-	ID       string `json:"id"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
-	Name     string `json:"name"`
-	Cart     *Cart  `json:"cart"`
+type Category struct {
+	ID       string  `json:"id"`
+	Name     string  `json:"name"`
+	Slug     string  `json:"slug"`
+	Path     string  `json:"path"`
+	ParentID *string `json:"parentId"`
 }
 
 type Login struct {
@@ -24,15 +41,107 @@ type Login struct {
 	Password string `json:"password"`
 }
 
-type Product struct {
-	ID    string `json:"id"`
-	Name  string `json:"name"`
-	Price int    `json:"price"`
+type LoginResult struct {
+	Auth          *AuthPayload `json:"auth"`
+	TotpChallenge *string      `json:"totpChallenge"`
+}
+
+type NewCategory struct {
+	Name     string  `json:"name"`
+	Slug     string  `json:"slug"`
+	ParentID *string `json:"parentId"`
+}
+
+type NumericFilter struct {
+	Field NumericField `json:"field"`
+	Min   *int         `json:"min"`
+	Max   *int         `json:"max"`
+}
+
+type Order struct {
+	ID            string        `json:"id"`
+	Status        OrderStatus   `json:"status"`
+	Items         []*OrderItem  `json:"items"`
+	ItemCount     int           `json:"itemCount"`
+	Subtotal      int           `json:"subtotal"`
+	DiscountTotal int           `json:"discountTotal"`
+	TaxTotal      int           `json:"taxTotal"`
+	GrandTotal    int           `json:"grandTotal"`
+	CreatedAt     int           `json:"createdAt"`
+	Timeline      []*OrderEvent `json:"timeline"`
+}
+
+type OrderEvent struct {
+	From      *OrderStatus `json:"from"`
+	Status    OrderStatus  `json:"status"`
+	Reason    *string      `json:"reason"`
+	CreatedAt int          `json:"createdAt"`
+}
+
+type OrderItem struct {
+	ProductID string `json:"productId"`
+	Name      string `json:"name"`
+	UnitPrice int    `json:"unitPrice"`
+	Quantity  int    `json:"quantity"`
+	LineTotal int    `json:"lineTotal"`
+}
+
+type PageInfo struct {
+	HasNextPage     bool    `json:"hasNextPage"`
+	HasPreviousPage bool    `json:"hasPreviousPage"`
+	StartCursor     *string `json:"startCursor"`
+	EndCursor       *string `json:"endCursor"`
+}
+
+type Payment struct {
+	ID        string        `json:"id"`
+	Status    PaymentStatus `json:"status"`
+	Amount    int           `json:"amount"`
+	ActionURL *string       `json:"actionUrl"`
+}
+
+type PriceFacet struct {
+	Min   *int `json:"min"`
+	Max   *int `json:"max"`
+	Count int  `json:"count"`
+}
+
+type ProductConnection struct {
+	Edges      []*ProductEdge `json:"edges"`
+	PageInfo   *PageInfo      `json:"pageInfo"`
+	TotalCount int            `json:"totalCount"`
+}
+
+type ProductEdge struct {
+	Cursor string   `json:"cursor"`
+	Node   *Product `json:"node"`
 }
 
 type ProductInCart struct {
-	Product  *Product `json:"product"`
-	Quantity int      `json:"quantity"`
+	Product   *Product `json:"product"`
+	Quantity  int      `json:"quantity"`
+	LineTotal int      `json:"lineTotal"`
+}
+
+type ProductSearch struct {
+	Text           *string          `json:"text"`
+	Fuzzy          *bool            `json:"fuzzy"`
+	MinPrice       *int             `json:"minPrice"`
+	MaxPrice       *int             `json:"maxPrice"`
+	NumericFilters []*NumericFilter `json:"numericFilters"`
+	InStock        *bool            `json:"inStock"`
+	Category       *string          `json:"category"`
+}
+
+type ProductSearchResult struct {
+	Products    *ProductConnection `json:"products"`
+	PriceFacets []*PriceFacet      `json:"priceFacets"`
+	Suggestions []string           `json:"suggestions"`
+}
+
+type ProductSuggestion struct {
+	Text      string `json:"text"`
+	ProductID string `json:"productId"`
 }
 
 type Register struct {
@@ -40,3 +149,288 @@ type Register struct {
 	Name     string `json:"name"`
 	Password string `json:"password"`
 }
+
+type TotpSetup struct {
+	URI           string   `json:"uri"`
+	Secret        string   `json:"secret"`
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+type UpdateProduct struct {
+	ID    string  `json:"id"`
+	Name  *string `json:"name"`
+	Price *int    `json:"price"`
+}
+
+type UpdateProfile struct {
+	Email           *string `json:"email"`
+	Name            *string `json:"name"`
+	CurrentPassword *string `json:"currentPassword"`
+	TotpCode        *string `json:"totpCode"`
+}
+
+type NumericField string
+
+const (
+	NumericFieldPrice NumericField = "PRICE"
+)
+
+var AllNumericField = []NumericField{
+	NumericFieldPrice,
+}
+
+func (e NumericField) IsValid() bool {
+	switch e {
+	case NumericFieldPrice:
+		return true
+	}
+	return false
+}
+
+func (e NumericField) String() string {
+	return string(e)
+}
+
+func (e *NumericField) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = NumericField(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid NumericField", str)
+	}
+	return nil
+}
+
+func (e NumericField) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type OrderStatus string
+
+const (
+	OrderStatusPending   OrderStatus = "PENDING"
+	OrderStatusPaid      OrderStatus = "PAID"
+	OrderStatusFulfilled OrderStatus = "FULFILLED"
+	OrderStatusShipped   OrderStatus = "SHIPPED"
+	OrderStatusDelivered OrderStatus = "DELIVERED"
+	OrderStatusCancelled OrderStatus = "CANCELLED"
+	OrderStatusRefunded  OrderStatus = "REFUNDED"
+)
+
+var AllOrderStatus = []OrderStatus{
+	OrderStatusPending,
+	OrderStatusPaid,
+	OrderStatusFulfilled,
+	OrderStatusShipped,
+	OrderStatusDelivered,
+	OrderStatusCancelled,
+	OrderStatusRefunded,
+}
+
+func (e OrderStatus) IsValid() bool {
+	switch e {
+	case OrderStatusPending, OrderStatusPaid, OrderStatusFulfilled, OrderStatusShipped, OrderStatusDelivered, OrderStatusCancelled, OrderStatusRefunded:
+		return true
+	}
+	return false
+}
+
+func (e OrderStatus) String() string {
+	return string(e)
+}
+
+func (e *OrderStatus) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = OrderStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid OrderStatus", str)
+	}
+	return nil
+}
+
+func (e OrderStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type PaymentStatus string
+
+const (
+	PaymentStatusPending    PaymentStatus = "PENDING"
+	PaymentStatusAuthorized PaymentStatus = "AUTHORIZED"
+	PaymentStatusCaptured   PaymentStatus = "CAPTURED"
+	PaymentStatusDeclined   PaymentStatus = "DECLINED"
+	PaymentStatusVoided     PaymentStatus = "VOIDED"
+	PaymentStatusRefunded   PaymentStatus = "REFUNDED"
+)
+
+var AllPaymentStatus = []PaymentStatus{
+	PaymentStatusPending,
+	PaymentStatusAuthorized,
+	PaymentStatusCaptured,
+	PaymentStatusDeclined,
+	PaymentStatusVoided,
+	PaymentStatusRefunded,
+}
+
+func (e PaymentStatus) IsValid() bool {
+	switch e {
+	case PaymentStatusPending, PaymentStatusAuthorized, PaymentStatusCaptured, PaymentStatusDeclined, PaymentStatusVoided, PaymentStatusRefunded:
+		return true
+	}
+	return false
+}
+
+func (e PaymentStatus) String() string {
+	return string(e)
+}
+
+func (e *PaymentStatus) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = PaymentStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid PaymentStatus", str)
+	}
+	return nil
+}
+
+func (e PaymentStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type ProductSortField string
+
+const (
+	ProductSortFieldRelevance ProductSortField = "RELEVANCE"
+	ProductSortFieldPrice     ProductSortField = "PRICE"
+	ProductSortFieldName      ProductSortField = "NAME"
+)
+
+var AllProductSortField = []ProductSortField{
+	ProductSortFieldRelevance,
+	ProductSortFieldPrice,
+	ProductSortFieldName,
+}
+
+func (e ProductSortField) IsValid() bool {
+	switch e {
+	case ProductSortFieldRelevance, ProductSortFieldPrice, ProductSortFieldName:
+		return true
+	}
+	return false
+}
+
+func (e ProductSortField) String() string {
+	return string(e)
+}
+
+func (e *ProductSortField) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ProductSortField(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ProductSortField", str)
+	}
+	return nil
+}
+
+func (e ProductSortField) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type Role string
+
+const (
+	RoleCustomer Role = "CUSTOMER"
+	RoleStaff    Role = "STAFF"
+	RoleAdmin    Role = "ADMIN"
+)
+
+var AllRole = []Role{
+	RoleCustomer,
+	RoleStaff,
+	RoleAdmin,
+}
+
+func (e Role) IsValid() bool {
+	switch e {
+	case RoleCustomer, RoleStaff, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+func (e Role) String() string {
+	return string(e)
+}
+
+func (e *Role) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = Role(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid Role", str)
+	}
+	return nil
+}
+
+func (e Role) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type SortDirection string
+
+const (
+	SortDirectionAsc  SortDirection = "ASC"
+	SortDirectionDesc SortDirection = "DESC"
+)
+
+var AllSortDirection = []SortDirection{
+	SortDirectionAsc,
+	SortDirectionDesc,
+}
+
+func (e SortDirection) IsValid() bool {
+	switch e {
+	case SortDirectionAsc, SortDirectionDesc:
+		return true
+	}
+	return false
+}
+
+func (e SortDirection) String() string {
+	return string(e)
+}
+
+func (e *SortDirection) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = SortDirection(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid SortDirection", str)
+	}
+	return nil
+}
+
+func (e SortDirection) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
@@ -0,0 +1,24 @@
+package model
+
+// Product is the GraphQL product, its categories are resolved when they're requested
+// unless they're loaded along with the product
+type Product struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Price   int    `json:"price"`
+	Stock   int    `json:"stock"`
+	InStock bool   `json:"inStock"`
+
+	categories []*Category
+}
+
+// WithCategories sets the categories loaded along with the product, so they aren't queried again
+func (p *Product) WithCategories(categories []*Category) *Product {
+	p.categories = categories
+	return p
+}
+
+// LoadedCategories returns the categories set by WithCategories, nil if they're not loaded
+func (p *Product) LoadedCategories() []*Category {
+	return p.categories
+}
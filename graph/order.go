@@ -0,0 +1,118 @@
+package graph
+
+import (
+	"fmt"
+	"github.com/moeen/redisearch-shopping/graph/model"
+	"github.com/moeen/redisearch-shopping/internal/apperr"
+	"github.com/moeen/redisearch-shopping/internal/pricing"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxReasonLength is the limit of the reasons given for order status changes in characters
+const maxReasonLength = 500
+
+// newOrder creates the pending order of the cart items priced by the same pricing service as the cart,
+// the customer who checks out is recorded as the one who created it
+func (r *Resolver) newOrder(customerID int, items []*models.CartItem) *models.Order {
+	lines := pricing.CartLines(items)
+	b := r.Pricing.Price(lines)
+
+	order := &models.Order{
+		CustomerID: customerID,
+		Status:     models.OrderPending,
+		History: []models.OrderHistory{
+			{ToStatus: models.OrderPending, ActorID: customerID},
+		},
+		Items:         make([]models.OrderItem, len(items)),
+		ItemCount:     b.ItemCount,
+		Subtotal:      b.Subtotal,
+		DiscountTotal: b.DiscountTotal,
+		TaxTotal:      b.TaxTotal,
+		GrandTotal:    b.GrandTotal,
+	}
+
+	for i, ci := range items {
+		order.Items[i] = models.OrderItem{
+			ProductID: ci.ProductID,
+			Name:      ci.Product.Name,
+			UnitPrice: lines[i].UnitPrice,
+			Quantity:  lines[i].Quantity,
+			LineTotal: lines[i].Total(),
+		}
+	}
+
+	return order
+}
+
+// orderModel converts the stored order to the GraphQL one
+func orderModel(o *models.Order) *model.Order {
+	order := &model.Order{
+		ID:            fmt.Sprintf("%d", o.ID),
+		Status:        orderStatusModel(o.Status),
+		Items:         make([]*model.OrderItem, len(o.Items)),
+		ItemCount:     o.ItemCount,
+		Subtotal:      o.Subtotal,
+		DiscountTotal: o.DiscountTotal,
+		TaxTotal:      o.TaxTotal,
+		GrandTotal:    o.GrandTotal,
+		CreatedAt:     int(o.CreatedAt.Unix()),
+		Timeline:      make([]*model.OrderEvent, len(o.History)),
+	}
+
+	for i, oi := range o.Items {
+		order.Items[i] = &model.OrderItem{
+			ProductID: fmt.Sprintf("%d", oi.ProductID),
+			Name:      oi.Name,
+			UnitPrice: oi.UnitPrice,
+			Quantity:  oi.Quantity,
+			LineTotal: oi.LineTotal,
+		}
+	}
+
+	// who changed the status is only kept for auditing, customers only see what happened and why
+	for i, h := range o.History {
+		e := &model.OrderEvent{
+			Status:    orderStatusModel(h.ToStatus),
+			CreatedAt: int(h.CreatedAt.Unix()),
+		}
+		if h.FromStatus != "" {
+			from := orderStatusModel(h.FromStatus)
+			e.From = &from
+		}
+		if h.Reason != "" {
+			reason := h.Reason
+			e.Reason = &reason
+		}
+
+		order.Timeline[i] = e
+	}
+
+	return order
+}
+
+// orderStatusModel converts the stored order status to the GraphQL one
+func orderStatusModel(s models.OrderStatus) model.OrderStatus {
+	return model.OrderStatus(strings.ToUpper(string(s)))
+}
+
+// orderStatus converts the GraphQL order status to the stored one
+func orderStatus(s model.OrderStatus) models.OrderStatus {
+	return models.OrderStatus(strings.ToLower(s.String()))
+}
+
+// validateReason trims the reason of an order status change and checks its length
+func validateReason(reason *string) (string, error) {
+	if reason == nil {
+		return "", nil
+	}
+
+	r := strings.TrimSpace(*reason)
+	if utf8.RuneCountInString(r) > maxReasonLength {
+		return "", apperr.Validation(fmt.Sprintf("reason can not be longer than %d characters", maxReasonLength)).
+			With("field", "reason")
+	}
+
+	return r, nil
+}
@@ -0,0 +1,116 @@
+package graph
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/moeen/redisearch-shopping/graph/model"
+	"github.com/moeen/redisearch-shopping/internal/apperr"
+	"github.com/moeen/redisearch-shopping/internal/storage"
+)
+
+const (
+	// defaultPageSize is the number of products returned when first is not provided
+	defaultPageSize = 10
+
+	// maxPageSize is the maximum number of products which can be requested in a page
+	maxPageSize = 100
+
+	// maxCursorOffset is the largest offset a cursor can point to, larger ones would overflow
+	// once the page is moved past them
+	maxCursorOffset = 1000000
+
+	// cursorPrefix is prepended to the offset before encoding it as a cursor
+	cursorPrefix = "offset:"
+)
+
+// encodeCursor creates an opaque cursor pointing to the given offset
+func encodeCursor(offset int) string {
+	return base64.StdEncoding.EncodeToString([]byte(cursorPrefix + strconv.Itoa(offset)))
+}
+
+// decodeCursor returns the offset which the given cursor points to
+func decodeCursor(cursor string) (int, error) {
+	b, err := base64.StdEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, apperr.Validation(fmt.Sprintf("invalid cursor: %s", cursor)).With("field", "after")
+	}
+
+	s := string(b)
+	if !strings.HasPrefix(s, cursorPrefix) {
+		return 0, apperr.Validation(fmt.Sprintf("invalid cursor: %s", cursor)).With("field", "after")
+	}
+
+	offset, err := strconv.Atoi(strings.TrimPrefix(s, cursorPrefix))
+	if err != nil || offset < 0 || offset > maxCursorOffset {
+		return 0, apperr.Validation(fmt.Sprintf("invalid cursor: %s", cursor)).With("field", "after")
+	}
+
+	return offset, nil
+}
+
+// pageOptions converts the pagination arguments of a connection to offset and limit
+func pageOptions(first *int, after *string) (offset, limit int, err error) {
+	limit = defaultPageSize
+	if first != nil {
+		// storages treat a zero limit as no limit, so a page must have at least one product
+		if *first < 1 || *first > maxPageSize {
+			return 0, 0, apperr.Validation(fmt.Sprintf("first must be between 1 and %d", maxPageSize)).With("field", "first")
+		}
+		limit = *first
+	}
+
+	if after != nil && *after != "" {
+		offset, err = decodeCursor(*after)
+		if err != nil {
+			return 0, 0, err
+		}
+		// after points to the last seen item, so the page starts right after it
+		offset++
+	}
+
+	return offset, limit, nil
+}
+
+// sortOptions converts the GraphQL sort arguments to the storage ones
+func sortOptions(sortBy *model.ProductSortField, direction *model.SortDirection) (storage.SortField, bool) {
+	field := storage.SortByRelevance
+	if sortBy != nil {
+		switch *sortBy {
+		case model.ProductSortFieldPrice:
+			field = storage.SortByPrice
+		case model.ProductSortFieldName:
+			field = storage.SortByName
+		}
+	}
+
+	return field, direction != nil && *direction == model.SortDirectionDesc
+}
+
+// productConnection creates a connection from a page of products starting at offset
+func productConnection(products []*model.Product, offset, total int) *model.ProductConnection {
+	conn := &model.ProductConnection{
+		Edges: make([]*model.ProductEdge, len(products)),
+		PageInfo: &model.PageInfo{
+			HasNextPage:     offset+len(products) < total,
+			HasPreviousPage: offset > 0,
+		},
+		TotalCount: total,
+	}
+
+	for i, p := range products {
+		conn.Edges[i] = &model.ProductEdge{
+			Cursor: encodeCursor(offset + i),
+			Node:   p,
+		}
+	}
+
+	if len(conn.Edges) > 0 {
+		conn.PageInfo.StartCursor = &conn.Edges[0].Cursor
+		conn.PageInfo.EndCursor = &conn.Edges[len(conn.Edges)-1].Cursor
+	}
+
+	return conn
+}
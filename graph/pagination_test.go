@@ -0,0 +1,85 @@
+package graph
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/moeen/redisearch-shopping/graph/model"
+	"github.com/moeen/redisearch-shopping/internal/apperr"
+	"github.com/moeen/redisearch-shopping/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+func TestDecodeCursor(t *testing.T) {
+	t.Run("test valid cursors", func(t *testing.T) {
+		cases := []int{0, 1, 100, maxCursorOffset}
+
+		for _, tc := range cases {
+			offset, err := decodeCursor(encodeCursor(tc))
+			assert.NoError(t, err)
+			assert.Equal(t, tc, offset)
+		}
+	})
+
+	t.Run("test invalid cursors", func(t *testing.T) {
+		cases := []string{
+			"not-base64!",
+			base64.StdEncoding.EncodeToString([]byte("10")),
+			base64.StdEncoding.EncodeToString([]byte("offset:abc")),
+			base64.StdEncoding.EncodeToString([]byte("offset:-1")),
+			encodeCursor(maxCursorOffset + 1),
+			encodeCursor(math.MaxInt64),
+		}
+
+		for _, tc := range cases {
+			_, err := decodeCursor(tc)
+
+			var appErr *apperr.Error
+			assert.True(t, errors.As(err, &appErr))
+			assert.Equal(t, apperr.CodeValidation, appErr.Code)
+			assert.Equal(t, "invalid cursor: "+tc, appErr.Message)
+			assert.Equal(t, "after", appErr.Extensions["field"])
+		}
+	})
+}
+
+func TestPageOptions(t *testing.T) {
+	t.Run("test defaults", func(t *testing.T) {
+		offset, limit, err := pageOptions(nil, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, offset)
+		assert.Equal(t, defaultPageSize, limit)
+	})
+
+	t.Run("test with after cursor", func(t *testing.T) {
+		first := 5
+		after := encodeCursor(9)
+		offset, limit, err := pageOptions(&first, &after)
+		assert.NoError(t, err)
+		assert.Equal(t, 10, offset)
+		assert.Equal(t, first, limit)
+	})
+
+	t.Run("test with out of range first", func(t *testing.T) {
+		cases := []int{-1, 0, maxPageSize + 1}
+
+		for _, tc := range cases {
+			_, _, err := pageOptions(&tc, nil)
+			assert.Error(t, err)
+		}
+	})
+}
+
+func TestSortOptions(t *testing.T) {
+	name := model.ProductSortFieldName
+	desc := model.SortDirectionDesc
+
+	field, descending := sortOptions(nil, nil)
+	assert.Equal(t, storage.SortByRelevance, field)
+	assert.False(t, descending)
+
+	field, descending = sortOptions(&name, &desc)
+	assert.Equal(t, storage.SortByName, field)
+	assert.True(t, descending)
+}
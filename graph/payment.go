@@ -0,0 +1,46 @@
+package graph
+
+import (
+	"context"
+	"github.com/moeen/redisearch-shopping/graph/model"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+	"strings"
+)
+
+// paymentModel converts the stored payment to the GraphQL one
+func paymentModel(p *models.Payment) *model.Payment {
+	payment := &model.Payment{
+		ID:     p.ProviderID,
+		Status: model.PaymentStatus(strings.ToUpper(string(p.Status))),
+		Amount: p.Amount,
+	}
+	if p.ActionURL != "" {
+		url := p.ActionURL
+		payment.ActionURL = &url
+	}
+
+	return payment
+}
+
+// hasPaymentRelease reports whether the payment of an order is given back when it's moved to the status
+func hasPaymentRelease(to models.OrderStatus) bool {
+	return to == models.OrderCancelled || to == models.OrderRefunded
+}
+
+// checkPaymentRelease returns an error when the payment of the order keeps it from moving to the status
+func (r *Resolver) checkPaymentRelease(order *models.Order, to models.OrderStatus) error {
+	if !hasPaymentRelease(to) {
+		return nil
+	}
+
+	return r.Payments.CheckRelease(order, to)
+}
+
+// releasePayment gives the payment of the order back after it's cancelled or refunded
+func (r *Resolver) releasePayment(ctx context.Context, order *models.Order, to models.OrderStatus) error {
+	if !hasPaymentRelease(to) {
+		return nil
+	}
+
+	return r.Payments.Release(ctx, order, to)
+}
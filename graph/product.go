@@ -0,0 +1,28 @@
+package graph
+
+import (
+	"fmt"
+	"github.com/moeen/redisearch-shopping/graph/model"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+)
+
+// productModel converts the stored product to the GraphQL one
+func productModel(p *models.Product) *model.Product {
+	return &model.Product{
+		ID:      fmt.Sprintf("%d", p.ID),
+		Name:    p.Name,
+		Price:   p.Price,
+		Stock:   p.Stock,
+		InStock: p.Stock > 0,
+	}
+}
+
+// productWithCategories converts the stored product along with its loaded categories to the GraphQL one
+func productWithCategories(p *models.Product) *model.Product {
+	categories := make([]*model.Category, len(p.Categories))
+	for i := range p.Categories {
+		categories[i] = categoryModel(&p.Categories[i])
+	}
+
+	return productModel(p).WithCategories(categories)
+}
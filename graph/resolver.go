@@ -1,6 +1,14 @@
 package graph
 
-import "github.com/moeen/redisearch-shopping/internal/storage"
+import (
+	"github.com/moeen/redisearch-shopping/internal/auth"
+	"github.com/moeen/redisearch-shopping/internal/mailer"
+	"github.com/moeen/redisearch-shopping/internal/payment"
+	"github.com/moeen/redisearch-shopping/internal/pricing"
+	"github.com/moeen/redisearch-shopping/internal/storage"
+	"go.uber.org/zap"
+	"time"
+)
 
 // This file will not be regenerated automatically.
 //
@@ -9,4 +17,21 @@ import "github.com/moeen/redisearch-shopping/internal/storage"
 type Resolver struct {
 	Storage  storage.Storage
 	Searcher storage.Searcher
+	Keys     *auth.KeySet
+	Denylist auth.Denylist
+	Limiter  *auth.LoginLimiter
+	Mailer   mailer.Mailer
+	Logger   *zap.Logger
+
+	// PasswordPolicy is the set of rules which new passwords must follow
+	PasswordPolicy auth.PasswordPolicy
+
+	// Pricing computes the totals of carts
+	Pricing pricing.Service
+
+	// ReservationTTL is how long the stock of a checked out order is reserved for it to be paid
+	ReservationTTL time.Duration
+
+	// Payments charges orders and gives their payments back when they're cancelled or refunded, it's required
+	Payments *payment.Processor
 }
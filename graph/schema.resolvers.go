@@ -7,166 +7,1109 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strconv"
 	"time"
 
 	"github.com/moeen/redisearch-shopping/graph/generated"
 	"github.com/moeen/redisearch-shopping/graph/model"
+	"github.com/moeen/redisearch-shopping/internal/apperr"
 	"github.com/moeen/redisearch-shopping/internal/auth"
+	"github.com/moeen/redisearch-shopping/internal/orderstate"
+	"github.com/moeen/redisearch-shopping/internal/storage"
 	"github.com/moeen/redisearch-shopping/pkg/models"
+	"go.uber.org/zap"
 )
 
-func (r *mutationResolver) Login(ctx context.Context, input model.Login) (string, error) {
-	c, err := r.Storage.GetCustomerByEmail(input.Email)
+func (r *customerResolver) Cart(ctx context.Context, obj *model.Customer) (*model.Cart, error) {
+	customer, ok := auth.CustomerFromContext(ctx)
+	if !ok {
+		return nil, errUnauthenticated
+	}
+
+	// customers are only resolved for themselves for now, but carts must stay private either way
+	if obj.ID != fmt.Sprintf("%d", customer.ID) {
+		return nil, apperr.Forbidden("access denied")
+	}
+
+	return r.customerCart(int(customer.ID))
+}
+
+func (r *mutationResolver) Login(ctx context.Context, input model.Login) (*model.LoginResult, error) {
+	ip, _ := auth.ClientIPFromContext(ctx)
+	email := auth.NormalizeEmail(input.Email)
+
+	if err := r.Limiter.Check(email, ip); err != nil {
+		var locked *auth.LockedError
+		if errors.As(err, &locked) {
+			return nil, loginLockedError(locked)
+		}
+		return nil, err
+	}
+
+	c, err := r.Storage.GetCustomerByEmail(email)
+	if err != nil {
+		r.Limiter.Failed(email, ip)
+		return nil, apperr.Unauthenticated("email or password is wrong")
+	}
+
+	if !auth.CheckPasswordHash(input.Password, c.Password) {
+		r.Limiter.Failed(email, ip)
+		return nil, apperr.Unauthenticated("email or password is wrong")
+	}
+
+	// failures are only forgotten once the second factor is verified too, otherwise
+	// knowing the password would be enough to keep guessing TOTP codes
+	if c.TotpEnabled() {
+		challenge, err := r.startTotpChallenge(c)
+		if err != nil {
+			return nil, err
+		}
+
+		return &model.LoginResult{TotpChallenge: &challenge}, nil
+	}
+
+	r.Limiter.Succeeded(email)
+
+	payload, err := r.startSession(c, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.LoginResult{Auth: payload}, nil
+}
+
+func (r *mutationResolver) VerifyTotp(ctx context.Context, challenge string, code string) (*model.AuthPayload, error) {
+	ip, _ := auth.ClientIPFromContext(ctx)
+
+	t, err := r.Storage.UseActionToken(auth.HashSecretToken(challenge), models.PurposeTotpChallenge)
+	if err != nil {
+		if errors.Is(err, storage.ErrInvalidActionToken) {
+			return nil, apperr.Unauthenticated("invalid or expired challenge")
+		}
+		return nil, err
+	}
+
+	c, err := r.Storage.GetCustomer(t.CustomerID)
+	if err != nil || !c.TotpEnabled() {
+		return nil, apperr.Unauthenticated("invalid or expired challenge")
+	}
+
+	if err := r.Limiter.Check(c.Email, ip); err != nil {
+		var locked *auth.LockedError
+		if errors.As(err, &locked) {
+			return nil, loginLockedError(locked)
+		}
+		return nil, err
+	}
+
+	if err := r.checkTotpCode(c, code); err != nil {
+		if errors.Is(err, errInvalidTotpCode) {
+			r.Limiter.Failed(c.Email, ip)
+		}
+		return nil, err
+	}
+
+	r.Limiter.Succeeded(c.Email)
+
+	return r.startSession(c, true)
+}
+
+func (r *mutationResolver) Register(ctx context.Context, input model.Register) (*model.AuthPayload, error) {
+	email, err := auth.ValidateEmail(input.Email)
+	if err != nil {
+		return nil, apperr.Invalid("email", err)
+	}
+
+	name, err := validateName(input.Name)
+	if err != nil {
+		return nil, apperr.Invalid("name", err)
+	}
+
+	if err := r.PasswordPolicy.Validate(input.Password); err != nil {
+		return nil, apperr.Invalid("password", err)
+	}
+
+	hash, err := auth.HashPassword(input.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := r.Storage.CreateCustomer(email, name, hash)
+	if err != nil {
+		if errors.Is(err, storage.ErrEmailTaken) {
+			return nil, emailTakenError()
+		}
+		return nil, err
+	}
+
+	// the customer is already created, so a failed email must not fail the registration
+	if err := r.sendActionToken(c, models.PurposeEmailVerification); err != nil {
+		r.Logger.Error("failed to send verification email", zap.Int("customer", int(c.ID)), zap.Error(err))
+	}
+
+	return r.startSession(c, false)
+}
+
+func (r *mutationResolver) RefreshToken(ctx context.Context, token string) (*model.AuthPayload, error) {
+	rt, err := r.Storage.GetRefreshToken(auth.HashSecretToken(token))
+	if err != nil {
+		return nil, errInvalidRefreshToken
+	}
+
+	if rt.RevokedAt != nil || !rt.ExpiresAt.After(time.Now()) {
+		return nil, errInvalidRefreshToken
+	}
+
+	if rt.UsedAt != nil {
+		// a used token is only presented again when it's stolen, so the whole session is revoked
+		if err := r.revokeSession(rt.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, errInvalidRefreshToken
+	}
+
+	c, err := r.Storage.GetCustomer(rt.CustomerID)
+	if err != nil {
+		return nil, errInvalidRefreshToken
+	}
+
+	payload, next, err := r.issueTokens(c, rt.FamilyID, rt.MFA)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.Storage.RotateRefreshToken(int(rt.ID), next); err != nil {
+		if errors.Is(err, storage.ErrRefreshTokenUsed) {
+			if err := r.revokeSession(rt.FamilyID); err != nil {
+				return nil, err
+			}
+			return nil, errInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	return payload, nil
+}
+
+func (r *mutationResolver) Logout(ctx context.Context) (bool, error) {
+	claims, ok := auth.ClaimsFromContext(ctx)
+	if !ok {
+		return false, errUnauthenticated
+	}
+
+	if err := r.revokeToken(claims); err != nil {
+		return false, err
+	}
+
+	if claims.SessionID != "" {
+		if err := r.revokeSession(claims.SessionID); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func (r *mutationResolver) LogoutAll(ctx context.Context) (bool, error) {
+	claims, ok := auth.ClaimsFromContext(ctx)
+	if !ok {
+		return false, errUnauthenticated
+	}
+
+	if err := r.revokeToken(claims); err != nil {
+		return false, err
+	}
+
+	if err := r.revokeCustomerSessions(claims.CustomerID); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *mutationResolver) RequestPasswordReset(ctx context.Context, email string) (bool, error) {
+	ip, _ := auth.ClientIPFromContext(ctx)
+	email = auth.NormalizeEmail(email)
+
+	// the result is always the same, whether the email is unknown, limited or failed to be
+	// sent, so registered emails can't be discovered
+	if !r.Limiter.AllowPasswordReset(email, ip) {
+		return true, nil
+	}
+
+	c, err := r.Storage.GetCustomerByEmail(email)
+	if err != nil {
+		return true, nil
+	}
+
+	if err := r.sendActionToken(c, models.PurposePasswordReset); err != nil {
+		r.Logger.Error("failed to send password reset email", zap.Int("customer", int(c.ID)), zap.Error(err))
+	}
+
+	return true, nil
+}
+
+func (r *mutationResolver) ResetPassword(ctx context.Context, token string, password string) (bool, error) {
+	if err := r.PasswordPolicy.Validate(password); err != nil {
+		return false, apperr.Invalid("password", err)
+	}
+
+	t, err := r.Storage.UseActionToken(auth.HashSecretToken(token), models.PurposePasswordReset)
+	if err != nil {
+		if errors.Is(err, storage.ErrInvalidActionToken) {
+			return false, apperr.Validation("invalid or expired token").With("field", "token")
+		}
+		return false, err
+	}
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return false, err
+	}
+
+	if err := r.Storage.SetCustomerPassword(t.CustomerID, hash); err != nil {
+		return false, err
+	}
+
+	// whoever had the old password may still be logged in
+	if err := r.revokeCustomerSessions(t.CustomerID); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *mutationResolver) VerifyEmail(ctx context.Context, token string) (bool, error) {
+	t, err := r.Storage.UseActionToken(auth.HashSecretToken(token), models.PurposeEmailVerification)
+	if err != nil {
+		if errors.Is(err, storage.ErrInvalidActionToken) {
+			return false, apperr.Validation("invalid or expired token").With("field", "token")
+		}
+		return false, err
+	}
+
+	if err := r.Storage.VerifyCustomerEmail(t.CustomerID); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *mutationResolver) EnableTotp(ctx context.Context, currentPassword string, totpCode *string) (*model.TotpSetup, error) {
+	c, ok := auth.CustomerFromContext(ctx)
+	if !ok {
+		return nil, errUnauthenticated
+	}
+
+	// a stolen access token must not be enough to replace the second factor
+	if err := r.checkProfileCredentials(ctx, c, &currentPassword, totpCode); err != nil {
+		return nil, err
+	}
+
+	if c.TotpEnabled() {
+		return nil, apperr.Conflict("two-factor authentication is already enabled")
+	}
+
+	secret, err := auth.NewTotpSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := auth.NewRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = auth.HashRecoveryCode(code)
+	}
+
+	if err := r.Storage.SetCustomerTotp(int(c.ID), secret, hashes); err != nil {
+		return nil, err
+	}
+
+	return &model.TotpSetup{
+		URI:           auth.TotpURI(c.Email, secret),
+		Secret:        secret,
+		RecoveryCodes: codes,
+	}, nil
+}
+
+func (r *mutationResolver) ConfirmTotp(ctx context.Context, code string) (bool, error) {
+	c, ok := auth.CustomerFromContext(ctx)
+	if !ok {
+		return false, errUnauthenticated
+	}
+
+	if c.TotpEnabled() {
+		return false, apperr.Conflict("two-factor authentication is already enabled")
+	}
+
+	if c.TotpSecret == "" {
+		return false, apperr.Conflict("two-factor authentication is not set up")
+	}
+
+	step, ok := auth.ValidateTotp(c.TotpSecret, code, time.Now())
+	if !ok {
+		return false, errInvalidTotpCode
+	}
+
+	if err := r.Storage.ConfirmCustomerTotp(int(c.ID), step); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *mutationResolver) DisableTotp(ctx context.Context, code string) (bool, error) {
+	c, ok := auth.CustomerFromContext(ctx)
+	if !ok {
+		return false, errUnauthenticated
+	}
+
+	if !c.TotpEnabled() {
+		return false, apperr.Conflict("two-factor authentication is not enabled")
+	}
+
+	if c.Role.RequiresMFA() {
+		return false, apperr.Forbidden(fmt.Sprintf("two-factor authentication is mandatory for the %s role", c.Role))
+	}
+
+	// a stolen access token must not be enough to guess the code
+	ip, _ := auth.ClientIPFromContext(ctx)
+	if err := r.Limiter.Check(c.Email, ip); err != nil {
+		var locked *auth.LockedError
+		if errors.As(err, &locked) {
+			return false, loginLockedError(locked)
+		}
+		return false, err
+	}
+
+	if err := r.checkTotpCode(c, code); err != nil {
+		if errors.Is(err, errInvalidTotpCode) {
+			r.Limiter.Failed(c.Email, ip)
+		}
+		return false, err
+	}
+
+	r.Limiter.Succeeded(c.Email)
+
+	if err := r.Storage.DisableCustomerTotp(int(c.ID)); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *mutationResolver) UpdateProfile(ctx context.Context, input model.UpdateProfile) (*model.Customer, error) {
+	customer, ok := auth.CustomerFromContext(ctx)
+	if !ok {
+		return nil, errUnauthenticated
+	}
+
+	c := *customer
+
+	if input.Name != nil {
+		name, err := validateName(*input.Name)
+		if err != nil {
+			return nil, apperr.Invalid("name", err)
+		}
+		c.Name = name
+	}
+
+	if input.Email != nil {
+		email, err := auth.ValidateEmail(*input.Email)
+		if err != nil {
+			return nil, apperr.Invalid("email", err)
+		}
+
+		if email != c.Email {
+			c.Email = email
+			c.EmailVerifiedAt = nil
+		}
+	}
+
+	// the email is where password resets go, so a stolen access token must not be enough to change it
+	if c.Email != customer.Email {
+		if err := r.checkProfileCredentials(ctx, customer, input.CurrentPassword, input.TotpCode); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := r.Storage.UpdateCustomerProfile(int(c.ID), c.Name, c.Email); err != nil {
+		if errors.Is(err, storage.ErrEmailTaken) {
+			return nil, emailTakenError()
+		}
+		return nil, err
+	}
+
+	// the new email must be verified again, but a failed email must not fail the update
+	if c.Email != customer.Email {
+		// like changePassword, every session is revoked, the customer logs in again with the new email
+		claims, ok := auth.ClaimsFromContext(ctx)
+		if !ok {
+			return nil, errUnauthenticated
+		}
+
+		if err := r.revokeToken(claims); err != nil {
+			return nil, err
+		}
+
+		if err := r.revokeCustomerSessions(int(c.ID)); err != nil {
+			return nil, err
+		}
+
+		if err := r.sendActionToken(&c, models.PurposeEmailVerification); err != nil {
+			r.Logger.Error("failed to send verification email", zap.Int("customer", int(c.ID)), zap.Error(err))
+		}
+	}
+
+	return customerModel(&c), nil
+}
+
+func (r *mutationResolver) ChangePassword(ctx context.Context, currentPassword string, newPassword string) (*model.AuthPayload, error) {
+	customer, ok := auth.CustomerFromContext(ctx)
+	if !ok {
+		return nil, errUnauthenticated
+	}
+
+	claims, ok := auth.ClaimsFromContext(ctx)
+	if !ok {
+		return nil, errUnauthenticated
+	}
+
+	// a stolen access token must not be enough to guess the current password
+	ip, _ := auth.ClientIPFromContext(ctx)
+	if err := r.Limiter.Check(customer.Email, ip); err != nil {
+		var locked *auth.LockedError
+		if errors.As(err, &locked) {
+			return nil, loginLockedError(locked)
+		}
+		return nil, err
+	}
+
+	if !auth.CheckPasswordHash(currentPassword, customer.Password) {
+		r.Limiter.Failed(customer.Email, ip)
+		return nil, apperr.Invalid("currentPassword", errors.New("current password is wrong"))
+	}
+
+	r.Limiter.Succeeded(customer.Email)
+
+	if err := r.PasswordPolicy.Validate(newPassword); err != nil {
+		return nil, apperr.Invalid("newPassword", err)
+	}
+
+	hash, err := auth.HashPassword(newPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.Storage.SetCustomerPassword(int(customer.ID), hash); err != nil {
+		return nil, err
+	}
+
+	// every other session may have been started by whoever knew the old password, so all of
+	// them are revoked and the caller gets a new session in place of the current one
+	if err := r.revokeToken(claims); err != nil {
+		return nil, err
+	}
+
+	if err := r.revokeCustomerSessions(int(customer.ID)); err != nil {
+		return nil, err
+	}
+
+	return r.startSession(customer, claims.MFA)
+}
+
+func (r *mutationResolver) AddToCart(ctx context.Context, input model.AddToCard) (*model.Cart, error) {
+	customer, ok := auth.CustomerFromContext(ctx)
+	if !ok {
+		return nil, errUnauthenticated
+	}
+
+	pID, err := parseID("product_id", input.ProductID)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.Quantity <= 0 {
+		return nil, apperr.Validation("quantity must be positive").With("field", "quantity")
+	}
+
+	p, err := r.checkCartProduct("product_id", pID)
+	if err != nil {
+		return nil, err
+	}
+
+	// the whole quantity which ends up in the cart must be in stock
+	inCart, err := r.cartQuantity(int(customer.ID), pID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkStock(p, inCart+input.Quantity); err != nil {
+		return nil, err
+	}
+
+	if err := r.Storage.AddToCart(int(customer.ID), pID, input.Quantity); err != nil {
+		return nil, cartProductError("product_id", err)
+	}
+
+	return r.customerCart(int(customer.ID))
+}
+
+func (r *mutationResolver) RemoveFromCart(ctx context.Context, productID string) (*model.Cart, error) {
+	customer, ok := auth.CustomerFromContext(ctx)
+	if !ok {
+		return nil, errUnauthenticated
+	}
+
+	pID, err := parseID("product_id", productID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.Storage.RemoveFromCart(int(customer.ID), pID); err != nil {
+		return nil, err
+	}
+
+	return r.customerCart(int(customer.ID))
+}
+
+func (r *mutationResolver) SetCartItemQuantity(ctx context.Context, productID string, quantity int) (*model.Cart, error) {
+	customer, ok := auth.CustomerFromContext(ctx)
+	if !ok {
+		return nil, errUnauthenticated
+	}
+
+	pID, err := parseID("productId", productID)
 	if err != nil {
-		return "", errors.New("email or password is wrong")
+		return nil, err
 	}
 
-	if !auth.CheckPasswordHash(input.Password, c.Password) {
-		return "", errors.New("email or password is wrong")
+	if quantity < 0 {
+		return nil, apperr.Validation("quantity can not be negative").With("field", "quantity")
+	}
+
+	// removing a product doesn't need it to exist, it might have been deleted already
+	if quantity > 0 {
+		p, err := r.checkCartProduct("productId", pID)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := checkStock(p, quantity); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := r.Storage.SetCartItemQuantity(int(customer.ID), pID, quantity); err != nil {
+		return nil, cartProductError("productId", err)
+	}
+
+	return r.customerCart(int(customer.ID))
+}
+
+func (r *mutationResolver) ClearCart(ctx context.Context) (*model.Cart, error) {
+	customer, ok := auth.CustomerFromContext(ctx)
+	if !ok {
+		return nil, errUnauthenticated
+	}
+
+	if err := r.Storage.ClearCart(int(customer.ID)); err != nil {
+		return nil, err
+	}
+
+	return r.customerCart(int(customer.ID))
+}
+
+func (r *mutationResolver) Checkout(ctx context.Context) (*model.Order, error) {
+	customer, ok := auth.CustomerFromContext(ctx)
+	if !ok {
+		return nil, errUnauthenticated
 	}
 
-	token, err := auth.GenerateToken(int(c.ID), time.Now().Add(auth.DefaultExpirationTime))
+	order, err := r.Storage.Checkout(int(customer.ID), time.Now().Add(r.ReservationTTL), func(items []*models.CartItem) *models.Order {
+		return r.newOrder(int(customer.ID), items)
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to generate token: %w", err)
+		return nil, err
 	}
 
-	return token, nil
+	return orderModel(order), nil
 }
 
-func (r *mutationResolver) Register(ctx context.Context, input model.Register) (string, error) {
-	hash, err := auth.HashPassword(input.Password)
+func (r *mutationResolver) PayOrder(ctx context.Context, id string, paymentToken string) (*model.Payment, error) {
+	customer, ok := auth.CustomerFromContext(ctx)
+	if !ok {
+		return nil, errUnauthenticated
+	}
+
+	oID, err := parseID("id", id)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	if paymentToken == "" {
+		return nil, apperr.Validation("payment token is required").With("field", "paymentToken")
 	}
 
-	c, err := r.Storage.CreateCustomer(input.Email, input.Name, hash)
+	order, err := r.Storage.GetCustomerOrder(int(customer.ID), oID)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	token, err := auth.GenerateToken(int(c.ID), time.Now().Add(auth.DefaultExpirationTime))
+	p, err := r.Payments.Pay(ctx, order, paymentToken)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate token: %w", err)
+		return nil, err
 	}
 
-	return token, nil
+	return paymentModel(p), nil
 }
 
-func (r *mutationResolver) AddToCart(ctx context.Context, input model.AddToCard) (*model.Cart, error) {
+func (r *mutationResolver) UpdateOrderStatus(ctx context.Context, id string, status model.OrderStatus, reason *string) (*model.Order, error) {
 	customer, ok := auth.CustomerFromContext(ctx)
 	if !ok {
-		return nil, errors.New("access denied")
+		return nil, errUnauthenticated
 	}
 
-	pID, err := strconv.Atoi(input.ProductID)
+	oID, err := parseID("id", id)
 	if err != nil {
-		return nil, fmt.Errorf("inavlid product id: %w", err)
+		return nil, err
 	}
 
-	if err := r.Storage.AddToCart(int(customer.ID), pID, input.Quantity); err != nil {
+	why, err := validateReason(reason)
+	if err != nil {
 		return nil, err
 	}
 
-	cartItems, err := r.Storage.GetCartItems(int(customer.ID))
+	order, err := r.Storage.GetOrder(oID)
 	if err != nil {
 		return nil, err
 	}
 
-	cart := &model.Cart{
-		Products: make([]*model.ProductInCart, len(cartItems)),
+	// moving a cancelled or refunded order to its status again retries giving its payment back
+	if to := orderStatus(status); order.Status == to && hasPaymentRelease(to) {
+		if err := r.Payments.Release(ctx, order, to); err != nil {
+			return nil, err
+		}
+
+		return orderModel(order), nil
 	}
 
-	for i, ci := range cartItems {
-		cart.Products[i] = &model.ProductInCart{
-			Product: &model.Product{
-				ID:    fmt.Sprintf("%d", ci.ProductID),
-				Name:  ci.Product.Name,
-				Price: ci.Product.Price,
-			},
-			Quantity: ci.Quantity,
-		}
+	entry, err := orderstate.Transition(order, orderStatus(status), int(customer.ID), why)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.checkPaymentRelease(order, entry.ToStatus); err != nil {
+		return nil, err
+	}
+
+	// the payment webhook can move the order to the same status first
+	if err := r.Storage.UpdateOrderStatus(entry); err != nil && !errors.Is(err, storage.ErrOrderStatusChanged) {
+		return nil, err
+	}
+
+	if order, err = r.Storage.GetOrder(oID); err != nil {
+		return nil, err
+	}
+
+	if order.Status != entry.ToStatus {
+		return nil, storage.ErrOrderStatusChanged
+	}
+
+	// the payment is only given back once the order can't be paid or shipped anymore
+	if err := r.releasePayment(ctx, order, entry.ToStatus); err != nil {
+		return nil, err
 	}
 
-	return cart, nil
+	return orderModel(order), nil
 }
 
-func (r *mutationResolver) RemoveFromCart(ctx context.Context, productID string) (*model.Cart, error) {
-	customer, ok := auth.CustomerFromContext(ctx)
-	if !ok {
-		return nil, errors.New("access denied")
+func (r *mutationResolver) UpdateProduct(ctx context.Context, input model.UpdateProduct) (*model.Product, error) {
+	pID, err := parseID("id", input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.Name != nil && *input.Name == "" {
+		return nil, apperr.Validation("product name can not be empty").With("field", "name")
+	}
+
+	if input.Price != nil && *input.Price < 0 {
+		return nil, apperr.Validation("product price can not be negative").With("field", "price")
+	}
+
+	p, err := r.Storage.GetProduct(pID)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.Name != nil {
+		p.Name = *input.Name
+	}
+	if input.Price != nil {
+		p.Price = *input.Price
+	}
+
+	if err := r.Storage.UpdateProduct(p); err != nil {
+		return nil, err
 	}
 
-	pID, err := strconv.Atoi(productID)
+	return productModel(p), nil
+}
+
+func (r *mutationResolver) AdjustProductStock(ctx context.Context, id string, delta int) (*model.Product, error) {
+	pID, err := parseID("id", id)
 	if err != nil {
-		return nil, fmt.Errorf("inavlid product id: %w", err)
+		return nil, err
 	}
 
-	if err := r.Storage.RemoveFromCart(int(customer.ID), pID); err != nil {
+	p, err := r.Storage.AdjustProductStock(pID, delta)
+	if err != nil {
 		return nil, err
 	}
 
-	cartItems, err := r.Storage.GetCartItems(int(customer.ID))
+	return productModel(p), nil
+}
+
+func (r *mutationResolver) DeleteProduct(ctx context.Context, id string) (bool, error) {
+	pID, err := parseID("id", id)
+	if err != nil {
+		return false, err
+	}
+
+	if err := r.Storage.DeleteProduct(pID); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *mutationResolver) CreateCategory(ctx context.Context, input model.NewCategory) (*model.Category, error) {
+	c, err := newCategory(input)
 	if err != nil {
 		return nil, err
 	}
 
-	cart := &model.Cart{
-		Products: make([]*model.ProductInCart, len(cartItems)),
+	if err := r.Storage.CreateCategory(c); err != nil {
+		return nil, err
+	}
+
+	return categoryModel(c), nil
+}
+
+func (r *mutationResolver) SetProductCategories(ctx context.Context, productID string, categoryIds []string) (*model.Product, error) {
+	pID, err := parseID("productId", productID)
+	if err != nil {
+		return nil, err
 	}
 
-	for i, ci := range cartItems {
-		cart.Products[i] = &model.ProductInCart{
-			Product: &model.Product{
-				ID:    fmt.Sprintf("%d", ci.ProductID),
-				Name:  ci.Product.Name,
-				Price: ci.Product.Price,
-			},
-			Quantity: ci.Quantity,
+	ids := make([]int, len(categoryIds))
+	for i, id := range categoryIds {
+		if ids[i], err = parseID("categoryIds", id); err != nil {
+			return nil, err
 		}
 	}
 
-	return cart, nil
+	p, err := r.Storage.SetProductCategories(pID, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	return productModel(p), nil
+}
+
+func (r *productResolver) Categories(ctx context.Context, obj *model.Product) ([]*model.Category, error) {
+	if categories := obj.LoadedCategories(); categories != nil {
+		return categories, nil
+	}
+
+	pID, err := parseID("id", obj.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	categories, err := r.Storage.GetProductCategories(pID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product categories from storage: %w", err)
+	}
+
+	return categoryModels(categories), nil
 }
 
-func (r *queryResolver) Products(ctx context.Context, name *string) ([]*model.Product, error) {
+func (r *queryResolver) Products(ctx context.Context, name *string, first *int, after *string, sortBy *model.ProductSortField, sortDirection *model.SortDirection, category *string) (*model.ProductConnection, error) {
 	_, ok := auth.CustomerFromContext(ctx)
 	if !ok {
-		return nil, errors.New("access denied")
+		return nil, errUnauthenticated
+	}
+
+	offset, limit, err := pageOptions(first, after)
+	if err != nil {
+		return nil, err
+	}
+
+	category, err = categoryFilter(category)
+	if err != nil {
+		return nil, err
 	}
 
-	var products []*models.Product
-	var err error
+	sortField, descending := sortOptions(sortBy, sortDirection)
+
+	opts := storage.SearchOptions{
+		Name:       name,
+		Category:   category,
+		Offset:     offset,
+		Limit:      limit,
+		SortBy:     sortField,
+		Descending: descending,
+	}
 
 	if name == nil || *name == "" {
-		products, err = r.Storage.SearchProducts(name)
+		products, total, err := r.Storage.SearchProducts(opts)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get products from storage: %w", err)
 		}
-	} else {
-		products, err = r.Searcher.SearchProducts(name)
+
+		// storage loads the categories along with the products
+		res := make([]*model.Product, len(products))
+		for i, p := range products {
+			res[i] = productWithCategories(p)
+		}
+
+		return productConnection(res, offset, total), nil
+	}
+
+	products, total, err := r.Searcher.SearchProducts(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get products from searcher: %w", err)
+	}
+
+	res := make([]*model.Product, len(products))
+	for i, p := range products {
+		res[i] = productModel(p)
+	}
+
+	return productConnection(res, offset, total), nil
+}
+
+func (r *queryResolver) ProductSearch(ctx context.Context, input model.ProductSearch, first *int, after *string, sortBy *model.ProductSortField, sortDirection *model.SortDirection, priceBuckets []int) (*model.ProductSearchResult, error) {
+	_, ok := auth.CustomerFromContext(ctx)
+	if !ok {
+		return nil, errUnauthenticated
+	}
+
+	offset, limit, err := pageOptions(first, after)
+	if err != nil {
+		return nil, err
+	}
+
+	filters, err := searchFilters(input)
+	if err != nil {
+		return nil, err
+	}
+
+	category, err := categoryFilter(input.Category)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateBuckets(priceBuckets); err != nil {
+		return nil, err
+	}
+
+	sortField, descending := sortOptions(sortBy, sortDirection)
+
+	opts := storage.SearchOptions{
+		Name:       input.Text,
+		Fuzzy:      input.Fuzzy != nil && *input.Fuzzy,
+		Filters:    filters,
+		InStock:    input.InStock,
+		Category:   category,
+		Offset:     offset,
+		Limit:      limit,
+		SortBy:     sortField,
+		Descending: descending,
+	}
+
+	products, total, err := r.Searcher.SearchProducts(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get products from searcher: %w", err)
+	}
+
+	facets, err := r.Searcher.PriceFacets(storage.SearchOptions{
+		Name:     input.Text,
+		Fuzzy:    opts.Fuzzy,
+		Filters:  withoutPriceFilters(filters),
+		InStock:  input.InStock,
+		Category: category,
+	}, priceBuckets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get price facets from searcher: %w", err)
+	}
+
+	var suggestions []string
+	if total == 0 && input.Text != nil && *input.Text != "" {
+		suggestions, err = r.Searcher.SpellCheck(*input.Text, maxSpellSuggestions)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get products from searcher: %w", err)
+			return nil, fmt.Errorf("failed to spell check: %w", err)
 		}
 	}
 
 	res := make([]*model.Product, len(products))
 	for i, p := range products {
-		res[i] = &model.Product{
-			ID:    fmt.Sprintf("%d", p.ID),
-			Name:  p.Name,
-			Price: p.Price,
+		res[i] = productModel(p)
+	}
+
+	priceFacets := make([]*model.PriceFacet, len(facets))
+	for i, f := range facets {
+		priceFacets[i] = &model.PriceFacet{
+			Min:   f.Min,
+			Max:   f.Max,
+			Count: f.Count,
+		}
+	}
+
+	return &model.ProductSearchResult{
+		Products:    productConnection(res, offset, total),
+		PriceFacets: priceFacets,
+		Suggestions: suggestions,
+	}, nil
+}
+
+func (r *queryResolver) Product(ctx context.Context, id string) (*model.Product, error) {
+	_, ok := auth.CustomerFromContext(ctx)
+	if !ok {
+		return nil, errUnauthenticated
+	}
+
+	pID, err := parseID("id", id)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := r.Storage.GetProduct(pID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product from storage: %w", err)
+	}
+
+	return productModel(p), nil
+}
+
+func (r *queryResolver) SuggestProducts(ctx context.Context, prefix string, limit *int, fuzzy *bool) ([]*model.ProductSuggestion, error) {
+	_, ok := auth.CustomerFromContext(ctx)
+	if !ok {
+		return nil, errUnauthenticated
+	}
+
+	n := defaultSuggestions
+	if limit != nil {
+		if *limit < 1 || *limit > maxSuggestions {
+			return nil, apperr.Validation(fmt.Sprintf("limit must be between 1 and %d", maxSuggestions)).With("field", "limit")
+		}
+		n = *limit
+	}
+
+	suggestions, err := r.Searcher.SuggestProducts(prefix, n, fuzzy != nil && *fuzzy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get suggestions from searcher: %w", err)
+	}
+
+	res := make([]*model.ProductSuggestion, len(suggestions))
+	for i, s := range suggestions {
+		res[i] = &model.ProductSuggestion{
+			Text:      s.Term,
+			ProductID: fmt.Sprintf("%d", s.ProductID),
 		}
 	}
 
 	return res, nil
 }
 
+func (r *queryResolver) Categories(ctx context.Context) ([]*model.Category, error) {
+	_, ok := auth.CustomerFromContext(ctx)
+	if !ok {
+		return nil, errUnauthenticated
+	}
+
+	categories, err := r.Storage.GetCategories()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get categories from storage: %w", err)
+	}
+
+	return categoryModels(categories), nil
+}
+
+func (r *queryResolver) Me(ctx context.Context) (*model.Customer, error) {
+	customer, ok := auth.CustomerFromContext(ctx)
+	if !ok {
+		return nil, nil
+	}
+
+	return customerModel(customer), nil
+}
+
+func (r *queryResolver) Cart(ctx context.Context) (*model.Cart, error) {
+	customer, ok := auth.CustomerFromContext(ctx)
+	if !ok {
+		return nil, errUnauthenticated
+	}
+
+	return r.customerCart(int(customer.ID))
+}
+
+func (r *queryResolver) Orders(ctx context.Context) ([]*model.Order, error) {
+	customer, ok := auth.CustomerFromContext(ctx)
+	if !ok {
+		return nil, errUnauthenticated
+	}
+
+	orders, err := r.Storage.GetCustomerOrders(int(customer.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]*model.Order, len(orders))
+	for i, o := range orders {
+		ret[i] = orderModel(o)
+	}
+
+	return ret, nil
+}
+
+func (r *queryResolver) Order(ctx context.Context, id string) (*model.Order, error) {
+	customer, ok := auth.CustomerFromContext(ctx)
+	if !ok {
+		return nil, errUnauthenticated
+	}
+
+	oID, err := parseID("id", id)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := r.Storage.GetCustomerOrder(int(customer.ID), oID)
+	if err != nil {
+		return nil, err
+	}
+
+	return orderModel(order), nil
+}
+
+// Customer returns generated.CustomerResolver implementation.
+func (r *Resolver) Customer() generated.CustomerResolver { return &customerResolver{r} }
+
 // Mutation returns generated.MutationResolver implementation.
 func (r *Resolver) Mutation() generated.MutationResolver { return &mutationResolver{r} }
 
+// Product returns generated.ProductResolver implementation.
+func (r *Resolver) Product() generated.ProductResolver { return &productResolver{r} }
+
 // Query returns generated.QueryResolver implementation.
 func (r *Resolver) Query() generated.QueryResolver { return &queryResolver{r} }
 
+type customerResolver struct{ *Resolver }
 type mutationResolver struct{ *Resolver }
+type productResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
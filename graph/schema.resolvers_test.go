@@ -5,12 +5,20 @@ import (
 	"errors"
 	"github.com/golang/mock/gomock"
 	"github.com/moeen/redisearch-shopping/graph/model"
+	"github.com/moeen/redisearch-shopping/internal/apperr"
 	"github.com/moeen/redisearch-shopping/internal/auth"
+	"github.com/moeen/redisearch-shopping/internal/mailer"
+	"github.com/moeen/redisearch-shopping/internal/payment"
+	"github.com/moeen/redisearch-shopping/internal/pricing"
 	"github.com/moeen/redisearch-shopping/internal/storage"
 	"github.com/moeen/redisearch-shopping/pkg/models"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestMutationResolver_Login(t *testing.T) {
@@ -20,9 +28,14 @@ func TestMutationResolver_Login(t *testing.T) {
 	st := storage.NewMockStorage(c)
 	sr := storage.NewMockSearcher(c)
 
+	key, _ := auth.NewHMACKey("test", "HS256", []byte("secret"))
+	keys, _ := auth.NewKeySet(key)
+
 	mr := mutationResolver{&Resolver{
 		Storage:  st,
 		Searcher: sr,
+		Keys:     keys,
+		Limiter:  auth.NewLoginLimiter(auth.NewMemoryAttemptStore(), zap.NewNop()),
 	}}
 
 	t.Run("test with invalid customer", func(t *testing.T) {
@@ -39,7 +52,7 @@ func TestMutationResolver_Login(t *testing.T) {
 			Password: customer.Password,
 		})
 		assert.Error(t, err)
-		assert.Equal(t, "", token)
+		assert.Nil(t, token)
 	})
 
 	t.Run("test with wrong password", func(t *testing.T) {
@@ -55,8 +68,8 @@ func TestMutationResolver_Login(t *testing.T) {
 			Email:    customer.Email,
 			Password: "test",
 		})
-		assert.Error(t, err)
-		assert.Equal(t, "", token)
+		assert.Equal(t, apperr.CodeUnauthenticated, apperr.CodeOf(err))
+		assert.Nil(t, token)
 	})
 
 	t.Run("test successful login", func(t *testing.T) {
@@ -70,12 +83,77 @@ func TestMutationResolver_Login(t *testing.T) {
 		}
 
 		st.EXPECT().GetCustomerByEmail(customer.Email).Times(1).Return(customer, nil)
+		st.EXPECT().CreateRefreshToken(gomock.Any()).Times(1).Return(nil)
+
+		res, err := mr.Login(context.Background(), model.Login{
+			Email:    " TEST@test.com",
+			Password: pass,
+		})
+		assert.NoError(t, err)
+		assert.Nil(t, res.TotpChallenge)
+		assert.NotEmpty(t, res.Auth.RefreshToken)
+
+		claims, err := keys.ParseToken(res.Auth.AccessToken)
+		assert.NoError(t, err)
+		assert.Equal(t, int(customer.ID), claims.CustomerID)
+		assert.NotEmpty(t, claims.SessionID)
+		assert.False(t, claims.MFA)
+	})
+
+	t.Run("test login with totp enabled", func(t *testing.T) {
+		pass := "pass"
+		hash, _ := auth.HashPassword(pass)
+		now := time.Now()
+
+		customer := &models.Customer{
+			Model: gorm.Model{
+				ID: 2,
+			},
+			Email:           "totp@test.com",
+			Password:        hash,
+			TotpSecret:      "SECRET",
+			TotpConfirmedAt: &now,
+		}
+
+		st.EXPECT().GetCustomerByEmail(customer.Email).Times(1).Return(customer, nil)
+		st.EXPECT().CreateActionToken(gomock.Any()).Times(1).DoAndReturn(func(at *models.ActionToken) error {
+			assert.Equal(t, int(customer.ID), at.CustomerID)
+			assert.Equal(t, models.PurposeTotpChallenge, at.Purpose)
+			assert.True(t, at.ExpiresAt.After(time.Now()))
+			return nil
+		})
 
-		_, err := mr.Login(context.Background(), model.Login{
+		res, err := mr.Login(context.Background(), model.Login{
 			Email:    customer.Email,
 			Password: pass,
 		})
 		assert.NoError(t, err)
+		assert.Nil(t, res.Auth)
+		assert.NotEmpty(t, *res.TotpChallenge)
+	})
+	t.Run("test locked login", func(t *testing.T) {
+		email := "locked@test.com"
+		ctx := context.WithValue(context.Background(), auth.ClientIPContextKey{}, "127.0.0.1")
+
+		st.EXPECT().GetCustomerByEmail(email).Times(5).Return(nil, errors.New("not found"))
+
+		for i := 0; i < 5; i++ {
+			_, err := mr.Login(ctx, model.Login{Email: email, Password: "test"})
+			assert.EqualError(t, err, "email or password is wrong")
+		}
+
+		// the sixth failure locks the account
+		st.EXPECT().GetCustomerByEmail(email).Times(1).Return(nil, errors.New("not found"))
+		_, err := mr.Login(ctx, model.Login{Email: email, Password: "test"})
+		assert.Error(t, err)
+
+		token, err := mr.Login(ctx, model.Login{Email: email, Password: "test"})
+		assert.Nil(t, token)
+
+		var appErr *apperr.Error
+		assert.True(t, errors.As(err, &appErr))
+		assert.Equal(t, apperr.Code("LOGIN_LOCKED"), appErr.Code)
+		assert.Equal(t, 30, appErr.Extensions["retryAfter"])
 	})
 }
 
@@ -86,16 +164,25 @@ func TestMutationResolver_Register(t *testing.T) {
 	st := storage.NewMockStorage(c)
 	sr := storage.NewMockSearcher(c)
 
+	key, _ := auth.NewHMACKey("test", "HS256", []byte("secret"))
+	keys, _ := auth.NewKeySet(key)
+	ml := mailer.NewLocalMailer(zap.NewNop())
+
 	mr := mutationResolver{&Resolver{
 		Storage:  st,
 		Searcher: sr,
+		Keys:     keys,
+		Mailer:   ml,
+		Logger:   zap.NewNop(),
+
+		PasswordPolicy: auth.DefaultPasswordPolicy,
 	}}
 
 	t.Run("test when storage returns an error", func(t *testing.T) {
 		input := model.Register{
 			Email:    "test@test.com",
 			Name:     "test",
-			Password: "test",
+			Password: "password",
 		}
 
 		st.EXPECT().CreateCustomer(input.Email, input.Name, gomock.Any()).
@@ -103,14 +190,49 @@ func TestMutationResolver_Register(t *testing.T) {
 
 		token, err := mr.Register(context.Background(), input)
 		assert.Error(t, err)
-		assert.Equal(t, "", token)
+		assert.Nil(t, token)
+	})
+
+	t.Run("test with invalid input", func(t *testing.T) {
+		cases := []model.Register{
+			{Email: "invalid", Name: "test", Password: "password"},
+			{Email: "test@test.com", Name: " t ", Password: "password"},
+			{Email: "test@test.com", Name: strings.Repeat("a", maxNameLength+1), Password: "password"},
+			{Email: "test@test.com", Name: "test", Password: "short"},
+		}
+
+		fields := []string{"email", "name", "name", "password"}
+
+		for i, input := range cases {
+			token, err := mr.Register(context.Background(), input)
+			assert.Nil(t, token)
+
+			var appErr *apperr.Error
+			assert.True(t, errors.As(err, &appErr))
+			assert.Equal(t, apperr.CodeValidation, appErr.Code)
+			assert.Equal(t, fields[i], appErr.Extensions["field"])
+		}
+	})
+
+	t.Run("test with taken email", func(t *testing.T) {
+		st.EXPECT().CreateCustomer("taken@test.com", "test", gomock.Any()).
+			Times(1).Return(nil, storage.ErrEmailTaken)
+
+		token, err := mr.Register(context.Background(), model.Register{
+			Email:    " Taken@Test.com",
+			Name:     " test ",
+			Password: "password",
+		})
+		assert.Nil(t, token)
+
+		assert.Equal(t, apperr.Code("EMAIL_TAKEN"), apperr.CodeOf(err))
 	})
 
 	t.Run("test successful register", func(t *testing.T) {
 		input := model.Register{
 			Email:    "test@test.com",
 			Name:     "test",
-			Password: "test",
+			Password: "password",
 		}
 
 		customer := &models.Customer{
@@ -124,235 +246,1120 @@ func TestMutationResolver_Register(t *testing.T) {
 
 		st.EXPECT().CreateCustomer(input.Email, input.Name, gomock.Any()).
 			Times(1).Return(customer, nil)
+		st.EXPECT().CreateActionToken(gomock.Any()).Times(1).DoAndReturn(func(at *models.ActionToken) error {
+			assert.Equal(t, int(customer.ID), at.CustomerID)
+			assert.Equal(t, models.PurposeEmailVerification, at.Purpose)
+			assert.True(t, at.ExpiresAt.After(time.Now()))
+			return nil
+		})
+		st.EXPECT().CreateRefreshToken(gomock.Any()).Times(1).DoAndReturn(func(rt *models.RefreshToken) error {
+			assert.Equal(t, int(customer.ID), rt.CustomerID)
+			assert.NotEmpty(t, rt.FamilyID)
+			assert.NotEmpty(t, rt.TokenHash)
+			return nil
+		})
+
+		payload, err := mr.Register(context.Background(), input)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, payload.AccessToken)
+		assert.NotEmpty(t, payload.RefreshToken)
+
+		msg, ok := ml.Last(input.Email)
+		assert.True(t, ok)
+		assert.Equal(t, "Verify your email", msg.Subject)
+	})
+
+	t.Run("test when verification email fails", func(t *testing.T) {
+		input := model.Register{
+			Email:    "failed@test.com",
+			Name:     "test",
+			Password: "password",
+		}
+
+		customer := &models.Customer{
+			Model: gorm.Model{
+				ID: 2,
+			},
+			Email: input.Email,
+			Name:  input.Name,
+		}
+
+		st.EXPECT().CreateCustomer(input.Email, input.Name, gomock.Any()).
+			Times(1).Return(customer, nil)
+		st.EXPECT().CreateActionToken(gomock.Any()).Times(1).Return(errors.New("failed"))
+		st.EXPECT().CreateRefreshToken(gomock.Any()).Times(1).Return(nil)
 
-		_, err := mr.Register(context.Background(), input)
+		payload, err := mr.Register(context.Background(), input)
 		assert.NoError(t, err)
+		assert.NotEmpty(t, payload.AccessToken)
+
+		_, ok := ml.Last(input.Email)
+		assert.False(t, ok)
 	})
 }
 
-func TestMutationResolver_AddToCart(t *testing.T) {
+func TestMutationResolver_RefreshToken(t *testing.T) {
 	c := gomock.NewController(t)
 	defer c.Finish()
 
 	st := storage.NewMockStorage(c)
 	sr := storage.NewMockSearcher(c)
+	dl := auth.NewMemoryDenylist()
+
+	key, _ := auth.NewHMACKey("test", "HS256", []byte("secret"))
+	keys, _ := auth.NewKeySet(key)
 
 	mr := mutationResolver{&Resolver{
 		Storage:  st,
 		Searcher: sr,
+		Keys:     keys,
+		Denylist: dl,
 	}}
 
-	t.Run("test with no customer in ctx", func(t *testing.T) {
-		_, err := mr.AddToCart(context.Background(), model.AddToCard{
-			ProductID: "1",
-			Quantity:  1,
-		})
+	customer := &models.Customer{
+		Model: gorm.Model{
+			ID: 1,
+		},
+		Email: "test@test.com",
+		Name:  "test",
+		Role:  models.RoleCustomer,
+	}
+
+	token := "refresh-token"
+	hash := auth.HashSecretToken(token)
+
+	t.Run("test with unknown token", func(t *testing.T) {
+		st.EXPECT().GetRefreshToken(hash).Times(1).Return(nil, errors.New("not found"))
 
+		payload, err := mr.RefreshToken(context.Background(), token)
 		assert.Error(t, err)
+		assert.Nil(t, payload)
 	})
 
-	t.Run("test with invalid product id", func(t *testing.T) {
-		customer := &models.Customer{
-			Model: gorm.Model{
-				ID: 1,
-			},
-			Email:    "test@test.com",
-			Password: "test",
-			Name:     "test",
+	t.Run("test with expired or revoked token", func(t *testing.T) {
+		now := time.Now()
+
+		cases := []*models.RefreshToken{
+			{CustomerID: 1, FamilyID: "family", ExpiresAt: now.Add(-time.Minute)},
+			{CustomerID: 1, FamilyID: "family", ExpiresAt: now.Add(time.Hour), RevokedAt: &now},
 		}
 
-		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+		for _, tc := range cases {
+			st.EXPECT().GetRefreshToken(hash).Times(1).Return(tc, nil)
 
-		_, err := mr.AddToCart(ctx, model.AddToCard{
-			ProductID: "invalid",
-			Quantity:  1,
-		})
+			payload, err := mr.RefreshToken(context.Background(), token)
+			assert.Error(t, err)
+			assert.Nil(t, payload)
+		}
+	})
 
+	t.Run("test with reused token", func(t *testing.T) {
+		now := time.Now()
+
+		st.EXPECT().GetRefreshToken(hash).Times(1).Return(&models.RefreshToken{
+			CustomerID: 1, FamilyID: "reused", ExpiresAt: now.Add(time.Hour), UsedAt: &now,
+		}, nil)
+		st.EXPECT().RevokeRefreshTokenFamily("reused").Times(1).Return(nil)
+
+		payload, err := mr.RefreshToken(context.Background(), token)
 		assert.Error(t, err)
+		assert.Nil(t, payload)
+
+		revoked, _ := dl.IsRevoked("reused")
+		assert.True(t, revoked)
 	})
 
-	t.Run("test when storage.AddToCart returns an error", func(t *testing.T) {
-		customer := &models.Customer{
-			Model: gorm.Model{
-				ID: 1,
-			},
-			Email:    "test@test.com",
-			Password: "test",
-			Name:     "test",
-		}
+	t.Run("test when token is used concurrently", func(t *testing.T) {
+		st.EXPECT().GetRefreshToken(hash).Times(1).Return(&models.RefreshToken{
+			Model: gorm.Model{ID: 5}, CustomerID: 1, FamilyID: "raced", ExpiresAt: time.Now().Add(time.Hour),
+		}, nil)
+		st.EXPECT().GetCustomer(1).Times(1).Return(customer, nil)
+		st.EXPECT().RotateRefreshToken(5, gomock.Any()).Times(1).Return(storage.ErrRefreshTokenUsed)
+		st.EXPECT().RevokeRefreshTokenFamily("raced").Times(1).Return(nil)
 
-		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+		payload, err := mr.RefreshToken(context.Background(), token)
+		assert.Error(t, err)
+		assert.Nil(t, payload)
 
-		st.EXPECT().AddToCart(int(customer.ID), 1, 1).
-			Times(1).Return(errors.New("failed"))
+		revoked, _ := dl.IsRevoked("raced")
+		assert.True(t, revoked)
+	})
 
-		_, err := mr.AddToCart(ctx, model.AddToCard{
-			ProductID: "1",
-			Quantity:  1,
+	t.Run("test successful refresh", func(t *testing.T) {
+		st.EXPECT().GetRefreshToken(hash).Times(1).Return(&models.RefreshToken{
+			Model: gorm.Model{ID: 6}, CustomerID: 1, FamilyID: "family", ExpiresAt: time.Now().Add(time.Hour),
+		}, nil)
+		st.EXPECT().GetCustomer(1).Times(1).Return(customer, nil)
+
+		var next *models.RefreshToken
+		st.EXPECT().RotateRefreshToken(6, gomock.Any()).Times(1).DoAndReturn(func(id int, rt *models.RefreshToken) error {
+			next = rt
+			return nil
 		})
 
-		assert.Error(t, err)
+		payload, err := mr.RefreshToken(context.Background(), token)
+		assert.NoError(t, err)
+		assert.Equal(t, "family", next.FamilyID)
+		assert.Equal(t, auth.HashSecretToken(payload.RefreshToken), next.TokenHash)
+
+		claims, err := keys.ParseToken(payload.AccessToken)
+		assert.NoError(t, err)
+		assert.Equal(t, "family", claims.SessionID)
+		assert.Equal(t, 1, claims.CustomerID)
+		assert.False(t, claims.MFA)
 	})
 
-	t.Run("test when storage.GetCartItems returns an error", func(t *testing.T) {
-		customer := &models.Customer{
-			Model: gorm.Model{
-				ID: 1,
-			},
-			Email:    "test@test.com",
-			Password: "test",
-			Name:     "test",
-		}
+	t.Run("test refresh keeps second factor of the session", func(t *testing.T) {
+		st.EXPECT().GetRefreshToken(hash).Times(1).Return(&models.RefreshToken{
+			Model: gorm.Model{ID: 7}, CustomerID: 1, FamilyID: "mfa", ExpiresAt: time.Now().Add(time.Hour), MFA: true,
+		}, nil)
+		st.EXPECT().GetCustomer(1).Times(1).Return(customer, nil)
+		st.EXPECT().RotateRefreshToken(7, gomock.Any()).Times(1).DoAndReturn(func(id int, rt *models.RefreshToken) error {
+			assert.True(t, rt.MFA)
+			return nil
+		})
 
-		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+		payload, err := mr.RefreshToken(context.Background(), token)
+		assert.NoError(t, err)
 
-		st.EXPECT().AddToCart(int(customer.ID), 1, 1).
-			Times(1).Return(nil)
+		claims, err := keys.ParseToken(payload.AccessToken)
+		assert.NoError(t, err)
+		assert.True(t, claims.MFA)
+	})
+}
 
-		st.EXPECT().GetCartItems(int(customer.ID)).
-			Times(1).Return(nil, errors.New("failed"))
+func TestMutationResolver_Logout(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
 
-		_, err := mr.AddToCart(ctx, model.AddToCard{
-			ProductID: "1",
-			Quantity:  1,
-		})
+	st := storage.NewMockStorage(c)
+	sr := storage.NewMockSearcher(c)
+	dl := auth.NewMemoryDenylist()
+
+	mr := mutationResolver{&Resolver{
+		Storage:  st,
+		Searcher: sr,
+		Denylist: dl,
+	}}
 
+	t.Run("test with no claims in ctx", func(t *testing.T) {
+		ok, err := mr.Logout(context.Background())
 		assert.Error(t, err)
+		assert.False(t, ok)
 	})
 
-	t.Run("test successful add to cart", func(t *testing.T) {
-		customer := &models.Customer{
-			Model: gorm.Model{
-				ID: 1,
-			},
-			Email:    "test@test.com",
-			Password: "test",
-			Name:     "test",
-		}
-
-		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+	t.Run("test when storage.RevokeRefreshTokenFamily returns an error", func(t *testing.T) {
+		claims := &auth.Claims{ID: "failed", SessionID: "failed", CustomerID: 1, ExpiresAt: time.Now().Add(time.Minute)}
+		ctx := context.WithValue(context.Background(), auth.ClaimsContextKey{}, claims)
 
-		st.EXPECT().AddToCart(int(customer.ID), 1, 1).
-			Times(1).Return(nil)
+		st.EXPECT().RevokeRefreshTokenFamily("failed").Times(1).Return(errors.New("failed"))
 
-		ret := &model.Cart{
-			Products: []*model.ProductInCart{
-				{
-					Product: &model.Product{
-						ID:    "1",
-						Name:  "test",
-						Price: 1000,
-					},
-					Quantity: 1,
-				},
-			},
-		}
+		ok, err := mr.Logout(ctx)
+		assert.Error(t, err)
+		assert.False(t, ok)
+	})
 
-		var cartItems []*models.CartItem
-		for _, p := range ret.Products {
-			cartItems = append(cartItems, &models.CartItem{
-				CustomerID: 0,
-				Customer:   models.Customer{},
-				Quantity:   p.Quantity,
-				ProductID:  1,
-				Product: models.Product{
-					Model: gorm.Model{
-						ID: 1,
-					},
-					Name:  p.Product.Name,
-					Price: p.Product.Price,
-				},
-			})
-		}
+	t.Run("test successful logout", func(t *testing.T) {
+		claims := &auth.Claims{ID: "token", SessionID: "session", CustomerID: 1, ExpiresAt: time.Now().Add(time.Minute)}
+		ctx := context.WithValue(context.Background(), auth.ClaimsContextKey{}, claims)
 
-		st.EXPECT().GetCartItems(int(customer.ID)).
-			Times(1).Return(cartItems, nil)
+		st.EXPECT().RevokeRefreshTokenFamily("session").Times(1).Return(nil)
 
-		items, err := mr.AddToCart(ctx, model.AddToCard{
-			ProductID: "1",
-			Quantity:  1,
-		})
+		ok, err := mr.Logout(ctx)
 		assert.NoError(t, err)
-		assert.Equal(t, ret, items)
+		assert.True(t, ok)
+
+		for _, id := range []string{"token", "session"} {
+			revoked, _ := dl.IsRevoked(id)
+			assert.True(t, revoked)
+		}
 	})
 }
 
-func TestMutationResolver_RemoveFromCart(t *testing.T) {
+func TestMutationResolver_LogoutAll(t *testing.T) {
 	c := gomock.NewController(t)
 	defer c.Finish()
 
 	st := storage.NewMockStorage(c)
 	sr := storage.NewMockSearcher(c)
+	dl := auth.NewMemoryDenylist()
 
 	mr := mutationResolver{&Resolver{
 		Storage:  st,
 		Searcher: sr,
+		Denylist: dl,
 	}}
 
-	t.Run("test with no customer in ctx", func(t *testing.T) {
-		_, err := mr.RemoveFromCart(context.Background(), "1")
+	claims := &auth.Claims{ID: "token", SessionID: "a", CustomerID: 1, ExpiresAt: time.Now().Add(time.Minute)}
+	ctx := context.WithValue(context.Background(), auth.ClaimsContextKey{}, claims)
 
+	t.Run("test with no claims in ctx", func(t *testing.T) {
+		ok, err := mr.LogoutAll(context.Background())
 		assert.Error(t, err)
+		assert.False(t, ok)
 	})
 
-	t.Run("test with invalid product id", func(t *testing.T) {
-		customer := &models.Customer{
-			Model: gorm.Model{
-				ID: 1,
-			},
-			Email:    "test@test.com",
-			Password: "test",
-			Name:     "test",
-		}
-
-		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
-
-		_, err := mr.RemoveFromCart(ctx, "invalid")
+	t.Run("test when storage.RevokeCustomerRefreshTokens returns an error", func(t *testing.T) {
+		st.EXPECT().RevokeCustomerRefreshTokens(1).Times(1).Return(nil, errors.New("failed"))
 
+		ok, err := mr.LogoutAll(ctx)
 		assert.Error(t, err)
+		assert.False(t, ok)
 	})
 
-	t.Run("test when storage.RemoveFromCart returns an error", func(t *testing.T) {
-		customer := &models.Customer{
-			Model: gorm.Model{
-				ID: 1,
-			},
-			Email:    "test@test.com",
-			Password: "test",
-			Name:     "test",
-		}
-
-		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
-
-		st.EXPECT().RemoveFromCart(int(customer.ID), 1).
-			Times(1).Return(errors.New("failed"))
+	t.Run("test successful logout", func(t *testing.T) {
+		st.EXPECT().RevokeCustomerRefreshTokens(1).Times(1).Return([]string{"a", "b"}, nil)
 
-		_, err := mr.RemoveFromCart(ctx, "1")
+		ok, err := mr.LogoutAll(ctx)
+		assert.NoError(t, err)
+		assert.True(t, ok)
 
-		assert.Error(t, err)
+		for _, id := range []string{"token", "a", "b"} {
+			revoked, _ := dl.IsRevoked(id)
+			assert.True(t, revoked)
+		}
 	})
+}
 
-	t.Run("test when storage.GetCartItems returns an error", func(t *testing.T) {
-		customer := &models.Customer{
-			Model: gorm.Model{
-				ID: 1,
-			},
-			Email:    "test@test.com",
-			Password: "test",
-			Name:     "test",
-		}
+func TestMutationResolver_RequestPasswordReset(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
 
-		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+	st := storage.NewMockStorage(c)
+	sr := storage.NewMockSearcher(c)
+	ml := mailer.NewLocalMailer(zap.NewNop())
 
-		st.EXPECT().RemoveFromCart(int(customer.ID), 1).
-			Times(1).Return(nil)
+	mr := mutationResolver{&Resolver{
+		Storage:  st,
+		Searcher: sr,
+		Limiter:  auth.NewLoginLimiter(auth.NewMemoryAttemptStore(), zap.NewNop()),
+		Mailer:   ml,
+		Logger:   zap.NewNop(),
+	}}
 
-		st.EXPECT().GetCartItems(int(customer.ID)).
-			Times(1).Return(nil, errors.New("failed"))
+	customer := &models.Customer{
+		Model: gorm.Model{
+			ID: 1,
+		},
+		Email: "test@test.com",
+		Name:  "test",
+	}
 
-		_, err := mr.RemoveFromCart(ctx, "1")
+	t.Run("test with unknown email", func(t *testing.T) {
+		st.EXPECT().GetCustomerByEmail("unknown@test.com").Times(1).Return(nil, errors.New("not found"))
 
-		assert.Error(t, err)
+		ok, err := mr.RequestPasswordReset(context.Background(), "unknown@test.com")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Empty(t, ml.Sent())
+	})
+
+	t.Run("test when storage.CreateActionToken returns an error", func(t *testing.T) {
+		st.EXPECT().GetCustomerByEmail(customer.Email).Times(1).Return(customer, nil)
+		st.EXPECT().CreateActionToken(gomock.Any()).Times(1).Return(errors.New("failed"))
+
+		// a failed email looks the same as an unknown one
+		ok, err := mr.RequestPasswordReset(context.Background(), customer.Email)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("test successful request", func(t *testing.T) {
+		var hash string
+
+		st.EXPECT().GetCustomerByEmail(customer.Email).Times(1).Return(customer, nil)
+		st.EXPECT().CreateActionToken(gomock.Any()).Times(1).DoAndReturn(func(at *models.ActionToken) error {
+			assert.Equal(t, int(customer.ID), at.CustomerID)
+			assert.Equal(t, models.PurposePasswordReset, at.Purpose)
+			hash = at.TokenHash
+			return nil
+		})
+
+		ok, err := mr.RequestPasswordReset(context.Background(), customer.Email)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		msg, found := ml.Last(customer.Email)
+		assert.True(t, found)
+		assert.Equal(t, "Reset your password", msg.Subject)
+
+		// the email carries the token which is only stored hashed
+		found = false
+		for _, l := range strings.Split(msg.Body, "\n") {
+			if l != "" && auth.HashSecretToken(l) == hash {
+				found = true
+			}
+		}
+		assert.True(t, found)
+	})
+
+	t.Run("test too many requests", func(t *testing.T) {
+		limited := "limited@test.com"
+		ctx := context.WithValue(context.Background(), auth.ClientIPContextKey{}, "1.1.1.1")
+
+		st.EXPECT().GetCustomerByEmail(limited).Times(3).Return(nil, errors.New("not found"))
+
+		// the limited requests look the same, but never reach the storage
+		for i := 0; i < 5; i++ {
+			ok, err := mr.RequestPasswordReset(ctx, limited)
+			assert.NoError(t, err)
+			assert.True(t, ok)
+		}
+	})
+}
+
+func TestMutationResolver_ResetPassword(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	st := storage.NewMockStorage(c)
+	sr := storage.NewMockSearcher(c)
+	dl := auth.NewMemoryDenylist()
+
+	mr := mutationResolver{&Resolver{
+		Storage:  st,
+		Searcher: sr,
+		Denylist: dl,
+
+		PasswordPolicy: auth.DefaultPasswordPolicy,
+	}}
+
+	token := "reset-token"
+	hash := auth.HashSecretToken(token)
+
+	t.Run("test with weak password", func(t *testing.T) {
+		for _, password := range []string{"", "short"} {
+			ok, err := mr.ResetPassword(context.Background(), token, password)
+			assert.Error(t, err)
+			assert.False(t, ok)
+		}
+	})
+
+	t.Run("test with invalid token", func(t *testing.T) {
+		st.EXPECT().UseActionToken(hash, models.PurposePasswordReset).Times(1).
+			Return(nil, storage.ErrInvalidActionToken)
+
+		ok, err := mr.ResetPassword(context.Background(), token, "new-password")
+		assert.EqualError(t, err, "invalid or expired token")
+		assert.False(t, ok)
+	})
+
+	t.Run("test when storage.SetCustomerPassword returns an error", func(t *testing.T) {
+		st.EXPECT().UseActionToken(hash, models.PurposePasswordReset).Times(1).
+			Return(&models.ActionToken{CustomerID: 1}, nil)
+		st.EXPECT().SetCustomerPassword(1, gomock.Any()).Times(1).Return(errors.New("failed"))
+
+		ok, err := mr.ResetPassword(context.Background(), token, "new-password")
+		assert.Error(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("test successful reset", func(t *testing.T) {
+		st.EXPECT().UseActionToken(hash, models.PurposePasswordReset).Times(1).
+			Return(&models.ActionToken{CustomerID: 1}, nil)
+		st.EXPECT().SetCustomerPassword(1, gomock.Any()).Times(1).DoAndReturn(func(id int, h string) error {
+			assert.True(t, auth.CheckPasswordHash("new-password", h))
+			return nil
+		})
+		st.EXPECT().RevokeCustomerRefreshTokens(1).Times(1).Return([]string{"session"}, nil)
+
+		ok, err := mr.ResetPassword(context.Background(), token, "new-password")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		revoked, _ := dl.IsRevoked("session")
+		assert.True(t, revoked)
+	})
+}
+
+func TestMutationResolver_VerifyEmail(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	st := storage.NewMockStorage(c)
+	sr := storage.NewMockSearcher(c)
+
+	mr := mutationResolver{&Resolver{
+		Storage:  st,
+		Searcher: sr,
+	}}
+
+	token := "verify-token"
+	hash := auth.HashSecretToken(token)
+
+	t.Run("test with invalid token", func(t *testing.T) {
+		st.EXPECT().UseActionToken(hash, models.PurposeEmailVerification).Times(1).
+			Return(nil, storage.ErrInvalidActionToken)
+
+		ok, err := mr.VerifyEmail(context.Background(), token)
+		assert.EqualError(t, err, "invalid or expired token")
+		assert.False(t, ok)
+	})
+
+	t.Run("test when storage.VerifyCustomerEmail returns an error", func(t *testing.T) {
+		st.EXPECT().UseActionToken(hash, models.PurposeEmailVerification).Times(1).
+			Return(&models.ActionToken{CustomerID: 1}, nil)
+		st.EXPECT().VerifyCustomerEmail(1).Times(1).Return(errors.New("failed"))
+
+		ok, err := mr.VerifyEmail(context.Background(), token)
+		assert.Error(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("test successful verification", func(t *testing.T) {
+		st.EXPECT().UseActionToken(hash, models.PurposeEmailVerification).Times(1).
+			Return(&models.ActionToken{CustomerID: 1}, nil)
+		st.EXPECT().VerifyCustomerEmail(1).Times(1).Return(nil)
+
+		ok, err := mr.VerifyEmail(context.Background(), token)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+}
+
+func TestMutationResolver_VerifyTotp(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	st := storage.NewMockStorage(c)
+	sr := storage.NewMockSearcher(c)
+
+	key, _ := auth.NewHMACKey("test", "HS256", []byte("secret"))
+	keys, _ := auth.NewKeySet(key)
+
+	mr := mutationResolver{&Resolver{
+		Storage:  st,
+		Searcher: sr,
+		Keys:     keys,
+		Limiter:  auth.NewLoginLimiter(auth.NewMemoryAttemptStore(), zap.NewNop()),
+	}}
+
+	secret, _ := auth.NewTotpSecret()
+	now := time.Now()
+
+	customer := &models.Customer{
+		Model: gorm.Model{
+			ID: 1,
+		},
+		Email:           "test@test.com",
+		Role:            models.RoleAdmin,
+		TotpSecret:      secret,
+		TotpConfirmedAt: &now,
+	}
+
+	challenge := "challenge"
+	hash := auth.HashSecretToken(challenge)
+
+	t.Run("test with invalid challenge", func(t *testing.T) {
+		st.EXPECT().UseActionToken(hash, models.PurposeTotpChallenge).Times(1).
+			Return(nil, storage.ErrInvalidActionToken)
+
+		payload, err := mr.VerifyTotp(context.Background(), challenge, "123456")
+		assert.EqualError(t, err, "invalid or expired challenge")
+		assert.Nil(t, payload)
+	})
+
+	t.Run("test with wrong code", func(t *testing.T) {
+		st.EXPECT().UseActionToken(hash, models.PurposeTotpChallenge).Times(1).
+			Return(&models.ActionToken{CustomerID: 1}, nil)
+		st.EXPECT().GetCustomer(1).Times(1).Return(customer, nil)
+		st.EXPECT().UseRecoveryCode(1, auth.HashRecoveryCode("wrong")).Times(1).Return(storage.ErrInvalidRecoveryCode)
+
+		payload, err := mr.VerifyTotp(context.Background(), challenge, "wrong")
+		assert.EqualError(t, err, "invalid two-factor code")
+		assert.Nil(t, payload)
+	})
+
+	t.Run("test with replayed code", func(t *testing.T) {
+		code, _ := auth.TotpCode(secret, time.Now())
+
+		st.EXPECT().UseActionToken(hash, models.PurposeTotpChallenge).Times(1).
+			Return(&models.ActionToken{CustomerID: 1}, nil)
+		st.EXPECT().GetCustomer(1).Times(1).Return(customer, nil)
+		st.EXPECT().UseTotpStep(1, gomock.Any()).Times(1).Return(storage.ErrTotpCodeUsed)
+
+		payload, err := mr.VerifyTotp(context.Background(), challenge, code)
+		assert.EqualError(t, err, "invalid two-factor code")
+		assert.Nil(t, payload)
+	})
+
+	t.Run("test with valid code", func(t *testing.T) {
+		code, _ := auth.TotpCode(secret, time.Now())
+
+		st.EXPECT().UseActionToken(hash, models.PurposeTotpChallenge).Times(1).
+			Return(&models.ActionToken{CustomerID: 1}, nil)
+		st.EXPECT().GetCustomer(1).Times(1).Return(customer, nil)
+		st.EXPECT().UseTotpStep(1, gomock.Any()).Times(1).Return(nil)
+		st.EXPECT().CreateRefreshToken(gomock.Any()).Times(1).DoAndReturn(func(rt *models.RefreshToken) error {
+			assert.True(t, rt.MFA)
+			return nil
+		})
+
+		payload, err := mr.VerifyTotp(context.Background(), challenge, code)
+		assert.NoError(t, err)
+
+		claims, err := keys.ParseToken(payload.AccessToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, claims.CustomerID)
+		assert.True(t, claims.MFA)
+	})
+
+	t.Run("test with recovery code", func(t *testing.T) {
+		st.EXPECT().UseActionToken(hash, models.PurposeTotpChallenge).Times(1).
+			Return(&models.ActionToken{CustomerID: 1}, nil)
+		st.EXPECT().GetCustomer(1).Times(1).Return(customer, nil)
+		st.EXPECT().UseRecoveryCode(1, auth.HashRecoveryCode("abcde-fghij")).Times(1).Return(nil)
+		st.EXPECT().CreateRefreshToken(gomock.Any()).Times(1).Return(nil)
+
+		payload, err := mr.VerifyTotp(context.Background(), challenge, "abcde-fghij")
+		assert.NoError(t, err)
+		assert.NotEmpty(t, payload.AccessToken)
+	})
+}
+
+func TestMutationResolver_EnableTotp(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	st := storage.NewMockStorage(c)
+	sr := storage.NewMockSearcher(c)
+
+	mr := mutationResolver{&Resolver{
+		Storage:  st,
+		Searcher: sr,
+		Limiter:  auth.NewLoginLimiter(auth.NewMemoryAttemptStore(), zap.NewNop()),
+	}}
+
+	hash, _ := auth.HashPassword("password")
+
+	t.Run("test with no customer in ctx", func(t *testing.T) {
+		setup, err := mr.EnableTotp(context.Background(), "password", nil)
+		assert.EqualError(t, err, "access denied")
+		assert.Nil(t, setup)
+	})
+
+	t.Run("test with wrong password", func(t *testing.T) {
+		customer := &models.Customer{Model: gorm.Model{ID: 1}, Email: "test@test.com", Password: hash}
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		setup, err := mr.EnableTotp(ctx, "wrong", nil)
+		assert.Equal(t, apperr.CodeValidation, apperr.CodeOf(err))
+		assert.Nil(t, setup)
+	})
+
+	t.Run("test when totp is already enabled without a code", func(t *testing.T) {
+		now := time.Now()
+		customer := &models.Customer{Model: gorm.Model{ID: 1}, Email: "test@test.com", Password: hash,
+			TotpSecret: "SECRET", TotpConfirmedAt: &now}
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		setup, err := mr.EnableTotp(ctx, "password", nil)
+		assert.EqualError(t, err, "two-factor code is required")
+		assert.Nil(t, setup)
+	})
+
+	t.Run("test when totp is already enabled", func(t *testing.T) {
+		secret, _ := auth.NewTotpSecret()
+		code, _ := auth.TotpCode(secret, time.Now())
+
+		now := time.Now()
+		customer := &models.Customer{Model: gorm.Model{ID: 1}, Email: "test@test.com", Password: hash,
+			TotpSecret: secret, TotpConfirmedAt: &now}
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		st.EXPECT().UseTotpStep(1, gomock.Any()).Times(1).Return(nil)
+
+		setup, err := mr.EnableTotp(ctx, "password", &code)
+		assert.Equal(t, apperr.CodeConflict, apperr.CodeOf(err))
+		assert.Nil(t, setup)
+	})
+
+	t.Run("test successful enable", func(t *testing.T) {
+		customer := &models.Customer{Model: gorm.Model{ID: 1}, Email: "test@test.com", Password: hash}
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		var hashes []string
+		st.EXPECT().SetCustomerTotp(1, gomock.Any(), gomock.Any()).Times(1).
+			DoAndReturn(func(id int, secret string, h []string) error {
+				hashes = h
+				return nil
+			})
+
+		setup, err := mr.EnableTotp(ctx, "password", nil)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, setup.Secret)
+		assert.Equal(t, auth.TotpURI(customer.Email, setup.Secret), setup.URI)
+		assert.Len(t, hashes, len(setup.RecoveryCodes))
+
+		for i, code := range setup.RecoveryCodes {
+			assert.Equal(t, auth.HashRecoveryCode(code), hashes[i])
+		}
+	})
+}
+
+func TestMutationResolver_ConfirmTotp(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	st := storage.NewMockStorage(c)
+	sr := storage.NewMockSearcher(c)
+
+	mr := mutationResolver{&Resolver{
+		Storage:  st,
+		Searcher: sr,
+	}}
+
+	secret, _ := auth.NewTotpSecret()
+
+	t.Run("test when totp is not set up", func(t *testing.T) {
+		customer := &models.Customer{Model: gorm.Model{ID: 1}}
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		ok, err := mr.ConfirmTotp(ctx, "123456")
+		assert.EqualError(t, err, "two-factor authentication is not set up")
+		assert.False(t, ok)
+	})
+
+	t.Run("test with wrong code", func(t *testing.T) {
+		customer := &models.Customer{Model: gorm.Model{ID: 1}, TotpSecret: secret}
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		ok, err := mr.ConfirmTotp(ctx, "wrong")
+		assert.EqualError(t, err, "invalid two-factor code")
+		assert.False(t, ok)
+	})
+
+	t.Run("test successful confirm", func(t *testing.T) {
+		customer := &models.Customer{Model: gorm.Model{ID: 1}, TotpSecret: secret}
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		code, _ := auth.TotpCode(secret, time.Now())
+		st.EXPECT().ConfirmCustomerTotp(1, gomock.Any()).Times(1).Return(nil)
+
+		ok, err := mr.ConfirmTotp(ctx, code)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+}
+
+func TestMutationResolver_DisableTotp(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	st := storage.NewMockStorage(c)
+	sr := storage.NewMockSearcher(c)
+
+	mr := mutationResolver{&Resolver{
+		Storage:  st,
+		Searcher: sr,
+		Limiter:  auth.NewLoginLimiter(auth.NewMemoryAttemptStore(), zap.NewNop()),
+	}}
+
+	secret, _ := auth.NewTotpSecret()
+	now := time.Now()
+
+	t.Run("test when totp is not enabled", func(t *testing.T) {
+		customer := &models.Customer{Model: gorm.Model{ID: 1}, TotpSecret: secret}
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		ok, err := mr.DisableTotp(ctx, "123456")
+		assert.EqualError(t, err, "two-factor authentication is not enabled")
+		assert.False(t, ok)
+	})
+
+	t.Run("test with admin customer", func(t *testing.T) {
+		customer := &models.Customer{Model: gorm.Model{ID: 1}, Role: models.RoleAdmin, TotpSecret: secret, TotpConfirmedAt: &now}
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		code, _ := auth.TotpCode(secret, time.Now())
+
+		ok, err := mr.DisableTotp(ctx, code)
+		assert.Error(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("test locked after wrong codes", func(t *testing.T) {
+		customer := &models.Customer{Model: gorm.Model{ID: 2}, Email: "locked@test.com", Role: models.RoleCustomer, TotpSecret: secret, TotpConfirmedAt: &now}
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+		ctx = context.WithValue(ctx, auth.ClientIPContextKey{}, "127.0.0.1")
+
+		st.EXPECT().UseRecoveryCode(2, auth.HashRecoveryCode("wrong")).Times(6).Return(storage.ErrInvalidRecoveryCode)
+
+		for i := 0; i < 6; i++ {
+			ok, err := mr.DisableTotp(ctx, "wrong")
+			assert.EqualError(t, err, "invalid two-factor code")
+			assert.False(t, ok)
+		}
+
+		// the right code is locked out too, without being checked
+		code, _ := auth.TotpCode(secret, time.Now())
+		ok, err := mr.DisableTotp(ctx, code)
+		assert.False(t, ok)
+
+		var appErr *apperr.Error
+		assert.True(t, errors.As(err, &appErr))
+		assert.Equal(t, apperr.Code("LOGIN_LOCKED"), appErr.Code)
+	})
+
+	t.Run("test successful disable", func(t *testing.T) {
+		customer := &models.Customer{Model: gorm.Model{ID: 1}, Role: models.RoleCustomer, TotpSecret: secret, TotpConfirmedAt: &now}
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		code, _ := auth.TotpCode(secret, time.Now())
+		st.EXPECT().UseTotpStep(1, gomock.Any()).Times(1).Return(nil)
+		st.EXPECT().DisableCustomerTotp(1).Times(1).Return(nil)
+
+		ok, err := mr.DisableTotp(ctx, code)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+}
+
+func TestMutationResolver_AddToCart(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	st := storage.NewMockStorage(c)
+	sr := storage.NewMockSearcher(c)
+
+	mr := mutationResolver{&Resolver{
+		Storage:  st,
+		Searcher: sr,
+	}}
+
+	t.Run("test with no customer in ctx", func(t *testing.T) {
+		_, err := mr.AddToCart(context.Background(), model.AddToCard{
+			ProductID: "1",
+			Quantity:  1,
+		})
+
+		assert.Error(t, err)
+	})
+
+	t.Run("test with invalid product id", func(t *testing.T) {
+		customer := &models.Customer{
+			Model: gorm.Model{
+				ID: 1,
+			},
+			Email:    "test@test.com",
+			Password: "test",
+			Name:     "test",
+		}
+
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		_, err := mr.AddToCart(ctx, model.AddToCard{
+			ProductID: "invalid",
+			Quantity:  1,
+		})
+
+		assert.Error(t, err)
+	})
+
+	t.Run("test with invalid quantity", func(t *testing.T) {
+		customer := &models.Customer{
+			Model: gorm.Model{
+				ID: 1,
+			},
+			Email:    "test@test.com",
+			Password: "test",
+			Name:     "test",
+		}
+
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		for _, q := range []int{0, -1} {
+			_, err := mr.AddToCart(ctx, model.AddToCard{
+				ProductID: "1",
+				Quantity:  q,
+			})
+
+			assert.Equal(t, apperr.CodeValidation, apperr.CodeOf(err))
+		}
+	})
+
+	t.Run("test with unknown product", func(t *testing.T) {
+		customer := &models.Customer{
+			Model: gorm.Model{
+				ID: 1,
+			},
+			Email:    "test@test.com",
+			Password: "test",
+			Name:     "test",
+		}
+
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		st.EXPECT().GetProduct(1).
+			Times(1).Return(nil, apperr.NotFound("product not found"))
+
+		_, err := mr.AddToCart(ctx, model.AddToCard{
+			ProductID: "1",
+			Quantity:  1,
+		})
+
+		assert.EqualError(t, err, "product does not exist")
+		assert.Equal(t, apperr.CodeValidation, apperr.CodeOf(err))
+	})
+
+	t.Run("test with not enough stock", func(t *testing.T) {
+		customer := &models.Customer{
+			Model: gorm.Model{
+				ID: 1,
+			},
+			Email:    "test@test.com",
+			Password: "test",
+			Name:     "test",
+		}
+
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		st.EXPECT().GetProduct(1).
+			Times(1).Return(&models.Product{Model: gorm.Model{ID: 1}, Stock: 2}, nil)
+
+		// the quantity already in the cart counts too
+		st.EXPECT().GetCartItems(int(customer.ID)).
+			Times(1).Return([]*models.CartItem{{ProductID: 1, Quantity: 2}}, nil)
+
+		_, err := mr.AddToCart(ctx, model.AddToCard{
+			ProductID: "1",
+			Quantity:  1,
+		})
+
+		var appErr *apperr.Error
+		require.True(t, errors.As(err, &appErr))
+		assert.Equal(t, apperr.CodeOutOfStock, appErr.Code)
+		assert.Equal(t, map[string]interface{}{"productId": "1", "available": 2}, appErr.Extensions)
+	})
+
+	t.Run("test when storage.AddToCart returns an error", func(t *testing.T) {
+		customer := &models.Customer{
+			Model: gorm.Model{
+				ID: 1,
+			},
+			Email:    "test@test.com",
+			Password: "test",
+			Name:     "test",
+		}
+
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		st.EXPECT().GetProduct(1).
+			Times(1).Return(&models.Product{Stock: 5}, nil)
+
+		st.EXPECT().GetCartItems(int(customer.ID)).
+			Times(1).Return(nil, nil)
+
+		st.EXPECT().AddToCart(int(customer.ID), 1, 1).
+			Times(1).Return(errors.New("failed"))
+
+		_, err := mr.AddToCart(ctx, model.AddToCard{
+			ProductID: "1",
+			Quantity:  1,
+		})
+
+		assert.Error(t, err)
+	})
+
+	t.Run("test when the product is deleted before it is added", func(t *testing.T) {
+		customer := &models.Customer{
+			Model: gorm.Model{
+				ID: 1,
+			},
+			Email:    "test@test.com",
+			Password: "test",
+			Name:     "test",
+		}
+
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		st.EXPECT().GetProduct(1).
+			Times(1).Return(&models.Product{Stock: 5}, nil)
+
+		st.EXPECT().GetCartItems(int(customer.ID)).
+			Times(1).Return(nil, nil)
+
+		st.EXPECT().AddToCart(int(customer.ID), 1, 1).
+			Times(1).Return(apperr.NotFound("product not found"))
+
+		_, err := mr.AddToCart(ctx, model.AddToCard{
+			ProductID: "1",
+			Quantity:  1,
+		})
+
+		assert.EqualError(t, err, "product does not exist")
+		assert.Equal(t, apperr.CodeValidation, apperr.CodeOf(err))
+	})
+
+	t.Run("test when storage.GetCartItems returns an error", func(t *testing.T) {
+		customer := &models.Customer{
+			Model: gorm.Model{
+				ID: 1,
+			},
+			Email:    "test@test.com",
+			Password: "test",
+			Name:     "test",
+		}
+
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		st.EXPECT().GetProduct(1).
+			Times(1).Return(&models.Product{Stock: 5}, nil)
+
+		st.EXPECT().GetCartItems(int(customer.ID)).
+			Times(1).Return(nil, errors.New("failed"))
+
+		_, err := mr.AddToCart(ctx, model.AddToCard{
+			ProductID: "1",
+			Quantity:  1,
+		})
+
+		assert.Error(t, err)
+	})
+
+	t.Run("test successful add to cart", func(t *testing.T) {
+		customer := &models.Customer{
+			Model: gorm.Model{
+				ID: 1,
+			},
+			Email:    "test@test.com",
+			Password: "test",
+			Name:     "test",
+		}
+
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		st.EXPECT().GetProduct(1).
+			Times(1).Return(&models.Product{Stock: 5}, nil)
+
+		st.EXPECT().GetCartItems(int(customer.ID)).
+			Times(1).Return(nil, nil)
+
+		st.EXPECT().AddToCart(int(customer.ID), 1, 1).
+			Times(1).Return(nil)
+
+		ret := &model.Cart{
+			Products: []*model.ProductInCart{
+				{
+					Product: &model.Product{
+						ID:    "1",
+						Name:  "test",
+						Price: 1000,
+					},
+					Quantity:  1,
+					LineTotal: 1000,
+				},
+			},
+			ItemCount:  1,
+			Subtotal:   1000,
+			GrandTotal: 1000,
+		}
+
+		var cartItems []*models.CartItem
+		for _, p := range ret.Products {
+			cartItems = append(cartItems, &models.CartItem{
+				CustomerID: 0,
+				Customer:   models.Customer{},
+				Quantity:   p.Quantity,
+				ProductID:  1,
+				Product: models.Product{
+					Model: gorm.Model{
+						ID: 1,
+					},
+					Name:  p.Product.Name,
+					Price: p.Product.Price,
+				},
+			})
+		}
+
+		st.EXPECT().GetCartItems(int(customer.ID)).
+			Times(1).Return(cartItems, nil)
+
+		items, err := mr.AddToCart(ctx, model.AddToCard{
+			ProductID: "1",
+			Quantity:  1,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, ret, items)
+	})
+}
+
+func TestMutationResolver_RemoveFromCart(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	st := storage.NewMockStorage(c)
+	sr := storage.NewMockSearcher(c)
+
+	mr := mutationResolver{&Resolver{
+		Storage:  st,
+		Searcher: sr,
+	}}
+
+	t.Run("test with no customer in ctx", func(t *testing.T) {
+		_, err := mr.RemoveFromCart(context.Background(), "1")
+
+		assert.Error(t, err)
+	})
+
+	t.Run("test with invalid product id", func(t *testing.T) {
+		customer := &models.Customer{
+			Model: gorm.Model{
+				ID: 1,
+			},
+			Email:    "test@test.com",
+			Password: "test",
+			Name:     "test",
+		}
+
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		_, err := mr.RemoveFromCart(ctx, "invalid")
+
+		assert.Error(t, err)
+	})
+
+	t.Run("test when storage.RemoveFromCart returns an error", func(t *testing.T) {
+		customer := &models.Customer{
+			Model: gorm.Model{
+				ID: 1,
+			},
+			Email:    "test@test.com",
+			Password: "test",
+			Name:     "test",
+		}
+
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		st.EXPECT().RemoveFromCart(int(customer.ID), 1).
+			Times(1).Return(errors.New("failed"))
+
+		_, err := mr.RemoveFromCart(ctx, "1")
+
+		assert.Error(t, err)
+	})
+
+	t.Run("test when storage.GetCartItems returns an error", func(t *testing.T) {
+		customer := &models.Customer{
+			Model: gorm.Model{
+				ID: 1,
+			},
+			Email:    "test@test.com",
+			Password: "test",
+			Name:     "test",
+		}
+
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		st.EXPECT().RemoveFromCart(int(customer.ID), 1).
+			Times(1).Return(nil)
+
+		st.EXPECT().GetCartItems(int(customer.ID)).
+			Times(1).Return(nil, errors.New("failed"))
+
+		_, err := mr.RemoveFromCart(ctx, "1")
+
+		assert.Error(t, err)
 	})
 
 	t.Run("test successful remove from cart", func(t *testing.T) {
@@ -365,51 +1372,1560 @@ func TestMutationResolver_RemoveFromCart(t *testing.T) {
 			Name:     "test",
 		}
 
-		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		st.EXPECT().RemoveFromCart(int(customer.ID), 1).
+			Times(1).Return(nil)
+
+		ret := &model.Cart{
+			Products: []*model.ProductInCart{
+				{
+					Product: &model.Product{
+						ID:    "1",
+						Name:  "test",
+						Price: 1000,
+					},
+					Quantity:  1,
+					LineTotal: 1000,
+				},
+			},
+			ItemCount:  1,
+			Subtotal:   1000,
+			GrandTotal: 1000,
+		}
+
+		var cartItems []*models.CartItem
+		for _, p := range ret.Products {
+			cartItems = append(cartItems, &models.CartItem{
+				CustomerID: 0,
+				Customer:   models.Customer{},
+				Quantity:   p.Quantity,
+				ProductID:  1,
+				Product: models.Product{
+					Model: gorm.Model{
+						ID: 1,
+					},
+					Name:  p.Product.Name,
+					Price: p.Product.Price,
+				},
+			})
+		}
+
+		st.EXPECT().GetCartItems(int(customer.ID)).
+			Times(1).Return(cartItems, nil)
+
+		items, err := mr.RemoveFromCart(ctx, "1")
+		assert.NoError(t, err)
+		assert.Equal(t, ret, items)
+	})
+}
+
+func TestMutationResolver_SetCartItemQuantity(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	st := storage.NewMockStorage(c)
+
+	mr := mutationResolver{&Resolver{
+		Storage: st,
+	}}
+
+	customer := &models.Customer{
+		Model: gorm.Model{
+			ID: 1,
+		},
+		Email: "test@test.com",
+		Name:  "test",
+	}
+	ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+	t.Run("test with no customer in ctx", func(t *testing.T) {
+		cart, err := mr.SetCartItemQuantity(context.Background(), "1", 1)
+		assert.Equal(t, apperr.CodeUnauthenticated, apperr.CodeOf(err))
+		assert.Nil(t, cart)
+	})
+
+	t.Run("test with invalid product id", func(t *testing.T) {
+		cart, err := mr.SetCartItemQuantity(ctx, "invalid", 1)
+		assert.Equal(t, apperr.CodeValidation, apperr.CodeOf(err))
+		assert.Nil(t, cart)
+	})
+
+	t.Run("test with negative quantity", func(t *testing.T) {
+		cart, err := mr.SetCartItemQuantity(ctx, "1", -1)
+		assert.Equal(t, apperr.CodeValidation, apperr.CodeOf(err))
+		assert.Nil(t, cart)
+	})
+
+	t.Run("test with unknown product", func(t *testing.T) {
+		st.EXPECT().GetProduct(2).Times(1).Return(nil, apperr.NotFound("product not found"))
+
+		cart, err := mr.SetCartItemQuantity(ctx, "2", 3)
+		assert.Equal(t, apperr.CodeValidation, apperr.CodeOf(err))
+		assert.Nil(t, cart)
+	})
+
+	t.Run("test with not enough stock", func(t *testing.T) {
+		st.EXPECT().GetProduct(2).Times(1).Return(&models.Product{Model: gorm.Model{ID: 2}, Stock: 2}, nil)
+
+		cart, err := mr.SetCartItemQuantity(ctx, "2", 3)
+		assert.Equal(t, apperr.CodeOutOfStock, apperr.CodeOf(err))
+		assert.Nil(t, cart)
+	})
+
+	t.Run("test when storage.SetCartItemQuantity returns an error", func(t *testing.T) {
+		st.EXPECT().GetProduct(2).Times(1).Return(&models.Product{Stock: 3}, nil)
+		st.EXPECT().SetCartItemQuantity(1, 2, 3).Times(1).Return(errors.New("failed"))
+
+		cart, err := mr.SetCartItemQuantity(ctx, "2", 3)
+		assert.Error(t, err)
+		assert.Nil(t, cart)
+	})
+
+	t.Run("test when the product is deleted before it is set", func(t *testing.T) {
+		st.EXPECT().GetProduct(2).Times(1).Return(&models.Product{Stock: 3}, nil)
+		st.EXPECT().SetCartItemQuantity(1, 2, 3).Times(1).Return(apperr.NotFound("product not found"))
+
+		cart, err := mr.SetCartItemQuantity(ctx, "2", 3)
+		assert.Equal(t, apperr.CodeValidation, apperr.CodeOf(err))
+		assert.Nil(t, cart)
+	})
+
+	t.Run("test successful set", func(t *testing.T) {
+		st.EXPECT().GetProduct(2).Times(1).Return(&models.Product{Stock: 3}, nil)
+		st.EXPECT().SetCartItemQuantity(1, 2, 3).Times(1).Return(nil)
+		st.EXPECT().GetCartItems(1).Times(1).Return([]*models.CartItem{
+			{ProductID: 2, Product: models.Product{Name: "Milk", Price: 3, Stock: 3}, Quantity: 3},
+		}, nil)
+
+		cart, err := mr.SetCartItemQuantity(ctx, "2", 3)
+		assert.NoError(t, err)
+		assert.Equal(t, &model.Cart{
+			Products: []*model.ProductInCart{
+				{Product: &model.Product{ID: "2", Name: "Milk", Price: 3, Stock: 3, InStock: true}, Quantity: 3, LineTotal: 9},
+			},
+			ItemCount:  3,
+			Subtotal:   9,
+			GrandTotal: 9,
+		}, cart)
+	})
+
+	t.Run("test successful remove", func(t *testing.T) {
+		st.EXPECT().SetCartItemQuantity(1, 2, 0).Times(1).Return(nil)
+		st.EXPECT().GetCartItems(1).Times(1).Return(nil, nil)
+
+		cart, err := mr.SetCartItemQuantity(ctx, "2", 0)
+		assert.NoError(t, err)
+		assert.Equal(t, &model.Cart{Products: []*model.ProductInCart{}}, cart)
+	})
+}
+
+func TestMutationResolver_ClearCart(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	st := storage.NewMockStorage(c)
+
+	mr := mutationResolver{&Resolver{
+		Storage: st,
+	}}
+
+	customer := &models.Customer{
+		Model: gorm.Model{
+			ID: 1,
+		},
+		Email: "test@test.com",
+		Name:  "test",
+	}
+	ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+	t.Run("test with no customer in ctx", func(t *testing.T) {
+		cart, err := mr.ClearCart(context.Background())
+		assert.Equal(t, apperr.CodeUnauthenticated, apperr.CodeOf(err))
+		assert.Nil(t, cart)
+	})
+
+	t.Run("test when storage.ClearCart returns an error", func(t *testing.T) {
+		st.EXPECT().ClearCart(1).Times(1).Return(errors.New("failed"))
+
+		cart, err := mr.ClearCart(ctx)
+		assert.Error(t, err)
+		assert.Nil(t, cart)
+	})
+
+	t.Run("test successful clear", func(t *testing.T) {
+		st.EXPECT().ClearCart(1).Times(1).Return(nil)
+		st.EXPECT().GetCartItems(1).Times(1).Return(nil, nil)
+
+		cart, err := mr.ClearCart(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, &model.Cart{Products: []*model.ProductInCart{}}, cart)
+	})
+}
+
+func TestQueryResolver_Cart(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	st := storage.NewMockStorage(c)
+
+	qr := queryResolver{&Resolver{
+		Storage: st,
+	}}
+
+	customer := &models.Customer{
+		Model: gorm.Model{
+			ID: 1,
+		},
+		Email: "test@test.com",
+		Name:  "test",
+	}
+	ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+	t.Run("test with no customer in ctx", func(t *testing.T) {
+		cart, err := qr.Cart(context.Background())
+		assert.Equal(t, apperr.CodeUnauthenticated, apperr.CodeOf(err))
+		assert.Nil(t, cart)
+	})
+
+	t.Run("test successful get", func(t *testing.T) {
+		st.EXPECT().GetCartItems(1).Times(1).Return([]*models.CartItem{
+			{ProductID: 2, Product: models.Product{Name: "Milk", Price: 3}, Quantity: 4},
+		}, nil)
+
+		cart, err := qr.Cart(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, &model.Cart{
+			Products: []*model.ProductInCart{
+				{Product: &model.Product{ID: "2", Name: "Milk", Price: 3}, Quantity: 4, LineTotal: 12},
+			},
+			ItemCount:  4,
+			Subtotal:   12,
+			GrandTotal: 12,
+		}, cart)
+	})
+	t.Run("test cart priced with tax", func(t *testing.T) {
+		qr := queryResolver{&Resolver{
+			Storage: st,
+			Pricing: pricing.Service{TaxRate: 1000},
+		}}
+
+		st.EXPECT().GetCartItems(1).Times(1).Return([]*models.CartItem{
+			{ProductID: 2, Product: models.Product{Name: "Milk", Price: 250}, Quantity: 4},
+			{ProductID: 3, Product: models.Product{Name: "Bread", Price: 199}, Quantity: 1},
+		}, nil)
+
+		cart, err := qr.Cart(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 1000, cart.Products[0].LineTotal)
+		assert.Equal(t, 199, cart.Products[1].LineTotal)
+		assert.Equal(t, 5, cart.ItemCount)
+		assert.Equal(t, 1199, cart.Subtotal)
+		assert.Equal(t, 0, cart.DiscountTotal)
+		assert.Equal(t, 120, cart.TaxTotal)
+		assert.Equal(t, 1319, cart.GrandTotal)
+	})
+}
+
+func TestMutationResolver_Checkout(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	st := storage.NewMockStorage(c)
+
+	mr := mutationResolver{&Resolver{
+		Storage:        st,
+		Pricing:        pricing.Service{TaxRate: 1000},
+		ReservationTTL: 15 * time.Minute,
+	}}
+
+	customer := &models.Customer{
+		Model: gorm.Model{
+			ID: 1,
+		},
+		Email: "test@test.com",
+		Name:  "test",
+	}
+	ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+	t.Run("test with no customer in ctx", func(t *testing.T) {
+		order, err := mr.Checkout(context.Background())
+		assert.Equal(t, apperr.CodeUnauthenticated, apperr.CodeOf(err))
+		assert.Nil(t, order)
+	})
+
+	t.Run("test with empty cart", func(t *testing.T) {
+		st.EXPECT().Checkout(1, gomock.Any(), gomock.Any()).Times(1).Return(nil, storage.ErrEmptyCart)
+
+		order, err := mr.Checkout(ctx)
+		assert.Equal(t, apperr.CodeValidation, apperr.CodeOf(err))
+		assert.Nil(t, order)
+	})
+
+	t.Run("test successful checkout", func(t *testing.T) {
+		st.EXPECT().Checkout(1, gomock.Any(), gomock.Any()).Times(1).DoAndReturn(
+			func(customerID int, reserveUntil time.Time, newOrder func([]*models.CartItem) *models.Order) (*models.Order, error) {
+				assert.WithinDuration(t, time.Now().Add(15*time.Minute), reserveUntil, time.Minute)
+
+				o := newOrder([]*models.CartItem{
+					{ProductID: 2, Product: models.Product{Name: "Milk", Price: 250}, Quantity: 4},
+					{ProductID: 3, Product: models.Product{Name: "Bread", Price: 199}, Quantity: 1},
+				})
+				assert.Equal(t, 1, o.CustomerID)
+				assert.Equal(t, []models.OrderHistory{{ToStatus: models.OrderPending, ActorID: 1}}, o.History)
+
+				o.ID = 7
+				o.CreatedAt = time.Unix(1000, 0)
+				o.History[0].CreatedAt = time.Unix(1000, 0)
+				return o, nil
+			})
+
+		order, err := mr.Checkout(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, &model.Order{
+			ID:     "7",
+			Status: model.OrderStatusPending,
+			Items: []*model.OrderItem{
+				{ProductID: "2", Name: "Milk", UnitPrice: 250, Quantity: 4, LineTotal: 1000},
+				{ProductID: "3", Name: "Bread", UnitPrice: 199, Quantity: 1, LineTotal: 199},
+			},
+			ItemCount:  5,
+			Subtotal:   1199,
+			TaxTotal:   120,
+			GrandTotal: 1319,
+			CreatedAt:  1000,
+			Timeline: []*model.OrderEvent{
+				{Status: model.OrderStatusPending, CreatedAt: 1000},
+			},
+		}, order)
+	})
+}
+
+func TestMutationResolver_PayOrder(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	st := storage.NewMockStorage(c)
+
+	newResolver := func() (mutationResolver, *payment.FakeProvider) {
+		provider := payment.NewFakeProvider(nil, "", "http://localhost/fake-payments/", zap.NewNop())
+		return mutationResolver{&Resolver{
+			Storage:  st,
+			Payments: payment.NewProcessor(st, provider, nil, zap.NewNop()),
+		}}, provider
+	}
+	mr, _ := newResolver()
+
+	customer := &models.Customer{
+		Model: gorm.Model{
+			ID: 1,
+		},
+		Email: "test@test.com",
+		Name:  "test",
+	}
+	ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+	pending := func() *models.Order {
+		return &models.Order{Model: gorm.Model{ID: 2}, CustomerID: 1, Status: models.OrderPending, GrandTotal: 30}
+	}
+
+	t.Run("test with no customer in ctx", func(t *testing.T) {
+		p, err := mr.PayOrder(context.Background(), "2", "tok")
+		assert.Equal(t, apperr.CodeUnauthenticated, apperr.CodeOf(err))
+		assert.Nil(t, p)
+	})
+
+	t.Run("test with invalid input", func(t *testing.T) {
+		p, err := mr.PayOrder(ctx, "invalid", "tok")
+		assert.Equal(t, apperr.CodeValidation, apperr.CodeOf(err))
+		assert.Nil(t, p)
+
+		p, err = mr.PayOrder(ctx, "2", "")
+		assert.Equal(t, apperr.CodeValidation, apperr.CodeOf(err))
+		assert.Nil(t, p)
+	})
+
+	t.Run("test when storage.GetCustomerOrder returns an error", func(t *testing.T) {
+		st.EXPECT().GetCustomerOrder(1, 2).Times(1).Return(nil, apperr.NotFound("order not found"))
+
+		p, err := mr.PayOrder(ctx, "2", "tok")
+		assert.Equal(t, apperr.CodeNotFound, apperr.CodeOf(err))
+		assert.Nil(t, p)
+	})
+
+	t.Run("test with an order which is not pending", func(t *testing.T) {
+		paid := pending()
+		paid.Status = models.OrderPaid
+		st.EXPECT().GetCustomerOrder(1, 2).Times(1).Return(paid, nil)
+
+		p, err := mr.PayOrder(ctx, "2", "tok")
+		assert.Equal(t, payment.ErrOrderNotPayable, err)
+		assert.Nil(t, p)
+	})
+
+	t.Run("test with an active payment", func(t *testing.T) {
+		st.EXPECT().GetCustomerOrder(1, 2).Times(1).Return(pending(), nil)
+		st.EXPECT().CountOrderPayments(2).Times(1).Return(1, nil)
+		st.EXPECT().GetOrderPayment(2).Times(1).Return(&models.Payment{
+			OrderID: 2, ProviderID: "pay_1", Status: models.PaymentPending, Amount: 30, ActionURL: "http://action",
+		}, nil)
+
+		p, err := mr.PayOrder(ctx, "2", "tok")
+		assert.NoError(t, err)
+		assert.Equal(t, model.PaymentStatusPending, p.Status)
+		assert.Equal(t, "http://action", *p.ActionURL)
+	})
+
+	t.Run("test payment which needs an action", func(t *testing.T) {
+		mr, provider := newResolver()
+
+		st.EXPECT().GetCustomerOrder(1, 2).Times(1).Return(pending(), nil)
+		st.EXPECT().CountOrderPayments(2).Times(1).Return(0, nil)
+		st.EXPECT().GetOrderPayment(2).Times(1).Return(nil, apperr.NotFound("payment not found"))
+		st.EXPECT().GetOrder(2).Times(1).Return(pending(), nil)
+		st.EXPECT().GetPayment("pay_1").Times(1).Return(nil, apperr.NotFound("payment not found"))
+		saved := &models.Payment{
+			OrderID: 2, ProviderID: "pay_1", Status: models.PaymentPending, Amount: 30,
+			ActionURL: "http://localhost/fake-payments/pay_1",
+		}
+		st.EXPECT().SavePayment(saved).Times(1).Return(nil)
+		st.EXPECT().GetPayment("pay_1").Times(1).Return(saved, nil)
+
+		p, err := mr.PayOrder(ctx, "2", payment.FakeToken3DS)
+		assert.NoError(t, err)
+		assert.Equal(t, &model.Payment{
+			ID:        "pay_1",
+			Status:    model.PaymentStatusPending,
+			Amount:    30,
+			ActionURL: &saved.ActionURL,
+		}, p)
+
+		// the idempotency key is derived from the order
+		tx, err := provider.Authorize(context.Background(), payment.AuthorizeRequest{
+			OrderID: 2, Amount: 30, Token: payment.FakeToken3DS,
+		}, "order:2:payment:1")
+		assert.NoError(t, err)
+		assert.Equal(t, "pay_1", tx.ID)
+	})
+
+	t.Run("test successful payment", func(t *testing.T) {
+		mr, _ := newResolver()
+
+		paid := pending()
+		paid.Status = models.OrderPaid
+
+		st.EXPECT().GetCustomerOrder(1, 2).Times(1).Return(pending(), nil)
+		st.EXPECT().CountOrderPayments(2).Times(1).Return(0, nil)
+		st.EXPECT().GetOrderPayment(2).Times(1).Return(nil, apperr.NotFound("payment not found"))
+		st.EXPECT().GetPayment("pay_1").Times(1).Return(nil, apperr.NotFound("payment not found"))
+		st.EXPECT().SavePayment(gomock.Any()).Times(1).Return(nil)
+		st.EXPECT().GetPayment("pay_1").Times(1).Return(&models.Payment{
+			OrderID: 2, ProviderID: "pay_1", Status: models.PaymentAuthorized, Amount: 30,
+		}, nil)
+		st.EXPECT().SavePayment(&models.Payment{
+			OrderID: 2, ProviderID: "pay_1", Status: models.PaymentCaptured, Amount: 30,
+		}).Times(1).Return(nil)
+		// the order is checked before authorizing, before capturing and when it's moved
+		st.EXPECT().GetOrder(2).Times(3).Return(pending(), nil)
+		st.EXPECT().UpdateOrderStatus(&models.OrderHistory{
+			OrderID:    2,
+			FromStatus: models.OrderPending,
+			ToStatus:   models.OrderPaid,
+			Reason:     "payment captured",
+		}).Times(1).Return(nil)
+		st.EXPECT().GetPayment("pay_1").Times(1).Return(&models.Payment{
+			OrderID: 2, ProviderID: "pay_1", Status: models.PaymentCaptured, Amount: 30,
+		}, nil)
+
+		p, err := mr.PayOrder(ctx, "2", "tok_visa")
+		assert.NoError(t, err)
+		assert.Equal(t, &model.Payment{ID: "pay_1", Status: model.PaymentStatusCaptured, Amount: 30}, p)
+	})
+}
+
+func TestMutationResolver_UpdateOrderStatus(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	st := storage.NewMockStorage(c)
+
+	mr := mutationResolver{&Resolver{
+		Storage:  st,
+		Payments: payment.NewProcessor(st, payment.NewFakeProvider(nil, "", "", zap.NewNop()), nil, zap.NewNop()),
+	}}
+
+	admin := &models.Customer{
+		Model: gorm.Model{
+			ID: 5,
+		},
+		Email: "admin@test.com",
+		Name:  "admin",
+		Role:  models.RoleAdmin,
+	}
+	ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, admin)
+
+	paid := func() *models.Order {
+		return &models.Order{Model: gorm.Model{ID: 2}, CustomerID: 1, Status: models.OrderPaid}
+	}
+
+	t.Run("test with no customer in ctx", func(t *testing.T) {
+		order, err := mr.UpdateOrderStatus(context.Background(), "2", model.OrderStatusFulfilled, nil)
+		assert.Equal(t, apperr.CodeUnauthenticated, apperr.CodeOf(err))
+		assert.Nil(t, order)
+	})
+
+	t.Run("test with invalid id", func(t *testing.T) {
+		order, err := mr.UpdateOrderStatus(ctx, "invalid", model.OrderStatusFulfilled, nil)
+		assert.Equal(t, apperr.CodeValidation, apperr.CodeOf(err))
+		assert.Nil(t, order)
+	})
+
+	t.Run("test with too long reason", func(t *testing.T) {
+		reason := strings.Repeat("a", maxReasonLength+1)
+
+		order, err := mr.UpdateOrderStatus(ctx, "2", model.OrderStatusFulfilled, &reason)
+		assert.Equal(t, apperr.CodeValidation, apperr.CodeOf(err))
+		assert.Nil(t, order)
+	})
+
+	t.Run("test when storage.GetOrder returns an error", func(t *testing.T) {
+		st.EXPECT().GetOrder(2).Times(1).Return(nil, apperr.NotFound("order not found"))
+
+		order, err := mr.UpdateOrderStatus(ctx, "2", model.OrderStatusFulfilled, nil)
+		assert.Equal(t, apperr.CodeNotFound, apperr.CodeOf(err))
+		assert.Nil(t, order)
+	})
+
+	t.Run("test illegal transition", func(t *testing.T) {
+		st.EXPECT().GetOrder(2).Times(1).Return(paid(), nil)
+
+		order, err := mr.UpdateOrderStatus(ctx, "2", model.OrderStatusCancelled, nil)
+		assert.Equal(t, apperr.CodeConflict, apperr.CodeOf(err))
+		assert.Nil(t, order)
+	})
+
+	t.Run("test when the status changed concurrently", func(t *testing.T) {
+		refunded := paid()
+		refunded.Status = models.OrderRefunded
+
+		st.EXPECT().GetOrder(2).Times(1).Return(paid(), nil)
+		st.EXPECT().UpdateOrderStatus(gomock.Any()).Times(1).Return(storage.ErrOrderStatusChanged)
+		st.EXPECT().GetOrder(2).Times(1).Return(refunded, nil)
+
+		order, err := mr.UpdateOrderStatus(ctx, "2", model.OrderStatusFulfilled, nil)
+		assert.Equal(t, storage.ErrOrderStatusChanged, err)
+		assert.Nil(t, order)
+	})
+
+	t.Run("test when the status changed concurrently to the same status", func(t *testing.T) {
+		fulfilled := paid()
+		fulfilled.Status = models.OrderFulfilled
+
+		st.EXPECT().GetOrder(2).Times(1).Return(paid(), nil)
+		st.EXPECT().UpdateOrderStatus(gomock.Any()).Times(1).Return(storage.ErrOrderStatusChanged)
+		st.EXPECT().GetOrder(2).Times(1).Return(fulfilled, nil)
+
+		order, err := mr.UpdateOrderStatus(ctx, "2", model.OrderStatusFulfilled, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, model.OrderStatusFulfilled, order.Status)
+	})
+
+	t.Run("test refund releases the payment", func(t *testing.T) {
+		provider := payment.NewFakeProvider(nil, "", "", zap.NewNop())
+		tx, err := provider.Authorize(context.Background(), payment.AuthorizeRequest{OrderID: 2, Amount: 10, Token: "tok"}, "k")
+		require.NoError(t, err)
+		_, err = provider.Capture(context.Background(), tx.ID, "c")
+		require.NoError(t, err)
+
+		pr := mutationResolver{&Resolver{
+			Storage:  st,
+			Payments: payment.NewProcessor(st, provider, nil, zap.NewNop()),
+		}}
+
+		refunded := paid()
+		refunded.Status = models.OrderRefunded
+
+		st.EXPECT().GetOrder(2).Times(1).Return(paid(), nil)
+		st.EXPECT().GetOrderPayment(2).Times(1).Return(&models.Payment{
+			OrderID: 2, ProviderID: tx.ID, Status: models.PaymentCaptured, Amount: 10,
+		}, nil)
+		st.EXPECT().GetPayment(tx.ID).Times(1).Return(&models.Payment{
+			OrderID: 2, ProviderID: tx.ID, Status: models.PaymentCaptured, Amount: 10,
+		}, nil)
+		st.EXPECT().SavePayment(&models.Payment{
+			OrderID: 2, ProviderID: tx.ID, Status: models.PaymentRefunded, Amount: 10,
+		}).Times(1).Return(nil)
+		st.EXPECT().UpdateOrderStatus(gomock.Any()).Times(1).Return(nil)
+		st.EXPECT().GetOrder(2).Times(1).Return(refunded, nil)
+
+		order, err := pr.UpdateOrderStatus(ctx, "2", model.OrderStatusRefunded, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, model.OrderStatusRefunded, order.Status)
+	})
+
+	t.Run("test the payment is kept when the status can't be saved", func(t *testing.T) {
+		pending := paid()
+		pending.Status = models.OrderPending
+
+		// no payment is voided, which would fail the test with an unexpected call
+		st.EXPECT().GetOrder(2).Times(1).Return(pending, nil)
+		st.EXPECT().GetOrderPayment(2).Times(1).Return(&models.Payment{
+			OrderID: 2, ProviderID: "pay_1", Status: models.PaymentAuthorized, Amount: 10,
+		}, nil)
+		st.EXPECT().UpdateOrderStatus(gomock.Any()).Times(1).Return(errors.New("failed"))
+
+		order, err := mr.UpdateOrderStatus(ctx, "2", model.OrderStatusCancelled, nil)
+		assert.Error(t, err)
+		assert.Nil(t, order)
+	})
+
+	t.Run("test cancel with a captured payment", func(t *testing.T) {
+		pending := paid()
+		pending.Status = models.OrderPending
+
+		st.EXPECT().GetOrder(2).Times(1).Return(pending, nil)
+		st.EXPECT().GetOrderPayment(2).Times(1).Return(&models.Payment{
+			OrderID: 2, ProviderID: "pay_1", Status: models.PaymentCaptured, Amount: 10,
+		}, nil)
+
+		order, err := mr.UpdateOrderStatus(ctx, "2", model.OrderStatusCancelled, nil)
+		assert.Equal(t, apperr.CodeConflict, apperr.CodeOf(err))
+		assert.Nil(t, order)
+	})
+
+	t.Run("test refunding a refunded order again retries the refund", func(t *testing.T) {
+		provider := payment.NewFakeProvider(nil, "", "", zap.NewNop())
+		tx, err := provider.Authorize(context.Background(), payment.AuthorizeRequest{OrderID: 2, Amount: 10, Token: "tok"}, "k")
+		require.NoError(t, err)
+		_, err = provider.Capture(context.Background(), tx.ID, "c")
+		require.NoError(t, err)
+
+		pr := mutationResolver{&Resolver{
+			Storage:  st,
+			Payments: payment.NewProcessor(st, provider, nil, zap.NewNop()),
+		}}
+
+		refunded := paid()
+		refunded.Status = models.OrderRefunded
+
+		st.EXPECT().GetOrder(2).Times(1).Return(refunded, nil)
+		st.EXPECT().GetOrderPayment(2).Times(1).Return(&models.Payment{
+			OrderID: 2, ProviderID: tx.ID, Status: models.PaymentCaptured, Amount: 10,
+		}, nil)
+		st.EXPECT().GetPayment(tx.ID).Times(1).Return(&models.Payment{
+			OrderID: 2, ProviderID: tx.ID, Status: models.PaymentCaptured, Amount: 10,
+		}, nil)
+		st.EXPECT().SavePayment(&models.Payment{
+			OrderID: 2, ProviderID: tx.ID, Status: models.PaymentRefunded, Amount: 10,
+		}).Times(1).Return(nil)
+
+		order, err := pr.UpdateOrderStatus(ctx, "2", model.OrderStatusRefunded, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, model.OrderStatusRefunded, order.Status)
+	})
+
+	t.Run("test successful update", func(t *testing.T) {
+		reason := "  packed  "
+
+		fulfilled := paid()
+		fulfilled.Status = models.OrderFulfilled
+
+		st.EXPECT().GetOrder(2).Times(1).Return(paid(), nil)
+		st.EXPECT().UpdateOrderStatus(&models.OrderHistory{
+			OrderID:    2,
+			FromStatus: models.OrderPaid,
+			ToStatus:   models.OrderFulfilled,
+			ActorID:    5,
+			Reason:     "packed",
+		}).Times(1).Return(nil)
+		st.EXPECT().GetOrder(2).Times(1).Return(fulfilled, nil)
+
+		order, err := mr.UpdateOrderStatus(ctx, "2", model.OrderStatusFulfilled, &reason)
+		assert.NoError(t, err)
+		assert.Equal(t, model.OrderStatusFulfilled, order.Status)
+	})
+}
+
+func TestQueryResolver_Orders(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	st := storage.NewMockStorage(c)
+
+	qr := queryResolver{&Resolver{
+		Storage: st,
+	}}
+
+	customer := &models.Customer{
+		Model: gorm.Model{
+			ID: 1,
+		},
+		Email: "test@test.com",
+		Name:  "test",
+	}
+	ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+	t.Run("test with no customer in ctx", func(t *testing.T) {
+		orders, err := qr.Orders(context.Background())
+		assert.Equal(t, apperr.CodeUnauthenticated, apperr.CodeOf(err))
+		assert.Nil(t, orders)
+	})
+
+	t.Run("test when storage.GetCustomerOrders returns an error", func(t *testing.T) {
+		st.EXPECT().GetCustomerOrders(1).Times(1).Return(nil, errors.New("failed"))
+
+		orders, err := qr.Orders(ctx)
+		assert.Error(t, err)
+		assert.Nil(t, orders)
+	})
+
+	t.Run("test successful get", func(t *testing.T) {
+		st.EXPECT().GetCustomerOrders(1).Times(1).Return([]*models.Order{
+			{Model: gorm.Model{ID: 2, CreatedAt: time.Unix(2000, 0)}, Status: models.OrderPending, ItemCount: 1, Subtotal: 3, GrandTotal: 3, Items: []models.OrderItem{
+				{ProductID: 5, Name: "Milk", UnitPrice: 3, Quantity: 1, LineTotal: 3},
+			}},
+			{Model: gorm.Model{ID: 1, CreatedAt: time.Unix(1000, 0)}, Status: models.OrderCancelled},
+		}, nil)
+
+		orders, err := qr.Orders(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, []*model.Order{
+			{ID: "2", Status: model.OrderStatusPending, ItemCount: 1, Subtotal: 3, GrandTotal: 3, CreatedAt: 2000, Items: []*model.OrderItem{
+				{ProductID: "5", Name: "Milk", UnitPrice: 3, Quantity: 1, LineTotal: 3},
+			}, Timeline: []*model.OrderEvent{}},
+			{ID: "1", Status: model.OrderStatusCancelled, CreatedAt: 1000, Items: []*model.OrderItem{}, Timeline: []*model.OrderEvent{}},
+		}, orders)
+	})
+}
+
+func TestQueryResolver_Order(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	st := storage.NewMockStorage(c)
+
+	qr := queryResolver{&Resolver{
+		Storage: st,
+	}}
+
+	customer := &models.Customer{
+		Model: gorm.Model{
+			ID: 1,
+		},
+		Email: "test@test.com",
+		Name:  "test",
+	}
+	ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+	t.Run("test with no customer in ctx", func(t *testing.T) {
+		order, err := qr.Order(context.Background(), "1")
+		assert.Equal(t, apperr.CodeUnauthenticated, apperr.CodeOf(err))
+		assert.Nil(t, order)
+	})
+
+	t.Run("test with invalid id", func(t *testing.T) {
+		order, err := qr.Order(ctx, "invalid")
+		assert.Equal(t, apperr.CodeValidation, apperr.CodeOf(err))
+		assert.Nil(t, order)
+	})
+
+	t.Run("test order of another customer", func(t *testing.T) {
+		st.EXPECT().GetCustomerOrder(1, 2).Times(1).Return(nil, apperr.NotFound("order not found"))
+
+		order, err := qr.Order(ctx, "2")
+		assert.Equal(t, apperr.CodeNotFound, apperr.CodeOf(err))
+		assert.Nil(t, order)
+	})
+
+	t.Run("test successful get", func(t *testing.T) {
+		st.EXPECT().GetCustomerOrder(1, 2).Times(1).Return(&models.Order{
+			Model:  gorm.Model{ID: 2, CreatedAt: time.Unix(2000, 0)},
+			Status: models.OrderCancelled,
+			History: []models.OrderHistory{
+				{Model: gorm.Model{CreatedAt: time.Unix(2000, 0)}, ToStatus: models.OrderPending, ActorID: 1},
+				{Model: gorm.Model{CreatedAt: time.Unix(3000, 0)}, FromStatus: models.OrderPending,
+					ToStatus: models.OrderCancelled, ActorID: 5, Reason: "out of stock"},
+			},
+		}, nil)
+
+		pending := model.OrderStatusPending
+		reason := "out of stock"
+
+		order, err := qr.Order(ctx, "2")
+		assert.NoError(t, err)
+		assert.Equal(t, &model.Order{
+			ID:        "2",
+			Status:    model.OrderStatusCancelled,
+			CreatedAt: 2000,
+			Items:     []*model.OrderItem{},
+			Timeline: []*model.OrderEvent{
+				{Status: model.OrderStatusPending, CreatedAt: 2000},
+				{From: &pending, Status: model.OrderStatusCancelled, Reason: &reason, CreatedAt: 3000},
+			},
+		}, order)
+	})
+}
+
+func TestQueryResolver_Products(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	st := storage.NewMockStorage(c)
+	sr := storage.NewMockSearcher(c)
+
+	r := queryResolver{&Resolver{
+		Storage:  st,
+		Searcher: sr,
+	}}
+
+	first := 2
+	sortBy := model.ProductSortFieldRelevance
+	direction := model.SortDirectionAsc
+
+	products := []*models.Product{
+		{
+			Model: gorm.Model{
+				ID: 1,
+			},
+			Name:  "test1",
+			Price: 10,
+		},
+		{
+			Model: gorm.Model{
+				ID: 2,
+			},
+			Name:  "test2",
+			Price: 20,
+		},
+	}
+
+	t.Run("test with no customer in ctx", func(t *testing.T) {
+		name := "product"
+		_, err := r.Products(context.Background(), &name, &first, nil, &sortBy, &direction, nil)
+
+		assert.Error(t, err)
+	})
+
+	t.Run("test when storage.SearchProducts returns an error", func(t *testing.T) {
+		customer := &models.Customer{
+			Model: gorm.Model{
+				ID: 1,
+			},
+			Email:    "test@test.com",
+			Password: "test",
+			Name:     "test",
+		}
+
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		st.EXPECT().SearchProducts(storage.SearchOptions{Limit: first, SortBy: storage.SortByRelevance}).
+			Times(1).Return(nil, 0, errors.New("failed"))
+
+		r, err := r.Products(ctx, nil, &first, nil, &sortBy, &direction, nil)
+		assert.Error(t, err)
+		assert.Nil(t, r)
+	})
+
+	t.Run("test successful search when name is null", func(t *testing.T) {
+		customer := &models.Customer{
+			Model: gorm.Model{
+				ID: 1,
+			},
+			Email:    "test@test.com",
+			Password: "test",
+			Name:     "test",
+		}
+
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		st.EXPECT().SearchProducts(storage.SearchOptions{Limit: first, SortBy: storage.SortByRelevance}).
+			Times(1).Return(products, len(products), nil)
+
+		r, err := r.Products(ctx, nil, &first, nil, &sortBy, &direction, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, len(products), len(r.Edges))
+		assert.Equal(t, len(products), r.TotalCount)
+		assert.False(t, r.PageInfo.HasNextPage)
+		assert.False(t, r.PageInfo.HasPreviousPage)
+
+		// storage loads the categories along with the products
+		for _, e := range r.Edges {
+			assert.NotNil(t, e.Node.LoadedCategories())
+		}
+	})
+
+	t.Run("test successful search when name length is zero", func(t *testing.T) {
+		customer := &models.Customer{
+			Model: gorm.Model{
+				ID: 1,
+			},
+			Email:    "test@test.com",
+			Password: "test",
+			Name:     "test",
+		}
+
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		name := ""
+
+		st.EXPECT().SearchProducts(storage.SearchOptions{Name: &name, Limit: first, SortBy: storage.SortByRelevance}).
+			Times(1).Return(products, len(products), nil)
+
+		r, err := r.Products(ctx, &name, &first, nil, &sortBy, &direction, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, len(products), len(r.Edges))
+	})
+
+	t.Run("test when searcher.SearchProducts returns an error", func(t *testing.T) {
+		customer := &models.Customer{
+			Model: gorm.Model{
+				ID: 1,
+			},
+			Email:    "test@test.com",
+			Password: "test",
+			Name:     "test",
+		}
+
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		name := "test"
+		sr.EXPECT().SearchProducts(storage.SearchOptions{Name: &name, Limit: first, SortBy: storage.SortByRelevance}).
+			Times(1).Return(nil, 0, errors.New("failed"))
+
+		r, err := r.Products(ctx, &name, &first, nil, &sortBy, &direction, nil)
+		assert.Error(t, err)
+		assert.Nil(t, r)
+	})
+
+	t.Run("test successful search when name is provided", func(t *testing.T) {
+		customer := &models.Customer{
+			Model: gorm.Model{
+				ID: 1,
+			},
+			Email:    "test@test.com",
+			Password: "test",
+			Name:     "test",
+		}
+
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		name := "test"
+
+		sr.EXPECT().SearchProducts(storage.SearchOptions{Name: &name, Limit: first, SortBy: storage.SortByRelevance}).
+			Times(1).Return(products, len(products), nil)
+
+		r, err := r.Products(ctx, &name, &first, nil, &sortBy, &direction, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, len(products), len(r.Edges))
+	})
+
+	t.Run("test search with cursor and sort", func(t *testing.T) {
+		customer := &models.Customer{
+			Model: gorm.Model{
+				ID: 1,
+			},
+			Email:    "test@test.com",
+			Password: "test",
+			Name:     "test",
+		}
+
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		name := "test"
+		after := encodeCursor(1)
+		sortBy := model.ProductSortFieldPrice
+		direction := model.SortDirectionDesc
+
+		sr.EXPECT().SearchProducts(storage.SearchOptions{
+			Name:       &name,
+			Offset:     2,
+			Limit:      first,
+			SortBy:     storage.SortByPrice,
+			Descending: true,
+		}).Times(1).Return(products, 5, nil)
+
+		r, err := r.Products(ctx, &name, &first, &after, &sortBy, &direction, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 5, r.TotalCount)
+		assert.True(t, r.PageInfo.HasNextPage)
+		assert.True(t, r.PageInfo.HasPreviousPage)
+		assert.Equal(t, encodeCursor(2), *r.PageInfo.StartCursor)
+		assert.Equal(t, encodeCursor(3), *r.PageInfo.EndCursor)
+	})
+
+	t.Run("test with invalid cursor", func(t *testing.T) {
+		customer := &models.Customer{
+			Model: gorm.Model{
+				ID: 1,
+			},
+			Email:    "test@test.com",
+			Password: "test",
+			Name:     "test",
+		}
+
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		after := "invalid"
+		_, err := r.Products(ctx, nil, &first, &after, &sortBy, &direction, nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("test search by category", func(t *testing.T) {
+		customer := &models.Customer{
+			Model: gorm.Model{
+				ID: 1,
+			},
+			Email:    "test@test.com",
+			Password: "test",
+			Name:     "test",
+		}
+
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		invalid := "Dairy Products"
+		_, err := r.Products(ctx, nil, &first, nil, &sortBy, &direction, &invalid)
+		assert.Equal(t, apperr.CodeValidation, apperr.CodeOf(err))
+
+		category := "dairy"
+		st.EXPECT().SearchProducts(storage.SearchOptions{Category: &category, Limit: first, SortBy: storage.SortByRelevance}).
+			Times(1).Return(products, len(products), nil)
+
+		r, err := r.Products(ctx, nil, &first, nil, &sortBy, &direction, &category)
+		assert.NoError(t, err)
+		assert.Equal(t, len(products), len(r.Edges))
+	})
+}
+
+func TestQueryResolver_ProductSearch(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	st := storage.NewMockStorage(c)
+	sr := storage.NewMockSearcher(c)
+
+	r := queryResolver{&Resolver{
+		Storage:  st,
+		Searcher: sr,
+	}}
+
+	customer := &models.Customer{
+		Model: gorm.Model{
+			ID: 1,
+		},
+		Email:    "test@test.com",
+		Password: "test",
+		Name:     "test",
+	}
+
+	first := 10
+	buckets := []int{5, 10}
+	text := "test"
+	minPrice := 5
+
+	t.Run("test with no customer in ctx", func(t *testing.T) {
+		_, err := r.ProductSearch(context.Background(), model.ProductSearch{Text: &text}, &first, nil, nil, nil, buckets)
+		assert.Error(t, err)
+	})
+
+	t.Run("test with invalid price range", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		maxPrice := 1
+		_, err := r.ProductSearch(ctx, model.ProductSearch{MinPrice: &minPrice, MaxPrice: &maxPrice}, &first, nil, nil, nil, buckets)
+		assert.Error(t, err)
+	})
+
+	t.Run("test with unsorted buckets", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		_, err := r.ProductSearch(ctx, model.ProductSearch{Text: &text}, &first, nil, nil, nil, []int{10, 5})
+		assert.Error(t, err)
+	})
+
+	t.Run("test when searcher.SearchProducts returns an error", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		sr.EXPECT().SearchProducts(gomock.Any()).Times(1).Return(nil, 0, errors.New("failed"))
+
+		res, err := r.ProductSearch(ctx, model.ProductSearch{Text: &text}, &first, nil, nil, nil, buckets)
+		assert.Error(t, err)
+		assert.Nil(t, res)
+	})
+
+	t.Run("test when searcher.PriceFacets returns an error", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		sr.EXPECT().SearchProducts(gomock.Any()).Times(1).Return([]*models.Product{}, 0, nil)
+		sr.EXPECT().PriceFacets(gomock.Any(), buckets).Times(1).Return(nil, errors.New("failed"))
+
+		res, err := r.ProductSearch(ctx, model.ProductSearch{Text: &text}, &first, nil, nil, nil, buckets)
+		assert.Error(t, err)
+		assert.Nil(t, res)
+	})
+
+	t.Run("test when searcher.SpellCheck returns an error", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		sr.EXPECT().SearchProducts(gomock.Any()).Times(1).Return([]*models.Product{}, 0, nil)
+		sr.EXPECT().PriceFacets(gomock.Any(), buckets).Times(1).Return([]*storage.PriceFacet{}, nil)
+		sr.EXPECT().SpellCheck(text, maxSpellSuggestions).Times(1).Return(nil, errors.New("failed"))
+
+		res, err := r.ProductSearch(ctx, model.ProductSearch{Text: &text}, &first, nil, nil, nil, buckets)
+		assert.Error(t, err)
+		assert.Nil(t, res)
+	})
+
+	t.Run("test successful search", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		products := []*models.Product{
+			{
+				Model: gorm.Model{
+					ID: 1,
+				},
+				Name:  "test1",
+				Price: 6,
+			},
+		}
+
+		filters := []storage.NumericFilter{{Field: storage.PriceField, Min: &minPrice}}
+
+		sr.EXPECT().SearchProducts(storage.SearchOptions{
+			Name:    &text,
+			Filters: filters,
+			Limit:   first,
+			SortBy:  storage.SortByRelevance,
+		}).Times(1).Return(products, len(products), nil)
+
+		facets := []*storage.PriceFacet{
+			{Max: &buckets[0], Count: 2},
+			{Min: &buckets[0], Max: &buckets[1], Count: 1},
+			{Min: &buckets[1], Count: 0},
+		}
+
+		// price facets are counted regardless of the selected price range
+		sr.EXPECT().PriceFacets(storage.SearchOptions{Name: &text}, buckets).Times(1).Return(facets, nil)
+
+		res, err := r.ProductSearch(ctx, model.ProductSearch{Text: &text, MinPrice: &minPrice}, &first, nil, nil, nil, buckets)
+		assert.NoError(t, err)
+		assert.Equal(t, len(products), res.Products.TotalCount)
+		assert.Equal(t, len(facets), len(res.PriceFacets))
+		assert.Equal(t, 2, res.PriceFacets[0].Count)
+		assert.Nil(t, res.PriceFacets[0].Min)
+		assert.Equal(t, buckets[1], *res.PriceFacets[2].Min)
+		assert.Nil(t, res.Suggestions)
+	})
+
+	t.Run("test fuzzy search with no hits returns suggestions", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		text := "tomatto"
+		fuzzy := true
+
+		sr.EXPECT().SearchProducts(storage.SearchOptions{
+			Name:   &text,
+			Fuzzy:  true,
+			Limit:  first,
+			SortBy: storage.SortByRelevance,
+		}).Times(1).Return([]*models.Product{}, 0, nil)
+		sr.EXPECT().PriceFacets(storage.SearchOptions{Name: &text, Fuzzy: true}, buckets).
+			Times(1).Return([]*storage.PriceFacet{}, nil)
+		sr.EXPECT().SpellCheck(text, maxSpellSuggestions).Times(1).Return([]string{"tomato"}, nil)
+
+		res, err := r.ProductSearch(ctx, model.ProductSearch{Text: &text, Fuzzy: &fuzzy}, &first, nil, nil, nil, buckets)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, res.Products.TotalCount)
+		assert.Equal(t, []string{"tomato"}, res.Suggestions)
+	})
+
+	t.Run("test search in stock products of a category", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		inStock := true
+		category := "dairy"
+
+		sr.EXPECT().SearchProducts(storage.SearchOptions{
+			Name:     &text,
+			InStock:  &inStock,
+			Category: &category,
+			Limit:    first,
+			SortBy:   storage.SortByRelevance,
+		}).Times(1).Return([]*models.Product{{Model: gorm.Model{ID: 1}, Name: "test1", Price: 6, Stock: 2}}, 1, nil)
+		sr.EXPECT().PriceFacets(storage.SearchOptions{Name: &text, InStock: &inStock, Category: &category}, buckets).
+			Times(1).Return([]*storage.PriceFacet{}, nil)
+
+		input := model.ProductSearch{Text: &text, InStock: &inStock, Category: &category}
+		res, err := r.ProductSearch(ctx, input, &first, nil, nil, nil, buckets)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, res.Products.TotalCount)
+		assert.True(t, res.Products.Edges[0].Node.InStock)
+	})
+}
+
+func TestQueryResolver_SuggestProducts(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	st := storage.NewMockStorage(c)
+	sr := storage.NewMockSearcher(c)
+
+	r := queryResolver{&Resolver{
+		Storage:  st,
+		Searcher: sr,
+	}}
+
+	customer := &models.Customer{
+		Model: gorm.Model{
+			ID: 1,
+		},
+		Email:    "test@test.com",
+		Password: "test",
+		Name:     "test",
+	}
+
+	t.Run("test with no customer in ctx", func(t *testing.T) {
+		_, err := r.SuggestProducts(context.Background(), "to", nil, nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("test with out of range limit", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		limit := maxSuggestions + 1
+		_, err := r.SuggestProducts(ctx, "to", &limit, nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("test when searcher.SuggestProducts returns an error", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		sr.EXPECT().SuggestProducts("to", defaultSuggestions, false).Times(1).Return(nil, errors.New("failed"))
+
+		res, err := r.SuggestProducts(ctx, "to", nil, nil)
+		assert.Error(t, err)
+		assert.Nil(t, res)
+	})
+
+	t.Run("test successful fuzzy suggest", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		limit := 2
+		fuzzy := true
+
+		sr.EXPECT().SuggestProducts("tp", limit, true).Times(1).Return([]*storage.Suggestion{
+			{Term: "Tomato", ProductID: 7},
+			{Term: "Potato", ProductID: 6},
+		}, nil)
+
+		res, err := r.SuggestProducts(ctx, "tp", &limit, &fuzzy)
+		assert.NoError(t, err)
+		assert.Equal(t, []*model.ProductSuggestion{
+			{Text: "Tomato", ProductID: "7"},
+			{Text: "Potato", ProductID: "6"},
+		}, res)
+	})
+}
+
+func TestMutationResolver_UpdateProduct(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	st := storage.NewMockStorage(c)
+	sr := storage.NewMockSearcher(c)
+
+	mr := mutationResolver{&Resolver{
+		Storage:  st,
+		Searcher: sr,
+	}}
+
+	name := "new name"
+	price := 20
+
+	t.Run("test with invalid input", func(t *testing.T) {
+		empty := ""
+		negative := -1
+
+		cases := []model.UpdateProduct{
+			{ID: "invalid", Name: &name},
+			{ID: "1", Name: &empty},
+			{ID: "1", Price: &negative},
+		}
+
+		for _, tc := range cases {
+			_, err := mr.UpdateProduct(context.Background(), tc)
+			assert.Error(t, err)
+		}
+	})
+
+	t.Run("test when storage.GetProduct returns an error", func(t *testing.T) {
+		st.EXPECT().GetProduct(1).Times(1).Return(nil, errors.New("not found"))
+
+		_, err := mr.UpdateProduct(context.Background(), model.UpdateProduct{ID: "1", Name: &name})
+		assert.Error(t, err)
+	})
+
+	t.Run("test when storage.UpdateProduct returns an error", func(t *testing.T) {
+		st.EXPECT().GetProduct(1).Times(1).Return(&models.Product{Model: gorm.Model{ID: 1}, Name: "old", Price: 10}, nil)
+		st.EXPECT().UpdateProduct(gomock.Any()).Times(1).Return(errors.New("failed"))
+
+		_, err := mr.UpdateProduct(context.Background(), model.UpdateProduct{ID: "1", Name: &name})
+		assert.Error(t, err)
+	})
+
+	t.Run("test successful update", func(t *testing.T) {
+		st.EXPECT().GetProduct(1).Times(1).Return(&models.Product{Model: gorm.Model{ID: 1}, Name: "old", Price: 10}, nil)
+		st.EXPECT().UpdateProduct(&models.Product{Model: gorm.Model{ID: 1}, Name: "old", Price: price}).
+			Times(1).Return(nil)
+
+		p, err := mr.UpdateProduct(context.Background(), model.UpdateProduct{ID: "1", Price: &price})
+		assert.NoError(t, err)
+		assert.Equal(t, &model.Product{ID: "1", Name: "old", Price: price}, p)
+	})
+}
+
+func TestMutationResolver_AdjustProductStock(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	st := storage.NewMockStorage(c)
+
+	mr := mutationResolver{&Resolver{
+		Storage: st,
+	}}
+
+	t.Run("test with invalid id", func(t *testing.T) {
+		_, err := mr.AdjustProductStock(context.Background(), "invalid", 1)
+		assert.Error(t, err)
+	})
+
+	t.Run("test when stock goes negative", func(t *testing.T) {
+		st.EXPECT().AdjustProductStock(1, -5).Times(1).Return(nil, storage.ErrNegativeStock)
+
+		_, err := mr.AdjustProductStock(context.Background(), "1", -5)
+		assert.Equal(t, storage.ErrNegativeStock, err)
+	})
+
+	t.Run("test successful adjustment", func(t *testing.T) {
+		st.EXPECT().AdjustProductStock(1, 5).Times(1).
+			Return(&models.Product{Model: gorm.Model{ID: 1}, Name: "Milk", Price: 3, Stock: 7}, nil)
+
+		p, err := mr.AdjustProductStock(context.Background(), "1", 5)
+		assert.NoError(t, err)
+		assert.Equal(t, &model.Product{ID: "1", Name: "Milk", Price: 3, Stock: 7, InStock: true}, p)
+	})
+}
+
+func TestMutationResolver_CreateCategory(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	st := storage.NewMockStorage(c)
+
+	mr := mutationResolver{&Resolver{
+		Storage: st,
+	}}
+
+	parentID := "1"
+
+	t.Run("test with invalid input", func(t *testing.T) {
+		invalid := "invalid"
+
+		cases := []model.NewCategory{
+			{Name: " ", Slug: "dairy"},
+			{Name: "Dairy", Slug: ""},
+			{Name: "Dairy", Slug: "Dairy"},
+			{Name: "Dairy", Slug: "dairy--products"},
+			{Name: "Dairy", Slug: "-dairy"},
+			{Name: "Dairy", Slug: "food/dairy"},
+			{Name: "Dairy", Slug: "dairy", ParentID: &invalid},
+		}
+
+		for _, tc := range cases {
+			_, err := mr.CreateCategory(context.Background(), tc)
+			assert.Equal(t, apperr.CodeValidation, apperr.CodeOf(err))
+		}
+	})
+
+	t.Run("test when storage.CreateCategory returns an error", func(t *testing.T) {
+		st.EXPECT().CreateCategory(gomock.Any()).Times(1).Return(storage.ErrCategorySlugTaken)
+
+		_, err := mr.CreateCategory(context.Background(), model.NewCategory{Name: "Dairy", Slug: "dairy"})
+		assert.Equal(t, storage.ErrCategorySlugTaken, err)
+	})
+
+	t.Run("test successful create", func(t *testing.T) {
+		parent := uint(1)
+
+		st.EXPECT().CreateCategory(&models.Category{Name: "Dairy", Slug: "dairy", ParentID: &parent}).Times(1).
+			DoAndReturn(func(c *models.Category) error {
+				c.ID = 2
+				c.Path = "food/dairy"
+				return nil
+			})
+
+		category, err := mr.CreateCategory(context.Background(), model.NewCategory{
+			Name:     " Dairy ",
+			Slug:     "dairy",
+			ParentID: &parentID,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, &model.Category{ID: "2", Name: "Dairy", Slug: "dairy", Path: "food/dairy", ParentID: &parentID}, category)
+	})
+}
+
+func TestMutationResolver_SetProductCategories(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	st := storage.NewMockStorage(c)
+
+	mr := mutationResolver{&Resolver{
+		Storage: st,
+	}}
+
+	t.Run("test with invalid ids", func(t *testing.T) {
+		_, err := mr.SetProductCategories(context.Background(), "invalid", []string{"1"})
+		assert.Error(t, err)
+
+		_, err = mr.SetProductCategories(context.Background(), "1", []string{"1", "invalid"})
+		assert.Error(t, err)
+	})
+
+	t.Run("test when storage.SetProductCategories returns an error", func(t *testing.T) {
+		st.EXPECT().SetProductCategories(1, []int{1000}).Times(1).Return(nil, apperr.NotFound("category not found"))
+
+		_, err := mr.SetProductCategories(context.Background(), "1", []string{"1000"})
+		assert.Equal(t, apperr.CodeNotFound, apperr.CodeOf(err))
+	})
+
+	t.Run("test successful set", func(t *testing.T) {
+		st.EXPECT().SetProductCategories(1, []int{2, 3}).Times(1).
+			Return(&models.Product{Model: gorm.Model{ID: 1}, Name: "Milk", Price: 3}, nil)
+
+		p, err := mr.SetProductCategories(context.Background(), "1", []string{"2", "3"})
+		assert.NoError(t, err)
+		assert.Equal(t, &model.Product{ID: "1", Name: "Milk", Price: 3}, p)
+	})
+}
+
+func TestQueryResolver_Categories(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	st := storage.NewMockStorage(c)
+
+	r := queryResolver{&Resolver{
+		Storage: st,
+	}}
+
+	ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, &models.Customer{Model: gorm.Model{ID: 1}})
+
+	t.Run("test with no customer in ctx", func(t *testing.T) {
+		_, err := r.Categories(context.Background())
+		assert.Error(t, err)
+	})
+
+	t.Run("test when storage.GetCategories returns an error", func(t *testing.T) {
+		st.EXPECT().GetCategories().Times(1).Return(nil, errors.New("failed"))
+
+		_, err := r.Categories(ctx)
+		assert.Error(t, err)
+	})
 
-		st.EXPECT().RemoveFromCart(int(customer.ID), 1).
-			Times(1).Return(nil)
+	t.Run("test successful query", func(t *testing.T) {
+		parent := uint(1)
+		st.EXPECT().GetCategories().Times(1).Return([]*models.Category{
+			{Model: gorm.Model{ID: 1}, Name: "Food", Slug: "food", Path: "food"},
+			{Model: gorm.Model{ID: 2}, Name: "Dairy", Slug: "dairy", Path: "food/dairy", ParentID: &parent},
+		}, nil)
 
-		ret := &model.Cart{
-			Products: []*model.ProductInCart{
-				{
-					Product: &model.Product{
-						ID:    "1",
-						Name:  "test",
-						Price: 1000,
-					},
-					Quantity: 1,
-				},
-			},
-		}
+		categories, err := r.Categories(ctx)
+		assert.NoError(t, err)
 
-		var cartItems []*models.CartItem
-		for _, p := range ret.Products {
-			cartItems = append(cartItems, &models.CartItem{
-				CustomerID: 0,
-				Customer:   models.Customer{},
-				Quantity:   p.Quantity,
-				ProductID:  1,
-				Product: models.Product{
-					Model: gorm.Model{
-						ID: 1,
-					},
-					Name:  p.Product.Name,
-					Price: p.Product.Price,
-				},
-			})
-		}
+		parentID := "1"
+		assert.Equal(t, []*model.Category{
+			{ID: "1", Name: "Food", Slug: "food", Path: "food"},
+			{ID: "2", Name: "Dairy", Slug: "dairy", Path: "food/dairy", ParentID: &parentID},
+		}, categories)
+	})
+}
 
-		st.EXPECT().GetCartItems(int(customer.ID)).
-			Times(1).Return(cartItems, nil)
+func TestProductResolver_Categories(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
 
-		items, err := mr.RemoveFromCart(ctx, "1")
+	st := storage.NewMockStorage(c)
+
+	r := productResolver{&Resolver{
+		Storage: st,
+	}}
+
+	t.Run("test when storage.GetProductCategories returns an error", func(t *testing.T) {
+		st.EXPECT().GetProductCategories(1).Times(1).Return(nil, errors.New("failed"))
+
+		_, err := r.Categories(context.Background(), &model.Product{ID: "1"})
+		assert.Error(t, err)
+	})
+
+	t.Run("test successful query", func(t *testing.T) {
+		st.EXPECT().GetProductCategories(1).Times(1).Return([]*models.Category{
+			{Model: gorm.Model{ID: 3}, Name: "Drinks", Slug: "drinks", Path: "drinks"},
+		}, nil)
+
+		categories, err := r.Categories(context.Background(), &model.Product{ID: "1"})
 		assert.NoError(t, err)
-		assert.Equal(t, ret, items)
+		assert.Equal(t, []*model.Category{{ID: "3", Name: "Drinks", Slug: "drinks", Path: "drinks"}}, categories)
+	})
+
+	t.Run("test with loaded categories", func(t *testing.T) {
+		loaded := []*model.Category{{ID: "3", Name: "Drinks", Slug: "drinks", Path: "drinks"}}
+
+		categories, err := r.Categories(context.Background(), (&model.Product{ID: "1"}).WithCategories(loaded))
+		assert.NoError(t, err)
+		assert.Equal(t, loaded, categories)
+
+		categories, err = r.Categories(context.Background(), (&model.Product{ID: "1"}).WithCategories([]*model.Category{}))
+		assert.NoError(t, err)
+		assert.Empty(t, categories)
 	})
 }
 
-func TestQueryResolver_Products(t *testing.T) {
+func TestMutationResolver_DeleteProduct(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	st := storage.NewMockStorage(c)
+	sr := storage.NewMockSearcher(c)
+
+	mr := mutationResolver{&Resolver{
+		Storage:  st,
+		Searcher: sr,
+	}}
+
+	t.Run("test with invalid product id", func(t *testing.T) {
+		ok, err := mr.DeleteProduct(context.Background(), "invalid")
+		assert.Error(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("test when storage.DeleteProduct returns an error", func(t *testing.T) {
+		st.EXPECT().DeleteProduct(1).Times(1).Return(errors.New("failed"))
+
+		ok, err := mr.DeleteProduct(context.Background(), "1")
+		assert.Error(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("test successful delete", func(t *testing.T) {
+		st.EXPECT().DeleteProduct(1).Times(1).Return(nil)
+
+		ok, err := mr.DeleteProduct(context.Background(), "1")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+}
+
+func TestQueryResolver_Product(t *testing.T) {
 	c := gomock.NewController(t)
 	defer c.Finish()
 
@@ -421,161 +2937,337 @@ func TestQueryResolver_Products(t *testing.T) {
 		Searcher: sr,
 	}}
 
-	t.Run("test with no customer in ctx", func(t *testing.T) {
-		name := "product"
-		_, err := r.Products(context.Background(), &name)
+	customer := &models.Customer{
+		Model: gorm.Model{
+			ID: 1,
+		},
+		Email:    "test@test.com",
+		Password: "test",
+		Name:     "test",
+	}
 
+	t.Run("test with no customer in ctx", func(t *testing.T) {
+		_, err := r.Product(context.Background(), "1")
 		assert.Error(t, err)
 	})
 
-	t.Run("test when storage.SearchProducts returns an error", func(t *testing.T) {
-		customer := &models.Customer{
-			Model: gorm.Model{
-				ID: 1,
-			},
-			Email:    "test@test.com",
-			Password: "test",
-			Name:     "test",
-		}
+	t.Run("test with invalid product id", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		_, err := r.Product(ctx, "invalid")
+		assert.Error(t, err)
+	})
 
+	t.Run("test when storage.GetProduct returns an error", func(t *testing.T) {
 		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
 
-		st.EXPECT().SearchProducts(nil).Times(1).Return(nil, errors.New("failed"))
+		st.EXPECT().GetProduct(1).Times(1).Return(nil, errors.New("not found"))
 
-		r, err := r.Products(ctx, nil)
+		p, err := r.Product(ctx, "1")
 		assert.Error(t, err)
-		assert.Nil(t, r)
+		assert.Nil(t, p)
 	})
 
-	t.Run("test successful search when name is null", func(t *testing.T) {
+	t.Run("test successful get", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+		st.EXPECT().GetProduct(1).Times(1).Return(&models.Product{Model: gorm.Model{ID: 1}, Name: "Milk", Price: 1}, nil)
+
+		p, err := r.Product(ctx, "1")
+		assert.NoError(t, err)
+		assert.Equal(t, &model.Product{ID: "1", Name: "Milk", Price: 1}, p)
+	})
+}
+
+func TestQueryResolver_Me(t *testing.T) {
+	r := queryResolver{&Resolver{}}
+
+	t.Run("test with no customer in ctx", func(t *testing.T) {
+		me, err := r.Me(context.Background())
+		assert.NoError(t, err)
+		assert.Nil(t, me)
+	})
+
+	t.Run("test with customer in ctx", func(t *testing.T) {
 		customer := &models.Customer{
 			Model: gorm.Model{
 				ID: 1,
 			},
 			Email:    "test@test.com",
-			Password: "test",
+			Password: "hash",
 			Name:     "test",
+			Role:     models.RoleStaff,
 		}
-
 		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
 
-		products := []*models.Product{
-			{
-				Model: gorm.Model{
-					ID: 1,
-				},
-				Name:  "test1",
-				Price: 10,
-			},
-			{
-				Model: gorm.Model{
-					ID: 2,
-				},
-				Name:  "test2",
-				Price: 20,
+		me, err := r.Me(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, &model.Customer{ID: "1", Email: "test@test.com", Name: "test", Role: model.RoleStaff}, me)
+	})
+}
+
+func TestCustomerResolver_Cart(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	st := storage.NewMockStorage(c)
+
+	r := customerResolver{&Resolver{
+		Storage: st,
+	}}
+
+	customer := &models.Customer{
+		Model: gorm.Model{
+			ID: 1,
+		},
+		Email: "test@test.com",
+		Name:  "test",
+	}
+	ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+
+	t.Run("test with no customer in ctx", func(t *testing.T) {
+		cart, err := r.Cart(context.Background(), &model.Customer{ID: "1"})
+		assert.Equal(t, apperr.CodeUnauthenticated, apperr.CodeOf(err))
+		assert.Nil(t, cart)
+	})
+
+	t.Run("test cart of another customer", func(t *testing.T) {
+		cart, err := r.Cart(ctx, &model.Customer{ID: "2"})
+		assert.Equal(t, apperr.CodeForbidden, apperr.CodeOf(err))
+		assert.Nil(t, cart)
+	})
+
+	t.Run("test when storage.GetCartItems returns an error", func(t *testing.T) {
+		st.EXPECT().GetCartItems(1).Times(1).Return(nil, errors.New("failed"))
+
+		cart, err := r.Cart(ctx, &model.Customer{ID: "1"})
+		assert.Error(t, err)
+		assert.Nil(t, cart)
+	})
+
+	t.Run("test successful get", func(t *testing.T) {
+		st.EXPECT().GetCartItems(1).Times(1).Return([]*models.CartItem{
+			{ProductID: 2, Product: models.Product{Name: "Milk", Price: 3}, Quantity: 4},
+		}, nil)
+
+		cart, err := r.Cart(ctx, &model.Customer{ID: "1"})
+		assert.NoError(t, err)
+		assert.Equal(t, &model.Cart{
+			Products: []*model.ProductInCart{
+				{Product: &model.Product{ID: "2", Name: "Milk", Price: 3}, Quantity: 4, LineTotal: 12},
 			},
+			ItemCount:  4,
+			Subtotal:   12,
+			GrandTotal: 12,
+		}, cart)
+	})
+}
+
+func TestMutationResolver_UpdateProfile(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	st := storage.NewMockStorage(c)
+	ml := mailer.NewLocalMailer(zap.NewNop())
+	dl := auth.NewMemoryDenylist()
+
+	mr := mutationResolver{&Resolver{
+		Storage:  st,
+		Mailer:   ml,
+		Denylist: dl,
+		Limiter:  auth.NewLoginLimiter(auth.NewMemoryAttemptStore(), zap.NewNop()),
+		Logger:   zap.NewNop(),
+	}}
+
+	now := time.Now()
+	hash, _ := auth.HashPassword("password")
+	customer := &models.Customer{
+		Model: gorm.Model{
+			ID: 1,
+		},
+		Email:           "test@test.com",
+		Name:            "test",
+		Password:        hash,
+		EmailVerifiedAt: &now,
+	}
+	claims := &auth.Claims{ID: "token", SessionID: "session", CustomerID: 1, ExpiresAt: time.Now().Add(time.Minute)}
+
+	ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+	ctx = context.WithValue(ctx, auth.ClaimsContextKey{}, claims)
+
+	str := func(s string) *string {
+		return &s
+	}
+
+	t.Run("test with no customer in ctx", func(t *testing.T) {
+		res, err := mr.UpdateProfile(context.Background(), model.UpdateProfile{Name: str("new")})
+		assert.Equal(t, apperr.CodeUnauthenticated, apperr.CodeOf(err))
+		assert.Nil(t, res)
+	})
+
+	t.Run("test with invalid input", func(t *testing.T) {
+		cases := []model.UpdateProfile{
+			{Name: str("a")},
+			{Email: str("invalid")},
+		}
+
+		for _, input := range cases {
+			res, err := mr.UpdateProfile(ctx, input)
+			assert.Equal(t, apperr.CodeValidation, apperr.CodeOf(err))
+			assert.Nil(t, res)
 		}
+	})
 
-		st.EXPECT().SearchProducts(nil).Times(1).Return(products, nil)
+	t.Run("test with taken email", func(t *testing.T) {
+		st.EXPECT().UpdateCustomerProfile(1, "test", "taken@test.com").Times(1).Return(storage.ErrEmailTaken)
 
-		r, err := r.Products(ctx, nil)
+		res, err := mr.UpdateProfile(ctx, model.UpdateProfile{Email: str("taken@test.com"), CurrentPassword: str("password")})
+		assert.Equal(t, apperr.Code("EMAIL_TAKEN"), apperr.CodeOf(err))
+		assert.Nil(t, res)
+	})
+
+	t.Run("test updating name", func(t *testing.T) {
+		st.EXPECT().UpdateCustomerProfile(1, "new name", "test@test.com").Times(1).Return(nil)
+
+		res, err := mr.UpdateProfile(ctx, model.UpdateProfile{Name: str(" new name "), Email: str("Test@test.com")})
 		assert.NoError(t, err)
-		assert.Equal(t, len(products), len(r))
+		assert.Equal(t, "new name", res.Name)
+		assert.True(t, res.EmailVerified)
+		assert.Equal(t, "test", customer.Name)
+		assert.Empty(t, ml.Sent())
 	})
 
-	t.Run("test successful search when name length is zero", func(t *testing.T) {
-		customer := &models.Customer{
-			Model: gorm.Model{
-				ID: 1,
-			},
-			Email:    "test@test.com",
-			Password: "test",
-			Name:     "test",
+	t.Run("test updating email without current password", func(t *testing.T) {
+		cases := []*string{nil, str("wrong")}
+
+		for _, password := range cases {
+			res, err := mr.UpdateProfile(ctx, model.UpdateProfile{Email: str("new@test.com"), CurrentPassword: password})
+			assert.Equal(t, apperr.CodeValidation, apperr.CodeOf(err))
+			assert.Nil(t, res)
 		}
+	})
 
-		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+	t.Run("test updating email", func(t *testing.T) {
+		st.EXPECT().UpdateCustomerProfile(1, "test", "new@test.com").Times(1).Return(nil)
+		st.EXPECT().RevokeCustomerRefreshTokens(1).Times(1).Return([]string{"session", "other"}, nil)
+		st.EXPECT().CreateActionToken(gomock.Any()).Times(1).DoAndReturn(func(at *models.ActionToken) error {
+			assert.Equal(t, models.PurposeEmailVerification, at.Purpose)
+			return nil
+		})
 
-		products := []*models.Product{
-			{
-				Model: gorm.Model{
-					ID: 1,
-				},
-				Name:  "test1",
-				Price: 10,
-			},
-			{
-				Model: gorm.Model{
-					ID: 2,
-				},
-				Name:  "test2",
-				Price: 20,
-			},
+		res, err := mr.UpdateProfile(ctx, model.UpdateProfile{Email: str("new@test.com"), CurrentPassword: str("password")})
+		assert.NoError(t, err)
+		assert.Equal(t, "new@test.com", res.Email)
+		assert.False(t, res.EmailVerified)
+
+		for _, id := range []string{"token", "session", "other"} {
+			revoked, _ := dl.IsRevoked(id)
+			assert.True(t, revoked)
 		}
 
-		name := ""
+		_, ok := ml.Last("new@test.com")
+		assert.True(t, ok)
+	})
+
+	t.Run("test updating email with two-factor authentication", func(t *testing.T) {
+		secret, _ := auth.NewTotpSecret()
+		totpCustomer := *customer
+		totpCustomer.TotpSecret = secret
+		totpCustomer.TotpConfirmedAt = &now
+
+		ctx := context.WithValue(ctx, auth.JwtContextKey{}, &totpCustomer)
 
-		st.EXPECT().SearchProducts(&name).Times(1).Return(products, nil)
+		res, err := mr.UpdateProfile(ctx, model.UpdateProfile{Email: str("new@test.com"), CurrentPassword: str("password")})
+		assert.Equal(t, apperr.CodeValidation, apperr.CodeOf(err))
+		assert.Nil(t, res)
 
-		r, err := r.Products(ctx, &name)
+		st.EXPECT().UseRecoveryCode(1, auth.HashRecoveryCode("wrong")).Times(1).Return(storage.ErrInvalidRecoveryCode)
+
+		res, err = mr.UpdateProfile(ctx, model.UpdateProfile{Email: str("new@test.com"), CurrentPassword: str("password"), TotpCode: str("wrong")})
+		assert.EqualError(t, err, "invalid two-factor code")
+		assert.Nil(t, res)
+
+		code, _ := auth.TotpCode(secret, time.Now())
+		st.EXPECT().UseTotpStep(1, gomock.Any()).Times(1).Return(nil)
+		st.EXPECT().UpdateCustomerProfile(1, "test", "new@test.com").Times(1).Return(nil)
+		st.EXPECT().RevokeCustomerRefreshTokens(1).Times(1).Return(nil, nil)
+		st.EXPECT().CreateActionToken(gomock.Any()).Times(1).Return(nil)
+
+		res, err = mr.UpdateProfile(ctx, model.UpdateProfile{Email: str("new@test.com"), CurrentPassword: str("password"), TotpCode: str(code)})
 		assert.NoError(t, err)
-		assert.Equal(t, len(products), len(r))
+		assert.Equal(t, "new@test.com", res.Email)
 	})
+}
 
-	t.Run("test when searcher.SearchProducts returns an error", func(t *testing.T) {
-		customer := &models.Customer{
-			Model: gorm.Model{
-				ID: 1,
-			},
-			Email:    "test@test.com",
-			Password: "test",
-			Name:     "test",
-		}
+func TestMutationResolver_ChangePassword(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
 
-		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+	st := storage.NewMockStorage(c)
+	dl := auth.NewMemoryDenylist()
 
-		name := "test"
-		sr.EXPECT().SearchProducts(&name).Times(1).Return(nil, errors.New("failed"))
+	key, _ := auth.NewHMACKey("test", "HS256", []byte("secret"))
+	keys, _ := auth.NewKeySet(key)
 
-		r, err := r.Products(ctx, &name)
-		assert.Error(t, err)
-		assert.Nil(t, r)
+	mr := mutationResolver{&Resolver{
+		Storage:  st,
+		Keys:     keys,
+		Denylist: dl,
+		Limiter:  auth.NewLoginLimiter(auth.NewMemoryAttemptStore(), zap.NewNop()),
+
+		PasswordPolicy: auth.DefaultPasswordPolicy,
+	}}
+
+	hash, _ := auth.HashPassword("password")
+	customer := &models.Customer{
+		Model: gorm.Model{
+			ID: 1,
+		},
+		Email:    "test@test.com",
+		Password: hash,
+	}
+	claims := &auth.Claims{ID: "token", SessionID: "session", CustomerID: 1, ExpiresAt: time.Now().Add(time.Minute), MFA: true}
+
+	ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+	ctx = context.WithValue(ctx, auth.ClaimsContextKey{}, claims)
+
+	t.Run("test with no customer in ctx", func(t *testing.T) {
+		payload, err := mr.ChangePassword(context.Background(), "password", "new-password")
+		assert.Equal(t, apperr.CodeUnauthenticated, apperr.CodeOf(err))
+		assert.Nil(t, payload)
 	})
 
-	t.Run("test successful search when name is provided", func(t *testing.T) {
-		customer := &models.Customer{
-			Model: gorm.Model{
-				ID: 1,
-			},
-			Email:    "test@test.com",
-			Password: "test",
-			Name:     "test",
-		}
+	t.Run("test with wrong current password", func(t *testing.T) {
+		payload, err := mr.ChangePassword(ctx, "wrong", "new-password")
+		assert.Equal(t, apperr.CodeValidation, apperr.CodeOf(err))
+		assert.Nil(t, payload)
+	})
 
-		ctx := context.WithValue(context.Background(), auth.JwtContextKey{}, customer)
+	t.Run("test with weak new password", func(t *testing.T) {
+		payload, err := mr.ChangePassword(ctx, "password", "short")
+		assert.Equal(t, apperr.CodeValidation, apperr.CodeOf(err))
+		assert.Nil(t, payload)
+	})
 
-		products := []*models.Product{
-			{
-				Model: gorm.Model{
-					ID: 1,
-				},
-				Name:  "test1",
-				Price: 10,
-			},
-			{
-				Model: gorm.Model{
-					ID: 2,
-				},
-				Name:  "test2",
-				Price: 20,
-			},
-		}
+	t.Run("test successful change", func(t *testing.T) {
+		st.EXPECT().SetCustomerPassword(1, gomock.Any()).Times(1).DoAndReturn(func(id int, h string) error {
+			assert.True(t, auth.CheckPasswordHash("new-password", h))
+			return nil
+		})
+		st.EXPECT().RevokeCustomerRefreshTokens(1).Times(1).Return([]string{"session", "other"}, nil)
+		st.EXPECT().CreateRefreshToken(gomock.Any()).Times(1).Return(nil)
 
-		name := "test"
+		payload, err := mr.ChangePassword(ctx, "password", "new-password")
+		assert.NoError(t, err)
 
-		sr.EXPECT().SearchProducts(&name).Times(1).Return(products, nil)
+		for _, id := range []string{"token", "session", "other"} {
+			revoked, _ := dl.IsRevoked(id)
+			assert.True(t, revoked)
+		}
 
-		r, err := r.Products(ctx, &name)
+		newClaims, err := keys.ParseToken(payload.AccessToken)
 		assert.NoError(t, err)
-		assert.Equal(t, len(products), len(r))
+		assert.NotEqual(t, "session", newClaims.SessionID)
+		assert.True(t, newClaims.MFA)
 	})
 }
@@ -0,0 +1,96 @@
+package graph
+
+import (
+	"fmt"
+
+	"github.com/moeen/redisearch-shopping/graph/model"
+	"github.com/moeen/redisearch-shopping/internal/apperr"
+	"github.com/moeen/redisearch-shopping/internal/storage"
+)
+
+const (
+	// defaultSuggestions is the number of suggestions returned when limit is not provided
+	defaultSuggestions = 5
+
+	// maxSuggestions is the maximum number of suggestions which can be requested
+	maxSuggestions = 20
+
+	// maxSpellSuggestions is the number of "did you mean" texts returned for searches with no hits
+	maxSpellSuggestions = 3
+
+	// maxPriceBuckets is the maximum number of price bucket boundaries, each one grows the aggregate query
+	maxPriceBuckets = 20
+)
+
+// searchFilters converts the filters of a product search input to the storage ones
+func searchFilters(input model.ProductSearch) ([]storage.NumericFilter, error) {
+	var filters []storage.NumericFilter
+
+	if input.MinPrice != nil || input.MaxPrice != nil {
+		filters = append(filters, storage.NumericFilter{
+			Field: storage.PriceField,
+			Min:   input.MinPrice,
+			Max:   input.MaxPrice,
+		})
+	}
+
+	for _, f := range input.NumericFilters {
+		field, err := numericField(f.Field)
+		if err != nil {
+			return nil, err
+		}
+
+		filters = append(filters, storage.NumericFilter{
+			Field: field,
+			Min:   f.Min,
+			Max:   f.Max,
+		})
+	}
+
+	for _, f := range filters {
+		if f.Min != nil && f.Max != nil && *f.Min > *f.Max {
+			return nil, apperr.Validation(fmt.Sprintf("invalid %s range: min is greater than max", f.Field))
+		}
+	}
+
+	return filters, nil
+}
+
+// numericField converts the GraphQL numeric field to the storage one
+func numericField(field model.NumericField) (storage.NumericField, error) {
+	switch field {
+	case model.NumericFieldPrice:
+		return storage.PriceField, nil
+	default:
+		return "", fmt.Errorf("unknown numeric field: %s", field)
+	}
+}
+
+// withoutPriceFilters returns the filters which are not applied on price, so
+// price facets show the counts of all price ranges and not only the selected one
+func withoutPriceFilters(filters []storage.NumericFilter) []storage.NumericFilter {
+	var res []storage.NumericFilter
+	for _, f := range filters {
+		if f.Field != storage.PriceField {
+			res = append(res, f)
+		}
+	}
+
+	return res
+}
+
+// validateBuckets checks the price bucket boundaries to be at most maxPriceBuckets and strictly increasing
+func validateBuckets(buckets []int) error {
+	if len(buckets) > maxPriceBuckets {
+		return apperr.Validation(fmt.Sprintf("at most %d price buckets can be requested", maxPriceBuckets)).
+			With("field", "priceBuckets")
+	}
+
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i] <= buckets[i-1] {
+			return apperr.Validation("price buckets must be in increasing order").With("field", "priceBuckets")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package graph
+
+import (
+	"github.com/moeen/redisearch-shopping/graph/model"
+	"github.com/moeen/redisearch-shopping/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSearchFilters(t *testing.T) {
+	min, max := 5, 10
+
+	t.Run("test with no filters", func(t *testing.T) {
+		filters, err := searchFilters(model.ProductSearch{})
+		assert.NoError(t, err)
+		assert.Empty(t, filters)
+	})
+
+	t.Run("test with price range and numeric filters", func(t *testing.T) {
+		filters, err := searchFilters(model.ProductSearch{
+			MinPrice: &min,
+			NumericFilters: []*model.NumericFilter{
+				{Field: model.NumericFieldPrice, Max: &max},
+			},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []storage.NumericFilter{
+			{Field: storage.PriceField, Min: &min},
+			{Field: storage.PriceField, Max: &max},
+		}, filters)
+	})
+
+	t.Run("test with min greater than max", func(t *testing.T) {
+		_, err := searchFilters(model.ProductSearch{MinPrice: &max, MaxPrice: &min})
+		assert.Error(t, err)
+	})
+
+	t.Run("test with unknown field", func(t *testing.T) {
+		_, err := searchFilters(model.ProductSearch{
+			NumericFilters: []*model.NumericFilter{{Field: "UNKNOWN"}},
+		})
+		assert.Error(t, err)
+	})
+}
+
+func TestValidateBuckets(t *testing.T) {
+	assert.NoError(t, validateBuckets(nil))
+	assert.NoError(t, validateBuckets([]int{5, 10}))
+	assert.Error(t, validateBuckets([]int{5, 5}))
+	assert.Error(t, validateBuckets([]int{10, 5}))
+
+	buckets := make([]int, maxPriceBuckets+1)
+	for i := range buckets {
+		buckets[i] = i + 1
+	}
+	assert.NoError(t, validateBuckets(buckets[:maxPriceBuckets]))
+	assert.Error(t, validateBuckets(buckets))
+}
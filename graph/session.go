@@ -0,0 +1,155 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/moeen/redisearch-shopping/graph/model"
+	"github.com/moeen/redisearch-shopping/internal/apperr"
+	"github.com/moeen/redisearch-shopping/internal/auth"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+)
+
+// startSession issues the tokens of a new session for the customer, mfa tells whether
+// the customer verified a second factor along with their password
+func (r *Resolver) startSession(c *models.Customer, mfa bool) (*model.AuthPayload, error) {
+	family, err := auth.NewTokenID()
+	if err != nil {
+		return nil, err
+	}
+
+	payload, rt, err := r.issueTokens(c, family, mfa)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.Storage.CreateRefreshToken(rt); err != nil {
+		return nil, err
+	}
+
+	return payload, nil
+}
+
+// issueTokens creates an access token and the next refresh token of the session for the customer,
+// the refresh token is returned along with the payload so the caller can store it
+func (r *Resolver) issueTokens(c *models.Customer, family string, mfa bool) (*model.AuthPayload, *models.RefreshToken, error) {
+	now := time.Now()
+
+	access, err := r.Keys.GenerateToken(auth.Claims{
+		SessionID:  family,
+		CustomerID: int(c.ID),
+		Role:       c.Role,
+		ExpiresAt:  now.Add(auth.AccessTokenExpiration),
+		MFA:        mfa,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	refresh, hash, err := auth.NewSecretToken()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	payload := &model.AuthPayload{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		ExpiresAt:    int(now.Add(auth.AccessTokenExpiration).Unix()),
+	}
+
+	rt := &models.RefreshToken{
+		CustomerID: int(c.ID),
+		FamilyID:   family,
+		TokenHash:  hash,
+		ExpiresAt:  now.Add(auth.RefreshTokenExpiration),
+		MFA:        mfa,
+	}
+
+	return payload, rt, nil
+}
+
+// revokeSession revokes the refresh tokens of the session and denies its access tokens
+func (r *Resolver) revokeSession(family string) error {
+	if err := r.Storage.RevokeRefreshTokenFamily(family); err != nil {
+		return err
+	}
+
+	if err := r.Denylist.Revoke(family, time.Now().Add(auth.AccessTokenExpiration)); err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	return nil
+}
+
+// revokeCustomerSessions revokes all the sessions of the customer and denies their access tokens
+func (r *Resolver) revokeCustomerSessions(customerID int) error {
+	families, err := r.Storage.RevokeCustomerRefreshTokens(customerID)
+	if err != nil {
+		return err
+	}
+
+	until := time.Now().Add(auth.AccessTokenExpiration)
+	for _, f := range families {
+		if err := r.Denylist.Revoke(f, until); err != nil {
+			return fmt.Errorf("failed to revoke session: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// revokeToken denies the access token until it expires
+func (r *Resolver) revokeToken(claims *auth.Claims) error {
+	if claims.ID == "" {
+		return nil
+	}
+
+	if err := r.Denylist.Revoke(claims.ID, claims.ExpiresAt); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+
+	return nil
+}
+
+// checkProfileCredentials makes the customer prove again who they are before changing their
+// profile, by their password and also a two-factor code if it's enabled. Wrong answers count
+// as failed logins of the customer
+func (r *Resolver) checkProfileCredentials(ctx context.Context, c *models.Customer, password, code *string) error {
+	ip, _ := auth.ClientIPFromContext(ctx)
+	if err := r.Limiter.Check(c.Email, ip); err != nil {
+		var locked *auth.LockedError
+		if errors.As(err, &locked) {
+			return loginLockedError(locked)
+		}
+		return err
+	}
+
+	if password == nil {
+		return apperr.Invalid("currentPassword", errors.New("current password is required"))
+	}
+
+	if !auth.CheckPasswordHash(*password, c.Password) {
+		r.Limiter.Failed(c.Email, ip)
+		return apperr.Invalid("currentPassword", errors.New("current password is wrong"))
+	}
+
+	if c.TotpEnabled() {
+		if code == nil {
+			return apperr.Validation("two-factor code is required").With("field", "totpCode")
+		}
+
+		if err := r.checkTotpCode(c, *code); err != nil {
+			if errors.Is(err, errInvalidTotpCode) {
+				r.Limiter.Failed(c.Email, ip)
+				return apperr.Validation("invalid two-factor code").With("field", "totpCode")
+			}
+			return err
+		}
+	}
+
+	r.Limiter.Succeeded(c.Email)
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/moeen/redisearch-shopping/internal/apperr"
+	"github.com/moeen/redisearch-shopping/internal/auth"
+	"github.com/moeen/redisearch-shopping/internal/storage"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+)
+
+// totpChallengeExpiration is how long a customer has to verify their TOTP code after the password
+const totpChallengeExpiration = 5 * time.Minute
+
+// errInvalidTotpCode is returned when a TOTP or recovery code is wrong or already used
+var errInvalidTotpCode = apperr.Validation("invalid two-factor code").With("field", "code")
+
+// startTotpChallenge creates the single use challenge token which verifyTotp exchanges for the
+// tokens of a session once the customer verifies their code
+func (r *Resolver) startTotpChallenge(c *models.Customer) (string, error) {
+	token, hash, err := auth.NewSecretToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate challenge token: %w", err)
+	}
+
+	err = r.Storage.CreateActionToken(&models.ActionToken{
+		CustomerID: int(c.ID),
+		Purpose:    models.PurposeTotpChallenge,
+		TokenHash:  hash,
+		ExpiresAt:  time.Now().Add(totpChallengeExpiration),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// checkTotpCode accepts either a TOTP code of the customer secret which isn't used yet or
+// one of their unused recovery codes, errInvalidTotpCode is returned otherwise
+func (r *Resolver) checkTotpCode(c *models.Customer, code string) error {
+	if step, ok := auth.ValidateTotp(c.TotpSecret, code, time.Now()); ok {
+		err := r.Storage.UseTotpStep(int(c.ID), step)
+		if errors.Is(err, storage.ErrTotpCodeUsed) {
+			return errInvalidTotpCode
+		}
+		return err
+	}
+
+	err := r.Storage.UseRecoveryCode(int(c.ID), auth.HashRecoveryCode(code))
+	if errors.Is(err, storage.ErrInvalidRecoveryCode) {
+		return errInvalidTotpCode
+	}
+	return err
+}
@@ -0,0 +1,45 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/moeen/redisearch-shopping/internal/apperr"
+)
+
+const (
+	// minNameLength and maxNameLength are the limits of customer names in characters
+	minNameLength = 2
+	maxNameLength = 100
+)
+
+// validateName trims the name and checks its length, the trimmed name is returned if it's valid
+func validateName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+
+	n := utf8.RuneCountInString(name)
+	if n < minNameLength || n > maxNameLength {
+		return "", fmt.Errorf("name must be between %d and %d characters", minNameLength, maxNameLength)
+	}
+
+	for _, r := range name {
+		if r < ' ' || r == 0x7f {
+			return "", errors.New("name can not contain control characters")
+		}
+	}
+
+	return name, nil
+}
+
+// parseID parses the ID given in the field of the input
+func parseID(field, id string) (int, error) {
+	n, err := strconv.Atoi(id)
+	if err != nil || n <= 0 {
+		return 0, apperr.Validation("invalid id").With("field", field)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,51 @@
+package graph
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/moeen/redisearch-shopping/internal/apperr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateName(t *testing.T) {
+	t.Run("test valid names", func(t *testing.T) {
+		cases := map[string]string{
+			"test":                   "test",
+			"  Moeen  ":              "Moeen",
+			"معین":                   "معین",
+			strings.Repeat("a", 100): strings.Repeat("a", 100),
+		}
+
+		for in, want := range cases {
+			name, err := validateName(in)
+			assert.NoError(t, err)
+			assert.Equal(t, want, name)
+		}
+	})
+
+	t.Run("test invalid names", func(t *testing.T) {
+		cases := []string{"", "   ", "a", strings.Repeat("a", 101), "test\nname", "test\x00"}
+
+		for _, in := range cases {
+			_, err := validateName(in)
+			assert.Error(t, err)
+		}
+	})
+}
+
+func TestParseID(t *testing.T) {
+	id, err := parseID("id", "10")
+	assert.NoError(t, err)
+	assert.Equal(t, 10, id)
+
+	for _, in := range []string{"", "abc", "0", "-1"} {
+		_, err := parseID("product_id", in)
+
+		var appErr *apperr.Error
+		assert.True(t, errors.As(err, &appErr))
+		assert.Equal(t, apperr.CodeValidation, appErr.Code)
+		assert.Equal(t, "product_id", appErr.Extensions["field"])
+	}
+}
@@ -0,0 +1,125 @@
+package apperr
+
+import (
+	"errors"
+)
+
+// Code is the class of an error which clients can handle errors by, it's sent as the
+// code extension of GraphQL errors
+type Code string
+
+const (
+	// CodeNotFound is used when the requested resource doesn't exist
+	CodeNotFound Code = "NOT_FOUND"
+
+	// CodeUnauthenticated is used when the request has no valid credentials
+	CodeUnauthenticated Code = "UNAUTHENTICATED"
+
+	// CodeForbidden is used when the customer isn't allowed to do the request
+	CodeForbidden Code = "FORBIDDEN"
+
+	// CodeValidation is used when the input of the request isn't valid
+	CodeValidation Code = "VALIDATION"
+
+	// CodeConflict is used when the request conflicts with the current state, like a taken email
+	CodeConflict Code = "CONFLICT"
+
+	// CodeOutOfStock is used when a product doesn't have enough stock for the requested quantity
+	CodeOutOfStock Code = "OUT_OF_STOCK"
+
+	// CodeInternal is used for every error which isn't an Error
+	CodeInternal Code = "INTERNAL"
+)
+
+// Error is an error which is safe to be shown to clients, the error it's caused by
+// is kept for logs but never shown
+type Error struct {
+	Code Code
+
+	// Message is shown to clients, so it must not contain any internal details
+	Message string
+
+	// Extensions are added to the extensions of the GraphQL error along with the code
+	Extensions map[string]interface{}
+
+	// Err is the error which caused this one, if any
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// With returns a copy of the error with an extra extension
+func (e *Error) With(key string, value interface{}) *Error {
+	c := *e
+	c.Extensions = make(map[string]interface{}, len(e.Extensions)+1)
+	for k, v := range e.Extensions {
+		c.Extensions[k] = v
+	}
+	c.Extensions[key] = value
+
+	return &c
+}
+
+// New creates an Error with a code and a message
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Wrap creates an Error with a code and a message which is caused by err
+func Wrap(code Code, message string, err error) *Error {
+	return &Error{Code: code, Message: message, Err: err}
+}
+
+// NotFound creates an Error with CodeNotFound
+func NotFound(message string) *Error {
+	return New(CodeNotFound, message)
+}
+
+// Unauthenticated creates an Error with CodeUnauthenticated
+func Unauthenticated(message string) *Error {
+	return New(CodeUnauthenticated, message)
+}
+
+// Forbidden creates an Error with CodeForbidden
+func Forbidden(message string) *Error {
+	return New(CodeForbidden, message)
+}
+
+// Validation creates an Error with CodeValidation
+func Validation(message string) *Error {
+	return New(CodeValidation, message)
+}
+
+// Conflict creates an Error with CodeConflict
+func Conflict(message string) *Error {
+	return New(CodeConflict, message)
+}
+
+// OutOfStock creates an Error with CodeOutOfStock
+func OutOfStock(message string) *Error {
+	return New(CodeOutOfStock, message)
+}
+
+// Invalid creates an Error with CodeValidation for an input field, err is
+// shown to clients so it must describe what's wrong with the field
+func Invalid(field string, err error) *Error {
+	return Wrap(CodeValidation, err.Error(), err).With("field", field)
+}
+
+// CodeOf returns the code of the first Error in the chain of err, or CodeInternal if there is none
+func CodeOf(err error) Code {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return CodeInternal
+}
@@ -0,0 +1,64 @@
+package apperr
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestError(t *testing.T) {
+	t.Run("test error without cause", func(t *testing.T) {
+		err := NotFound("product not found")
+		assert.Equal(t, CodeNotFound, err.Code)
+		assert.EqualError(t, err, "product not found")
+		assert.Nil(t, errors.Unwrap(err))
+	})
+
+	t.Run("test error with cause", func(t *testing.T) {
+		cause := errors.New("record not found")
+		err := Wrap(CodeNotFound, "product not found", cause)
+		assert.EqualError(t, err, "product not found: record not found")
+		assert.ErrorIs(t, err, cause)
+	})
+
+	t.Run("test constructors", func(t *testing.T) {
+		cases := map[Code]*Error{
+			CodeNotFound:        NotFound("m"),
+			CodeUnauthenticated: Unauthenticated("m"),
+			CodeForbidden:       Forbidden("m"),
+			CodeValidation:      Validation("m"),
+			CodeConflict:        Conflict("m"),
+			CodeOutOfStock:      OutOfStock("m"),
+		}
+
+		for code, err := range cases {
+			assert.Equal(t, code, err.Code)
+			assert.Equal(t, "m", err.Message)
+		}
+	})
+}
+
+func TestError_With(t *testing.T) {
+	base := Conflict("taken")
+	err := base.With("field", "email").With("retryAfter", 10)
+
+	assert.Equal(t, map[string]interface{}{"field": "email", "retryAfter": 10}, err.Extensions)
+	assert.Nil(t, base.Extensions)
+	assert.Equal(t, base.Message, err.Message)
+}
+
+func TestInvalid(t *testing.T) {
+	err := Invalid("email", errors.New("invalid email address"))
+	assert.Equal(t, CodeValidation, err.Code)
+	assert.Equal(t, "invalid email address", err.Message)
+	assert.Equal(t, "email", err.Extensions["field"])
+}
+
+func TestCodeOf(t *testing.T) {
+	assert.Equal(t, CodeForbidden, CodeOf(Forbidden("denied")))
+	assert.Equal(t, CodeNotFound, CodeOf(fmt.Errorf("failed to get product: %w", NotFound("product not found"))))
+	assert.Equal(t, CodeInternal, CodeOf(errors.New("failed")))
+	assert.Equal(t, CodeInternal, CodeOf(nil))
+}
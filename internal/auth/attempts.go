@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// AttemptStore keeps the failed login attempts and lockouts of keys
+type AttemptStore interface {
+	// Fail counts a failed attempt of the key and returns the number of failures,
+	// the failures are forgotten when there is no new failure for ttl
+	Fail(key string, ttl time.Duration) (int, error)
+
+	// Lock locks the key until the given time
+	Lock(key string, until time.Time) error
+
+	// LockedUntil returns when the lock of the key ends, zero time if it's not locked
+	LockedUntil(key string) (time.Time, error)
+
+	// Reset forgets the failures and lock of the key
+	Reset(key string) error
+}
+
+// memoryAttempts is the state of a key in MemoryAttemptStore
+type memoryAttempts struct {
+	failures    int
+	expiresAt   time.Time
+	lockedUntil time.Time
+}
+
+// MemoryAttemptStore is the in memory implementation of AttemptStore, it's only suitable when
+// a single instance of the server is running
+type MemoryAttemptStore struct {
+	keys map[string]*memoryAttempts
+	mu   sync.Mutex
+	now  func() time.Time
+}
+
+// NewMemoryAttemptStore creates an empty MemoryAttemptStore
+func NewMemoryAttemptStore() *MemoryAttemptStore {
+	return &MemoryAttemptStore{
+		keys: make(map[string]*memoryAttempts),
+		now:  time.Now,
+	}
+}
+
+func (s *MemoryAttemptStore) Fail(key string, ttl time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.prune(now)
+
+	a, ok := s.keys[key]
+	if !ok || !a.expiresAt.After(now) {
+		a = &memoryAttempts{lockedUntil: s.lockedUntil(key, now)}
+		s.keys[key] = a
+	}
+
+	a.failures++
+	a.expiresAt = now.Add(ttl)
+
+	return a.failures, nil
+}
+
+func (s *MemoryAttemptStore) Lock(key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.keys[key]
+	if !ok {
+		a = &memoryAttempts{}
+		s.keys[key] = a
+	}
+
+	a.lockedUntil = until
+
+	return nil
+}
+
+func (s *MemoryAttemptStore) LockedUntil(key string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.lockedUntil(key, s.now()), nil
+}
+
+func (s *MemoryAttemptStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.keys, key)
+
+	return nil
+}
+
+// lockedUntil returns the end of the key lock if it's still locked at now
+func (s *MemoryAttemptStore) lockedUntil(key string, now time.Time) time.Time {
+	if a, ok := s.keys[key]; ok && a.lockedUntil.After(now) {
+		return a.lockedUntil
+	}
+	return time.Time{}
+}
+
+// prune drops the keys which have neither failures nor a lock at now
+func (s *MemoryAttemptStore) prune(now time.Time) {
+	for k, a := range s.keys {
+		if !a.expiresAt.After(now) && !a.lockedUntil.After(now) {
+			delete(s.keys, k)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"fmt"
+	"github.com/gomodule/redigo/redis"
+	"time"
+)
+
+// RedisAttemptStore is the Redis implementation of AttemptStore, failures and locks are
+// stored as keys which expire by themselves, so they're shared between all the server instances
+type RedisAttemptStore struct {
+	pool   *redis.Pool
+	prefix string
+}
+
+// NewRedisAttemptStore creates a RedisAttemptStore storing attempts under the given key prefix
+func NewRedisAttemptStore(pool *redis.Pool, prefix string) *RedisAttemptStore {
+	return &RedisAttemptStore{pool: pool, prefix: prefix}
+}
+
+func (s *RedisAttemptStore) Fail(key string, ttl time.Duration) (int, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	if err := conn.Send("MULTI"); err != nil {
+		return 0, fmt.Errorf("failed to count attempt: %w", err)
+	}
+	if err := conn.Send("INCR", s.failuresKey(key)); err != nil {
+		return 0, fmt.Errorf("failed to count attempt: %w", err)
+	}
+	if err := conn.Send("PEXPIRE", s.failuresKey(key), ttl.Milliseconds()); err != nil {
+		return 0, fmt.Errorf("failed to count attempt: %w", err)
+	}
+
+	res, err := redis.Values(conn.Do("EXEC"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to count attempt: %w", err)
+	}
+
+	failures, err := redis.Int(res[0], nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count attempt: %w", err)
+	}
+
+	return failures, nil
+}
+
+func (s *RedisAttemptStore) Lock(key string, until time.Time) error {
+	ttl := time.Until(until).Milliseconds()
+	if ttl <= 0 {
+		return nil
+	}
+
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	if _, err := conn.Do("SET", s.lockKey(key), until.UnixNano(), "PX", ttl); err != nil {
+		return fmt.Errorf("failed to lock: %w", err)
+	}
+
+	return nil
+}
+
+func (s *RedisAttemptStore) LockedUntil(key string) (time.Time, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	until, err := redis.Int64(conn.Do("GET", s.lockKey(key)))
+	if err == redis.ErrNil {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get lock: %w", err)
+	}
+
+	return time.Unix(0, until), nil
+}
+
+func (s *RedisAttemptStore) Reset(key string) error {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	if _, err := conn.Do("DEL", s.failuresKey(key), s.lockKey(key)); err != nil {
+		return fmt.Errorf("failed to reset attempts: %w", err)
+	}
+
+	return nil
+}
+
+// failuresKey returns the Redis key of the key failures
+func (s *RedisAttemptStore) failuresKey(key string) string {
+	return s.prefix + key + ":failures"
+}
+
+// lockKey returns the Redis key of the key lock
+func (s *RedisAttemptStore) lockKey(key string) string {
+	return s.prefix + key + ":lock"
+}
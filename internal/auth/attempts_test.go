@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestMemoryAttemptStore(t *testing.T) {
+	now := time.Now()
+
+	s := NewMemoryAttemptStore()
+	s.now = func() time.Time {
+		return now
+	}
+
+	t.Run("test counting failures", func(t *testing.T) {
+		for i := 1; i <= 3; i++ {
+			failures, err := s.Fail("key", time.Minute)
+			assert.NoError(t, err)
+			assert.Equal(t, i, failures)
+		}
+
+		failures, err := s.Fail("other", time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, failures)
+	})
+
+	t.Run("test failures expire", func(t *testing.T) {
+		now = now.Add(2 * time.Minute)
+
+		failures, err := s.Fail("key", time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, failures)
+		assert.NotContains(t, s.keys, "other")
+	})
+
+	t.Run("test locking", func(t *testing.T) {
+		until, err := s.LockedUntil("key")
+		assert.NoError(t, err)
+		assert.True(t, until.IsZero())
+
+		assert.NoError(t, s.Lock("key", now.Add(time.Minute)))
+
+		until, err = s.LockedUntil("key")
+		assert.NoError(t, err)
+		assert.Equal(t, now.Add(time.Minute), until)
+
+		now = now.Add(2 * time.Minute)
+
+		until, err = s.LockedUntil("key")
+		assert.NoError(t, err)
+		assert.True(t, until.IsZero())
+	})
+
+	t.Run("test reset", func(t *testing.T) {
+		_, _ = s.Fail("reset", time.Hour)
+		assert.NoError(t, s.Lock("reset", now.Add(time.Hour)))
+
+		assert.NoError(t, s.Reset("reset"))
+
+		until, err := s.LockedUntil("reset")
+		assert.NoError(t, err)
+		assert.True(t, until.IsZero())
+
+		failures, err := s.Fail("reset", time.Hour)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, failures)
+	})
+}
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// forwardedForHeader is the header proxies append the address of the client to
+const forwardedForHeader = "X-Forwarded-For"
+
+// ClientIPContextKey is the key used to store the client IP in the context
+type ClientIPContextKey struct{}
+
+// ClientIPResolver finds the IP of the client of a request, the X-Forwarded-For header is only
+// honoured when the request comes from one of the trusted proxies
+type ClientIPResolver struct {
+	trusted []*net.IPNet
+}
+
+// NewClientIPResolver creates a ClientIPResolver which trusts the proxies of given IPs or CIDRs,
+// no proxy is trusted when there are none so the client is always the peer of the connection
+func NewClientIPResolver(trustedProxies []string) (*ClientIPResolver, error) {
+	r := &ClientIPResolver{}
+	for _, p := range trustedProxies {
+		p = strings.TrimSpace(p)
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy: %s", p)
+			}
+
+			p = ip.String() + "/128"
+			if ip.To4() != nil {
+				p = ip.String() + "/32"
+			}
+		}
+
+		_, cidr, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy: %w", err)
+		}
+		r.trusted = append(r.trusted, cidr)
+	}
+
+	return r, nil
+}
+
+// isTrusted reports whether the IP belongs to a trusted proxy
+func (r *ClientIPResolver) isTrusted(ip net.IP) bool {
+	for _, cidr := range r.trusted {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ClientIP returns the IP of the client of the request. X-Forwarded-For is read from the right, since
+// each proxy appends its peer, and the first address which is not a trusted proxy is the client, so
+// clients can't choose their IP by sending the header themselves.
+func (r *ClientIPResolver) ClientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(strings.TrimSpace(req.RemoteAddr))
+	if err != nil {
+		host = strings.TrimSpace(req.RemoteAddr)
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !r.isTrusted(ip) {
+		return host
+	}
+
+	forwarded := strings.Split(strings.Join(req.Header.Values(forwardedForHeader), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if hop == nil {
+			// the addresses left of an invalid one can't be trusted either
+			break
+		}
+
+		ip = hop
+		if !r.isTrusted(hop) {
+			break
+		}
+	}
+
+	return ip.String()
+}
+
+// GinMiddleware stores the IP of the client in the request context
+func (r *ClientIPResolver) GinMiddleware(ctx *gin.Context) {
+	ctx.Request = ctx.Request.WithContext(context.WithValue(ctx.Request.Context(), ClientIPContextKey{}, r.ClientIP(ctx.Request)))
+	ctx.Next()
+}
+
+// ClientIPFromContext searches for the client IP in given context
+func ClientIPFromContext(ctx context.Context) (string, bool) {
+	ip, ok := ctx.Value(ClientIPContextKey{}).(string)
+	return ip, ok
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientIPResolver_GinMiddleware(t *testing.T) {
+	r, err := NewClientIPResolver(nil)
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.GET("/test", r.GinMiddleware, func(ctx *gin.Context) {
+		ip, ok := ClientIPFromContext(ctx.Request.Context())
+		if !ok {
+			ctx.String(http.StatusInternalServerError, "missing ip")
+			return
+		}
+		ctx.String(http.StatusOK, ip)
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/test", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "10.0.0.1", w.Body.String())
+}
+
+func TestClientIPResolver_ClientIP(t *testing.T) {
+	t.Run("test with invalid trusted proxies", func(t *testing.T) {
+		for _, p := range []string{"invalid", "10.0.0.0/33"} {
+			_, err := NewClientIPResolver([]string{p})
+			assert.Error(t, err)
+		}
+	})
+
+	r, err := NewClientIPResolver([]string{"10.0.0.0/8", "192.168.1.1", "::1"})
+	require.NoError(t, err)
+
+	cases := []struct {
+		name      string
+		remote    string
+		forwarded []string
+		ip        string
+	}{
+		{name: "test without proxy", remote: "1.2.3.4:1234", ip: "1.2.3.4"},
+		{name: "test untrusted peer can't spoof", remote: "1.2.3.4:1234", forwarded: []string{"5.6.7.8"}, ip: "1.2.3.4"},
+		{name: "test trusted proxy", remote: "10.0.0.1:1234", forwarded: []string{"5.6.7.8"}, ip: "5.6.7.8"},
+		{name: "test trusted ipv6 proxy", remote: "[::1]:1234", forwarded: []string{"5.6.7.8"}, ip: "5.6.7.8"},
+		{name: "test trusted proxy without header", remote: "192.168.1.1:1234", ip: "192.168.1.1"},
+		{
+			name:      "test chain of proxies",
+			remote:    "10.0.0.1:1234",
+			forwarded: []string{"9.9.9.9, 5.6.7.8, 192.168.1.1"},
+			ip:        "5.6.7.8",
+		},
+		{
+			name:      "test repeated headers",
+			remote:    "10.0.0.1:1234",
+			forwarded: []string{"9.9.9.9", "5.6.7.8"},
+			ip:        "5.6.7.8",
+		},
+		{name: "test invalid forwarded address", remote: "10.0.0.1:1234", forwarded: []string{"5.6.7.8, junk"}, ip: "10.0.0.1"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tc.remote
+			for _, v := range tc.forwarded {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+
+			assert.Equal(t, tc.ip, r.ClientIP(req))
+		})
+	}
+}
+
+func TestClientIPFromContext(t *testing.T) {
+	ip, ok := ClientIPFromContext(context.WithValue(context.Background(), ClientIPContextKey{}, "10.0.0.1"))
+	assert.True(t, ok)
+	assert.Equal(t, "10.0.0.1", ip)
+
+	ip, ok = ClientIPFromContext(context.Background())
+	assert.False(t, ok)
+	assert.Empty(t, ip)
+}
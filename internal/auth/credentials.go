@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode"
+)
+
+const (
+	// maxEmailLength is the longest email address allowed by RFC 5321
+	maxEmailLength = 254
+
+	// maxPasswordLength is the longest password bcrypt hashes without truncating it
+	maxPasswordLength = 72
+)
+
+// ErrInvalidEmail is returned when an email address isn't valid
+var ErrInvalidEmail = errors.New("invalid email address")
+
+// NormalizeEmail trims and lowercases the email so each address is only stored once
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// ValidateEmail normalizes the email and checks it's a plain address with a domain,
+// the normalized email is returned if it's valid
+func ValidateEmail(email string) (string, error) {
+	email = NormalizeEmail(email)
+	if email == "" || len(email) > maxEmailLength {
+		return "", ErrInvalidEmail
+	}
+
+	// names and comments like "Name <a@b.com>" are parsed too, so only a bare address is accepted
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", ErrInvalidEmail
+	}
+
+	at := strings.LastIndex(email, "@")
+	domain := email[at+1:]
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		return "", ErrInvalidEmail
+	}
+
+	return email, nil
+}
+
+// PasswordPolicy is the set of rules which new passwords must follow, empty passwords and
+// passwords longer than bcrypt supports are always rejected
+type PasswordPolicy struct {
+	MinLength     int
+	RequireLower  bool
+	RequireUpper  bool
+	RequireDigit  bool
+	RequireSymbol bool
+}
+
+// DefaultPasswordPolicy only asks for a minimum length, which helps more than character classes
+var DefaultPasswordPolicy = PasswordPolicy{MinLength: 8}
+
+// Validate returns an error describing the first rule which the password doesn't follow
+func (p PasswordPolicy) Validate(password string) error {
+	if password == "" {
+		return errors.New("password can not be empty")
+	}
+
+	if n := len([]rune(password)); n < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters", p.MinLength)
+	}
+
+	if len(password) > maxPasswordLength {
+		return fmt.Errorf("password must be at most %d bytes", maxPasswordLength)
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+
+	switch {
+	case p.RequireLower && !lower:
+		return errors.New("password must contain a lowercase letter")
+	case p.RequireUpper && !upper:
+		return errors.New("password must contain an uppercase letter")
+	case p.RequireDigit && !digit:
+		return errors.New("password must contain a digit")
+	case p.RequireSymbol && !symbol:
+		return errors.New("password must contain a symbol")
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	assert.Equal(t, "test@test.com", NormalizeEmail("  Test@TEST.com "))
+	assert.Equal(t, "", NormalizeEmail(" "))
+}
+
+func TestValidateEmail(t *testing.T) {
+	t.Run("test valid emails", func(t *testing.T) {
+		cases := map[string]string{
+			"test@test.com":           "test@test.com",
+			" Test.Name@Test.co.uk ":  "test.name@test.co.uk",
+			"test+tag@sub.test.com":   "test+tag@sub.test.com",
+			"o'reilly@test-shop.info": "o'reilly@test-shop.info",
+		}
+
+		for in, want := range cases {
+			email, err := ValidateEmail(in)
+			assert.NoError(t, err, in)
+			assert.Equal(t, want, email)
+		}
+	})
+
+	t.Run("test invalid emails", func(t *testing.T) {
+		cases := []string{
+			"",
+			"test",
+			"test@",
+			"@test.com",
+			"test@test",
+			"test@.com",
+			"test@test.",
+			"test @test.com",
+			"test@test.com, other@test.com",
+			"Name <test@test.com>",
+			strings.Repeat("a", 250) + "@test.com",
+		}
+
+		for _, in := range cases {
+			_, err := ValidateEmail(in)
+			assert.ErrorIs(t, err, ErrInvalidEmail, in)
+		}
+	})
+}
+
+func TestPasswordPolicy_Validate(t *testing.T) {
+	t.Run("test zero policy", func(t *testing.T) {
+		p := PasswordPolicy{}
+		assert.NoError(t, p.Validate("a"))
+		assert.Error(t, p.Validate(""))
+		assert.Error(t, p.Validate(strings.Repeat("a", maxPasswordLength+1)))
+	})
+
+	t.Run("test min length", func(t *testing.T) {
+		p := PasswordPolicy{MinLength: 8}
+		assert.EqualError(t, p.Validate("1234567"), "password must be at least 8 characters")
+		assert.NoError(t, p.Validate("12345678"))
+
+		// lengths are counted in characters, not bytes
+		assert.NoError(t, p.Validate("رمزعبورم"))
+	})
+
+	t.Run("test character classes", func(t *testing.T) {
+		p := PasswordPolicy{RequireLower: true, RequireUpper: true, RequireDigit: true, RequireSymbol: true}
+
+		cases := map[string]string{
+			"PASSWORD1!": "password must contain a lowercase letter",
+			"password1!": "password must contain an uppercase letter",
+			"Password!":  "password must contain a digit",
+			"Password1":  "password must contain a symbol",
+		}
+
+		for in, msg := range cases {
+			assert.EqualError(t, p.Validate(in), msg)
+		}
+
+		assert.NoError(t, p.Validate("Password1!"))
+		assert.NoError(t, p.Validate("Password 1"))
+	})
+}
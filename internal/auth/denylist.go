@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// Denylist keeps the IDs of revoked tokens and sessions until the tokens carrying them expire
+type Denylist interface {
+	// Revoke denies the ID until the given time
+	Revoke(id string, until time.Time) error
+
+	// IsRevoked reports whether the ID is denied
+	IsRevoked(id string) (bool, error)
+}
+
+// MemoryDenylist is the in memory implementation of Denylist, it's only suitable when
+// a single instance of the server is running
+type MemoryDenylist struct {
+	ids map[string]time.Time
+	mu  sync.Mutex
+	now func() time.Time
+}
+
+// NewMemoryDenylist creates an empty MemoryDenylist
+func NewMemoryDenylist() *MemoryDenylist {
+	return &MemoryDenylist{
+		ids: make(map[string]time.Time),
+		now: time.Now,
+	}
+}
+
+func (d *MemoryDenylist) Revoke(id string, until time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	if !until.After(now) {
+		return nil
+	}
+
+	// expired IDs are dropped on writes so the list doesn't grow forever
+	for k, exp := range d.ids {
+		if !exp.After(now) {
+			delete(d.ids, k)
+		}
+	}
+
+	if exp, ok := d.ids[id]; !ok || until.After(exp) {
+		d.ids[id] = until
+	}
+
+	return nil
+}
+
+func (d *MemoryDenylist) IsRevoked(id string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	exp, ok := d.ids[id]
+	return ok && exp.After(d.now()), nil
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"fmt"
+	"github.com/gomodule/redigo/redis"
+	"time"
+)
+
+// RedisDenylist is the Redis implementation of Denylist, revoked IDs are stored as keys
+// which expire along with the tokens, so it's shared between all the server instances
+type RedisDenylist struct {
+	pool   *redis.Pool
+	prefix string
+}
+
+// NewRedisDenylist creates a RedisDenylist storing IDs under the given key prefix
+func NewRedisDenylist(pool *redis.Pool, prefix string) *RedisDenylist {
+	return &RedisDenylist{pool: pool, prefix: prefix}
+}
+
+func (d *RedisDenylist) Revoke(id string, until time.Time) error {
+	ttl := time.Until(until).Milliseconds()
+	if ttl <= 0 {
+		return nil
+	}
+
+	conn := d.pool.Get()
+	defer conn.Close()
+
+	if _, err := conn.Do("SET", d.key(id), 1, "PX", ttl); err != nil {
+		return fmt.Errorf("failed to revoke id: %w", err)
+	}
+
+	return nil
+}
+
+func (d *RedisDenylist) IsRevoked(id string) (bool, error) {
+	conn := d.pool.Get()
+	defer conn.Close()
+
+	ok, err := redis.Bool(conn.Do("EXISTS", d.key(id)))
+	if err != nil {
+		return false, fmt.Errorf("failed to check id: %w", err)
+	}
+
+	return ok, nil
+}
+
+// key returns the Redis key of the ID
+func (d *RedisDenylist) key(id string) string {
+	return d.prefix + id
+}
@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestMemoryDenylist(t *testing.T) {
+	now := time.Now()
+
+	dl := NewMemoryDenylist()
+	dl.now = func() time.Time {
+		return now
+	}
+
+	t.Run("test unknown id", func(t *testing.T) {
+		revoked, err := dl.IsRevoked("unknown")
+		assert.NoError(t, err)
+		assert.False(t, revoked)
+	})
+
+	t.Run("test revoked id", func(t *testing.T) {
+		assert.NoError(t, dl.Revoke("id", now.Add(time.Minute)))
+
+		revoked, err := dl.IsRevoked("id")
+		assert.NoError(t, err)
+		assert.True(t, revoked)
+	})
+
+	t.Run("test already expired id", func(t *testing.T) {
+		assert.NoError(t, dl.Revoke("expired", now.Add(-time.Minute)))
+
+		revoked, err := dl.IsRevoked("expired")
+		assert.NoError(t, err)
+		assert.False(t, revoked)
+		assert.NotContains(t, dl.ids, "expired")
+	})
+
+	t.Run("test revoking again keeps the later time", func(t *testing.T) {
+		assert.NoError(t, dl.Revoke("twice", now.Add(time.Hour)))
+		assert.NoError(t, dl.Revoke("twice", now.Add(time.Minute)))
+		assert.Equal(t, now.Add(time.Hour), dl.ids["twice"])
+	})
+
+	t.Run("test id expires", func(t *testing.T) {
+		assert.NoError(t, dl.Revoke("short", now.Add(time.Second)))
+
+		now = now.Add(2 * time.Second)
+
+		revoked, err := dl.IsRevoked("short")
+		assert.NoError(t, err)
+		assert.False(t, revoked)
+
+		// expired ids are dropped by the next revoke
+		assert.NoError(t, dl.Revoke("other", now.Add(time.Minute)))
+		assert.NotContains(t, dl.ids, "short")
+	})
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JWK is the JSON Web Key representation of a public key
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+
+	// N and E are the modulus and exponent of RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// Crv, X and Y are the curve and coordinates of ECDSA keys
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys which tokens can be verified by, HMAC secrets are never
+// published so sets with only HMAC keys return an empty key set
+func (ks *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+
+	for _, k := range ks.publicKeys() {
+		jwk := JWK{
+			Kid: k.ID,
+			Alg: k.Method.Alg(),
+			Use: "sig",
+		}
+
+		switch pub := k.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = encodeInt(pub.N, 0)
+			jwk.E = encodeInt(big.NewInt(int64(pub.E)), 0)
+		case *ecdsa.PublicKey:
+			size := (pub.Curve.Params().BitSize + 7) / 8
+			jwk.Kty = "EC"
+			jwk.Crv = pub.Curve.Params().Name
+			jwk.X = encodeInt(pub.X, size)
+			jwk.Y = encodeInt(pub.Y, size)
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set
+}
+
+// GinJWKSHandler serves the JSON Web Key Set of the keys so other services can verify tokens
+func (ks *KeySet) GinJWKSHandler(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, ks.JWKS())
+}
+
+// encodeInt encodes a big-endian integer as base64url, padding it with zeros to size bytes
+func encodeInt(n *big.Int, size int) string {
+	b := n.Bytes()
+	if len(b) < size {
+		b = append(make([]byte, size-len(b)), b...)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeySet_JWKS(t *testing.T) {
+	rsaPrivate, _ := rsaPEM(t)
+	ecPrivate, _ := ecPEM(t, elliptic.P256())
+
+	rsaKey, err := ParseKey("rsa", "RS256", rsaPrivate)
+	require.NoError(t, err)
+
+	ecKey, err := ParseKey("ec", "ES256", ecPrivate)
+	require.NoError(t, err)
+
+	hmacKey, err := NewHMACKey("hmac", "HS256", testSecret)
+	require.NoError(t, err)
+
+	t.Run("test with only hmac keys", func(t *testing.T) {
+		jwks := newTestKeySet(t).JWKS()
+		assert.Empty(t, jwks.Keys)
+	})
+
+	t.Run("test with asymmetric keys", func(t *testing.T) {
+		ks, err := NewKeySet(rsaKey, ecKey, hmacKey)
+		require.NoError(t, err)
+
+		jwks := ks.JWKS()
+		require.Len(t, jwks.Keys, 2)
+
+		ec, rs := jwks.Keys[0], jwks.Keys[1]
+
+		assert.Equal(t, "ec", ec.Kid)
+		assert.Equal(t, "EC", ec.Kty)
+		assert.Equal(t, "ES256", ec.Alg)
+		assert.Equal(t, "P-256", ec.Crv)
+		assert.Equal(t, "sig", ec.Use)
+
+		pub := ecKey.verifyKey.(*ecdsa.PublicKey)
+		x, err := base64.RawURLEncoding.DecodeString(ec.X)
+		assert.NoError(t, err)
+		assert.Len(t, x, 32)
+		assert.Equal(t, 0, pub.X.Cmp(new(big.Int).SetBytes(x)))
+
+		assert.Equal(t, "rsa", rs.Kid)
+		assert.Equal(t, "RSA", rs.Kty)
+		assert.Equal(t, "RS256", rs.Alg)
+		assert.Equal(t, "AQAB", rs.E)
+
+		n, err := base64.RawURLEncoding.DecodeString(rs.N)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, rsaKey.verifyKey.(*rsa.PublicKey).N.Cmp(new(big.Int).SetBytes(n)))
+	})
+}
+
+func TestKeySet_GinJWKSHandler(t *testing.T) {
+	rsaPrivate, _ := rsaPEM(t)
+
+	key, err := ParseKey("rsa", "RS256", rsaPrivate)
+	require.NoError(t, err)
+
+	ks, err := NewKeySet(key)
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.GET("/.well-known/jwks.json", ks.GinJWKSHandler)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var jwks JWKS
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &jwks))
+	assert.Equal(t, ks.JWKS(), jwks)
+}
@@ -1,27 +1,75 @@
 package auth
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"github.com/dgrijalva/jwt-go"
+	"github.com/moeen/redisearch-shopping/pkg/models"
 	"time"
 )
 
-// secretKey is the secret used to sign tokens
-// @TODO: get secret key from command or env
-var secretKey = []byte("super-secret")
+const (
+	// AccessTokenExpiration is the expiration time of the generated access tokens
+	AccessTokenExpiration = 15 * time.Minute
 
-// expirationTime is the default expiration time of the generated tokens
-const DefaultExpirationTime = 24 * time.Hour
+	// RefreshTokenExpiration is the expiration time of the generated refresh tokens
+	RefreshTokenExpiration = 30 * 24 * time.Hour
+)
+
+// Claims are the data carried by access tokens
+type Claims struct {
+	// ID is the unique id of the token, sent as the jti claim
+	ID string
+
+	// SessionID is the family of the refresh tokens which the token was issued along with
+	SessionID string
 
-// GenerateToken receives a customer id and generates a token for that customer
-func GenerateToken(customerID int, expireAt time.Time) (string, error) {
-	token := jwt.New(jwt.SigningMethodHS256)
+	CustomerID int
+	Role       models.Role
+	ExpiresAt  time.Time
+
+	// MFA tells whether the session was started by a second factor along with the password
+	MFA bool
+}
+
+// NewTokenID creates a random id for tokens and token families
+func NewTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to read random bytes: %w", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// GenerateToken generates an access token carrying given claims signed by the signing key
+// of the set, a random ID is set for the token if the claims don't have any
+func (ks *KeySet) GenerateToken(c Claims) (string, error) {
+	if c.ID == "" {
+		id, err := NewTokenID()
+		if err != nil {
+			return "", err
+		}
+		c.ID = id
+	}
+
+	token := jwt.New(ks.signing.Method)
+	token.Header["kid"] = ks.signing.ID
 
 	claims := token.Claims.(jwt.MapClaims)
-	claims["customer_id"] = customerID
-	claims["exp"] = expireAt
+	claims["jti"] = c.ID
+	claims["sid"] = c.SessionID
+	claims["customer_id"] = c.CustomerID
+	claims["role"] = c.Role
+	if c.MFA {
+		claims["mfa"] = true
+	}
+	claims["iat"] = time.Now().Unix()
+	claims["exp"] = c.ExpiresAt.Unix()
 
-	tokenString, err := token.SignedString(secretKey)
+	tokenString, err := token.SignedString(ks.signing.signKey)
 	if err != nil {
 		return "", fmt.Errorf("failed to sign token: %w", err)
 	}
@@ -29,23 +77,35 @@ func GenerateToken(customerID int, expireAt time.Time) (string, error) {
 	return tokenString, nil
 }
 
-// ParseToken tries to parse a given token a returns the customer id if it was ok
-func ParseToken(tokenStr string) (int, error) {
-	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-		return secretKey, nil
-	})
+// ParseToken tries to parse a given token a returns its claims if it was ok,
+// the token must be signed by one of the keys in the set and not be expired
+func (ks *KeySet) ParseToken(tokenStr string) (*Claims, error) {
+	token, err := jwt.Parse(tokenStr, ks.verifyKey)
 
 	if err != nil {
-		return 0, fmt.Errorf("failed to parse token: %w", err)
+		return nil, fmt.Errorf("failed to parse token: %w", err)
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		userID, ok := claims["customer_id"].(float64)
-		if !ok {
-			return 0, fmt.Errorf("failed to get cliams: %w", err)
-		}
-		return int(userID), nil
-	} else {
-		return 0, fmt.Errorf("failed to get cliams: %w", err)
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("failed to get cliams")
+	}
+
+	customerID, ok := claims["customer_id"].(float64)
+	if !ok {
+		return nil, errors.New("failed to get cliams: missing customer_id")
+	}
+
+	c := &Claims{CustomerID: int(customerID)}
+	c.ID, _ = claims["jti"].(string)
+	c.SessionID, _ = claims["sid"].(string)
+	if role, ok := claims["role"].(string); ok {
+		c.Role = models.Role(role)
 	}
+	c.MFA, _ = claims["mfa"].(bool)
+	if exp, ok := claims["exp"].(float64); ok {
+		c.ExpiresAt = time.Unix(int64(exp), 0)
+	}
+
+	return c, nil
 }
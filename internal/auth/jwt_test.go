@@ -2,27 +2,37 @@ package auth
 
 import (
 	"github.com/dgrijalva/jwt-go"
+	"github.com/moeen/redisearch-shopping/pkg/models"
 	"github.com/stretchr/testify/assert"
 	"testing"
 	"time"
 )
 
-func TestGenerateToken(t *testing.T) {
-	cases := []struct {
-		customerID int
-		expire     time.Time
-	}{
-		{customerID: 1, expire: time.Now().Add(time.Hour)},
-		{customerID: 100, expire: time.Now().Add(2 * time.Hour)},
-		{customerID: 1000, expire: time.Now().Add(3 * time.Hour)},
+func TestNewTokenID(t *testing.T) {
+	a, err := NewTokenID()
+	assert.NoError(t, err)
+	assert.Len(t, a, 32)
+
+	b, err := NewTokenID()
+	assert.NoError(t, err)
+	assert.NotEqual(t, a, b)
+}
+
+func TestKeySet_GenerateToken(t *testing.T) {
+	ks := newTestKeySet(t)
+
+	cases := []Claims{
+		{CustomerID: 1, Role: models.RoleCustomer, ExpiresAt: time.Now().Add(time.Hour)},
+		{CustomerID: 100, Role: models.RoleStaff, SessionID: "session", ExpiresAt: time.Now().Add(2 * time.Hour)},
+		{ID: "id", CustomerID: 1000, Role: models.RoleAdmin, ExpiresAt: time.Now().Add(3 * time.Hour), MFA: true},
 	}
 
 	for _, tc := range cases {
-		token, err := GenerateToken(tc.customerID, tc.expire)
+		token, err := ks.GenerateToken(tc)
 		assert.NoError(t, err)
 
 		pt, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-			return secretKey, nil
+			return testSecret, nil
 		})
 
 		assert.NoError(t, err)
@@ -30,51 +40,106 @@ func TestGenerateToken(t *testing.T) {
 		claims, ok := pt.Claims.(jwt.MapClaims)
 		assert.True(t, ok)
 		assert.True(t, pt.Valid)
+		assert.Equal(t, "test", pt.Header["kid"])
 
-		ex, err := time.Parse(time.RFC3339, claims["exp"].(string))
-		assert.NoError(t, err)
-		assert.Equal(t, time.Duration(0), tc.expire.Sub(ex))
+		assert.Equal(t, float64(tc.ExpiresAt.Unix()), claims["exp"].(float64))
+		assert.Equal(t, float64(tc.CustomerID), claims["customer_id"].(float64))
+		assert.Equal(t, string(tc.Role), claims["role"].(string))
+		assert.Equal(t, tc.SessionID, claims["sid"].(string))
+
+		mfa, _ := claims["mfa"].(bool)
+		assert.Equal(t, tc.MFA, mfa)
 
-		assert.Equal(t, float64(tc.customerID), claims["customer_id"].(float64))
+		if tc.ID != "" {
+			assert.Equal(t, tc.ID, claims["jti"].(string))
+		} else {
+			assert.NotEmpty(t, claims["jti"].(string))
+		}
 	}
 }
 
-func TestParseToken(t *testing.T) {
+func TestKeySet_ParseToken(t *testing.T) {
+	ks := newTestKeySet(t)
+
 	t.Run("test valid tokens", func(t *testing.T) {
-		cases := []int{10, 100, 100}
+		cases := []Claims{
+			{ID: "a", SessionID: "s", CustomerID: 10, Role: models.RoleCustomer},
+			{ID: "b", CustomerID: 100, Role: models.RoleAdmin, MFA: true},
+		}
 
 		for _, tc := range cases {
-			token := jwt.New(jwt.SigningMethodHS256)
+			tc.ExpiresAt = time.Unix(time.Now().Add(time.Hour).Unix(), 0)
 
-			claims := token.Claims.(jwt.MapClaims)
-			claims["customer_id"] = tc
-			tokenStr, _ := token.SignedString(secretKey)
+			tokenStr, err := ks.GenerateToken(tc)
+			assert.NoError(t, err)
 
-			cid, err := ParseToken(tokenStr)
+			claims, err := ks.ParseToken(tokenStr)
 			assert.NoError(t, err)
-			assert.Equal(t, tc, cid)
+			assert.Equal(t, &tc, claims)
 		}
 	})
 
+	t.Run("test token with only customer id", func(t *testing.T) {
+		token := jwt.New(jwt.SigningMethodHS256)
+		token.Claims.(jwt.MapClaims)["customer_id"] = 10
+		tokenStr, _ := token.SignedString(testSecret)
+
+		claims, err := ks.ParseToken(tokenStr)
+		assert.NoError(t, err)
+		assert.Equal(t, &Claims{CustomerID: 10}, claims)
+	})
+
+	t.Run("test expired token", func(t *testing.T) {
+		tokenStr, err := ks.GenerateToken(Claims{CustomerID: 1, ExpiresAt: time.Now().Add(-time.Minute)})
+		assert.NoError(t, err)
+
+		claims, err := ks.ParseToken(tokenStr)
+		assert.Error(t, err)
+		assert.Nil(t, claims)
+	})
+
 	t.Run("test invalid token strings", func(t *testing.T) {
-		cid, err := ParseToken("invalid-jwt-token")
+		claims, err := ks.ParseToken("invalid-jwt-token")
 		assert.Error(t, err)
-		assert.Equal(t, 0, cid)
+		assert.Nil(t, claims)
 	})
 
 	t.Run("test token with no claims", func(t *testing.T) {
 		token := jwt.New(jwt.SigningMethodHS256)
-		tokenStr, _ := token.SignedString(secretKey)
-		cid, err := ParseToken(tokenStr)
+		tokenStr, _ := token.SignedString(testSecret)
+		claims, err := ks.ParseToken(tokenStr)
 		assert.Error(t, err)
-		assert.Equal(t, 0, cid)
+		assert.Nil(t, claims)
 	})
 
 	t.Run("test token with invalid claims", func(t *testing.T) {
 		token := jwt.New(jwt.SigningMethodHS256)
-		tokenStr, _ := token.SignedString(secretKey)
-		cid, err := ParseToken(tokenStr)
+		token.Claims.(jwt.MapClaims)["customer_id"] = "invalid"
+		tokenStr, _ := token.SignedString(testSecret)
+		claims, err := ks.ParseToken(tokenStr)
+		assert.Error(t, err)
+		assert.Nil(t, claims)
+	})
+
+	t.Run("test token signed by unknown key", func(t *testing.T) {
+		token := jwt.New(jwt.SigningMethodHS256)
+		token.Header["kid"] = "unknown"
+		token.Claims.(jwt.MapClaims)["customer_id"] = 1
+		tokenStr, _ := token.SignedString(testSecret)
+
+		claims, err := ks.ParseToken(tokenStr)
+		assert.Error(t, err)
+		assert.Nil(t, claims)
+	})
+
+	t.Run("test token with different algorithm", func(t *testing.T) {
+		token := jwt.New(jwt.SigningMethodHS512)
+		token.Header["kid"] = "test"
+		token.Claims.(jwt.MapClaims)["customer_id"] = 1
+		tokenStr, _ := token.SignedString(testSecret)
+
+		claims, err := ks.ParseToken(tokenStr)
 		assert.Error(t, err)
-		assert.Equal(t, 0, cid)
+		assert.Nil(t, claims)
 	})
 }
@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// curves are the elliptic curves required by each ECDSA signing algorithm
+var curves = map[string]elliptic.Curve{
+	jwt.SigningMethodES256.Alg(): elliptic.P256(),
+	jwt.SigningMethodES384.Alg(): elliptic.P384(),
+	jwt.SigningMethodES512.Alg(): elliptic.P521(),
+}
+
+// Key is a key used to sign and verify tokens
+type Key struct {
+	// ID is sent as the kid header of the tokens signed by the key
+	ID string
+
+	// Method is the algorithm which the key is used with
+	Method jwt.SigningMethod
+
+	// signKey is nil for the keys which can only verify tokens
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// CanSign reports whether the key can be used to sign tokens
+func (k *Key) CanSign() bool {
+	return k.signKey != nil
+}
+
+// NewHMACKey creates a key from a shared secret, it can both sign and verify tokens
+func NewHMACKey(id, alg string, secret []byte) (*Key, error) {
+	method, ok := jwt.GetSigningMethod(alg).(*jwt.SigningMethodHMAC)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an HMAC algorithm", alg)
+	}
+
+	if len(secret) == 0 {
+		return nil, errors.New("secret can not be empty")
+	}
+
+	return &Key{ID: id, Method: method, signKey: secret, verifyKey: secret}, nil
+}
+
+// ParseKey creates a key for the given algorithm, data is the secret of HMAC algorithms
+// and a PEM encoded private or public key of RSA and ECDSA ones.
+// Keys created from a public key can only verify tokens
+func ParseKey(id, alg string, data []byte) (*Key, error) {
+	if id == "" {
+		return nil, errors.New("key id can not be empty")
+	}
+
+	switch method := jwt.GetSigningMethod(alg).(type) {
+	case *jwt.SigningMethodHMAC:
+		return NewHMACKey(id, alg, bytes.TrimSpace(data))
+
+	case *jwt.SigningMethodRSA:
+		if private, err := jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+			return &Key{ID: id, Method: method, signKey: private, verifyKey: &private.PublicKey}, nil
+		}
+
+		public, err := jwt.ParseRSAPublicKeyFromPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse RSA key: %w", err)
+		}
+
+		return &Key{ID: id, Method: method, verifyKey: public}, nil
+
+	case *jwt.SigningMethodECDSA:
+		var (
+			private *ecdsa.PrivateKey
+			public  *ecdsa.PublicKey
+			err     error
+		)
+
+		if private, err = jwt.ParseECPrivateKeyFromPEM(data); err == nil {
+			public = &private.PublicKey
+		} else if public, err = jwt.ParseECPublicKeyFromPEM(data); err != nil {
+			return nil, fmt.Errorf("failed to parse ECDSA key: %w", err)
+		}
+
+		if public.Curve != curves[alg] {
+			return nil, fmt.Errorf("%s requires the %s curve", alg, curves[alg].Params().Name)
+		}
+
+		key := &Key{ID: id, Method: method, verifyKey: public}
+		if private != nil {
+			key.signKey = private
+		}
+
+		return key, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported algorithm: %s", alg)
+	}
+}
+
+// LoadKey reads the key data from the given file and parses it with ParseKey
+func LoadKey(id, alg, path string) (*Key, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	return ParseKey(id, alg, data)
+}
+
+// KeySet holds the key used to sign new tokens along with all the keys which tokens are
+// verified by, previous signing keys are kept for verification so they can be rotated
+// without invalidating the tokens signed by them
+type KeySet struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+// NewKeySet creates a KeySet which signs tokens with the signing key and verifies them
+// with it or any of the verification keys
+func NewKeySet(signing *Key, verification ...*Key) (*KeySet, error) {
+	if signing == nil || !signing.CanSign() {
+		return nil, errors.New("signing key must have a private key or secret")
+	}
+
+	ks := &KeySet{
+		signing: signing,
+		keys:    make(map[string]*Key, len(verification)+1),
+	}
+
+	for _, k := range append([]*Key{signing}, verification...) {
+		if _, ok := ks.keys[k.ID]; ok {
+			return nil, fmt.Errorf("duplicate key id: %s", k.ID)
+		}
+		ks.keys[k.ID] = k
+	}
+
+	return ks, nil
+}
+
+// verifyKey finds the key which the given token must be verified by
+func (ks *KeySet) verifyKey(token *jwt.Token) (interface{}, error) {
+	// tokens signed before kid headers were added can only be verified by the signing key
+	key := ks.signing
+	if kid, ok := token.Header["kid"].(string); ok {
+		if key, ok = ks.keys[kid]; !ok {
+			return nil, fmt.Errorf("unknown key id: %s", kid)
+		}
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %s", token.Method.Alg())
+	}
+
+	return key.verifyKey, nil
+}
+
+// publicKeys returns the public keys of the asymmetric keys in the set
+func (ks *KeySet) publicKeys() []*Key {
+	keys := make([]*Key, 0, len(ks.keys))
+	for _, k := range ks.keys {
+		switch k.verifyKey.(type) {
+		case *rsa.PublicKey, *ecdsa.PublicKey:
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].ID < keys[j].ID
+	})
+
+	return keys
+}
@@ -0,0 +1,227 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testSecret is the secret of the key set created by newTestKeySet
+var testSecret = []byte("test-secret")
+
+// newTestKeySet creates a KeySet signing tokens with testSecret and the "test" key id
+func newTestKeySet(t *testing.T) *KeySet {
+	key, err := NewHMACKey("test", "HS256", testSecret)
+	require.NoError(t, err)
+
+	ks, err := NewKeySet(key)
+	require.NoError(t, err)
+
+	return ks
+}
+
+// rsaPEM creates an RSA key and returns its private and public keys encoded as PEM
+func rsaPEM(t *testing.T) ([]byte, []byte) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})
+}
+
+// ecPEM creates an ECDSA key on the curve and returns its private and public keys encoded as PEM
+func ecPEM(t *testing.T, curve elliptic.Curve) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	require.NoError(t, err)
+
+	private, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: private}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})
+}
+
+func TestParseKey(t *testing.T) {
+	rsaPrivate, rsaPublic := rsaPEM(t)
+	ecPrivate, ecPublic := ecPEM(t, elliptic.P256())
+
+	t.Run("test valid keys", func(t *testing.T) {
+		cases := []struct {
+			alg     string
+			data    []byte
+			canSign bool
+		}{
+			{alg: "HS256", data: []byte("secret\n"), canSign: true},
+			{alg: "RS256", data: rsaPrivate, canSign: true},
+			{alg: "RS256", data: rsaPublic, canSign: false},
+			{alg: "ES256", data: ecPrivate, canSign: true},
+			{alg: "ES256", data: ecPublic, canSign: false},
+		}
+
+		for _, tc := range cases {
+			key, err := ParseKey("kid", tc.alg, tc.data)
+			assert.NoError(t, err)
+			assert.Equal(t, "kid", key.ID)
+			assert.Equal(t, tc.alg, key.Method.Alg())
+			assert.Equal(t, tc.canSign, key.CanSign())
+		}
+	})
+
+	t.Run("test invalid keys", func(t *testing.T) {
+		cases := []struct {
+			id   string
+			alg  string
+			data []byte
+		}{
+			{id: "", alg: "HS256", data: []byte("secret")},
+			{id: "kid", alg: "HS256", data: []byte(" \n")},
+			{id: "kid", alg: "none", data: []byte("secret")},
+			{id: "kid", alg: "RS256", data: []byte("not a pem")},
+			{id: "kid", alg: "RS256", data: ecPrivate},
+			{id: "kid", alg: "ES256", data: rsaPrivate},
+			{id: "kid", alg: "ES384", data: ecPrivate},
+		}
+
+		for _, tc := range cases {
+			key, err := ParseKey(tc.id, tc.alg, tc.data)
+			assert.Error(t, err)
+			assert.Nil(t, key)
+		}
+	})
+}
+
+func TestLoadKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keys")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	private, _ := rsaPEM(t)
+	path := filepath.Join(dir, "key.pem")
+	require.NoError(t, ioutil.WriteFile(path, private, 0600))
+
+	t.Run("test existing file", func(t *testing.T) {
+		key, err := LoadKey("kid", "RS256", path)
+		assert.NoError(t, err)
+		assert.True(t, key.CanSign())
+	})
+
+	t.Run("test missing file", func(t *testing.T) {
+		key, err := LoadKey("kid", "RS256", filepath.Join(dir, "missing.pem"))
+		assert.Error(t, err)
+		assert.Nil(t, key)
+	})
+}
+
+func TestNewKeySet(t *testing.T) {
+	_, public := rsaPEM(t)
+
+	verifyOnly, err := ParseKey("verify", "RS256", public)
+	require.NoError(t, err)
+
+	signing, err := NewHMACKey("sign", "HS256", testSecret)
+	require.NoError(t, err)
+
+	t.Run("test without signing key", func(t *testing.T) {
+		ks, err := NewKeySet(nil)
+		assert.Error(t, err)
+		assert.Nil(t, ks)
+	})
+
+	t.Run("test with verification only signing key", func(t *testing.T) {
+		ks, err := NewKeySet(verifyOnly)
+		assert.Error(t, err)
+		assert.Nil(t, ks)
+	})
+
+	t.Run("test with duplicate key ids", func(t *testing.T) {
+		duplicate, err := NewHMACKey("sign", "HS256", []byte("other"))
+		require.NoError(t, err)
+
+		ks, err := NewKeySet(signing, duplicate)
+		assert.Error(t, err)
+		assert.Nil(t, ks)
+	})
+
+	t.Run("test valid keys", func(t *testing.T) {
+		ks, err := NewKeySet(signing, verifyOnly)
+		assert.NoError(t, err)
+		assert.Same(t, signing, ks.signing)
+		assert.Len(t, ks.keys, 2)
+	})
+}
+
+func TestKeySet_Rotation(t *testing.T) {
+	oldPrivate, oldPublic := rsaPEM(t)
+	newPrivate, _ := ecPEM(t, elliptic.P256())
+
+	oldKey, err := ParseKey("old", "RS256", oldPrivate)
+	require.NoError(t, err)
+
+	oldSet, err := NewKeySet(oldKey)
+	require.NoError(t, err)
+
+	token, err := oldSet.GenerateToken(Claims{CustomerID: 1, Role: models.RoleCustomer, ExpiresAt: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+
+	newKey, err := ParseKey("new", "ES256", newPrivate)
+	require.NoError(t, err)
+
+	t.Run("test token of removed key", func(t *testing.T) {
+		ks, err := NewKeySet(newKey)
+		require.NoError(t, err)
+
+		claims, err := ks.ParseToken(token)
+		assert.Error(t, err)
+		assert.Nil(t, claims)
+	})
+
+	t.Run("test token of previous key", func(t *testing.T) {
+		previous, err := ParseKey("old", "RS256", oldPublic)
+		require.NoError(t, err)
+
+		ks, err := NewKeySet(newKey, previous)
+		require.NoError(t, err)
+
+		claims, err := ks.ParseToken(token)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, claims.CustomerID)
+
+		newToken, err := ks.GenerateToken(Claims{CustomerID: 2, Role: models.RoleCustomer, ExpiresAt: time.Now().Add(time.Hour)})
+		require.NoError(t, err)
+
+		claims, err = ks.ParseToken(newToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, claims.CustomerID)
+	})
+
+	t.Run("test token without key id", func(t *testing.T) {
+		ks := newTestKeySet(t)
+
+		tk := jwt.New(jwt.SigningMethodHS256)
+		tk.Claims.(jwt.MapClaims)["customer_id"] = 3
+		tokenStr, _ := tk.SignedString(testSecret)
+
+		claims, err := ks.ParseToken(tokenStr)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, claims.CustomerID)
+	})
+}
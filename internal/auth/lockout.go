@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// lockoutPolicy decides when and for how long a key is locked after failed login attempts
+type lockoutPolicy struct {
+	// name is the kind of the keys, used as their prefix
+	name string
+
+	// free is the number of failures allowed before the key is locked
+	free int
+
+	// base is the lock duration of the first failure after the free ones, it's doubled
+	// by every other failure until it reaches max
+	base time.Duration
+	max  time.Duration
+
+	// window is how long failures are remembered after the last one
+	window time.Duration
+}
+
+// lockDuration returns how long the key must be locked after the given number of failures
+func (p lockoutPolicy) lockDuration(failures int) time.Duration {
+	if failures <= p.free {
+		return 0
+	}
+
+	d := p.base
+	for i := p.free + 1; i < failures && d < p.max; i++ {
+		d *= 2
+	}
+
+	if d > p.max {
+		return p.max
+	}
+	return d
+}
+
+var (
+	// accountPolicy protects a single account against guessing its password
+	accountPolicy = lockoutPolicy{name: "account", free: 5, base: 30 * time.Second, max: 15 * time.Minute, window: time.Hour}
+
+	// ipPolicy protects all accounts against a single client trying many of them
+	ipPolicy = lockoutPolicy{name: "ip", free: 20, base: 30 * time.Second, max: 15 * time.Minute, window: time.Hour}
+)
+
+// LockedError is returned when login attempts are locked
+type LockedError struct {
+	// RetryAfter is how long the client must wait before trying again
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("too many failed login attempts, retry after %s", e.RetryAfter.Round(time.Second))
+}
+
+// LoginLimiter tracks failed login attempts of each account and client IP and temporarily locks
+// them with an exponential backoff, store errors are logged and never block a login
+type LoginLimiter struct {
+	store  AttemptStore
+	logger *zap.Logger
+	now    func() time.Time
+}
+
+// NewLoginLimiter creates a LoginLimiter keeping attempts in the given store
+func NewLoginLimiter(store AttemptStore, logger *zap.Logger) *LoginLimiter {
+	return &LoginLimiter{
+		store:  store,
+		logger: logger,
+		now:    time.Now,
+	}
+}
+
+// Check returns a LockedError if either the account of the email or the IP is locked
+func (l *LoginLimiter) Check(email, ip string) error {
+	var until time.Time
+
+	for _, k := range l.keys(email, ip) {
+		lu, err := l.store.LockedUntil(k.key)
+		if err != nil {
+			l.logger.Error("failed to check login lock", zap.String("key", k.key), zap.Error(err))
+			continue
+		}
+
+		if lu.After(until) {
+			until = lu
+		}
+	}
+
+	if now := l.now(); until.After(now) {
+		return &LockedError{RetryAfter: until.Sub(now)}
+	}
+
+	return nil
+}
+
+// Failed records a failed login attempt and locks the account or IP if it's failed too many times
+func (l *LoginLimiter) Failed(email, ip string) {
+	for _, k := range l.keys(email, ip) {
+		failures, err := l.store.Fail(k.key, k.policy.window)
+		if err != nil {
+			l.logger.Error("failed to record login failure", zap.String("key", k.key), zap.Error(err))
+			continue
+		}
+
+		d := k.policy.lockDuration(failures)
+		if d == 0 {
+			continue
+		}
+
+		if err := l.store.Lock(k.key, l.now().Add(d)); err != nil {
+			l.logger.Error("failed to lock login", zap.String("key", k.key), zap.Error(err))
+			continue
+		}
+
+		l.logger.Warn("login locked",
+			zap.String("key", k.key),
+			zap.Int("failures", failures),
+			zap.Duration("duration", d),
+		)
+	}
+}
+
+// Succeeded forgets the failures of the account, IP failures are kept so a client owning
+// an account can't use it to reset its failures of guessing other accounts
+func (l *LoginLimiter) Succeeded(email string) {
+	k := l.keys(email, "")[0]
+	if err := l.store.Reset(k.key); err != nil {
+		l.logger.Error("failed to reset login failures", zap.String("key", k.key), zap.Error(err))
+	}
+}
+
+// lockoutKey is a key which attempts are tracked by along with its policy
+type lockoutKey struct {
+	key    string
+	policy lockoutPolicy
+}
+
+// keys returns the account key of the email and the IP key if the IP is known
+func (l *LoginLimiter) keys(email, ip string) []lockoutKey {
+	keys := []lockoutKey{{
+		key:    accountPolicy.name + ":" + strings.ToLower(strings.TrimSpace(email)),
+		policy: accountPolicy,
+	}}
+
+	if ip != "" {
+		keys = append(keys, lockoutKey{key: ipPolicy.name + ":" + ip, policy: ipPolicy})
+	}
+
+	return keys
+}
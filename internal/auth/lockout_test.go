@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLockoutPolicy_LockDuration(t *testing.T) {
+	p := lockoutPolicy{free: 2, base: time.Second, max: 10 * time.Second}
+
+	cases := []struct {
+		failures int
+		duration time.Duration
+	}{
+		{failures: 1, duration: 0},
+		{failures: 2, duration: 0},
+		{failures: 3, duration: time.Second},
+		{failures: 4, duration: 2 * time.Second},
+		{failures: 5, duration: 4 * time.Second},
+		{failures: 6, duration: 8 * time.Second},
+		{failures: 7, duration: 10 * time.Second},
+		{failures: 100, duration: 10 * time.Second},
+	}
+
+	for _, tc := range cases {
+		assert.Equal(t, tc.duration, p.lockDuration(tc.failures))
+	}
+}
+
+// failingAttemptStore is an AttemptStore which always fails
+type failingAttemptStore struct{}
+
+func (failingAttemptStore) Fail(string, time.Duration) (int, error) {
+	return 0, errors.New("failed")
+}
+
+func (failingAttemptStore) Lock(string, time.Time) error {
+	return errors.New("failed")
+}
+
+func (failingAttemptStore) LockedUntil(string) (time.Time, error) {
+	return time.Time{}, errors.New("failed")
+}
+
+func (failingAttemptStore) Reset(string) error {
+	return errors.New("failed")
+}
+
+func TestLoginLimiter(t *testing.T) {
+	now := time.Now()
+
+	core, logs := observer.New(zap.WarnLevel)
+
+	store := NewMemoryAttemptStore()
+	store.now = func() time.Time {
+		return now
+	}
+
+	l := NewLoginLimiter(store, zap.New(core))
+	l.now = store.now
+
+	t.Run("test account lockout", func(t *testing.T) {
+		for i := 0; i < accountPolicy.free; i++ {
+			assert.NoError(t, l.Check("test@test.com", "1.1.1.1"))
+			l.Failed("test@test.com", "1.1.1.1")
+		}
+		assert.NoError(t, l.Check("test@test.com", "1.1.1.1"))
+
+		l.Failed("Test@Test.com ", "1.1.1.1")
+
+		err := l.Check("test@test.com", "2.2.2.2")
+		var locked *LockedError
+		assert.True(t, errors.As(err, &locked))
+		assert.Equal(t, accountPolicy.base, locked.RetryAfter)
+
+		// other accounts from the same IP are still allowed
+		assert.NoError(t, l.Check("other@test.com", "1.1.1.1"))
+
+		assert.Equal(t, 1, logs.FilterMessage("login locked").Len())
+
+		now = now.Add(accountPolicy.base)
+		assert.NoError(t, l.Check("test@test.com", "1.1.1.1"))
+
+		// the next failure doubles the lock
+		l.Failed("test@test.com", "1.1.1.1")
+		err = l.Check("test@test.com", "1.1.1.1")
+		assert.True(t, errors.As(err, &locked))
+		assert.Equal(t, 2*accountPolicy.base, locked.RetryAfter)
+	})
+
+	t.Run("test success resets account failures", func(t *testing.T) {
+		for i := 0; i < accountPolicy.free; i++ {
+			l.Failed("reset@test.com", "")
+		}
+
+		l.Succeeded("reset@test.com")
+
+		l.Failed("reset@test.com", "")
+		assert.NoError(t, l.Check("reset@test.com", ""))
+	})
+
+	t.Run("test ip lockout", func(t *testing.T) {
+		for i := 0; i <= ipPolicy.free; i++ {
+			l.Failed("user"+string(rune('a'+i))+"@test.com", "3.3.3.3")
+		}
+
+		err := l.Check("new@test.com", "3.3.3.3")
+		var locked *LockedError
+		assert.True(t, errors.As(err, &locked))
+
+		assert.NoError(t, l.Check("new@test.com", "4.4.4.4"))
+	})
+
+	t.Run("test with failing store", func(t *testing.T) {
+		l := NewLoginLimiter(failingAttemptStore{}, zap.NewNop())
+
+		l.Failed("test@test.com", "1.1.1.1")
+		l.Succeeded("test@test.com")
+		assert.NoError(t, l.Check("test@test.com", "1.1.1.1"))
+	})
+}
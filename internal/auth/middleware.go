@@ -11,14 +11,20 @@ import (
 // JwtContextKey is the key used to store customer in the context
 type JwtContextKey struct{}
 
+// ClaimsContextKey is the key used to store the claims of the access token in the context
+type ClaimsContextKey struct{}
+
 // Auth is the object used to authenticate incoming requests
 type Auth struct {
-	storage storage.Storage
+	storage  storage.Storage
+	keys     *KeySet
+	denylist Denylist
 }
 
-// NewAuth creates a new Auth with given storage
-func NewAuth(storage storage.Storage) *Auth {
-	return &Auth{storage: storage}
+// NewAuth creates a new Auth with given storage, the keys which tokens are verified by
+// and the denylist of revoked tokens
+func NewAuth(storage storage.Storage, keys *KeySet, denylist Denylist) *Auth {
+	return &Auth{storage: storage, keys: keys, denylist: denylist}
 }
 
 // GinJWTMiddleware is the JWT middleware used for Gin handlers authentication
@@ -35,24 +41,52 @@ func (a *Auth) GinJWTMiddleware(ctx *gin.Context) {
 		return
 	}
 
-	customerID, err := ParseToken(header)
+	claims, err := a.keys.ParseToken(header)
 	if err != nil {
 		ctx.Next()
 		return
 	}
 
-	customer, err := a.storage.GetCustomer(customerID)
+	if a.revoked(claims) {
+		ctx.Next()
+		return
+	}
+
+	customer, err := a.storage.GetCustomer(claims.CustomerID)
 	if err != nil {
 		ctx.Next()
 		return
 	}
 
-	ctx.Request = ctx.Request.WithContext(context.WithValue(ctx, JwtContextKey{}, customer))
+	c := context.WithValue(ctx.Request.Context(), JwtContextKey{}, customer)
+	ctx.Request = ctx.Request.WithContext(context.WithValue(c, ClaimsContextKey{}, claims))
 	ctx.Next()
 }
 
+// revoked reports whether the token or its session is revoked, tokens are treated
+// as revoked when the denylist can't be checked
+func (a *Auth) revoked(claims *Claims) bool {
+	for _, id := range []string{claims.ID, claims.SessionID} {
+		if id == "" {
+			continue
+		}
+
+		if revoked, err := a.denylist.IsRevoked(id); err != nil || revoked {
+			return true
+		}
+	}
+
+	return false
+}
+
 // CustomerFromContext searches for the customer in given context
 func CustomerFromContext(ctx context.Context) (*models.Customer, bool) {
 	c, ok := ctx.Value(JwtContextKey{}).(*models.Customer)
 	return c, ok
 }
+
+// ClaimsFromContext searches for the claims of the access token in given context
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	c, ok := ctx.Value(ClaimsContextKey{}).(*Claims)
+	return c, ok
+}
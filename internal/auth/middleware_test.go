@@ -22,9 +22,13 @@ func TestNewAuth(t *testing.T) {
 	defer c.Finish()
 
 	st := storage.NewMockStorage(c)
+	ks := newTestKeySet(t)
+	dl := NewMemoryDenylist()
 
-	auth := NewAuth(st)
+	auth := NewAuth(st, ks, dl)
 	assert.Same(t, st, auth.storage)
+	assert.Same(t, ks, auth.keys)
+	assert.Same(t, dl, auth.denylist)
 }
 
 func TestAuth_GinJWTMiddleware(t *testing.T) {
@@ -32,8 +36,10 @@ func TestAuth_GinJWTMiddleware(t *testing.T) {
 	defer c.Finish()
 
 	st := storage.NewMockStorage(c)
+	ks := newTestKeySet(t)
+	dl := NewMemoryDenylist()
 
-	auth := NewAuth(st)
+	auth := NewAuth(st, ks, dl)
 	router := gin.New()
 	router.GET("/test", auth.GinJWTMiddleware, func(ctx *gin.Context) {
 		customer, ok := CustomerFromContext(ctx.Request.Context())
@@ -41,6 +47,13 @@ func TestAuth_GinJWTMiddleware(t *testing.T) {
 			ctx.String(http.StatusForbidden, "access denied")
 			return
 		}
+
+		claims, ok := ClaimsFromContext(ctx.Request.Context())
+		if !ok || claims.CustomerID != int(customer.ID) {
+			ctx.String(http.StatusInternalServerError, "missing claims")
+			return
+		}
+
 		ctx.String(http.StatusOK, customer.Email)
 	})
 
@@ -77,7 +90,7 @@ func TestAuth_GinJWTMiddleware(t *testing.T) {
 
 		st.EXPECT().GetCustomer(int(customer.ID)).Times(1).Return(nil, errors.New("not found"))
 
-		token, err := GenerateToken(int(customer.ID), time.Now().Add(time.Hour))
+		token, err := ks.GenerateToken(Claims{CustomerID: int(customer.ID), Role: customer.Role, ExpiresAt: time.Now().Add(time.Hour)})
 		assert.NoError(t, err)
 
 		w := httptest.NewRecorder()
@@ -97,7 +110,7 @@ func TestAuth_GinJWTMiddleware(t *testing.T) {
 
 		st.EXPECT().GetCustomer(int(customer.ID)).Times(1).Return(customer, nil)
 
-		token, err := GenerateToken(int(customer.ID), time.Now().Add(time.Hour))
+		token, err := ks.GenerateToken(Claims{CustomerID: int(customer.ID), Role: customer.Role, ExpiresAt: time.Now().Add(time.Hour)})
 		assert.NoError(t, err)
 
 		w := httptest.NewRecorder()
@@ -109,6 +122,31 @@ func TestAuth_GinJWTMiddleware(t *testing.T) {
 		body, _ := ioutil.ReadAll(w.Body)
 		assert.Equal(t, customer.Email, string(body))
 	})
+	t.Run("test with revoked token", func(t *testing.T) {
+		token, err := ks.GenerateToken(Claims{ID: "revoked", CustomerID: 10, ExpiresAt: time.Now().Add(time.Hour)})
+		assert.NoError(t, err)
+
+		assert.NoError(t, dl.Revoke("revoked", time.Now().Add(time.Hour)))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("test with revoked session", func(t *testing.T) {
+		token, err := ks.GenerateToken(Claims{SessionID: "session", CustomerID: 10, ExpiresAt: time.Now().Add(time.Hour)})
+		assert.NoError(t, err)
+
+		assert.NoError(t, dl.Revoke("session", time.Now().Add(time.Hour)))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
 }
 
 func TestCustomerFromContext(t *testing.T) {
@@ -134,3 +172,21 @@ func TestCustomerFromContext(t *testing.T) {
 		assert.Nil(t, rc)
 	})
 }
+
+func TestClaimsFromContext(t *testing.T) {
+	t.Run("test with claims in ctx", func(t *testing.T) {
+		c := &Claims{ID: "id", CustomerID: 1}
+
+		ctx := context.WithValue(context.Background(), ClaimsContextKey{}, c)
+
+		rc, ok := ClaimsFromContext(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, c, rc)
+	})
+
+	t.Run("test with no claims in ctx", func(t *testing.T) {
+		rc, ok := ClaimsFromContext(context.Background())
+		assert.False(t, ok)
+		assert.Nil(t, rc)
+	})
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// requestPolicy limits how many times a key can request something in a window
+type requestPolicy struct {
+	// name is the kind of the keys, used as their prefix
+	name string
+
+	// limit is the number of requests allowed in a window
+	limit int
+
+	// window is how long requests are remembered after the last one
+	window time.Duration
+}
+
+// requestKey is a key which requests are counted by along with its policy
+type requestKey struct {
+	key    string
+	policy requestPolicy
+}
+
+var (
+	// resetEmailPolicy keeps a single inbox from being flooded with password reset emails
+	resetEmailPolicy = requestPolicy{name: "reset-email", limit: 3, window: time.Hour}
+
+	// resetIPPolicy keeps a single client from requesting resets of many emails
+	resetIPPolicy = requestPolicy{name: "reset-ip", limit: 20, window: time.Hour}
+)
+
+// AllowPasswordReset counts a password reset request of the email from the IP and reports whether
+// neither of them has requested too many, store errors are logged and never block a request
+func (l *LoginLimiter) AllowPasswordReset(email, ip string) bool {
+	keys := []requestKey{{
+		key:    resetEmailPolicy.name + ":" + strings.ToLower(strings.TrimSpace(email)),
+		policy: resetEmailPolicy,
+	}}
+
+	if ip != "" {
+		keys = append(keys, requestKey{key: resetIPPolicy.name + ":" + ip, policy: resetIPPolicy})
+	}
+
+	allowed := true
+	for _, k := range keys {
+		requests, err := l.store.Fail(k.key, k.policy.window)
+		if err != nil {
+			l.logger.Error("failed to count password reset request", zap.String("key", k.key), zap.Error(err))
+			continue
+		}
+
+		if requests > k.policy.limit {
+			l.logger.Warn("too many password reset requests", zap.String("key", k.key), zap.Int("requests", requests))
+			allowed = false
+		}
+	}
+
+	return allowed
+}
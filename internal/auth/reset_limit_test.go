@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestLoginLimiter_AllowPasswordReset(t *testing.T) {
+	now := time.Now()
+
+	store := NewMemoryAttemptStore()
+	store.now = func() time.Time {
+		return now
+	}
+
+	l := NewLoginLimiter(store, zap.NewNop())
+	l.now = store.now
+
+	t.Run("test email limit", func(t *testing.T) {
+		for i := 0; i < resetEmailPolicy.limit; i++ {
+			assert.True(t, l.AllowPasswordReset("test@test.com", fmt.Sprintf("1.1.1.%d", i)))
+		}
+		assert.False(t, l.AllowPasswordReset("Test@Test.com ", "2.2.2.2"))
+
+		// other emails are still allowed
+		assert.True(t, l.AllowPasswordReset("other@test.com", "2.2.2.2"))
+
+		now = now.Add(resetEmailPolicy.window)
+		assert.True(t, l.AllowPasswordReset("test@test.com", "2.2.2.2"))
+	})
+
+	t.Run("test ip limit", func(t *testing.T) {
+		for i := 0; i < resetIPPolicy.limit; i++ {
+			assert.True(t, l.AllowPasswordReset(fmt.Sprintf("user%d@test.com", i), "3.3.3.3"))
+		}
+		assert.False(t, l.AllowPasswordReset("new@test.com", "3.3.3.3"))
+
+		assert.True(t, l.AllowPasswordReset("new@test.com", "4.4.4.4"))
+	})
+
+	t.Run("test with failing store", func(t *testing.T) {
+		l := NewLoginLimiter(failingAttemptStore{}, zap.NewNop())
+
+		assert.True(t, l.AllowPasswordReset("test@test.com", "1.1.1.1"))
+	})
+}
@@ -0,0 +1,27 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// NewSecretToken creates a random token along with the hash which it's stored by,
+// it's used for the tokens which are only checked against storage like refresh tokens
+func NewSecretToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("failed to read random bytes: %w", err)
+	}
+
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashSecretToken(token), nil
+}
+
+// HashSecretToken hashes a secret token so it's never stored in plain text
+func HashSecretToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,24 @@
+package auth
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNewSecretToken(t *testing.T) {
+	token, hash, err := NewSecretToken()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, token)
+	assert.NotEqual(t, token, hash)
+	assert.Equal(t, HashSecretToken(token), hash)
+
+	other, _, err := NewSecretToken()
+	assert.NoError(t, err)
+	assert.NotEqual(t, token, other)
+}
+
+func TestHashSecretToken(t *testing.T) {
+	assert.Equal(t, HashSecretToken("token"), HashSecretToken("token"))
+	assert.NotEqual(t, HashSecretToken("token"), HashSecretToken("other"))
+	assert.Len(t, HashSecretToken("token"), 64)
+}
@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// TotpIssuer is the issuer shown by authenticator apps
+	TotpIssuer = "RediSearch Shopping"
+
+	// totpDigits is the number of digits of TOTP codes
+	totpDigits = 6
+
+	// totpPeriod is how long each TOTP code is valid
+	totpPeriod = 30 * time.Second
+
+	// totpSkew is the number of periods before and after the current one which codes are
+	// still accepted from, so small clock differences don't reject valid codes
+	totpSkew = 1
+
+	// recoveryCodeCount is the number of recovery codes created when TOTP is enabled
+	recoveryCodeCount = 10
+)
+
+// totpEncoding is the base32 encoding of TOTP secrets used by authenticator apps
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewTotpSecret creates a random base32 encoded TOTP secret
+func NewTotpSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to read random bytes: %w", err)
+	}
+
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// TotpURI creates the otpauth URI which authenticator apps are set up by
+func TotpURI(account, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", TotpIssuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(totpDigits))
+	v.Set("period", fmt.Sprint(int(totpPeriod.Seconds())))
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + TotpIssuer + ":" + account,
+		RawQuery: v.Encode(),
+	}
+
+	return u.String()
+}
+
+// totpStep returns the time step which t is in
+func totpStep(t time.Time) int64 {
+	return t.Unix() / int64(totpPeriod.Seconds())
+}
+
+// totpCode creates the code of the secret for a time step as described by RFC 6238
+func totpCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("invalid totp secret: %w", err)
+	}
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", totpDigits, value%mod), nil
+}
+
+// TotpCode creates the code of the secret at the given time
+func TotpCode(secret string, t time.Time) (string, error) {
+	return totpCode(secret, totpStep(t))
+}
+
+// ValidateTotp checks the code against the secret around the given time and returns the time
+// step it's valid in, callers must reject steps which are already used so codes can't be replayed
+func ValidateTotp(secret, code string, t time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	now := totpStep(t)
+	for step := now - totpSkew; step <= now+totpSkew; step++ {
+		expected, err := totpCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// NewRecoveryCodes creates the single use codes which can be used instead of TOTP codes
+func NewRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 6)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("failed to read random bytes: %w", err)
+		}
+
+		c := strings.ToLower(totpEncoding.EncodeToString(b))[:10]
+		codes[i] = c[:5] + "-" + c[5:]
+	}
+
+	return codes, nil
+}
+
+// HashRecoveryCode normalizes a recovery code and hashes it so it's never stored in plain text
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return HashSecretToken(code)
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// rfcSecret is the SHA1 secret of the RFC 6238 test vectors
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestTotpCode(t *testing.T) {
+	// RFC 6238 test vectors truncated to 6 digits
+	cases := []struct {
+		unix int64
+		code string
+	}{
+		{unix: 59, code: "287082"},
+		{unix: 1111111109, code: "081804"},
+		{unix: 1111111111, code: "050471"},
+		{unix: 1234567890, code: "005924"},
+		{unix: 2000000000, code: "279037"},
+	}
+
+	for _, tc := range cases {
+		code, err := TotpCode(rfcSecret, time.Unix(tc.unix, 0))
+		assert.NoError(t, err)
+		assert.Equal(t, tc.code, code)
+	}
+
+	_, err := TotpCode("not base32!", time.Now())
+	assert.Error(t, err)
+}
+
+func TestValidateTotp(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+
+	t.Run("test codes in the skew window", func(t *testing.T) {
+		for _, offset := range []time.Duration{-totpPeriod, 0, totpPeriod} {
+			code, _ := TotpCode(rfcSecret, now.Add(offset))
+
+			step, ok := ValidateTotp(rfcSecret, code, now)
+			assert.True(t, ok)
+			assert.Equal(t, totpStep(now.Add(offset)), step)
+		}
+	})
+
+	t.Run("test codes out of the skew window", func(t *testing.T) {
+		code, _ := TotpCode(rfcSecret, now.Add(-3*totpPeriod))
+
+		_, ok := ValidateTotp(rfcSecret, code, now)
+		assert.False(t, ok)
+	})
+
+	t.Run("test invalid codes", func(t *testing.T) {
+		for _, code := range []string{"", "12345", "1234567", "abcdef"} {
+			_, ok := ValidateTotp(rfcSecret, code, now)
+			assert.False(t, ok)
+		}
+	})
+}
+
+func TestNewTotpSecret(t *testing.T) {
+	secret, err := NewTotpSecret()
+	assert.NoError(t, err)
+	assert.Len(t, secret, 32)
+
+	_, err = TotpCode(secret, time.Now())
+	assert.NoError(t, err)
+}
+
+func TestTotpURI(t *testing.T) {
+	u, err := url.Parse(TotpURI("test@test.com", "SECRET"))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "otpauth", u.Scheme)
+	assert.Equal(t, "totp", u.Host)
+	assert.Equal(t, "/"+TotpIssuer+":test@test.com", u.Path)
+	assert.Equal(t, "SECRET", u.Query().Get("secret"))
+	assert.Equal(t, TotpIssuer, u.Query().Get("issuer"))
+	assert.Equal(t, "6", u.Query().Get("digits"))
+	assert.Equal(t, "30", u.Query().Get("period"))
+}
+
+func TestNewRecoveryCodes(t *testing.T) {
+	codes, err := NewRecoveryCodes()
+	assert.NoError(t, err)
+	assert.Len(t, codes, recoveryCodeCount)
+
+	seen := make(map[string]bool)
+	for _, c := range codes {
+		assert.Regexp(t, "^[a-z2-7]{5}-[a-z2-7]{5}$", c)
+		assert.False(t, seen[c])
+		seen[c] = true
+	}
+}
+
+func TestHashRecoveryCode(t *testing.T) {
+	assert.Equal(t, HashRecoveryCode("abcde-fghij"), HashRecoveryCode(" ABCDE FGHIJ"))
+	assert.Equal(t, HashRecoveryCode("abcde-fghij"), HashRecoveryCode("abcdefghij"))
+	assert.NotEqual(t, HashRecoveryCode("abcde-fghij"), HashRecoveryCode("abcde-fghik"))
+}
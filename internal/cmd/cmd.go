@@ -3,6 +3,22 @@ package cmd
 import (
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
+	"time"
+)
+
+const (
+	// defaultRedisAddress is the RediSearch address used when no address is provided
+	defaultRedisAddress = "127.0.0.1:6379"
+
+	// defaultIndex is the RediSearch index alias used when no index is provided
+	defaultIndex = "products"
+
+	// authStoreMaxIdle is the maximum number of idle connections kept in the redis pool of the auth store,
+	// every authenticated request uses it so connections are reused instead of dialed each time
+	authStoreMaxIdle = 50
+
+	// authStoreIdleTimeout is the time after which idle connections of the auth store pool are closed
+	authStoreIdleTimeout = 5 * time.Minute
 )
 
 // CMD is the struct responsible for all commands in the app
@@ -20,9 +36,13 @@ func NewCMD(logger *zap.Logger) *CMD {
 	root := c.rootCommand()
 	serve := c.serveCommand()
 	mock := c.mockCommand()
+	reindex := c.reindexCommand()
+	role := c.roleCommand()
 
 	root.AddCommand(serve)
 	root.AddCommand(mock)
+	root.AddCommand(reindex)
+	root.AddCommand(role)
 
 	c.cmd = root
 
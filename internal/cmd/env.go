@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// envOrDefault returns the value of the environment variable or def if it's not set
+func envOrDefault(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return def
+}
+
+// envIntOrDefault returns the integer value of the environment variable or def if it's not set or not an integer
+func envIntOrDefault(key string, def int) int {
+	if v, err := strconv.Atoi(envOrDefault(key, "")); err == nil {
+		return v
+	}
+	return def
+}
+
+// envBoolOrDefault returns the boolean value of the environment variable or def if it's not set or not a boolean
+func envBoolOrDefault(key string, def bool) bool {
+	if v, err := strconv.ParseBool(envOrDefault(key, "")); err == nil {
+		return v
+	}
+	return def
+}
+
+// envDurationOrDefault returns the duration value of the environment variable or def if it's not set or not a duration
+func envDurationOrDefault(key string, def time.Duration) time.Duration {
+	if v, err := time.ParseDuration(envOrDefault(key, "")); err == nil {
+		return v
+	}
+	return def
+}
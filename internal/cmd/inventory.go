@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"github.com/moeen/redisearch-shopping/internal/inventory"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"time"
+)
+
+// addInventoryFlags adds the flags used to configure stock reservations,
+// every flag can also be set by its environment variable
+func addInventoryFlags(cmd *cobra.Command) {
+	cmd.Flags().Duration("reservation-ttl", envDurationOrDefault("RESERVATION_TTL", inventory.DefaultReservationTTL),
+		"how long the stock of a checked out order is reserved for it to be paid [RESERVATION_TTL]")
+}
+
+// loadReservationTTL returns the reservation TTL from the flags added by addInventoryFlags
+func (c *CMD) loadReservationTTL(cmd *cobra.Command) time.Duration {
+	ttl, err := cmd.Flags().GetDuration("reservation-ttl")
+	if err != nil {
+		c.logger.Fatal("failed to get the reservation ttl", zap.Error(err))
+	}
+
+	if ttl <= 0 {
+		c.logger.Fatal("reservation ttl must be positive", zap.Duration("ttl", ttl))
+	}
+
+	return ttl
+}
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/moeen/redisearch-shopping/internal/auth"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultJWTAlgorithm is the algorithm used to sign tokens when no algorithm is provided
+	defaultJWTAlgorithm = "HS256"
+
+	// defaultJWTKeyID is the kid header of the signed tokens when no key id is provided
+	defaultJWTKeyID = "default"
+)
+
+// addJWTFlags adds the flags used to configure the keys which tokens are signed and verified by,
+// every flag can also be set by its environment variable
+func addJWTFlags(cmd *cobra.Command) {
+	var verify []string
+	if v := os.Getenv("JWT_VERIFY_KEYS"); v != "" {
+		verify = strings.Split(v, ",")
+	}
+
+	cmd.Flags().String("jwt-alg", envOrDefault("JWT_ALGORITHM", defaultJWTAlgorithm),
+		"token signing algorithm, one of HS256, RS256 or ES256 (and their 384 and 512 variants) [JWT_ALGORITHM]")
+	cmd.Flags().String("jwt-kid", envOrDefault("JWT_KEY_ID", defaultJWTKeyID), "id of the signing key [JWT_KEY_ID]")
+	cmd.Flags().String("jwt-key", envOrDefault("JWT_KEY_FILE", ""),
+		"file of the PEM encoded private key, or the secret of HMAC algorithms, "+
+			"it or --jwt-secret is required in release mode [JWT_KEY_FILE]")
+	cmd.Flags().String("jwt-secret", envOrDefault("JWT_SECRET", ""), "secret of HMAC algorithms [JWT_SECRET]")
+	cmd.Flags().StringSlice("jwt-verify-key", verify,
+		"previous keys which tokens are still verified by, formatted as kid:alg:file [JWT_VERIFY_KEYS]")
+}
+
+// loadKeySet creates the KeySet from the flags added by addJWTFlags, tokens are only signed by
+// a random secret when no key is provided in debug mode
+func (c *CMD) loadKeySet(cmd *cobra.Command, mode string) *auth.KeySet {
+	alg, err := cmd.Flags().GetString("jwt-alg")
+	if err != nil {
+		c.logger.Fatal("failed to get the jwt algorithm", zap.Error(err))
+	}
+
+	kid, err := cmd.Flags().GetString("jwt-kid")
+	if err != nil {
+		c.logger.Fatal("failed to get the jwt key id", zap.Error(err))
+	}
+
+	keyFile, err := cmd.Flags().GetString("jwt-key")
+	if err != nil {
+		c.logger.Fatal("failed to get the jwt key file", zap.Error(err))
+	}
+
+	secret, err := cmd.Flags().GetString("jwt-secret")
+	if err != nil {
+		c.logger.Fatal("failed to get the jwt secret", zap.Error(err))
+	}
+
+	verify, err := cmd.Flags().GetStringSlice("jwt-verify-key")
+	if err != nil {
+		c.logger.Fatal("failed to get the jwt verification keys", zap.Error(err))
+	}
+
+	var signing *auth.Key
+	switch {
+	case keyFile != "":
+		signing, err = auth.LoadKey(kid, alg, keyFile)
+	case secret != "":
+		signing, err = auth.NewHMACKey(kid, alg, []byte(secret))
+	default:
+		if mode == gin.ReleaseMode {
+			c.logger.Fatal("a jwt key file or secret is required in release mode")
+		}
+		if _, ok := jwt.GetSigningMethod(alg).(*jwt.SigningMethodHMAC); !ok {
+			c.logger.Fatal("a key file is required", zap.String("algorithm", alg))
+		}
+		c.logger.Warn("no jwt key is provided, tokens are signed by a random secret and won't survive restarts")
+		random := make([]byte, 32)
+		if _, err := rand.Read(random); err != nil {
+			c.logger.Fatal("failed to create jwt secret", zap.Error(err))
+		}
+		signing, err = auth.NewHMACKey(kid, alg, random)
+	}
+	if err != nil {
+		c.logger.Fatal("failed to load the jwt signing key", zap.Error(err))
+	}
+
+	keys := make([]*auth.Key, len(verify))
+	for i, v := range verify {
+		keys[i], err = parseKeySpec(v)
+		if err != nil {
+			c.logger.Fatal("failed to load the jwt verification key", zap.Error(err))
+		}
+	}
+
+	ks, err := auth.NewKeySet(signing, keys...)
+	if err != nil {
+		c.logger.Fatal("failed to create jwt key set", zap.Error(err))
+	}
+
+	return ks
+}
+
+// parseKeySpec loads a key described as kid:alg:file
+func parseKeySpec(spec string) (*auth.Key, error) {
+	parts := strings.SplitN(spec, ":", 3)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid key %q, expected kid:alg:file", spec)
+	}
+
+	return auth.LoadKey(parts[0], parts[1], parts[2])
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/moeen/redisearch-shopping/internal/mailer"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// addMailerFlags adds the flags used to configure how emails are delivered,
+// every flag can also be set by its environment variable
+func addMailerFlags(cmd *cobra.Command) {
+	cmd.Flags().String("smtp-addr", envOrDefault("SMTP_ADDR", ""),
+		"SMTP server address as host:port, required in release mode, emails are only logged when it's empty [SMTP_ADDR]")
+	cmd.Flags().String("smtp-from", envOrDefault("SMTP_FROM", "no-reply@localhost"), "sender address of emails [SMTP_FROM]")
+	cmd.Flags().String("smtp-user", envOrDefault("SMTP_USER", ""), "SMTP username [SMTP_USER]")
+	cmd.Flags().String("smtp-password", envOrDefault("SMTP_PASSWORD", ""), "SMTP password [SMTP_PASSWORD]")
+}
+
+// loadMailer creates the Mailer from the flags added by addMailerFlags, emails are only logged
+// without an SMTP server, which is refused in release mode
+func (c *CMD) loadMailer(cmd *cobra.Command, mode string) mailer.Mailer {
+	addr, err := cmd.Flags().GetString("smtp-addr")
+	if err != nil {
+		c.logger.Fatal("failed to get the smtp address", zap.Error(err))
+	}
+
+	if addr == "" {
+		if mode == gin.ReleaseMode {
+			c.logger.Fatal("an smtp server is required in release mode")
+		}
+		c.logger.Warn("no smtp server is provided, emails are only logged")
+		return mailer.NewLocalMailer(c.logger.Named("mailer"))
+	}
+
+	from, err := cmd.Flags().GetString("smtp-from")
+	if err != nil {
+		c.logger.Fatal("failed to get the smtp sender", zap.Error(err))
+	}
+
+	user, err := cmd.Flags().GetString("smtp-user")
+	if err != nil {
+		c.logger.Fatal("failed to get the smtp username", zap.Error(err))
+	}
+
+	password, err := cmd.Flags().GetString("smtp-password")
+	if err != nil {
+		c.logger.Fatal("failed to get the smtp password", zap.Error(err))
+	}
+
+	m, err := mailer.NewSMTPMailer(addr, from, user, password)
+	if err != nil {
+		c.logger.Fatal("failed to create smtp mailer", zap.Error(err))
+	}
+
+	return m
+}
@@ -11,50 +11,92 @@ var mockProductsData = []*models.Product{
 	{
 		Name:  "Bread",
 		Price: 4,
+		Stock: 100,
 	},
 	{
 		Name:  "Meat",
 		Price: 16,
+		Stock: 100,
 	},
 	{
 		Name:  "Rice",
 		Price: 5,
+		Stock: 100,
 	},
 	{
 		Name:  "Eggs",
 		Price: 4,
+		Stock: 100,
 	},
 	{
 		Name:  "Apples",
 		Price: 6,
+		Stock: 100,
 	},
 	{
 		Name:  "Potato",
 		Price: 4,
+		Stock: 100,
 	},
 	{
 		Name:  "Tomato",
 		Price: 6,
+		Stock: 100,
 	},
 	{
 		Name:  "Onion",
 		Price: 4,
+		Stock: 100,
 	},
 	{
 		Name:  "Chicken",
 		Price: 13,
+		Stock: 100,
 	},
 	{
 		Name:  "Milk",
 		Price: 1,
+		Stock: 100,
 	},
 }
 
+// mockCategory is a mock category along with the slug of its parent, parents are listed before their children
+type mockCategory struct {
+	name   string
+	slug   string
+	parent string
+}
+
+var mockCategoriesData = []mockCategory{
+	{name: "Groceries", slug: "groceries"},
+	{name: "Bakery", slug: "bakery", parent: "groceries"},
+	{name: "Meat", slug: "meat", parent: "groceries"},
+	{name: "Grains", slug: "grains", parent: "groceries"},
+	{name: "Dairy & Eggs", slug: "dairy-and-eggs", parent: "groceries"},
+	{name: "Produce", slug: "produce", parent: "groceries"},
+	{name: "Fruits", slug: "fruits", parent: "produce"},
+	{name: "Vegetables", slug: "vegetables", parent: "produce"},
+}
+
+// mockProductCategories is the slug of the category of each mock product by its name
+var mockProductCategories = map[string]string{
+	"Bread":   "bakery",
+	"Meat":    "meat",
+	"Rice":    "grains",
+	"Eggs":    "dairy-and-eggs",
+	"Apples":  "fruits",
+	"Potato":  "vegetables",
+	"Tomato":  "vegetables",
+	"Onion":   "vegetables",
+	"Chicken": "meat",
+	"Milk":    "dairy-and-eggs",
+}
+
 // mockCommand creates the mock command which populates the database with mock data
 func (c *CMD) mockCommand() *cobra.Command {
 	mock := &cobra.Command{
 		Use:   "mock",
-		Long:  "mock will populate the database with mock products data",
+		Long:  "mock will populate the database with mock categories and products data",
 		Short: "populate products in database",
 		Run:   c.mockRun,
 	}
@@ -79,9 +121,33 @@ func (c *CMD) mockRun(cmd *cobra.Command, args []string) {
 		c.logger.Fatal("failed to init database", zap.Error(err))
 	}
 
+	categories := make(map[string]uint, len(mockCategoriesData))
+	for _, m := range mockCategoriesData {
+		category := &models.Category{Name: m.name, Slug: m.slug}
+		if parentID, ok := categories[m.parent]; ok {
+			category.ParentID = &parentID
+		}
+
+		if err := db.CreateCategory(category); err != nil {
+			c.logger.Error("failed to add category", zap.String("slug", m.slug), zap.Error(err))
+			continue
+		}
+		categories[m.slug] = category.ID
+	}
+
 	for _, p := range mockProductsData {
 		if err := db.AddProduct(p); err != nil {
 			c.logger.Error("failed to add product", zap.Error(err))
+			continue
+		}
+
+		categoryID, ok := categories[mockProductCategories[p.Name]]
+		if !ok {
+			continue
+		}
+
+		if _, err := db.SetProductCategories(int(p.ID), []int{int(categoryID)}); err != nil {
+			c.logger.Error("failed to set product categories", zap.String("product", p.Name), zap.Error(err))
 		}
 	}
 }
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"github.com/moeen/redisearch-shopping/internal/auth"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// addPasswordFlags adds the flags used to configure the rules which new passwords must follow,
+// every flag can also be set by its environment variable
+func addPasswordFlags(cmd *cobra.Command) {
+	def := auth.DefaultPasswordPolicy
+
+	cmd.Flags().Int("password-min-length", envIntOrDefault("PASSWORD_MIN_LENGTH", def.MinLength),
+		"minimum number of characters of passwords [PASSWORD_MIN_LENGTH]")
+	cmd.Flags().Bool("password-require-lower", envBoolOrDefault("PASSWORD_REQUIRE_LOWER", def.RequireLower),
+		"require a lowercase letter in passwords [PASSWORD_REQUIRE_LOWER]")
+	cmd.Flags().Bool("password-require-upper", envBoolOrDefault("PASSWORD_REQUIRE_UPPER", def.RequireUpper),
+		"require an uppercase letter in passwords [PASSWORD_REQUIRE_UPPER]")
+	cmd.Flags().Bool("password-require-digit", envBoolOrDefault("PASSWORD_REQUIRE_DIGIT", def.RequireDigit),
+		"require a digit in passwords [PASSWORD_REQUIRE_DIGIT]")
+	cmd.Flags().Bool("password-require-symbol", envBoolOrDefault("PASSWORD_REQUIRE_SYMBOL", def.RequireSymbol),
+		"require a symbol in passwords [PASSWORD_REQUIRE_SYMBOL]")
+}
+
+// loadPasswordPolicy creates the PasswordPolicy from the flags added by addPasswordFlags
+func (c *CMD) loadPasswordPolicy(cmd *cobra.Command) auth.PasswordPolicy {
+	var (
+		p   auth.PasswordPolicy
+		err error
+	)
+
+	if p.MinLength, err = cmd.Flags().GetInt("password-min-length"); err != nil {
+		c.logger.Fatal("failed to get the password min length", zap.Error(err))
+	}
+
+	if p.RequireLower, err = cmd.Flags().GetBool("password-require-lower"); err != nil {
+		c.logger.Fatal("failed to get the password lowercase rule", zap.Error(err))
+	}
+
+	if p.RequireUpper, err = cmd.Flags().GetBool("password-require-upper"); err != nil {
+		c.logger.Fatal("failed to get the password uppercase rule", zap.Error(err))
+	}
+
+	if p.RequireDigit, err = cmd.Flags().GetBool("password-require-digit"); err != nil {
+		c.logger.Fatal("failed to get the password digit rule", zap.Error(err))
+	}
+
+	if p.RequireSymbol, err = cmd.Flags().GetBool("password-require-symbol"); err != nil {
+		c.logger.Fatal("failed to get the password symbol rule", zap.Error(err))
+	}
+
+	return p
+}
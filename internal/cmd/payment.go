@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/moeen/redisearch-shopping/internal/payment"
+	"github.com/moeen/redisearch-shopping/internal/router"
+	"github.com/moeen/redisearch-shopping/internal/storage"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"strings"
+)
+
+// addPaymentFlags adds the flags used to configure the payment provider,
+// every flag can also be set by its environment variable
+func addPaymentFlags(cmd *cobra.Command) {
+	cmd.Flags().String("payment-provider", envOrDefault("PAYMENT_PROVIDER", ""),
+		"payment provider which charges orders, only fake is supported, "+
+			"defaults to fake outside release mode [PAYMENT_PROVIDER]")
+	cmd.Flags().Bool("allow-fake-payments", envBoolOrDefault("ALLOW_FAKE_PAYMENTS", false),
+		"allow the fake provider, which never charges anything, in release mode [ALLOW_FAKE_PAYMENTS]")
+	cmd.Flags().String("payment-webhook-secret", envOrDefault("PAYMENT_WEBHOOK_SECRET", ""),
+		"secret which payment webhook events are signed with [PAYMENT_WEBHOOK_SECRET]")
+	cmd.Flags().String("fake-payments-url", envOrDefault("FAKE_PAYMENTS_URL", ""),
+		"public URL of the server which the fake provider sends events and customers to, "+
+			"defaults to localhost with the server port [FAKE_PAYMENTS_URL]")
+}
+
+// loadPayments creates the payment Processor from the flags added by addPaymentFlags, the provider
+// defaults to the fake one outside release mode, where it's refused unless it's explicitly allowed
+func (c *CMD) loadPayments(cmd *cobra.Command, st storage.Storage, mode string, port int) *payment.Processor {
+	name, err := cmd.Flags().GetString("payment-provider")
+	if err != nil {
+		c.logger.Fatal("failed to get the payment provider", zap.Error(err))
+	}
+
+	allowFake, err := cmd.Flags().GetBool("allow-fake-payments")
+	if err != nil {
+		c.logger.Fatal("failed to get whether fake payments are allowed", zap.Error(err))
+	}
+
+	secret, err := cmd.Flags().GetString("payment-webhook-secret")
+	if err != nil {
+		c.logger.Fatal("failed to get the payment webhook secret", zap.Error(err))
+	}
+
+	fakeURL, err := cmd.Flags().GetString("fake-payments-url")
+	if err != nil {
+		c.logger.Fatal("failed to get the fake payments url", zap.Error(err))
+	}
+
+	key := []byte(secret)
+	if secret == "" {
+		c.logger.Warn("no payment webhook secret is provided, a random one is used")
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			c.logger.Fatal("failed to create payment webhook secret", zap.Error(err))
+		}
+	}
+
+	if name == "" {
+		if mode == gin.ReleaseMode {
+			c.logger.Fatal("a payment provider is required in release mode")
+		}
+		name = "fake"
+	}
+
+	var provider payment.PaymentProvider
+	switch name {
+	case "fake":
+		if mode == gin.ReleaseMode && !allowFake {
+			c.logger.Fatal("the fake payment provider authorizes payments without charging anything, " +
+				"it's refused in release mode unless --allow-fake-payments is set")
+		}
+		c.logger.Warn("fake payments are enabled, orders are paid without charging anything")
+
+		if fakeURL == "" {
+			fakeURL = fmt.Sprintf("http://localhost:%d", port)
+		}
+		fakeURL = strings.TrimSuffix(fakeURL, "/")
+
+		provider = payment.NewFakeProvider(key, fakeURL+router.PaymentWebhookPath,
+			fakeURL+router.FakePaymentActionPath+"/", c.logger.Named("fake-payments"))
+	default:
+		c.logger.Fatal("invalid payment provider", zap.String("provider", name))
+	}
+
+	return payment.NewProcessor(st, provider, key, c.logger.Named("payments"))
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"github.com/moeen/redisearch-shopping/internal/pricing"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// addPricingFlags adds the flags used to configure how carts are priced,
+// every flag can also be set by its environment variable
+func addPricingFlags(cmd *cobra.Command) {
+	cmd.Flags().Int("tax-rate", envIntOrDefault("TAX_RATE", 0),
+		"tax charged on carts in basis points, 1000 is 10% [TAX_RATE]")
+}
+
+// loadPricing creates the pricing Service from the flags added by addPricingFlags
+func (c *CMD) loadPricing(cmd *cobra.Command) pricing.Service {
+	var (
+		s   pricing.Service
+		err error
+	)
+
+	if s.TaxRate, err = cmd.Flags().GetInt("tax-rate"); err != nil {
+		c.logger.Fatal("failed to get the tax rate", zap.Error(err))
+	}
+
+	if err := s.Validate(); err != nil {
+		c.logger.Fatal("invalid pricing configuration", zap.Error(err))
+	}
+
+	return s
+}
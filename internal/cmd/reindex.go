@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"github.com/moeen/redisearch-shopping/internal/storage/redisearch"
+	"github.com/moeen/redisearch-shopping/internal/storage/sqlite"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// reindexCommand creates the reindex command which rebuilds the search index
+func (c *CMD) reindexCommand() *cobra.Command {
+	reindex := &cobra.Command{
+		Use:   "reindex",
+		Long:  "reindex builds a new version of the search index from the database and swaps it with the live one",
+		Short: "rebuild search index",
+		Run:   c.reindexRun,
+	}
+
+	reindex.Flags().StringP("sqlite", "s", "./test.db", "sqlite database file address")
+	reindex.Flags().StringP("redis", "r", defaultRedisAddress, "RediSearch address")
+	reindex.Flags().StringP("index", "i", defaultIndex, "RediSearch index alias")
+
+	return reindex
+}
+
+// reindexRun rebuilds the search index while the live one keeps serving searches
+func (c *CMD) reindexRun(cmd *cobra.Command, args []string) {
+	addr, err := cmd.Flags().GetString("sqlite")
+	if err != nil {
+		c.logger.Fatal("failed to get the sqlite address", zap.Error(err))
+	}
+
+	redisAddr, err := cmd.Flags().GetString("redis")
+	if err != nil {
+		c.logger.Fatal("failed to get the redis address", zap.Error(err))
+	}
+
+	index, err := cmd.Flags().GetString("index")
+	if err != nil {
+		c.logger.Fatal("failed to get the index", zap.Error(err))
+	}
+
+	db, err := sqlite.NewSQLiteDatabase(addr)
+	if err != nil {
+		c.logger.Fatal("failed to create sqlite db", zap.Error(err))
+	}
+	if err := db.Init(); err != nil {
+		c.logger.Fatal("failed to init database", zap.Error(err))
+	}
+
+	rs := redisearch.NewRediSearch(redisAddr, index, db, c.logger.Named("redisearch"))
+	if err := rs.Reindex(); err != nil {
+		c.logger.Fatal("failed to reindex", zap.Error(err))
+	}
+
+	c.logger.Info("reindex finished", zap.String("index", index))
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"github.com/moeen/redisearch-shopping/internal/storage/sqlite"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// roleCommand creates the role command which changes the role of a customer
+func (c *CMD) roleCommand() *cobra.Command {
+	role := &cobra.Command{
+		Use:   "role",
+		Long:  "role will change the role of a customer to one of customer, staff or admin",
+		Short: "change customer role",
+		Run:   c.roleRun,
+	}
+
+	role.Flags().StringP("sqlite", "s", "./test.db", "sqlite database file address")
+	role.Flags().IntP("customer", "c", 0, "customer id")
+	role.Flags().StringP("role", "r", string(models.RoleCustomer), "new role of the customer")
+
+	return role
+}
+
+// roleRun changes the role of the given customer
+func (c *CMD) roleRun(cmd *cobra.Command, args []string) {
+	addr, err := cmd.Flags().GetString("sqlite")
+	if err != nil {
+		c.logger.Fatal("failed to get the sqlite address", zap.Error(err))
+	}
+
+	id, err := cmd.Flags().GetInt("customer")
+	if err != nil {
+		c.logger.Fatal("failed to get the customer id", zap.Error(err))
+	}
+
+	r, err := cmd.Flags().GetString("role")
+	if err != nil {
+		c.logger.Fatal("failed to get the role", zap.Error(err))
+	}
+
+	role := models.Role(r)
+	if !role.Valid() {
+		c.logger.Fatal("invalid role", zap.String("role", r))
+	}
+
+	db, err := sqlite.NewSQLiteDatabase(addr)
+	if err != nil {
+		c.logger.Fatal("failed to create sqlite db", zap.Error(err))
+	}
+	if err := db.Init(); err != nil {
+		c.logger.Fatal("failed to init database", zap.Error(err))
+	}
+
+	if err := db.SetCustomerRole(id, role); err != nil {
+		c.logger.Fatal("failed to set customer role", zap.Error(err))
+	}
+
+	c.logger.Info("customer role changed", zap.Int("customer", id), zap.String("role", r))
+}
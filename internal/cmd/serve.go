@@ -1,12 +1,20 @@
 package cmd
 
 import (
+	"context"
 	"github.com/gin-gonic/gin"
+	"github.com/gomodule/redigo/redis"
+	"github.com/moeen/redisearch-shopping/graph"
+	"github.com/moeen/redisearch-shopping/internal/auth"
+	"github.com/moeen/redisearch-shopping/internal/inventory"
+	"github.com/moeen/redisearch-shopping/internal/outbox"
 	"github.com/moeen/redisearch-shopping/internal/router"
 	"github.com/moeen/redisearch-shopping/internal/storage/redisearch"
 	"github.com/moeen/redisearch-shopping/internal/storage/sqlite"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
+	"os"
+	"strings"
 )
 
 // serveCommand creates the serve command which runs the GraphQL server
@@ -20,6 +28,24 @@ func (c *CMD) serveCommand() *cobra.Command {
 	serve.Flags().IntP("port", "p", router.DefaultPort, "http server port")
 	serve.Flags().StringP("mode", "m", gin.DebugMode, "router mode")
 	serve.Flags().StringP("sqlite", "s", "./test.db", "sqlite database file address")
+	serve.Flags().StringP("redis", "r", defaultRedisAddress, "RediSearch address")
+	serve.Flags().StringP("index", "i", defaultIndex, "RediSearch index alias")
+	serve.Flags().String("auth-store", "redis", "where revoked tokens and failed login attempts are kept, redis or memory")
+	serve.Flags().String("denylist", "redis", "where revoked tokens are kept, redis or memory")
+	serve.Flags().MarkDeprecated("denylist", "use --auth-store instead")
+
+	var proxies []string
+	if v := os.Getenv("TRUSTED_PROXIES"); v != "" {
+		proxies = strings.Split(v, ",")
+	}
+	serve.Flags().StringSlice("trusted-proxies", proxies,
+		"IPs or CIDRs of the proxies whose X-Forwarded-For header is trusted for client IPs [TRUSTED_PROXIES]")
+	addJWTFlags(serve)
+	addMailerFlags(serve)
+	addPasswordFlags(serve)
+	addPricingFlags(serve)
+	addPaymentFlags(serve)
+	addInventoryFlags(serve)
 
 	return serve
 }
@@ -41,6 +67,44 @@ func (c *CMD) serveRun(cmd *cobra.Command, args []string) {
 		c.logger.Fatal("failed to get the sqlite address", zap.Error(err))
 	}
 
+	redisAddr, err := cmd.Flags().GetString("redis")
+	if err != nil {
+		c.logger.Fatal("failed to get the redis address", zap.Error(err))
+	}
+
+	index, err := cmd.Flags().GetString("index")
+	if err != nil {
+		c.logger.Fatal("failed to get the index", zap.Error(err))
+	}
+
+	authStore, err := cmd.Flags().GetString("auth-store")
+	if err != nil {
+		c.logger.Fatal("failed to get the auth store", zap.Error(err))
+	}
+
+	// the old name of the flag is still honoured unless the new one is set
+	if cmd.Flags().Changed("denylist") && !cmd.Flags().Changed("auth-store") {
+		if authStore, err = cmd.Flags().GetString("denylist"); err != nil {
+			c.logger.Fatal("failed to get the denylist", zap.Error(err))
+		}
+	}
+
+	proxies, err := cmd.Flags().GetStringSlice("trusted-proxies")
+	if err != nil {
+		c.logger.Fatal("failed to get the trusted proxies", zap.Error(err))
+	}
+
+	clientIPs, err := auth.NewClientIPResolver(proxies)
+	if err != nil {
+		c.logger.Fatal("invalid trusted proxies", zap.Error(err))
+	}
+
+	keys := c.loadKeySet(cmd, mode)
+	mailer := c.loadMailer(cmd, mode)
+	passwords := c.loadPasswordPolicy(cmd)
+	prices := c.loadPricing(cmd)
+	reservationTTL := c.loadReservationTTL(cmd)
+
 	db, err := sqlite.NewSQLiteDatabase(addr)
 	if err != nil {
 		c.logger.Fatal("failed to create sqlite db", zap.Error(err))
@@ -49,11 +113,56 @@ func (c *CMD) serveRun(cmd *cobra.Command, args []string) {
 		c.logger.Fatal("failed to init database", zap.Error(err))
 	}
 
-	rs := redisearch.NewRediSearch("127.0.0.1:6379", "test", db)
+	payments := c.loadPayments(cmd, db, mode, port)
+
+	rs := redisearch.NewRediSearch(redisAddr, index, db, c.logger.Named("redisearch"))
 	if err := rs.Init(); err != nil {
 		c.logger.Fatal("failed to init RediSearch", zap.Error(err))
 	}
 
-	restServer := router.GraphQLServer(mode, port, db, rs, c.logger.Named("router"))
+	var (
+		denylist auth.Denylist
+		attempts auth.AttemptStore
+	)
+	switch authStore {
+	case "redis":
+		pool := &redis.Pool{
+			Dial: func() (redis.Conn, error) {
+				return redis.Dial("tcp", redisAddr)
+			},
+			MaxIdle:     authStoreMaxIdle,
+			IdleTimeout: authStoreIdleTimeout,
+		}
+		denylist = auth.NewRedisDenylist(pool, index+":denylist:")
+		attempts = auth.NewRedisAttemptStore(pool, index+":login:")
+	case "memory":
+		denylist = auth.NewMemoryDenylist()
+		attempts = auth.NewMemoryAttemptStore()
+	default:
+		c.logger.Fatal("invalid auth store", zap.String("store", authStore))
+	}
+
+	w := outbox.NewWorker(db, rs, c.logger.Named("outbox"), outbox.DefaultInterval)
+	go w.Run(context.Background())
+
+	iw := inventory.NewWorker(db, payments, c.logger.Named("inventory"), inventory.DefaultInterval)
+	go iw.Run(context.Background())
+
+	resolver := &graph.Resolver{
+		Storage:  db,
+		Searcher: rs,
+		Keys:     keys,
+		Denylist: denylist,
+		Limiter:  auth.NewLoginLimiter(attempts, c.logger.Named("login")),
+		Mailer:   mailer,
+		Logger:   c.logger.Named("graph"),
+
+		PasswordPolicy: passwords,
+		Pricing:        prices,
+		Payments:       payments,
+		ReservationTTL: reservationTTL,
+	}
+
+	restServer := router.GraphQLServer(mode, port, resolver, clientIPs, c.logger.Named("router"))
 	c.logger.Fatal(restServer.ListenAndServe().Error())
 }
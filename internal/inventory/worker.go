@@ -0,0 +1,118 @@
+// Package inventory cancels the orders which are not paid before their stock reservations expire,
+// which puts the reserved stock back so other customers can buy it
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/moeen/redisearch-shopping/internal/orderstate"
+	"github.com/moeen/redisearch-shopping/internal/payment"
+	"github.com/moeen/redisearch-shopping/internal/storage"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+	"go.uber.org/zap"
+	"time"
+)
+
+const (
+	// DefaultInterval is the default time between two checks of expired reservations
+	DefaultInterval = 30 * time.Second
+
+	// DefaultReservationTTL is the default time the stock of an order is reserved for it to be paid
+	DefaultReservationTTL = 15 * time.Minute
+
+	// batchSize is the maximum number of orders cancelled in each check
+	batchSize = 100
+
+	// expiredReason is the reason recorded for orders cancelled by the worker
+	expiredReason = "stock reservation expired"
+)
+
+// Worker cancels the pending orders whose stock reservations are expired and voids their payments,
+// a payment which is captured meanwhile is refunded
+type Worker struct {
+	storage  storage.Storage
+	payments *payment.Processor
+	logger   *zap.Logger
+	interval time.Duration
+	now      func() time.Time
+}
+
+// NewWorker creates a new Worker which checks for expired reservations every interval
+func NewWorker(storage storage.Storage, payments *payment.Processor, logger *zap.Logger, interval time.Duration) *Worker {
+	return &Worker{
+		storage:  storage,
+		payments: payments,
+		logger:   logger,
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+// Run cancels the expired orders periodically until the context is done
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.Expire(ctx); err != nil {
+			w.logger.Error("failed to expire stock reservations", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Expire cancels the orders with expired reservations once, orders which fail are logged and retried next time
+func (w *Worker) Expire(ctx context.Context) error {
+	ids, err := w.storage.GetExpiredReservationOrders(w.now(), batchSize)
+	if err != nil {
+		return fmt.Errorf("failed to get expired reservations: %w", err)
+	}
+
+	for _, id := range ids {
+		if err := w.cancel(ctx, id); err != nil {
+			w.logger.Warn("failed to cancel expired order", zap.Int("order_id", id), zap.Error(err))
+		}
+	}
+
+	return nil
+}
+
+// cancel cancels the pending order, which releases its reservations, and voids its payment
+func (w *Worker) cancel(ctx context.Context, id int) error {
+	order, err := w.storage.GetOrder(id)
+	if err != nil {
+		return err
+	}
+
+	entry, err := orderstate.Transition(order, models.OrderCancelled, 0, expiredReason)
+	if err != nil {
+		return err
+	}
+
+	// a captured payment fails here, its order is about to be paid so it's not cancelled
+	if err := w.payments.CheckRelease(order, models.OrderCancelled); err != nil {
+		return err
+	}
+
+	err = w.storage.UpdateOrderStatus(entry)
+	if errors.Is(err, storage.ErrOrderStatusChanged) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// the payment is only given back once the order is cancelled, so an order which stays pending
+	// can still be paid. A payment captured meanwhile is refunded.
+	if err := w.payments.Release(ctx, order, models.OrderCancelled); err != nil {
+		return fmt.Errorf("order is cancelled but its payment is not released: %w", err)
+	}
+
+	return nil
+}
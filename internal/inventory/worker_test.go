@@ -0,0 +1,147 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/golang/mock/gomock"
+	"github.com/moeen/redisearch-shopping/internal/apperr"
+	"github.com/moeen/redisearch-shopping/internal/payment"
+	"github.com/moeen/redisearch-shopping/internal/storage"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+func TestWorker_Expire(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	order := func(id uint, status models.OrderStatus) *models.Order {
+		return &models.Order{Model: gorm.Model{ID: id}, Status: status}
+	}
+	cancelled := func(id int) *models.OrderHistory {
+		return &models.OrderHistory{
+			OrderID:    id,
+			FromStatus: models.OrderPending,
+			ToStatus:   models.OrderCancelled,
+			Reason:     expiredReason,
+		}
+	}
+
+	newWorker := func(st storage.Storage, provider payment.PaymentProvider) *Worker {
+		w := NewWorker(st, payment.NewProcessor(st, provider, nil, zap.NewNop()), zap.NewNop(), DefaultInterval)
+		w.now = func() time.Time { return now }
+		return w
+	}
+
+	t.Run("test when storage returns an error", func(t *testing.T) {
+		c := gomock.NewController(t)
+		defer c.Finish()
+
+		st := storage.NewMockStorage(c)
+		st.EXPECT().GetExpiredReservationOrders(now, batchSize).Times(1).Return(nil, errors.New("failed"))
+
+		assert.Error(t, newWorker(st, payment.NewFakeProvider(nil, "", "", zap.NewNop())).Expire(ctx))
+	})
+
+	t.Run("test expired orders are cancelled", func(t *testing.T) {
+		c := gomock.NewController(t)
+		defer c.Finish()
+
+		st := storage.NewMockStorage(c)
+		st.EXPECT().GetExpiredReservationOrders(now, batchSize).Times(1).Return([]int{1, 2, 3}, nil)
+
+		// a failed order doesn't stop the others
+		st.EXPECT().GetOrder(1).Times(1).Return(nil, errors.New("failed"))
+
+		st.EXPECT().GetOrder(2).Times(1).Return(order(2, models.OrderPending), nil)
+		st.EXPECT().GetOrderPayment(2).Times(1).Return(nil, apperr.NotFound("payment not found"))
+		st.EXPECT().UpdateOrderStatus(cancelled(2)).Times(1).Return(storage.ErrOrderStatusChanged)
+
+		st.EXPECT().GetOrder(3).Times(1).Return(order(3, models.OrderPending), nil)
+		st.EXPECT().GetOrderPayment(3).Times(2).Return(nil, apperr.NotFound("payment not found"))
+		st.EXPECT().UpdateOrderStatus(cancelled(3)).Times(1).Return(nil)
+
+		assert.NoError(t, newWorker(st, payment.NewFakeProvider(nil, "", "", zap.NewNop())).Expire(ctx))
+	})
+
+	t.Run("test payments are voided once the order is cancelled", func(t *testing.T) {
+		c := gomock.NewController(t)
+		defer c.Finish()
+
+		st := storage.NewMockStorage(c)
+		provider := payment.NewFakeProvider(nil, "", "", zap.NewNop())
+		pending, err := provider.Authorize(ctx, payment.AuthorizeRequest{OrderID: 1, Amount: 10, Token: payment.FakeToken3DS}, "a")
+		require.NoError(t, err)
+
+		st.EXPECT().GetExpiredReservationOrders(now, batchSize).Times(1).Return([]int{1, 2}, nil)
+
+		st.EXPECT().GetOrder(1).Times(1).Return(order(1, models.OrderPending), nil)
+		st.EXPECT().GetOrderPayment(1).Times(2).Return(&models.Payment{
+			OrderID: 1, ProviderID: pending.ID, Status: models.PaymentPending, Amount: 10,
+		}, nil)
+		st.EXPECT().GetPayment(pending.ID).Times(1).Return(&models.Payment{
+			OrderID: 1, ProviderID: pending.ID, Status: models.PaymentPending, Amount: 10,
+		}, nil)
+		st.EXPECT().SavePayment(&models.Payment{
+			OrderID: 1, ProviderID: pending.ID, Status: models.PaymentVoided, Amount: 10,
+		}).Times(1).Return(nil)
+		st.EXPECT().UpdateOrderStatus(cancelled(1)).Times(1).Return(nil)
+
+		// captured payments can't be voided, their orders are about to be paid
+		st.EXPECT().GetOrder(2).Times(1).Return(order(2, models.OrderPending), nil)
+		st.EXPECT().GetOrderPayment(2).Times(1).Return(&models.Payment{
+			OrderID: 2, ProviderID: "pay_9", Status: models.PaymentCaptured, Amount: 10,
+		}, nil)
+
+		w := newWorker(st, provider)
+		assert.NoError(t, w.Expire(ctx))
+	})
+
+	t.Run("test orders which moved meanwhile keep their payment", func(t *testing.T) {
+		c := gomock.NewController(t)
+		defer c.Finish()
+
+		st := storage.NewMockStorage(c)
+		provider := payment.NewFakeProvider(nil, "", "", zap.NewNop())
+		pending, err := provider.Authorize(ctx, payment.AuthorizeRequest{OrderID: 1, Amount: 10, Token: payment.FakeToken3DS}, "a")
+		require.NoError(t, err)
+
+		st.EXPECT().GetExpiredReservationOrders(now, batchSize).Times(1).Return([]int{1}, nil)
+		st.EXPECT().GetOrder(1).Times(1).Return(order(1, models.OrderPending), nil)
+		st.EXPECT().GetOrderPayment(1).Times(1).Return(&models.Payment{
+			OrderID: 1, ProviderID: pending.ID, Status: models.PaymentPending, Amount: 10,
+		}, nil)
+		st.EXPECT().UpdateOrderStatus(cancelled(1)).Times(1).Return(fmt.Errorf("wrapped: %w", storage.ErrOrderStatusChanged))
+
+		// the payment is neither voided nor saved
+		assert.NoError(t, newWorker(st, provider).Expire(ctx))
+	})
+
+	t.Run("test orders which moved on are left alone", func(t *testing.T) {
+		c := gomock.NewController(t)
+		defer c.Finish()
+
+		st := storage.NewMockStorage(c)
+		st.EXPECT().GetExpiredReservationOrders(now, batchSize).Times(1).Return([]int{1}, nil)
+		st.EXPECT().GetOrder(1).Times(1).Return(order(1, models.OrderPaid), nil)
+
+		assert.NoError(t, newWorker(st, payment.NewFakeProvider(nil, "", "", zap.NewNop())).Expire(ctx))
+	})
+
+	t.Run("test unknown order", func(t *testing.T) {
+		c := gomock.NewController(t)
+		defer c.Finish()
+
+		st := storage.NewMockStorage(c)
+		st.EXPECT().GetExpiredReservationOrders(now, batchSize).Times(1).Return([]int{1}, nil)
+		st.EXPECT().GetOrder(1).Times(1).Return(nil, apperr.NotFound("order not found"))
+
+		assert.NoError(t, newWorker(st, payment.NewFakeProvider(nil, "", "", zap.NewNop())).Expire(ctx))
+	})
+}
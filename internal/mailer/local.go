@@ -0,0 +1,63 @@
+package mailer
+
+import (
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// maxSent is how many of the last messages a LocalMailer keeps
+const maxSent = 100
+
+// LocalMailer is the Mailer used in development and tests, instead of delivering the messages
+// it logs them without their body, which can hold tokens, and keeps the last maxSent of them so
+// they can be inspected
+type LocalMailer struct {
+	logger *zap.Logger
+
+	sent []Message
+	mu   sync.Mutex
+}
+
+// NewLocalMailer creates a LocalMailer which logs the messages to the given logger
+func NewLocalMailer(logger *zap.Logger) *LocalMailer {
+	return &LocalMailer{logger: logger}
+}
+
+func (m *LocalMailer) Send(msg Message) error {
+	m.mu.Lock()
+	m.sent = append(m.sent, msg)
+	if len(m.sent) > maxSent {
+		m.sent = append([]Message(nil), m.sent[len(m.sent)-maxSent:]...)
+	}
+	m.mu.Unlock()
+
+	m.logger.Info("email sent",
+		zap.String("to", msg.To),
+		zap.String("subject", msg.Subject),
+	)
+
+	return nil
+}
+
+// Sent returns the last messages sent so far in the order they were sent
+func (m *LocalMailer) Sent() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Message(nil), m.sent...)
+}
+
+// Last returns the last message sent to the address
+func (m *LocalMailer) Last(to string) (Message, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.sent) - 1; i >= 0; i-- {
+		if m.sent[i].To == to {
+			return m.sent[i], true
+		}
+	}
+
+	return Message{}, false
+}
@@ -0,0 +1,61 @@
+package mailer
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"testing"
+)
+
+func TestLocalMailer(t *testing.T) {
+	m := NewLocalMailer(zap.NewNop())
+
+	t.Run("test with no messages", func(t *testing.T) {
+		assert.Empty(t, m.Sent())
+
+		_, ok := m.Last("test@test.com")
+		assert.False(t, ok)
+	})
+
+	t.Run("test sent messages", func(t *testing.T) {
+		first := Message{To: "test@test.com", Subject: "first", Body: "first"}
+		second := Message{To: "other@test.com", Subject: "second", Body: "second"}
+		third := Message{To: "test@test.com", Subject: "third", Body: "third"}
+
+		for _, msg := range []Message{first, second, third} {
+			assert.NoError(t, m.Send(msg))
+		}
+
+		assert.Equal(t, []Message{first, second, third}, m.Sent())
+
+		last, ok := m.Last("test@test.com")
+		assert.True(t, ok)
+		assert.Equal(t, third, last)
+	})
+
+	t.Run("test body is not logged", func(t *testing.T) {
+		core, logs := observer.New(zap.InfoLevel)
+		m := NewLocalMailer(zap.New(core))
+
+		assert.NoError(t, m.Send(Message{To: "test@test.com", Subject: "reset", Body: "secret-token"}))
+
+		entries := logs.All()
+		if assert.Len(t, entries, 1) {
+			assert.NotContains(t, entries[0].ContextMap(), "body")
+		}
+	})
+
+	t.Run("test only the last messages are kept", func(t *testing.T) {
+		m := NewLocalMailer(zap.NewNop())
+
+		for i := 0; i < maxSent+10; i++ {
+			assert.NoError(t, m.Send(Message{To: "test@test.com", Subject: fmt.Sprint(i)}))
+		}
+
+		sent := m.Sent()
+		assert.Len(t, sent, maxSent)
+		assert.Equal(t, "10", sent[0].Subject)
+		assert.Equal(t, fmt.Sprint(maxSent+9), sent[maxSent-1].Subject)
+	})
+}
@@ -0,0 +1,14 @@
+package mailer
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer is the interface used to deliver emails to customers
+type Mailer interface {
+	// Send delivers the message
+	Send(msg Message) error
+}
@@ -0,0 +1,65 @@
+package mailer
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+// headerReplacer removes line breaks from header values so they can't inject other headers
+var headerReplacer = strings.NewReplacer("\r", "", "\n", "")
+
+// SMTPMailer is the SMTP implementation of Mailer
+type SMTPMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+
+	// send is smtp.SendMail, it's replaced in tests
+	send func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// NewSMTPMailer creates an SMTPMailer which sends emails from the given address through the
+// server at addr, username and password are only used when username is not empty
+func NewSMTPMailer(addr, from, username, password string) (*SMTPMailer, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid smtp address: %w", err)
+	}
+
+	m := &SMTPMailer{
+		addr: addr,
+		from: from,
+		send: smtp.SendMail,
+	}
+
+	if username != "" {
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return m, nil
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	if err := m.send(m.addr, m.auth, m.from, []string{msg.To}, m.encode(msg)); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	return nil
+}
+
+// encode creates the RFC 5322 representation of the message
+func (m *SMTPMailer) encode(msg Message) []byte {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "From: %s\r\n", headerReplacer.Replace(m.from))
+	fmt.Fprintf(&b, "To: %s\r\n", headerReplacer.Replace(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerReplacer.Replace(msg.Subject))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	return []byte(b.String())
+}
@@ -0,0 +1,66 @@
+package mailer
+
+import (
+	"errors"
+	"net/smtp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSMTPMailer(t *testing.T) {
+	t.Run("test with invalid address", func(t *testing.T) {
+		m, err := NewSMTPMailer("localhost", "shop@test.com", "", "")
+		assert.Error(t, err)
+		assert.Nil(t, m)
+	})
+
+	t.Run("test without credentials", func(t *testing.T) {
+		m, err := NewSMTPMailer("localhost:25", "shop@test.com", "", "")
+		assert.NoError(t, err)
+		assert.Nil(t, m.auth)
+	})
+
+	t.Run("test with credentials", func(t *testing.T) {
+		m, err := NewSMTPMailer("localhost:25", "shop@test.com", "user", "pass")
+		assert.NoError(t, err)
+		assert.NotNil(t, m.auth)
+	})
+}
+
+func TestSMTPMailer_Send(t *testing.T) {
+	m, err := NewSMTPMailer("localhost:25", "shop@test.com", "", "")
+	assert.NoError(t, err)
+
+	msg := Message{To: "test@test.com", Subject: "subject", Body: "line 1\nline 2"}
+
+	t.Run("test successful send", func(t *testing.T) {
+		m.send = func(addr string, a smtp.Auth, from string, to []string, body []byte) error {
+			assert.Equal(t, "localhost:25", addr)
+			assert.Equal(t, "shop@test.com", from)
+			assert.Equal(t, []string{"test@test.com"}, to)
+			assert.Equal(t, "From: shop@test.com\r\nTo: test@test.com\r\nSubject: subject\r\n"+
+				"MIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\nline 1\r\nline 2", string(body))
+			return nil
+		}
+
+		assert.NoError(t, m.Send(msg))
+	})
+
+	t.Run("test with line breaks in headers", func(t *testing.T) {
+		m.send = func(addr string, a smtp.Auth, from string, to []string, body []byte) error {
+			assert.Contains(t, string(body), "Subject: subjectBcc: other@test.com\r\n")
+			return nil
+		}
+
+		assert.NoError(t, m.Send(Message{To: "test@test.com", Subject: "subject\r\nBcc: other@test.com"}))
+	})
+
+	t.Run("test when server returns an error", func(t *testing.T) {
+		m.send = func(addr string, a smtp.Auth, from string, to []string, body []byte) error {
+			return errors.New("failed")
+		}
+
+		assert.Error(t, m.Send(msg))
+	})
+}
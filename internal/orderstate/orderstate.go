@@ -0,0 +1,66 @@
+// Package orderstate is the state machine of the order lifecycle, an order is paid, fulfilled,
+// shipped and delivered in order, it can be cancelled before it's paid and refunded after
+package orderstate
+
+import (
+	"fmt"
+	"github.com/moeen/redisearch-shopping/internal/apperr"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+	"strings"
+)
+
+// transitions are the statuses which orders can move to from each status,
+// cancelled and refunded orders are final
+var transitions = map[models.OrderStatus][]models.OrderStatus{
+	models.OrderPending:   {models.OrderPaid, models.OrderCancelled},
+	models.OrderPaid:      {models.OrderFulfilled, models.OrderRefunded},
+	models.OrderFulfilled: {models.OrderShipped, models.OrderRefunded},
+	models.OrderShipped:   {models.OrderDelivered, models.OrderRefunded},
+	models.OrderDelivered: {models.OrderRefunded},
+	models.OrderCancelled: nil,
+	models.OrderRefunded:  nil,
+}
+
+// Valid reports whether the status is one of the known statuses
+func Valid(s models.OrderStatus) bool {
+	_, ok := transitions[s]
+	return ok
+}
+
+// Final reports whether orders with the status can't move anymore
+func Final(s models.OrderStatus) bool {
+	return Valid(s) && len(transitions[s]) == 0
+}
+
+// CanTransition reports whether an order can move from a status to another
+func CanTransition(from, to models.OrderStatus) bool {
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Transition checks the order can move to the status and returns the history entry which records it,
+// actorID is the customer who moves the order or zero when the system does
+func Transition(o *models.Order, to models.OrderStatus, actorID int, reason string) (*models.OrderHistory, error) {
+	if !Valid(to) {
+		return nil, apperr.Validation("unknown order status").With("field", "status")
+	}
+
+	if !CanTransition(o.Status, to) {
+		return nil, apperr.Conflict(fmt.Sprintf("order can not move from %s to %s", o.Status, to)).
+			With("from", strings.ToUpper(string(o.Status))).
+			With("to", strings.ToUpper(string(to)))
+	}
+
+	return &models.OrderHistory{
+		OrderID:    int(o.ID),
+		FromStatus: o.Status,
+		ToStatus:   to,
+		ActorID:    actorID,
+		Reason:     reason,
+	}, nil
+}
@@ -0,0 +1,80 @@
+package orderstate
+
+import (
+	"github.com/moeen/redisearch-shopping/internal/apperr"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"testing"
+)
+
+func TestCanTransition(t *testing.T) {
+	allowed := []struct {
+		from, to models.OrderStatus
+	}{
+		{models.OrderPending, models.OrderPaid},
+		{models.OrderPending, models.OrderCancelled},
+		{models.OrderPaid, models.OrderFulfilled},
+		{models.OrderPaid, models.OrderRefunded},
+		{models.OrderFulfilled, models.OrderShipped},
+		{models.OrderShipped, models.OrderDelivered},
+		{models.OrderDelivered, models.OrderRefunded},
+	}
+	for _, tc := range allowed {
+		assert.True(t, CanTransition(tc.from, tc.to), "%s -> %s", tc.from, tc.to)
+	}
+
+	rejected := []struct {
+		from, to models.OrderStatus
+	}{
+		{models.OrderPending, models.OrderShipped},
+		{models.OrderPending, models.OrderRefunded},
+		{models.OrderPaid, models.OrderPending},
+		{models.OrderPaid, models.OrderCancelled},
+		{models.OrderShipped, models.OrderFulfilled},
+		{models.OrderDelivered, models.OrderDelivered},
+		{models.OrderCancelled, models.OrderPaid},
+		{models.OrderRefunded, models.OrderPaid},
+		{"unknown", models.OrderPaid},
+	}
+	for _, tc := range rejected {
+		assert.False(t, CanTransition(tc.from, tc.to), "%s -> %s", tc.from, tc.to)
+	}
+}
+
+func TestFinal(t *testing.T) {
+	assert.True(t, Final(models.OrderCancelled))
+	assert.True(t, Final(models.OrderRefunded))
+	assert.False(t, Final(models.OrderPending))
+	assert.False(t, Final(models.OrderDelivered))
+	assert.False(t, Final("unknown"))
+}
+
+func TestTransition(t *testing.T) {
+	o := &models.Order{Model: gorm.Model{ID: 3}, Status: models.OrderPaid}
+
+	t.Run("test unknown status", func(t *testing.T) {
+		h, err := Transition(o, "lost", 1, "")
+		assert.Equal(t, apperr.CodeValidation, apperr.CodeOf(err))
+		assert.Nil(t, h)
+	})
+
+	t.Run("test illegal transition", func(t *testing.T) {
+		h, err := Transition(o, models.OrderCancelled, 1, "")
+		assert.EqualError(t, err, "order can not move from paid to cancelled")
+		assert.Equal(t, apperr.CodeConflict, apperr.CodeOf(err))
+		assert.Nil(t, h)
+	})
+
+	t.Run("test legal transition", func(t *testing.T) {
+		h, err := Transition(o, models.OrderFulfilled, 1, "packed")
+		assert.NoError(t, err)
+		assert.Equal(t, &models.OrderHistory{
+			OrderID:    3,
+			FromStatus: models.OrderPaid,
+			ToStatus:   models.OrderFulfilled,
+			ActorID:    1,
+			Reason:     "packed",
+		}, h)
+	})
+}
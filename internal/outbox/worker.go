@@ -0,0 +1,182 @@
+// Package outbox applies the product changes recorded in storage outbox to the searcher
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/moeen/redisearch-shopping/internal/storage"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+	"go.uber.org/zap"
+	"os"
+	"time"
+)
+
+const (
+	// DefaultInterval is the default time between two drains of the outbox
+	DefaultInterval = time.Second
+
+	// batchSize is the maximum number of events read from the outbox in each drain
+	batchSize = 100
+
+	// claimLease is how long the events of a drain are claimed for, other workers take them over after it
+	claimLease = time.Minute
+
+	// baseBackoff is the retry delay of the first failed attempt, it doubles on each failure
+	baseBackoff = time.Second
+
+	// maxBackoff is the maximum retry delay of a failed event
+	maxBackoff = 5 * time.Minute
+
+	// maxAttempts is the number of failed attempts after which an event is given up on
+	maxAttempts = 10
+
+	// retention is how long processed events are kept before they're pruned
+	retention = 24 * time.Hour
+)
+
+// Worker drains the storage outbox into the searcher, events of each product are applied in the
+// order they were created and failed ones are retried with backoff until they fail maxAttempts times,
+// workers of several replicas share the outbox by claiming the events they apply
+type Worker struct {
+	owner    string
+	storage  storage.Storage
+	searcher storage.Searcher
+	logger   *zap.Logger
+	interval time.Duration
+	now      func() time.Time
+}
+
+// NewWorker creates a new Worker which drains the outbox every interval
+func NewWorker(storage storage.Storage, searcher storage.Searcher, logger *zap.Logger, interval time.Duration) *Worker {
+	host, _ := os.Hostname()
+
+	return &Worker{
+		owner:    fmt.Sprintf("%s:%d", host, os.Getpid()),
+		storage:  storage,
+		searcher: searcher,
+		logger:   logger,
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+// Run drains the outbox periodically until the context is done
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.Drain(); err != nil {
+			w.logger.Error("failed to drain outbox", zap.Error(err))
+		}
+
+		if err := w.Prune(); err != nil {
+			w.logger.Error("failed to prune outbox", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Drain applies the due outbox events once
+func (w *Worker) Drain() error {
+	events, err := w.storage.ClaimOutboxEvents(w.owner, w.now(), claimLease, batchSize)
+	if err != nil {
+		return fmt.Errorf("failed to claim outbox events: %w", err)
+	}
+
+	// a product is blocked when one of its events is not applied yet,
+	// so its later events won't overtake it
+	blocked := make(map[int]bool)
+
+	for _, e := range events {
+		if blocked[e.ProductID] {
+			continue
+		}
+
+		if err := w.apply(e); err != nil {
+			if e.Attempts+1 >= maxAttempts {
+				w.logger.Error("gave up on outbox event",
+					zap.Uint("event_id", e.ID),
+					zap.Int("product_id", e.ProductID),
+					zap.Int("attempts", e.Attempts+1),
+					zap.Error(err))
+
+				if err := w.storage.MarkOutboxEventDead(int(e.ID), err.Error()); err != nil {
+					return fmt.Errorf("failed to mark outbox event as dead: %w", err)
+				}
+				continue
+			}
+
+			blocked[e.ProductID] = true
+
+			retryAt := w.now().Add(backoff(e.Attempts))
+			w.logger.Warn("failed to apply outbox event",
+				zap.Uint("event_id", e.ID),
+				zap.Int("product_id", e.ProductID),
+				zap.Int("attempts", e.Attempts+1),
+				zap.Time("retry_at", retryAt),
+				zap.Error(err))
+
+			if err := w.storage.MarkOutboxEventFailed(int(e.ID), err.Error(), retryAt); err != nil {
+				return fmt.Errorf("failed to mark outbox event as failed: %w", err)
+			}
+			continue
+		}
+
+		if err := w.storage.MarkOutboxEventProcessed(int(e.ID)); err != nil {
+			return fmt.Errorf("failed to mark outbox event as processed: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Prune deletes the events which were processed longer than the retention ago
+func (w *Worker) Prune() error {
+	n, err := w.storage.PruneOutboxEvents(w.now().Add(-retention))
+	if err != nil {
+		return fmt.Errorf("failed to prune outbox events: %w", err)
+	}
+
+	if n > 0 {
+		w.logger.Info("pruned outbox events", zap.Int("count", n))
+	}
+
+	return nil
+}
+
+// apply applies a single outbox event to the searcher
+func (w *Worker) apply(e *models.OutboxEvent) error {
+	switch e.Type {
+	case models.OutboxProductUpserted:
+		var p models.Product
+		if err := json.Unmarshal([]byte(e.Payload), &p); err != nil {
+			return fmt.Errorf("failed to decode product: %w", err)
+		}
+
+		return w.searcher.UpdateProduct(&p)
+	case models.OutboxProductDeleted:
+		return w.searcher.DeleteProduct(e.ProductID)
+	default:
+		return fmt.Errorf("unknown outbox event type: %s", e.Type)
+	}
+}
+
+// backoff returns the retry delay of an event which has failed given number of times before
+func backoff(attempts int) time.Duration {
+	d := baseBackoff
+	for i := 0; i < attempts; i++ {
+		d *= 2
+		if d >= maxBackoff {
+			return maxBackoff
+		}
+	}
+
+	return d
+}
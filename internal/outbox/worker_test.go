@@ -0,0 +1,179 @@
+package outbox
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/moeen/redisearch-shopping/internal/storage"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+func upsertEvent(t *testing.T, id uint, product *models.Product, next time.Time) *models.OutboxEvent {
+	payload, err := json.Marshal(product)
+	assert.NoError(t, err)
+
+	return &models.OutboxEvent{
+		Model:         gorm.Model{ID: id},
+		Type:          models.OutboxProductUpserted,
+		ProductID:     int(product.ID),
+		Payload:       string(payload),
+		NextAttemptAt: next,
+	}
+}
+
+func TestWorker_Drain(t *testing.T) {
+	now := time.Now()
+
+	p1 := &models.Product{Model: gorm.Model{ID: 1}, Name: "Bread", Price: 4}
+	p2 := &models.Product{Model: gorm.Model{ID: 2}, Name: "Milk", Price: 1}
+
+	newWorker := func(c *gomock.Controller) (*Worker, *storage.MockStorage, *storage.MockSearcher) {
+		st := storage.NewMockStorage(c)
+		sr := storage.NewMockSearcher(c)
+		w := NewWorker(st, sr, zap.NewNop(), DefaultInterval)
+		w.now = func() time.Time { return now }
+		return w, st, sr
+	}
+
+	t.Run("test when storage returns an error", func(t *testing.T) {
+		c := gomock.NewController(t)
+		defer c.Finish()
+
+		w, st, _ := newWorker(c)
+		st.EXPECT().ClaimOutboxEvents(w.owner, now, claimLease, batchSize).Times(1).Return(nil, errors.New("failed"))
+
+		assert.Error(t, w.Drain())
+	})
+
+	t.Run("test successful drain", func(t *testing.T) {
+		c := gomock.NewController(t)
+		defer c.Finish()
+
+		w, st, sr := newWorker(c)
+		st.EXPECT().ClaimOutboxEvents(w.owner, now, claimLease, batchSize).Times(1).Return([]*models.OutboxEvent{
+			upsertEvent(t, 1, p1, now),
+			upsertEvent(t, 2, p2, now),
+		}, nil)
+
+		gomock.InOrder(
+			sr.EXPECT().UpdateProduct(gomock.Any()).Times(1).DoAndReturn(func(p *models.Product) error {
+				assert.Equal(t, p1.ID, p.ID)
+				assert.Equal(t, p1.Name, p.Name)
+				return nil
+			}),
+			st.EXPECT().MarkOutboxEventProcessed(1).Times(1).Return(nil),
+			sr.EXPECT().UpdateProduct(gomock.Any()).Times(1).Return(nil),
+			st.EXPECT().MarkOutboxEventProcessed(2).Times(1).Return(nil),
+		)
+
+		assert.NoError(t, w.Drain())
+	})
+
+	t.Run("test delete event", func(t *testing.T) {
+		c := gomock.NewController(t)
+		defer c.Finish()
+
+		w, st, sr := newWorker(c)
+		e := upsertEvent(t, 1, p1, now)
+		e.Type = models.OutboxProductDeleted
+
+		st.EXPECT().ClaimOutboxEvents(w.owner, now, claimLease, batchSize).Times(1).Return([]*models.OutboxEvent{e}, nil)
+		sr.EXPECT().DeleteProduct(int(p1.ID)).Times(1).Return(nil)
+		st.EXPECT().MarkOutboxEventProcessed(1).Times(1).Return(nil)
+
+		assert.NoError(t, w.Drain())
+	})
+
+	t.Run("test failed event blocks later events of the same product", func(t *testing.T) {
+		c := gomock.NewController(t)
+		defer c.Finish()
+
+		w, st, sr := newWorker(c)
+		st.EXPECT().ClaimOutboxEvents(w.owner, now, claimLease, batchSize).Times(1).Return([]*models.OutboxEvent{
+			upsertEvent(t, 1, p1, now),
+			upsertEvent(t, 2, p2, now),
+			upsertEvent(t, 3, p1, now),
+		}, nil)
+
+		sr.EXPECT().UpdateProduct(gomock.Any()).Times(1).Return(errors.New("failed"))
+		st.EXPECT().MarkOutboxEventFailed(1, "failed", now.Add(baseBackoff)).Times(1).Return(nil)
+		sr.EXPECT().UpdateProduct(gomock.Any()).Times(1).Return(nil)
+		st.EXPECT().MarkOutboxEventProcessed(2).Times(1).Return(nil)
+
+		assert.NoError(t, w.Drain())
+	})
+
+	t.Run("test event is given up on after too many attempts", func(t *testing.T) {
+		c := gomock.NewController(t)
+		defer c.Finish()
+
+		w, st, sr := newWorker(c)
+		e := upsertEvent(t, 1, p1, now)
+		e.Attempts = maxAttempts - 1
+
+		st.EXPECT().ClaimOutboxEvents(w.owner, now, claimLease, batchSize).Times(1).Return([]*models.OutboxEvent{
+			e,
+			upsertEvent(t, 2, p1, now),
+		}, nil)
+
+		// later events of the product are applied since the dead one won't be retried
+		sr.EXPECT().UpdateProduct(gomock.Any()).Times(1).Return(errors.New("failed"))
+		st.EXPECT().MarkOutboxEventDead(1, "failed").Times(1).Return(nil)
+		sr.EXPECT().UpdateProduct(gomock.Any()).Times(1).Return(nil)
+		st.EXPECT().MarkOutboxEventProcessed(2).Times(1).Return(nil)
+
+		assert.NoError(t, w.Drain())
+	})
+
+	t.Run("test unknown event type", func(t *testing.T) {
+		c := gomock.NewController(t)
+		defer c.Finish()
+
+		w, st, _ := newWorker(c)
+		e := upsertEvent(t, 1, p1, now)
+		e.Type = "unknown"
+		e.Attempts = 2
+
+		st.EXPECT().ClaimOutboxEvents(w.owner, now, claimLease, batchSize).Times(1).Return([]*models.OutboxEvent{e}, nil)
+		st.EXPECT().MarkOutboxEventFailed(1, gomock.Any(), now.Add(4*baseBackoff)).Times(1).Return(nil)
+
+		assert.NoError(t, w.Drain())
+	})
+}
+
+func TestWorker_Prune(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	now := time.Now()
+	st := storage.NewMockStorage(c)
+	w := NewWorker(st, storage.NewMockSearcher(c), zap.NewNop(), DefaultInterval)
+	w.now = func() time.Time { return now }
+
+	st.EXPECT().PruneOutboxEvents(now.Add(-retention)).Times(1).Return(3, nil)
+	assert.NoError(t, w.Prune())
+
+	st.EXPECT().PruneOutboxEvents(now.Add(-retention)).Times(1).Return(0, errors.New("failed"))
+	assert.Error(t, w.Prune())
+}
+
+func TestBackoff(t *testing.T) {
+	cases := []struct {
+		attempts int
+		delay    time.Duration
+	}{
+		{attempts: 0, delay: baseBackoff},
+		{attempts: 1, delay: 2 * baseBackoff},
+		{attempts: 3, delay: 8 * baseBackoff},
+		{attempts: 100, delay: maxBackoff},
+	}
+
+	for _, tc := range cases {
+		assert.Equal(t, tc.delay, backoff(tc.attempts))
+	}
+}
@@ -0,0 +1,283 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/moeen/redisearch-shopping/internal/apperr"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// FakeTokenDecline is the payment token whose payments the fake provider declines
+	FakeTokenDecline = "tok_decline"
+
+	// FakeToken3DS is the payment token whose payments stay pending until the customer
+	// completes a 3-D Secure style action at their action URL
+	FakeToken3DS = "tok_3ds"
+
+	// fakeDeliveryAttempts is how many times an event is sent before the fake provider gives up on it
+	fakeDeliveryAttempts = 3
+)
+
+// fakeRequest is a request which the fake provider handled along with its result, so it's
+// returned again when the request is repeated with the same idempotency key
+type fakeRequest struct {
+	request string
+	result  Transaction
+}
+
+// FakeProvider is an in-process PaymentProvider which never moves money, it's used in development
+// and tests. Payments of FakeTokenDecline are declined, payments of FakeToken3DS stay pending until
+// CompleteAction is called and every other token is authorized. Every status change is sent to the
+// webhook as a signed event in the background.
+type FakeProvider struct {
+	secret     []byte
+	webhookURL string
+	actionURL  string
+	client     *http.Client
+	logger     *zap.Logger
+	now        func() time.Time
+
+	// retryDelay is the delay before the first retry of an event, it doubles on every retry
+	retryDelay time.Duration
+
+	mu       sync.Mutex
+	seq      int
+	payments map[string]*Transaction
+	requests map[string]fakeRequest
+
+	deliveries sync.WaitGroup
+}
+
+// NewFakeProvider creates a FakeProvider which signs the events it sends to webhookURL with the secret,
+// the action URL of pending payments is actionURL followed by the payment ID. No events are sent when
+// webhookURL is empty.
+func NewFakeProvider(secret []byte, webhookURL, actionURL string, logger *zap.Logger) *FakeProvider {
+	return &FakeProvider{
+		secret:     secret,
+		webhookURL: webhookURL,
+		actionURL:  actionURL,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		logger:     logger,
+		now:        time.Now,
+		retryDelay: 500 * time.Millisecond,
+		payments:   make(map[string]*Transaction),
+		requests:   make(map[string]fakeRequest),
+	}
+}
+
+// do runs the request once per idempotency key, f is called with the lock held
+func (f *FakeProvider) do(idempotencyKey, request string, fn func() (*Transaction, error)) (*Transaction, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if idempotencyKey == "" {
+		return nil, apperr.Validation("idempotency key is required")
+	}
+
+	if r, ok := f.requests[idempotencyKey]; ok {
+		if r.request != request {
+			return nil, ErrIdempotencyKeyReused
+		}
+
+		result := r.result
+		return &result, nil
+	}
+
+	t, err := fn()
+	if err != nil {
+		return nil, err
+	}
+
+	f.requests[idempotencyKey] = fakeRequest{request: request, result: *t}
+
+	result := *t
+	return &result, nil
+}
+
+// update moves the payment to the status and sends its event, it must be called with the lock held
+func (f *FakeProvider) update(t *Transaction, status models.PaymentStatus) *Transaction {
+	t.Status = status
+	if status != models.PaymentPending {
+		t.ActionURL = ""
+	}
+
+	f.seq++
+	f.send(Event{
+		ID:      fmt.Sprintf("evt_%d", f.seq),
+		Payment: *t,
+	})
+
+	return t
+}
+
+// transition moves the payment to the status if it's in one of the from statuses
+func (f *FakeProvider) transition(id string, to models.PaymentStatus, from ...models.PaymentStatus) (*Transaction, error) {
+	t, ok := f.payments[id]
+	if !ok {
+		return nil, apperr.NotFound("payment not found")
+	}
+
+	for _, s := range from {
+		if t.Status == s {
+			return f.update(t, to), nil
+		}
+	}
+
+	return nil, apperr.Conflict(fmt.Sprintf("%s payment can not be %s", t.Status, to))
+}
+
+func (f *FakeProvider) Authorize(_ context.Context, req AuthorizeRequest, idempotencyKey string) (*Transaction, error) {
+	request := fmt.Sprintf("authorize:%d:%d:%s", req.OrderID, req.Amount, req.Token)
+
+	return f.do(idempotencyKey, request, func() (*Transaction, error) {
+		if req.Amount <= 0 {
+			return nil, apperr.Validation("amount must be positive")
+		}
+
+		f.seq++
+		t := &Transaction{
+			ID:      fmt.Sprintf("pay_%d", f.seq),
+			OrderID: req.OrderID,
+			Amount:  req.Amount,
+		}
+		f.payments[t.ID] = t
+
+		switch req.Token {
+		case FakeTokenDecline:
+			return f.update(t, models.PaymentDeclined), nil
+		case FakeToken3DS:
+			t.ActionURL = f.actionURL + t.ID
+			return f.update(t, models.PaymentPending), nil
+		default:
+			return f.update(t, models.PaymentAuthorized), nil
+		}
+	})
+}
+
+func (f *FakeProvider) Capture(_ context.Context, id string, idempotencyKey string) (*Transaction, error) {
+	return f.do(idempotencyKey, "capture:"+id, func() (*Transaction, error) {
+		return f.transition(id, models.PaymentCaptured, models.PaymentAuthorized)
+	})
+}
+
+func (f *FakeProvider) Refund(_ context.Context, id string, idempotencyKey string) (*Transaction, error) {
+	return f.do(idempotencyKey, "refund:"+id, func() (*Transaction, error) {
+		return f.transition(id, models.PaymentRefunded, models.PaymentCaptured)
+	})
+}
+
+func (f *FakeProvider) Void(_ context.Context, id string, idempotencyKey string) (*Transaction, error) {
+	return f.do(idempotencyKey, "void:"+id, func() (*Transaction, error) {
+		return f.transition(id, models.PaymentVoided, models.PaymentPending, models.PaymentAuthorized)
+	})
+}
+
+// CompleteAction simulates the customer completing the action of a pending payment, which
+// authorizes the payment when it's approved and declines it otherwise
+func (f *FakeProvider) CompleteAction(id string, approve bool) (*Transaction, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	to := models.PaymentDeclined
+	if approve {
+		to = models.PaymentAuthorized
+	}
+
+	t, err := f.transition(id, to, models.PaymentPending)
+	if err != nil {
+		return nil, err
+	}
+
+	result := *t
+	return &result, nil
+}
+
+// GinActionHandler is the page of the action URL of pending payments, the action is approved
+// unless the approve query parameter is false
+func (f *FakeProvider) GinActionHandler(ctx *gin.Context) {
+	approve, err := strconv.ParseBool(ctx.DefaultQuery("approve", "true"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid approve parameter"})
+		return
+	}
+
+	t, err := f.CompleteAction(ctx.Param("id"), approve)
+	if err != nil {
+		status := http.StatusConflict
+		if apperr.CodeOf(err) == apperr.CodeNotFound {
+			status = http.StatusNotFound
+		}
+
+		ctx.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, t)
+}
+
+// send delivers the event to the webhook in the background
+func (f *FakeProvider) send(e Event) {
+	if f.webhookURL == "" {
+		return
+	}
+
+	f.deliveries.Add(1)
+	go func() {
+		defer f.deliveries.Done()
+
+		delay := f.retryDelay
+		for attempt := 1; attempt <= fakeDeliveryAttempts; attempt++ {
+			err := f.deliver(e)
+			if err == nil {
+				return
+			}
+
+			f.logger.Warn("failed to deliver payment event", zap.String("event", e.ID),
+				zap.Int("attempt", attempt), zap.Error(err))
+
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}()
+}
+
+// deliver posts the signed event to the webhook
+func (f *FakeProvider) deliver(e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, f.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(f.secret, body, f.now()))
+
+	res, err := f.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with %s", res.Status)
+	}
+
+	return nil
+}
+
+// Wait blocks until all the events which are being sent are delivered or given up on
+func (f *FakeProvider) Wait() {
+	f.deliveries.Wait()
+}
@@ -0,0 +1,182 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/moeen/redisearch-shopping/internal/apperr"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFakeProvider(t *testing.T) {
+	ctx := context.Background()
+	req := AuthorizeRequest{OrderID: 1, Amount: 100, Token: "tok_visa"}
+
+	t.Run("test without idempotency key", func(t *testing.T) {
+		f := NewFakeProvider(nil, "", "", zap.NewNop())
+
+		_, err := f.Authorize(ctx, req, "")
+		assert.Equal(t, apperr.CodeValidation, apperr.CodeOf(err))
+	})
+
+	t.Run("test authorize", func(t *testing.T) {
+		f := NewFakeProvider(nil, "", "http://localhost/action/", zap.NewNop())
+
+		tx, err := f.Authorize(ctx, req, "a")
+		require.NoError(t, err)
+		assert.Equal(t, models.PaymentAuthorized, tx.Status)
+		assert.Equal(t, 100, tx.Amount)
+
+		tx, err = f.Authorize(ctx, AuthorizeRequest{OrderID: 2, Amount: 100, Token: FakeTokenDecline}, "b")
+		require.NoError(t, err)
+		assert.Equal(t, models.PaymentDeclined, tx.Status)
+
+		tx, err = f.Authorize(ctx, AuthorizeRequest{OrderID: 3, Amount: 100, Token: FakeToken3DS}, "c")
+		require.NoError(t, err)
+		assert.Equal(t, models.PaymentPending, tx.Status)
+		assert.Equal(t, "http://localhost/action/"+tx.ID, tx.ActionURL)
+	})
+
+	t.Run("test idempotency", func(t *testing.T) {
+		f := NewFakeProvider(nil, "", "", zap.NewNop())
+
+		first, err := f.Authorize(ctx, req, "key")
+		require.NoError(t, err)
+
+		second, err := f.Authorize(ctx, req, "key")
+		require.NoError(t, err)
+		assert.Equal(t, first, second)
+
+		_, err = f.Authorize(ctx, AuthorizeRequest{OrderID: 1, Amount: 200, Token: "tok_visa"}, "key")
+		assert.Equal(t, ErrIdempotencyKeyReused, err)
+
+		captured, err := f.Capture(ctx, first.ID, "capture")
+		require.NoError(t, err)
+		assert.Equal(t, models.PaymentCaptured, captured.Status)
+
+		again, err := f.Capture(ctx, first.ID, "capture")
+		require.NoError(t, err)
+		assert.Equal(t, captured, again)
+
+		// a new key is a new request, which the payment is not in the state for anymore
+		_, err = f.Capture(ctx, first.ID, "capture again")
+		assert.Equal(t, apperr.CodeConflict, apperr.CodeOf(err))
+	})
+
+	t.Run("test payment lifecycle", func(t *testing.T) {
+		f := NewFakeProvider(nil, "", "", zap.NewNop())
+
+		_, err := f.Capture(ctx, "pay_unknown", "x")
+		assert.Equal(t, apperr.CodeNotFound, apperr.CodeOf(err))
+
+		tx, err := f.Authorize(ctx, req, "a")
+		require.NoError(t, err)
+
+		_, err = f.Refund(ctx, tx.ID, "r1")
+		assert.Equal(t, apperr.CodeConflict, apperr.CodeOf(err))
+
+		tx, err = f.Capture(ctx, tx.ID, "c")
+		require.NoError(t, err)
+
+		_, err = f.Void(ctx, tx.ID, "v")
+		assert.Equal(t, apperr.CodeConflict, apperr.CodeOf(err))
+
+		tx, err = f.Refund(ctx, tx.ID, "r2")
+		require.NoError(t, err)
+		assert.Equal(t, models.PaymentRefunded, tx.Status)
+	})
+
+	t.Run("test complete action", func(t *testing.T) {
+		f := NewFakeProvider(nil, "", "", zap.NewNop())
+
+		approved, err := f.Authorize(ctx, AuthorizeRequest{OrderID: 1, Amount: 100, Token: FakeToken3DS}, "a")
+		require.NoError(t, err)
+		refused, err := f.Authorize(ctx, AuthorizeRequest{OrderID: 2, Amount: 100, Token: FakeToken3DS}, "b")
+		require.NoError(t, err)
+
+		tx, err := f.CompleteAction(approved.ID, true)
+		require.NoError(t, err)
+		assert.Equal(t, models.PaymentAuthorized, tx.Status)
+		assert.Empty(t, tx.ActionURL)
+
+		tx, err = f.CompleteAction(refused.ID, false)
+		require.NoError(t, err)
+		assert.Equal(t, models.PaymentDeclined, tx.Status)
+
+		_, err = f.CompleteAction(approved.ID, true)
+		assert.Equal(t, apperr.CodeConflict, apperr.CodeOf(err))
+	})
+}
+
+func TestFakeProvider_Events(t *testing.T) {
+	secret := []byte("secret")
+
+	var (
+		mu       sync.Mutex
+		events   []Event
+		attempts int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.NoError(t, VerifySignature(secret, r.Header.Get(SignatureHeader), body, time.Now()))
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		// the first delivery fails so it's retried
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		var e Event
+		require.NoError(t, json.Unmarshal(body, &e))
+		events = append(events, e)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	f := NewFakeProvider(secret, srv.URL, "", zap.NewNop())
+	f.retryDelay = time.Millisecond
+
+	tx, err := f.Authorize(context.Background(), AuthorizeRequest{OrderID: 1, Amount: 100, Token: "tok_visa"}, "a")
+	require.NoError(t, err)
+	f.Wait()
+
+	require.Len(t, events, 1)
+	assert.Equal(t, *tx, events[0].Payment)
+	assert.Equal(t, 2, attempts)
+}
+
+func TestFakeProvider_GinActionHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	f := NewFakeProvider(nil, "", "", zap.NewNop())
+	router := gin.New()
+	router.GET("/fake-payments/:id", f.GinActionHandler)
+
+	tx, err := f.Authorize(context.Background(), AuthorizeRequest{OrderID: 1, Amount: 100, Token: FakeToken3DS}, "a")
+	require.NoError(t, err)
+
+	get := func(url string) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusBadRequest, get("/fake-payments/"+tx.ID+"?approve=maybe"))
+	assert.Equal(t, http.StatusNotFound, get("/fake-payments/pay_unknown"))
+	assert.Equal(t, http.StatusOK, get("/fake-payments/"+tx.ID))
+	assert.Equal(t, http.StatusConflict, get("/fake-payments/"+tx.ID))
+}
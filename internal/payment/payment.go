@@ -0,0 +1,57 @@
+// Package payment charges orders through a payment provider and applies the payment
+// updates which the provider sends to the webhook to the orders
+package payment
+
+import (
+	"context"
+	"github.com/moeen/redisearch-shopping/internal/apperr"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+)
+
+// ErrIdempotencyKeyReused is returned when an idempotency key is used again for a different request
+var ErrIdempotencyKeyReused = apperr.Conflict("idempotency key is already used for another request")
+
+// AuthorizeRequest is a request to authorize an amount for an order
+type AuthorizeRequest struct {
+	OrderID int
+	Amount  int
+
+	// Token is the payment method of the customer tokenized by the provider
+	Token string
+}
+
+// Transaction is the state of a payment at the provider
+type Transaction struct {
+	// ID is the provider's ID of the payment
+	ID      string               `json:"id"`
+	OrderID int                  `json:"orderId"`
+	Status  models.PaymentStatus `json:"status"`
+	Amount  int                  `json:"amount"`
+
+	// ActionURL is where the customer completes the action of pending payments
+	ActionURL string `json:"actionUrl,omitempty"`
+}
+
+// Event is sent by the provider to the webhook whenever the status of a payment changes,
+// events can arrive late, out of order or more than once
+type Event struct {
+	ID      string      `json:"id"`
+	Payment Transaction `json:"payment"`
+}
+
+// PaymentProvider is the interface used to charge customers, every request takes an idempotency
+// key and requests repeated with the same key return the result of the first one
+type PaymentProvider interface {
+	// Authorize holds the amount on the payment method, the payment is pending when the
+	// customer must complete an action first and declined when the payment method is refused
+	Authorize(ctx context.Context, req AuthorizeRequest, idempotencyKey string) (*Transaction, error)
+
+	// Capture charges the authorized amount of the payment
+	Capture(ctx context.Context, id string, idempotencyKey string) (*Transaction, error)
+
+	// Refund returns the captured amount of the payment to the customer
+	Refund(ctx context.Context, id string, idempotencyKey string) (*Transaction, error)
+
+	// Void releases the amount of a payment which is not captured yet
+	Void(ctx context.Context, id string, idempotencyKey string) (*Transaction, error)
+}
@@ -0,0 +1,277 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/moeen/redisearch-shopping/internal/apperr"
+	"github.com/moeen/redisearch-shopping/internal/orderstate"
+	"github.com/moeen/redisearch-shopping/internal/storage"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+	"go.uber.org/zap"
+	"time"
+)
+
+// advanceAttempts is how many times an order is moved when its status keeps changing concurrently
+const advanceAttempts = 3
+
+// ErrOrderNotPayable is returned when an order which is not pending is paid
+var ErrOrderNotPayable = apperr.Conflict("order is not awaiting payment")
+
+// ErrOrderBeingPaid is returned when an order is paid while it's paid with another payment token
+var ErrOrderBeingPaid = apperr.Conflict("order is already being paid")
+
+// Processor charges orders through the payment provider and applies the payment updates to the
+// orders, it's safe to apply the same update more than once or out of order
+type Processor struct {
+	storage  storage.Storage
+	provider PaymentProvider
+	secret   []byte
+	logger   *zap.Logger
+	now      func() time.Time
+}
+
+// NewProcessor creates a new Processor which accepts the webhook events signed with the secret
+func NewProcessor(storage storage.Storage, provider PaymentProvider, secret []byte, logger *zap.Logger) *Processor {
+	return &Processor{
+		storage:  storage,
+		provider: provider,
+		secret:   secret,
+		logger:   logger,
+		now:      time.Now,
+	}
+}
+
+// Provider returns the payment provider of the processor
+func (p *Processor) Provider() PaymentProvider {
+	return p.provider
+}
+
+// Pay authorizes the grand total of a pending order with the payment token and captures it. The active
+// payment of the order is returned instead when it already has one, so retries never charge twice.
+func (p *Processor) Pay(ctx context.Context, order *models.Order, token string) (*models.Payment, error) {
+	if order.Status != models.OrderPending {
+		return nil, ErrOrderNotPayable
+	}
+
+	// the key of an attempt only depends on the order and its earlier payments, so concurrent attempts
+	// share it and the provider authorizes one of them, a new key is used once the attempt is declined.
+	// The payments are counted first, an attempt which counts the payment of another one also finds it.
+	n, err := p.storage.CountOrderPayments(int(order.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := p.storage.GetOrderPayment(int(order.ID))
+	switch {
+	case err == nil && current.Status != models.PaymentVoided:
+		return current, nil
+	case err != nil && apperr.CodeOf(err) != apperr.CodeNotFound:
+		return nil, err
+	}
+
+	// the order can be cancelled since the caller read it, a payment racing with that is given back by Apply
+	if current, err := p.storage.GetOrder(int(order.ID)); err != nil {
+		return nil, err
+	} else if current.Status != models.OrderPending {
+		return nil, ErrOrderNotPayable
+	}
+
+	tx, err := p.provider.Authorize(ctx, AuthorizeRequest{
+		OrderID: int(order.ID),
+		Amount:  order.GrandTotal,
+		Token:   token,
+	}, fmt.Sprintf("order:%d:payment:%d", order.ID, n+1))
+	if errors.Is(err, ErrIdempotencyKeyReused) {
+		return nil, ErrOrderBeingPaid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.Apply(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	return p.storage.GetPayment(tx.ID)
+}
+
+// CheckRelease returns an error when the order can't be moved to the status because of its payment,
+// a captured payment of an order which is not paid yet is about to pay it, so it can't be cancelled
+func (p *Processor) CheckRelease(order *models.Order, to models.OrderStatus) error {
+	if to != models.OrderCancelled {
+		return nil
+	}
+
+	payment, err := p.storage.GetOrderPayment(int(order.ID))
+	if err != nil {
+		if apperr.CodeOf(err) == apperr.CodeNotFound {
+			return nil
+		}
+
+		return err
+	}
+
+	if payment.Status == models.PaymentCaptured {
+		return apperr.Conflict("order payment is captured, refund the order instead")
+	}
+
+	return nil
+}
+
+// Release gives the payment of an order back once the order is moved to the status, captured payments
+// are refunded when the order is refunded or cancelled and uncaptured ones are voided when it's cancelled.
+// A payment which is already given back is left alone, so a failed release can be retried.
+func (p *Processor) Release(ctx context.Context, order *models.Order, to models.OrderStatus) error {
+	payment, err := p.storage.GetOrderPayment(int(order.ID))
+	if err != nil {
+		if apperr.CodeOf(err) == apperr.CodeNotFound {
+			return nil
+		}
+
+		return err
+	}
+
+	var tx *Transaction
+	switch {
+	case (to == models.OrderRefunded || to == models.OrderCancelled) && payment.Status == models.PaymentCaptured:
+		// cancelled orders only have a captured payment when it raced with the cancellation
+		tx, err = p.provider.Refund(ctx, payment.ProviderID, payment.ProviderID+":refund")
+	case to == models.OrderCancelled && !payment.Status.Advances(models.PaymentAuthorized):
+		tx, err = p.provider.Void(ctx, payment.ProviderID, payment.ProviderID+":void")
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// the order is already moved by the caller, only the payment is recorded here
+	_, err = p.save(tx)
+	return err
+}
+
+// Apply records the payment update and moves its order, authorized payments are captured. Payments of
+// orders which are cancelled meanwhile are voided instead, or refunded when they're already captured.
+func (p *Processor) Apply(ctx context.Context, tx *Transaction) error {
+	ok, err := p.save(tx)
+	if err != nil || !ok {
+		return err
+	}
+
+	var status models.OrderStatus
+	switch tx.Status {
+	case models.PaymentAuthorized:
+		order, err := p.storage.GetOrder(tx.OrderID)
+		if err != nil {
+			return err
+		}
+
+		if order.Status != models.OrderPending {
+			p.logger.Warn("voiding payment of an order which is not pending", zap.Int("order", tx.OrderID),
+				zap.String("payment", tx.ID), zap.String("status", string(order.Status)))
+
+			voided, err := p.provider.Void(ctx, tx.ID, tx.ID+":void")
+			if err != nil {
+				return err
+			}
+
+			return p.Apply(ctx, voided)
+		}
+
+		captured, err := p.provider.Capture(ctx, tx.ID, tx.ID+":capture")
+		if err != nil {
+			return err
+		}
+
+		return p.Apply(ctx, captured)
+	case models.PaymentCaptured:
+		if status, err = p.advanceOrder(tx.OrderID, models.OrderPaid, "payment captured"); err != nil {
+			return err
+		}
+	case models.PaymentVoided:
+		_, err = p.advanceOrder(tx.OrderID, models.OrderCancelled, "payment voided")
+		return err
+	case models.PaymentRefunded:
+		_, err = p.advanceOrder(tx.OrderID, models.OrderRefunded, "payment refunded")
+		return err
+	}
+
+	if status != models.OrderCancelled {
+		return nil
+	}
+
+	// the order was cancelled while the payment was captured, the order can't be paid anymore so the
+	// customer gets the money back. The order is final, so only the payment is recorded.
+	p.logger.Warn("refunding payment of a cancelled order", zap.Int("order", tx.OrderID), zap.String("payment", tx.ID))
+
+	refunded, err := p.provider.Refund(ctx, tx.ID, tx.ID+":refund")
+	if err != nil {
+		return err
+	}
+
+	_, err = p.save(refunded)
+	return err
+}
+
+// save records the payment update unless the payment is already past it, it reports whether the
+// update is current. Repeated updates are current too, so their effects are retried.
+func (p *Processor) save(tx *Transaction) (bool, error) {
+	current, err := p.storage.GetPayment(tx.ID)
+	switch {
+	case err == nil:
+		if current.Status != tx.Status && !tx.Status.Advances(current.Status) {
+			p.logger.Info("skipped stale payment update", zap.String("payment", tx.ID),
+				zap.String("status", string(tx.Status)), zap.String("current", string(current.Status)))
+			return false, nil
+		}
+	case apperr.CodeOf(err) != apperr.CodeNotFound:
+		return false, err
+	}
+
+	err = p.storage.SavePayment(&models.Payment{
+		OrderID:    tx.OrderID,
+		ProviderID: tx.ID,
+		Status:     tx.Status,
+		Amount:     tx.Amount,
+		ActionURL:  tx.ActionURL,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// advanceOrder moves the order to the status on behalf of the system and returns the status the order
+// ends up in, orders which are already in the status are left alone and orders which can't move there
+// anymore are logged and keep their status
+func (p *Processor) advanceOrder(orderID int, to models.OrderStatus, reason string) (models.OrderStatus, error) {
+	for attempt := 0; attempt < advanceAttempts; attempt++ {
+		order, err := p.storage.GetOrder(orderID)
+		if err != nil {
+			return "", err
+		}
+
+		if order.Status == to {
+			return to, nil
+		}
+
+		entry, err := orderstate.Transition(order, to, 0, reason)
+		if err != nil {
+			p.logger.Warn("payment update can not move order", zap.Int("order", orderID),
+				zap.String("status", string(to)), zap.Error(err))
+			return order.Status, nil
+		}
+
+		err = p.storage.UpdateOrderStatus(entry)
+		if err == nil {
+			return to, nil
+		}
+		if !errors.Is(err, storage.ErrOrderStatusChanged) {
+			return "", err
+		}
+	}
+
+	return "", fmt.Errorf("failed to move order %d to %s: %w", orderID, to, storage.ErrOrderStatusChanged)
+}
@@ -0,0 +1,464 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/moeen/redisearch-shopping/internal/apperr"
+	"github.com/moeen/redisearch-shopping/internal/storage"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"sync"
+	"testing"
+)
+
+func TestProcessor_Apply(t *testing.T) {
+	ctx := context.Background()
+
+	order := func(status models.OrderStatus) *models.Order {
+		return &models.Order{Model: gorm.Model{ID: 1}, Status: status, GrandTotal: 100}
+	}
+	stored := func(status models.PaymentStatus) *models.Payment {
+		return &models.Payment{OrderID: 1, ProviderID: "pay_1", Status: status, Amount: 100}
+	}
+	tx := func(status models.PaymentStatus) *Transaction {
+		return &Transaction{ID: "pay_1", OrderID: 1, Status: status, Amount: 100}
+	}
+
+	t.Run("test stale event", func(t *testing.T) {
+		c := gomock.NewController(t)
+		defer c.Finish()
+
+		st := storage.NewMockStorage(c)
+		p := NewProcessor(st, NewFakeProvider(nil, "", "", zap.NewNop()), nil, zap.NewNop())
+
+		st.EXPECT().GetPayment("pay_1").Times(1).Return(stored(models.PaymentCaptured), nil)
+		assert.NoError(t, p.Apply(ctx, tx(models.PaymentAuthorized)))
+
+		// statuses of the same rank don't replace each other either
+		st.EXPECT().GetPayment("pay_1").Times(1).Return(stored(models.PaymentCaptured), nil)
+		assert.NoError(t, p.Apply(ctx, tx(models.PaymentDeclined)))
+	})
+
+	t.Run("test repeated event", func(t *testing.T) {
+		c := gomock.NewController(t)
+		defer c.Finish()
+
+		st := storage.NewMockStorage(c)
+		p := NewProcessor(st, NewFakeProvider(nil, "", "", zap.NewNop()), nil, zap.NewNop())
+
+		st.EXPECT().GetPayment("pay_1").Times(1).Return(stored(models.PaymentCaptured), nil)
+		st.EXPECT().SavePayment(stored(models.PaymentCaptured)).Times(1).Return(nil)
+		st.EXPECT().GetOrder(1).Times(1).Return(order(models.OrderPaid), nil)
+
+		assert.NoError(t, p.Apply(ctx, tx(models.PaymentCaptured)))
+	})
+
+	t.Run("test event which can't move the order", func(t *testing.T) {
+		c := gomock.NewController(t)
+		defer c.Finish()
+
+		st := storage.NewMockStorage(c)
+		p := NewProcessor(st, NewFakeProvider(nil, "", "", zap.NewNop()), nil, zap.NewNop())
+
+		st.EXPECT().GetPayment("pay_1").Times(1).Return(stored(models.PaymentAuthorized), nil)
+		st.EXPECT().SavePayment(stored(models.PaymentVoided)).Times(1).Return(nil)
+		st.EXPECT().GetOrder(1).Times(1).Return(order(models.OrderShipped), nil)
+
+		assert.NoError(t, p.Apply(ctx, tx(models.PaymentVoided)))
+	})
+
+	t.Run("test when the order status changes concurrently", func(t *testing.T) {
+		c := gomock.NewController(t)
+		defer c.Finish()
+
+		st := storage.NewMockStorage(c)
+		p := NewProcessor(st, NewFakeProvider(nil, "", "", zap.NewNop()), nil, zap.NewNop())
+
+		st.EXPECT().GetPayment("pay_1").Times(1).Return(stored(models.PaymentCaptured), nil)
+		st.EXPECT().SavePayment(stored(models.PaymentRefunded)).Times(1).Return(nil)
+		st.EXPECT().GetOrder(1).Times(1).Return(order(models.OrderPaid), nil)
+		st.EXPECT().UpdateOrderStatus(gomock.Any()).Times(1).Return(storage.ErrOrderStatusChanged)
+		st.EXPECT().GetOrder(1).Times(1).Return(order(models.OrderFulfilled), nil)
+		st.EXPECT().UpdateOrderStatus(&models.OrderHistory{
+			OrderID:    1,
+			FromStatus: models.OrderFulfilled,
+			ToStatus:   models.OrderRefunded,
+			Reason:     "payment refunded",
+		}).Times(1).Return(nil)
+
+		assert.NoError(t, p.Apply(ctx, tx(models.PaymentRefunded)))
+	})
+
+	t.Run("test when storage returns an error", func(t *testing.T) {
+		c := gomock.NewController(t)
+		defer c.Finish()
+
+		st := storage.NewMockStorage(c)
+		p := NewProcessor(st, NewFakeProvider(nil, "", "", zap.NewNop()), nil, zap.NewNop())
+
+		st.EXPECT().GetPayment("pay_1").Times(1).Return(nil, errors.New("failed"))
+		assert.Error(t, p.Apply(ctx, tx(models.PaymentCaptured)))
+	})
+
+	t.Run("test authorized payment of a cancelled order is voided", func(t *testing.T) {
+		c := gomock.NewController(t)
+		defer c.Finish()
+
+		st := storage.NewMockStorage(c)
+		f := NewFakeProvider(nil, "", "", zap.NewNop())
+		p := NewProcessor(st, f, nil, zap.NewNop())
+
+		authorized, err := f.Authorize(ctx, AuthorizeRequest{OrderID: 1, Amount: 100, Token: "tok_visa"}, "a")
+		require.NoError(t, err)
+
+		st.EXPECT().GetPayment("pay_1").Times(1).Return(nil, apperr.NotFound("payment not found"))
+		st.EXPECT().SavePayment(stored(models.PaymentAuthorized)).Times(1).Return(nil)
+		st.EXPECT().GetOrder(1).Times(2).Return(order(models.OrderCancelled), nil)
+		st.EXPECT().GetPayment("pay_1").Times(1).Return(stored(models.PaymentAuthorized), nil)
+		st.EXPECT().SavePayment(stored(models.PaymentVoided)).Times(1).Return(nil)
+
+		assert.NoError(t, p.Apply(ctx, authorized))
+		assert.Equal(t, models.PaymentVoided, f.payments["pay_1"].Status)
+	})
+
+	t.Run("test captured payment of a cancelled order is refunded", func(t *testing.T) {
+		c := gomock.NewController(t)
+		defer c.Finish()
+
+		st := storage.NewMockStorage(c)
+		f := NewFakeProvider(nil, "", "", zap.NewNop())
+		p := NewProcessor(st, f, nil, zap.NewNop())
+
+		_, err := f.Authorize(ctx, AuthorizeRequest{OrderID: 1, Amount: 100, Token: "tok_visa"}, "a")
+		require.NoError(t, err)
+		captured, err := f.Capture(ctx, "pay_1", "c")
+		require.NoError(t, err)
+
+		st.EXPECT().GetPayment("pay_1").Times(1).Return(stored(models.PaymentAuthorized), nil)
+		st.EXPECT().SavePayment(stored(models.PaymentCaptured)).Times(1).Return(nil)
+		st.EXPECT().GetOrder(1).Times(1).Return(order(models.OrderCancelled), nil)
+		st.EXPECT().GetPayment("pay_1").Times(1).Return(stored(models.PaymentCaptured), nil)
+		st.EXPECT().SavePayment(stored(models.PaymentRefunded)).Times(1).Return(nil)
+
+		assert.NoError(t, p.Apply(ctx, captured))
+		assert.Equal(t, models.PaymentRefunded, f.payments["pay_1"].Status)
+	})
+
+	t.Run("test repeated capture of a shipped order is not refunded", func(t *testing.T) {
+		c := gomock.NewController(t)
+		defer c.Finish()
+
+		st := storage.NewMockStorage(c)
+		p := NewProcessor(st, NewFakeProvider(nil, "", "", zap.NewNop()), nil, zap.NewNop())
+
+		st.EXPECT().GetPayment("pay_1").Times(1).Return(stored(models.PaymentCaptured), nil)
+		st.EXPECT().SavePayment(stored(models.PaymentCaptured)).Times(1).Return(nil)
+		st.EXPECT().GetOrder(1).Times(1).Return(order(models.OrderShipped), nil)
+
+		assert.NoError(t, p.Apply(ctx, tx(models.PaymentCaptured)))
+	})
+}
+
+func TestProcessor_Pay(t *testing.T) {
+	ctx := context.Background()
+	order := &models.Order{Model: gorm.Model{ID: 1}, Status: models.OrderPending, GrandTotal: 100}
+
+	// newProcessor keeps the payments and the order status in memory, so the attempts see each other.
+	// Attempts wait for each other after looking for the payment of the order when looked is given.
+	newProcessor := func(c *gomock.Controller, looked *sync.WaitGroup) (*Processor, *FakeProvider) {
+		var mu sync.Mutex
+		var payments []models.Payment
+		status := models.OrderPending
+
+		st := storage.NewMockStorage(c)
+		st.EXPECT().GetOrderPayment(1).AnyTimes().DoAndReturn(func(int) (*models.Payment, error) {
+			if looked != nil {
+				looked.Done()
+				defer looked.Wait()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			for i := len(payments) - 1; i >= 0; i-- {
+				if payments[i].Status != models.PaymentDeclined {
+					p := payments[i]
+					return &p, nil
+				}
+			}
+			return nil, apperr.NotFound("payment not found")
+		})
+		st.EXPECT().CountOrderPayments(1).AnyTimes().DoAndReturn(func(int) (int, error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			return len(payments), nil
+		})
+		st.EXPECT().GetPayment(gomock.Any()).AnyTimes().DoAndReturn(func(id string) (*models.Payment, error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			for _, p := range payments {
+				if p.ProviderID == id {
+					return &p, nil
+				}
+			}
+			return nil, apperr.NotFound("payment not found")
+		})
+		st.EXPECT().SavePayment(gomock.Any()).AnyTimes().DoAndReturn(func(p *models.Payment) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			for i := range payments {
+				if payments[i].ProviderID == p.ProviderID {
+					payments[i].Status = p.Status
+					return nil
+				}
+			}
+			payments = append(payments, *p)
+			return nil
+		})
+		st.EXPECT().GetOrder(1).AnyTimes().DoAndReturn(func(int) (*models.Order, error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			return &models.Order{Model: gorm.Model{ID: 1}, Status: status, GrandTotal: 100}, nil
+		})
+		st.EXPECT().UpdateOrderStatus(gomock.Any()).AnyTimes().DoAndReturn(func(entry *models.OrderHistory) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if status != entry.FromStatus {
+				return storage.ErrOrderStatusChanged
+			}
+			status = entry.ToStatus
+			return nil
+		})
+
+		f := NewFakeProvider(nil, "", "", zap.NewNop())
+		return NewProcessor(st, f, nil, zap.NewNop()), f
+	}
+
+	t.Run("test order which is not pending", func(t *testing.T) {
+		c := gomock.NewController(t)
+		defer c.Finish()
+
+		p, _ := newProcessor(c, nil)
+		paid := &models.Order{Model: gorm.Model{ID: 1}, Status: models.OrderPaid, GrandTotal: 100}
+
+		payment, err := p.Pay(ctx, paid, "tok_visa")
+		assert.Equal(t, ErrOrderNotPayable, err)
+		assert.Nil(t, payment)
+	})
+
+	t.Run("test order which is cancelled after it was read", func(t *testing.T) {
+		c := gomock.NewController(t)
+		defer c.Finish()
+
+		st := storage.NewMockStorage(c)
+		f := NewFakeProvider(nil, "", "", zap.NewNop())
+		p := NewProcessor(st, f, nil, zap.NewNop())
+
+		st.EXPECT().CountOrderPayments(1).Times(1).Return(0, nil)
+		st.EXPECT().GetOrderPayment(1).Times(1).Return(nil, apperr.NotFound("payment not found"))
+		st.EXPECT().GetOrder(1).Times(1).Return(&models.Order{
+			Model: gorm.Model{ID: 1}, Status: models.OrderCancelled, GrandTotal: 100,
+		}, nil)
+
+		payment, err := p.Pay(ctx, order, "tok_visa")
+		assert.Equal(t, ErrOrderNotPayable, err)
+		assert.Nil(t, payment)
+		assert.Empty(t, f.payments)
+	})
+
+	t.Run("test concurrent payments charge once", func(t *testing.T) {
+		c := gomock.NewController(t)
+		defer c.Finish()
+
+		const attempts = 10
+
+		var looked sync.WaitGroup
+		looked.Add(attempts)
+		p, f := newProcessor(c, &looked)
+
+		results := make([]*models.Payment, attempts)
+		errs := make([]error, attempts)
+
+		var wg sync.WaitGroup
+		for i := 0; i < attempts; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+
+				// different tokens are different requests with their own client side idempotency keys
+				token := "tok_visa"
+				if i%2 == 1 {
+					token = "tok_mastercard"
+				}
+				results[i], errs[i] = p.Pay(ctx, order, token)
+			}(i)
+		}
+		wg.Wait()
+
+		var id string
+		for i := range results {
+			// an attempt which looks at the order after another one paid it finds it's not pending anymore
+			if errs[i] != nil {
+				assert.Contains(t, []error{ErrOrderBeingPaid, ErrOrderNotPayable}, errs[i])
+				continue
+			}
+
+			if id == "" {
+				id = results[i].ProviderID
+			}
+			assert.Equal(t, id, results[i].ProviderID)
+		}
+
+		assert.NotEmpty(t, id)
+		assert.Len(t, f.payments, 1)
+		assert.Equal(t, models.PaymentCaptured, f.payments[id].Status)
+	})
+
+	t.Run("test declined payment is retried with a new key", func(t *testing.T) {
+		c := gomock.NewController(t)
+		defer c.Finish()
+
+		p, f := newProcessor(c, nil)
+
+		declined, err := p.Pay(ctx, order, FakeTokenDecline)
+		require.NoError(t, err)
+		assert.Equal(t, models.PaymentDeclined, declined.Status)
+
+		captured, err := p.Pay(ctx, order, "tok_visa")
+		require.NoError(t, err)
+		assert.Equal(t, models.PaymentCaptured, captured.Status)
+		assert.NotEqual(t, declined.ProviderID, captured.ProviderID)
+		assert.Len(t, f.payments, 2)
+	})
+}
+
+func TestProcessor_Release(t *testing.T) {
+	ctx := context.Background()
+	order := &models.Order{Model: gorm.Model{ID: 1}, Status: models.OrderPending, GrandTotal: 100}
+
+	newProcessor := func(c *gomock.Controller, token string) (*Processor, *storage.MockStorage, *Transaction) {
+		st := storage.NewMockStorage(c)
+		f := NewFakeProvider(nil, "", "", zap.NewNop())
+
+		tx, err := f.Authorize(ctx, AuthorizeRequest{OrderID: 1, Amount: 100, Token: token}, "a")
+		require.NoError(t, err)
+
+		return NewProcessor(st, f, nil, zap.NewNop()), st, tx
+	}
+
+	t.Run("test order without payment", func(t *testing.T) {
+		c := gomock.NewController(t)
+		defer c.Finish()
+
+		p, st, _ := newProcessor(c, "tok_visa")
+		st.EXPECT().GetOrderPayment(1).Times(1).Return(nil, apperr.NotFound("payment not found"))
+
+		assert.NoError(t, p.Release(ctx, order, models.OrderCancelled))
+	})
+
+	t.Run("test cancel voids the payment", func(t *testing.T) {
+		c := gomock.NewController(t)
+		defer c.Finish()
+
+		p, st, tx := newProcessor(c, FakeToken3DS)
+		payment := &models.Payment{OrderID: 1, ProviderID: tx.ID, Status: models.PaymentPending, Amount: 100}
+
+		st.EXPECT().GetOrderPayment(1).Times(1).Return(payment, nil)
+		st.EXPECT().GetPayment(tx.ID).Times(1).Return(payment, nil)
+		st.EXPECT().SavePayment(&models.Payment{
+			OrderID: 1, ProviderID: tx.ID, Status: models.PaymentVoided, Amount: 100,
+		}).Times(1).Return(nil)
+
+		assert.NoError(t, p.Release(ctx, order, models.OrderCancelled))
+	})
+
+	t.Run("test cancel refunds a payment captured meanwhile", func(t *testing.T) {
+		c := gomock.NewController(t)
+		defer c.Finish()
+
+		p, st, tx := newProcessor(c, "tok_visa")
+		_, err := p.provider.Capture(ctx, tx.ID, "c")
+		require.NoError(t, err)
+
+		captured := &models.Payment{OrderID: 1, ProviderID: tx.ID, Status: models.PaymentCaptured, Amount: 100}
+		st.EXPECT().GetOrderPayment(1).Times(1).Return(captured, nil)
+		st.EXPECT().GetPayment(tx.ID).Times(1).Return(captured, nil)
+		st.EXPECT().SavePayment(&models.Payment{
+			OrderID: 1, ProviderID: tx.ID, Status: models.PaymentRefunded, Amount: 100,
+		}).Times(1).Return(nil)
+
+		assert.NoError(t, p.Release(ctx, order, models.OrderCancelled))
+	})
+
+	t.Run("test released payment is left alone", func(t *testing.T) {
+		c := gomock.NewController(t)
+		defer c.Finish()
+
+		p, st, tx := newProcessor(c, "tok_visa")
+		st.EXPECT().GetOrderPayment(1).Times(1).Return(&models.Payment{
+			OrderID: 1, ProviderID: tx.ID, Status: models.PaymentVoided, Amount: 100,
+		}, nil)
+
+		assert.NoError(t, p.Release(ctx, order, models.OrderCancelled))
+	})
+
+	t.Run("test other statuses", func(t *testing.T) {
+		c := gomock.NewController(t)
+		defer c.Finish()
+
+		p, st, tx := newProcessor(c, "tok_visa")
+		st.EXPECT().GetOrderPayment(1).Times(1).Return(&models.Payment{
+			OrderID: 1, ProviderID: tx.ID, Status: models.PaymentAuthorized, Amount: 100,
+		}, nil)
+
+		assert.NoError(t, p.Release(ctx, order, models.OrderRefunded))
+	})
+}
+
+func TestProcessor_CheckRelease(t *testing.T) {
+	order := &models.Order{Model: gorm.Model{ID: 1}, Status: models.OrderPending, GrandTotal: 100}
+	payment := func(status models.PaymentStatus) *models.Payment {
+		return &models.Payment{OrderID: 1, ProviderID: "pay_1", Status: status, Amount: 100}
+	}
+
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	st := storage.NewMockStorage(c)
+	p := NewProcessor(st, NewFakeProvider(nil, "", "", zap.NewNop()), nil, zap.NewNop())
+
+	t.Run("test order without payment", func(t *testing.T) {
+		st.EXPECT().GetOrderPayment(1).Times(1).Return(nil, apperr.NotFound("payment not found"))
+		assert.NoError(t, p.CheckRelease(order, models.OrderCancelled))
+	})
+
+	t.Run("test cancel with an uncaptured payment", func(t *testing.T) {
+		st.EXPECT().GetOrderPayment(1).Times(1).Return(payment(models.PaymentAuthorized), nil)
+		assert.NoError(t, p.CheckRelease(order, models.OrderCancelled))
+	})
+
+	t.Run("test cancel with a captured payment", func(t *testing.T) {
+		st.EXPECT().GetOrderPayment(1).Times(1).Return(payment(models.PaymentCaptured), nil)
+
+		err := p.CheckRelease(order, models.OrderCancelled)
+		assert.Equal(t, apperr.CodeConflict, apperr.CodeOf(err))
+	})
+
+	t.Run("test other statuses", func(t *testing.T) {
+		assert.NoError(t, p.CheckRelease(order, models.OrderRefunded))
+	})
+
+	t.Run("test when storage returns an error", func(t *testing.T) {
+		st.EXPECT().GetOrderPayment(1).Times(1).Return(nil, errors.New("failed"))
+		assert.Error(t, p.CheckRelease(order, models.OrderCancelled))
+	})
+}
@@ -0,0 +1,76 @@
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// SignatureHeader is the header of webhook requests which carries their signature
+	SignatureHeader = "Payment-Signature"
+
+	// SignatureTolerance is how far the time of a signature can be from now, so captured
+	// webhook requests can't be replayed later
+	SignatureTolerance = 5 * time.Minute
+)
+
+// ErrInvalidSignature is returned when the signature of a webhook request doesn't match its body
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// signature is the HMAC-SHA256 of the time and the body, signing the time stops it from being changed
+func signature(secret []byte, body []byte, unix int64) string {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%d.", unix)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sign creates the signature header of the body sent at time t, in the form of t=<unix time>,v1=<signature>
+func Sign(secret []byte, body []byte, t time.Time) string {
+	return fmt.Sprintf("t=%d,v1=%s", t.Unix(), signature(secret, body, t.Unix()))
+}
+
+// VerifySignature checks the signature header matches the body and was created around now
+func VerifySignature(secret []byte, header string, body []byte, now time.Time) error {
+	var (
+		unix int64
+		sig  string
+		err  error
+	)
+
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return ErrInvalidSignature
+		}
+
+		switch kv[0] {
+		case "t":
+			if unix, err = strconv.ParseInt(kv[1], 10, 64); err != nil {
+				return ErrInvalidSignature
+			}
+		case "v1":
+			sig = kv[1]
+		}
+	}
+
+	if unix == 0 || sig == "" {
+		return ErrInvalidSignature
+	}
+
+	if d := now.Sub(time.Unix(unix, 0)); d > SignatureTolerance || d < -SignatureTolerance {
+		return ErrInvalidSignature
+	}
+
+	if !hmac.Equal([]byte(sig), []byte(signature(secret, body, unix))) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
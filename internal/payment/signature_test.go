@@ -0,0 +1,47 @@
+package payment
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestVerifySignature(t *testing.T) {
+	secret := []byte("secret")
+	body := []byte(`{"id":"evt_1"}`)
+	now := time.Unix(1600000000, 0)
+
+	t.Run("test valid signature", func(t *testing.T) {
+		assert.NoError(t, VerifySignature(secret, Sign(secret, body, now), body, now))
+		assert.NoError(t, VerifySignature(secret, Sign(secret, body, now), body, now.Add(SignatureTolerance)))
+	})
+
+	t.Run("test changed body", func(t *testing.T) {
+		err := VerifySignature(secret, Sign(secret, body, now), []byte(`{"id":"evt_2"}`), now)
+		assert.Equal(t, ErrInvalidSignature, err)
+	})
+
+	t.Run("test other secret", func(t *testing.T) {
+		err := VerifySignature([]byte("other"), Sign(secret, body, now), body, now)
+		assert.Equal(t, ErrInvalidSignature, err)
+	})
+
+	t.Run("test old signature", func(t *testing.T) {
+		err := VerifySignature(secret, Sign(secret, body, now), body, now.Add(SignatureTolerance+time.Second))
+		assert.Equal(t, ErrInvalidSignature, err)
+	})
+
+	t.Run("test changed time", func(t *testing.T) {
+		header := Sign(secret, body, now)
+		header = "t=1600000001" + header[len("t=1600000000"):]
+
+		err := VerifySignature(secret, header, body, now)
+		assert.Equal(t, ErrInvalidSignature, err)
+	})
+
+	t.Run("test malformed headers", func(t *testing.T) {
+		for _, h := range []string{"", "t=1600000000", "v1=abc", "t=abc,v1=abc", "garbage"} {
+			assert.Equal(t, ErrInvalidSignature, VerifySignature(secret, h, body, now), h)
+		}
+	})
+}
@@ -0,0 +1,41 @@
+package payment
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+)
+
+// maxWebhookBodySize is the maximum size of webhook request bodies
+const maxWebhookBodySize = 1 << 20
+
+// GinWebhookHandler applies the payment events sent by the provider, events with an invalid
+// signature are rejected and failed events are answered with an error so the provider retries them
+func (p *Processor) GinWebhookHandler(ctx *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(ctx.Request.Body, maxWebhookBodySize))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to read body"})
+		return
+	}
+
+	if err := VerifySignature(p.secret, ctx.GetHeader(SignatureHeader), body, p.now()); err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var e Event
+	if err := json.Unmarshal(body, &e); err != nil || e.Payment.ID == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid event"})
+		return
+	}
+
+	if err := p.Apply(ctx.Request.Context(), &e.Payment); err != nil {
+		p.logger.Error("failed to apply payment event", zap.String("event", e.ID), zap.Error(err))
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to apply event"})
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
@@ -0,0 +1,92 @@
+package payment
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/moeen/redisearch-shopping/internal/apperr"
+	"github.com/moeen/redisearch-shopping/internal/storage"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestProcessor_GinWebhookHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	secret := []byte("secret")
+	now := time.Now()
+
+	newRouter := func(st storage.Storage) *gin.Engine {
+		p := NewProcessor(st, NewFakeProvider(nil, "", "", zap.NewNop()), secret, zap.NewNop())
+		p.now = func() time.Time { return now }
+
+		router := gin.New()
+		router.POST("/webhooks/payments", p.GinWebhookHandler)
+		return router
+	}
+
+	post := func(router *gin.Engine, body []byte, signature string) int {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/payments", bytes.NewReader(body))
+		req.Header.Set(SignatureHeader, signature)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	event, err := json.Marshal(Event{
+		ID:      "evt_1",
+		Payment: Transaction{ID: "pay_1", OrderID: 1, Status: models.PaymentDeclined, Amount: 100},
+	})
+	require.NoError(t, err)
+
+	t.Run("test invalid signature", func(t *testing.T) {
+		c := gomock.NewController(t)
+		defer c.Finish()
+
+		router := newRouter(storage.NewMockStorage(c))
+		assert.Equal(t, http.StatusUnauthorized, post(router, event, ""))
+		assert.Equal(t, http.StatusUnauthorized, post(router, event, Sign([]byte("other"), event, now)))
+		assert.Equal(t, http.StatusUnauthorized, post(router, event, Sign(secret, event, now.Add(-time.Hour))))
+	})
+
+	t.Run("test invalid event", func(t *testing.T) {
+		c := gomock.NewController(t)
+		defer c.Finish()
+
+		router := newRouter(storage.NewMockStorage(c))
+		body := []byte(`{"id":"evt_1"}`)
+		assert.Equal(t, http.StatusBadRequest, post(router, body, Sign(secret, body, now)))
+	})
+
+	t.Run("test when applying fails", func(t *testing.T) {
+		c := gomock.NewController(t)
+		defer c.Finish()
+
+		st := storage.NewMockStorage(c)
+		st.EXPECT().GetPayment("pay_1").Times(1).Return(nil, errors.New("failed"))
+
+		assert.Equal(t, http.StatusInternalServerError, post(newRouter(st), event, Sign(secret, event, now)))
+	})
+
+	t.Run("test successful event", func(t *testing.T) {
+		c := gomock.NewController(t)
+		defer c.Finish()
+
+		st := storage.NewMockStorage(c)
+		st.EXPECT().GetPayment("pay_1").Times(1).Return(nil, apperr.NotFound("payment not found"))
+		st.EXPECT().SavePayment(&models.Payment{
+			OrderID: 1, ProviderID: "pay_1", Status: models.PaymentDeclined, Amount: 100,
+		}).Times(1).Return(nil)
+
+		assert.Equal(t, http.StatusNoContent, post(newRouter(st), event, Sign(secret, event, now)))
+	})
+}
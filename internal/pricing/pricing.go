@@ -0,0 +1,100 @@
+// Package pricing computes the totals of carts so every place which shows or charges a cart
+// agrees on the amounts, all amounts are in the smallest unit of the currency like product prices
+package pricing
+
+import (
+	"fmt"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+)
+
+// MaxTaxRate is the highest tax rate in basis points, which is 100%
+const MaxTaxRate = 10000
+
+// Line is a product in a cart with the price of a single unit of it
+type Line struct {
+	ProductID int
+	UnitPrice int
+	Quantity  int
+}
+
+// Total returns the price of all the units of the line
+func (l Line) Total() int {
+	return l.UnitPrice * l.Quantity
+}
+
+// CartLines creates the lines of the cart items, the items must be loaded with their products
+func CartLines(items []*models.CartItem) []Line {
+	lines := make([]Line, len(items))
+	for i, ci := range items {
+		lines[i] = Line{
+			ProductID: ci.ProductID,
+			UnitPrice: ci.Product.Price,
+			Quantity:  ci.Quantity,
+		}
+	}
+
+	return lines
+}
+
+// Discount returns the amount which is taken off the subtotal of the lines
+type Discount func(lines []Line, subtotal int) int
+
+// Breakdown is the priced cart
+type Breakdown struct {
+	// ItemCount is the number of units of all the lines
+	ItemCount int
+
+	// Subtotal is the sum of the totals of the lines
+	Subtotal int
+
+	// DiscountTotal is the amount taken off the subtotal, it's never more than the subtotal
+	DiscountTotal int
+
+	// TaxTotal is the tax charged on the discounted subtotal
+	TaxTotal int
+
+	// GrandTotal is the amount the customer pays
+	GrandTotal int
+}
+
+// Service prices carts, the zero value charges no tax and gives no discount
+type Service struct {
+	// TaxRate is the tax charged on the discounted subtotal in basis points, 1000 is 10%
+	TaxRate int
+
+	// Discounts are applied to every cart in order
+	Discounts []Discount
+}
+
+// Validate checks the configuration of the service
+func (s Service) Validate() error {
+	if s.TaxRate < 0 || s.TaxRate > MaxTaxRate {
+		return fmt.Errorf("tax rate must be between 0 and %d basis points", MaxTaxRate)
+	}
+
+	return nil
+}
+
+// Price computes the breakdown of the lines, the tax is rounded half up to the smallest unit
+func (s Service) Price(lines []Line) Breakdown {
+	var b Breakdown
+	for _, l := range lines {
+		b.ItemCount += l.Quantity
+		b.Subtotal += l.Total()
+	}
+
+	for _, d := range s.Discounts {
+		if amount := d(lines, b.Subtotal); amount > 0 {
+			b.DiscountTotal += amount
+		}
+	}
+	if b.DiscountTotal > b.Subtotal {
+		b.DiscountTotal = b.Subtotal
+	}
+
+	taxable := b.Subtotal - b.DiscountTotal
+	b.TaxTotal = (taxable*s.TaxRate + MaxTaxRate/2) / MaxTaxRate
+	b.GrandTotal = taxable + b.TaxTotal
+
+	return b
+}
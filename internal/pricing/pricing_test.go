@@ -0,0 +1,80 @@
+package pricing
+
+import (
+	"github.com/moeen/redisearch-shopping/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCartLines(t *testing.T) {
+	lines := CartLines([]*models.CartItem{
+		{ProductID: 1, Product: models.Product{Price: 250}, Quantity: 2},
+		{ProductID: 2, Product: models.Product{Price: 100}, Quantity: 1},
+	})
+
+	assert.Equal(t, []Line{
+		{ProductID: 1, UnitPrice: 250, Quantity: 2},
+		{ProductID: 2, UnitPrice: 100, Quantity: 1},
+	}, lines)
+	assert.Equal(t, 500, lines[0].Total())
+}
+
+func TestService_Price(t *testing.T) {
+	lines := []Line{
+		{ProductID: 1, UnitPrice: 250, Quantity: 2},
+		{ProductID: 2, UnitPrice: 99, Quantity: 3},
+	}
+
+	fixed := func(amount int) Discount {
+		return func([]Line, int) int { return amount }
+	}
+
+	t.Run("test zero value", func(t *testing.T) {
+		assert.Equal(t, Breakdown{
+			ItemCount:  5,
+			Subtotal:   797,
+			GrandTotal: 797,
+		}, Service{}.Price(lines))
+	})
+
+	t.Run("test empty cart", func(t *testing.T) {
+		assert.Equal(t, Breakdown{}, Service{TaxRate: 1000, Discounts: []Discount{fixed(100)}}.Price(nil))
+	})
+
+	t.Run("test tax is rounded half up", func(t *testing.T) {
+		// 10% of 797 is 79.7
+		b := Service{TaxRate: 1000}.Price(lines)
+		assert.Equal(t, 80, b.TaxTotal)
+		assert.Equal(t, 877, b.GrandTotal)
+
+		// 10% of 795 is 79.5
+		b = Service{TaxRate: 1000, Discounts: []Discount{fixed(2)}}.Price(lines)
+		assert.Equal(t, 80, b.TaxTotal)
+		assert.Equal(t, 875, b.GrandTotal)
+	})
+
+	t.Run("test discounts", func(t *testing.T) {
+		b := Service{TaxRate: 1000, Discounts: []Discount{fixed(97), fixed(-50), fixed(200)}}.Price(lines)
+		assert.Equal(t, Breakdown{
+			ItemCount:     5,
+			Subtotal:      797,
+			DiscountTotal: 297,
+			TaxTotal:      50,
+			GrandTotal:    550,
+		}, b)
+	})
+
+	t.Run("test discounts more than the subtotal", func(t *testing.T) {
+		b := Service{TaxRate: 1000, Discounts: []Discount{fixed(1000)}}.Price(lines)
+		assert.Equal(t, 797, b.DiscountTotal)
+		assert.Equal(t, 0, b.TaxTotal)
+		assert.Equal(t, 0, b.GrandTotal)
+	})
+}
+
+func TestService_Validate(t *testing.T) {
+	assert.NoError(t, Service{}.Validate())
+	assert.NoError(t, Service{TaxRate: MaxTaxRate}.Validate())
+	assert.Error(t, Service{TaxRate: -1}.Validate())
+	assert.Error(t, Service{TaxRate: MaxTaxRate + 1}.Validate())
+}
@@ -0,0 +1,68 @@
+package router
+
+import (
+	"context"
+	"errors"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/gin-gonic/gin"
+	"github.com/moeen/redisearch-shopping/internal/apperr"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"go.uber.org/zap"
+)
+
+// internalErrorMessage replaces the message of internal errors in release mode
+const internalErrorMessage = "internal server error"
+
+// errorPresenter turns resolver errors into GraphQL errors carrying their code in extensions. Errors of
+// gqlgen itself, like invalid arguments and variables, are validation errors. Any other errors which
+// aren't domain errors are logged and their messages are hidden in release mode.
+func errorPresenter(mode string, logger *zap.Logger) graphql.ErrorPresenterFunc {
+	return func(ctx context.Context, err error) *gqlerror.Error {
+		gqlErr := graphql.DefaultErrorPresenter(ctx, err)
+
+		var appErr *apperr.Error
+		if errors.As(err, &appErr) {
+			gqlErr.Message = appErr.Message
+			gqlErr.Extensions = make(map[string]interface{}, len(appErr.Extensions)+1)
+			for k, v := range appErr.Extensions {
+				gqlErr.Extensions[k] = v
+			}
+			gqlErr.Extensions["code"] = string(appErr.Code)
+
+			return gqlErr
+		}
+
+		if isGraphQLError(ctx, gqlErr) {
+			if gqlErr.Extensions == nil {
+				gqlErr.Extensions = make(map[string]interface{}, 1)
+			}
+			if _, ok := gqlErr.Extensions["code"]; !ok {
+				gqlErr.Extensions["code"] = string(apperr.CodeValidation)
+			}
+
+			return gqlErr
+		}
+
+		logger.Error("internal error", zap.String("path", gqlErr.Path.String()), zap.Error(err))
+
+		if mode == gin.ReleaseMode {
+			gqlErr.Message = internalErrorMessage
+		}
+		gqlErr.Extensions = map[string]interface{}{"code": string(apperr.CodeInternal)}
+
+		return gqlErr
+	}
+}
+
+// isGraphQLError reports whether the error was made by gqlgen or a resolver as a GraphQL error rather
+// than wrapped on the way out of a resolver. Such errors either wrap nothing, or are on the path of an
+// argument which failed to be coerced rather than on the path of the field.
+func isGraphQLError(ctx context.Context, gqlErr *gqlerror.Error) bool {
+	if errors.Unwrap(gqlErr) == nil {
+		return true
+	}
+
+	fc := graphql.GetFieldContext(ctx)
+	return fc != nil && gqlErr.Path.String() != fc.Path().String()
+}
@@ -0,0 +1,139 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/gin-gonic/gin"
+	"github.com/moeen/redisearch-shopping/graph"
+	"github.com/moeen/redisearch-shopping/graph/generated"
+	"github.com/moeen/redisearch-shopping/internal/apperr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestErrorPresenter(t *testing.T) {
+	path := ast.Path{ast.PathName("product")}
+
+	t.Run("test domain error", func(t *testing.T) {
+		present := errorPresenter(gin.ReleaseMode, zap.NewNop())
+
+		cause := apperr.Wrap(apperr.CodeNotFound, "product not found", errors.New("sqlite: record not found"))
+		err := present(context.Background(), gqlerror.WrapPath(path, fmt.Errorf("failed to get product: %w", cause)))
+
+		assert.Equal(t, "product not found", err.Message)
+		assert.Equal(t, path, err.Path)
+		assert.Equal(t, map[string]interface{}{"code": "NOT_FOUND"}, err.Extensions)
+	})
+
+	t.Run("test domain error with extensions", func(t *testing.T) {
+		present := errorPresenter(gin.ReleaseMode, zap.NewNop())
+
+		cause := apperr.Validation("invalid id").With("field", "id")
+		err := present(context.Background(), gqlerror.WrapPath(path, cause))
+
+		assert.Equal(t, "invalid id", err.Message)
+		assert.Equal(t, map[string]interface{}{"code": "VALIDATION", "field": "id"}, err.Extensions)
+		assert.Nil(t, cause.Extensions["code"])
+	})
+
+	t.Run("test internal error in release mode", func(t *testing.T) {
+		core, logs := observer.New(zap.ErrorLevel)
+		present := errorPresenter(gin.ReleaseMode, zap.New(core))
+
+		err := present(context.Background(), gqlerror.WrapPath(path, errors.New("failed to query: no such table")))
+
+		assert.Equal(t, internalErrorMessage, err.Message)
+		assert.Equal(t, map[string]interface{}{"code": "INTERNAL"}, err.Extensions)
+		assert.Equal(t, 1, logs.FilterMessage("internal error").Len())
+	})
+
+	t.Run("test graphql error in release mode", func(t *testing.T) {
+		core, logs := observer.New(zap.ErrorLevel)
+		present := errorPresenter(gin.ReleaseMode, zap.New(core))
+
+		err := present(context.Background(), gqlerror.ErrorPathf(path, "variable id must be an ID"))
+
+		assert.Equal(t, "variable id must be an ID", err.Message)
+		assert.Equal(t, map[string]interface{}{"code": "VALIDATION"}, err.Extensions)
+		assert.Equal(t, 0, logs.Len())
+	})
+
+	t.Run("test argument which failed to be coerced", func(t *testing.T) {
+		core, logs := observer.New(zap.ErrorLevel)
+		present := errorPresenter(gin.ReleaseMode, zap.New(core))
+
+		ctx := graphql.WithFieldContext(context.Background(), &graphql.FieldContext{
+			Field: graphql.CollectedField{Field: &ast.Field{Alias: "product"}},
+		})
+		argPath := append(ast.Path{}, path...)
+		argPath = append(argPath, ast.PathName("id"))
+		err := present(ctx, gqlerror.WrapPath(argPath, errors.New("map[string]interface {} is not a string")))
+
+		assert.Equal(t, "map[string]interface {} is not a string", err.Message)
+		assert.Equal(t, map[string]interface{}{"code": "VALIDATION"}, err.Extensions)
+		assert.Equal(t, 0, logs.Len())
+	})
+
+	t.Run("test internal error of a field in release mode", func(t *testing.T) {
+		core, logs := observer.New(zap.ErrorLevel)
+		present := errorPresenter(gin.ReleaseMode, zap.New(core))
+
+		ctx := graphql.WithFieldContext(context.Background(), &graphql.FieldContext{
+			Field: graphql.CollectedField{Field: &ast.Field{Alias: "product"}},
+		})
+		err := present(ctx, gqlerror.WrapPath(path, errors.New("failed to query: no such table")))
+
+		assert.Equal(t, internalErrorMessage, err.Message)
+		assert.Equal(t, map[string]interface{}{"code": "INTERNAL"}, err.Extensions)
+		assert.Equal(t, 1, logs.FilterMessage("internal error").Len())
+	})
+
+	t.Run("test invalid variables of a request", func(t *testing.T) {
+		core, logs := observer.New(zap.ErrorLevel)
+
+		srv := handler.NewDefaultServer(generated.NewExecutableSchema(generated.Config{
+			Resolvers:  &graph.Resolver{},
+			Directives: generated.DirectiveRoot{HasRole: graph.HasRole},
+		}))
+		srv.SetErrorPresenter(errorPresenter(gin.ReleaseMode, zap.New(core)))
+
+		body := `{"query":"query ($id: ID!) { product(id: $id) { id } }","variables":{"id":{"a":1}}}`
+		req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		res := httptest.NewRecorder()
+		srv.ServeHTTP(res, req)
+
+		var resp struct {
+			Errors []struct {
+				Message    string                 `json:"message"`
+				Extensions map[string]interface{} `json:"extensions"`
+			} `json:"errors"`
+		}
+		require.NoError(t, json.Unmarshal(res.Body.Bytes(), &resp))
+		require.Len(t, resp.Errors, 1)
+		assert.NotEqual(t, internalErrorMessage, resp.Errors[0].Message)
+		assert.Equal(t, 0, logs.Len())
+	})
+
+	t.Run("test internal error in debug mode", func(t *testing.T) {
+		present := errorPresenter(gin.DebugMode, zap.NewNop())
+
+		err := present(context.Background(), gqlerror.WrapPath(path, errors.New("failed to query: no such table")))
+
+		assert.Equal(t, "failed to query: no such table", err.Message)
+		assert.Equal(t, map[string]interface{}{"code": "INTERNAL"}, err.Extensions)
+	})
+}
@@ -9,40 +9,61 @@ import (
 	"github.com/moeen/redisearch-shopping/graph"
 	"github.com/moeen/redisearch-shopping/graph/generated"
 	"github.com/moeen/redisearch-shopping/internal/auth"
-	"github.com/moeen/redisearch-shopping/internal/storage"
+	"github.com/moeen/redisearch-shopping/internal/payment"
 	"go.uber.org/zap"
 	"net/http"
 	"time"
 )
 
-// DefaultPort is used when no port is provided to run the GraphQL server
-const DefaultPort = 8080
+const (
+	// DefaultPort is used when no port is provided to run the GraphQL server
+	DefaultPort = 8080
 
-// setupGraphQLRouter creates the router along with handlers and needed middlewares
-func setupGraphQLRouter(mode string, storage storage.Storage, searcher storage.Searcher, logger *zap.Logger) *gin.Engine {
-	a := auth.NewAuth(storage)
+	// PaymentWebhookPath is where the payment provider sends payment events
+	PaymentWebhookPath = "/webhooks/payments"
+
+	// FakePaymentActionPath is where customers complete the actions of fake payments
+	FakePaymentActionPath = "/fake-payments"
+)
+
+// setupGraphQLRouter creates the router along with handlers and needed middlewares,
+// the resolver holds all the dependencies of the handlers
+func setupGraphQLRouter(mode string, resolver *graph.Resolver, clientIPs *auth.ClientIPResolver, logger *zap.Logger) *gin.Engine {
+	a := auth.NewAuth(resolver.Storage, resolver.Keys, resolver.Denylist)
 
 	gin.SetMode(mode)
 
 	router := gin.New()
+	// client IPs are resolved by clientIPs, gin only trusts forwarded headers of proxies prepared by Run
+	router.ForwardedByClientIP = false
 	router.Use(gin.Recovery())
 
 	router.Use(ginzap.Ginzap(logger, time.RFC3339, false))
 	router.Use(ginzap.RecoveryWithZap(logger, true))
 
 	srv := handler.NewDefaultServer(generated.NewExecutableSchema(generated.Config{
-		Resolvers: &graph.Resolver{Storage: storage, Searcher: searcher},
+		Resolvers:  resolver,
+		Directives: generated.DirectiveRoot{HasRole: graph.HasRole},
 	}))
+	srv.SetErrorPresenter(errorPresenter(mode, logger))
 	router.GET("/", gin.WrapH(playground.Handler("GraphQL playground", "/query")))
-	router.POST("/query", a.GinJWTMiddleware, gin.WrapH(srv))
+	router.POST("/query", clientIPs.GinMiddleware, a.GinJWTMiddleware, gin.WrapH(srv))
+	router.GET("/.well-known/jwks.json", resolver.Keys.GinJWKSHandler)
+
+	router.POST(PaymentWebhookPath, resolver.Payments.GinWebhookHandler)
+
+	// the fake provider is only loaded outside release mode or when fake payments are allowed
+	if fake, ok := resolver.Payments.Provider().(*payment.FakeProvider); ok {
+		router.GET(FakePaymentActionPath+"/:id", fake.GinActionHandler)
+	}
 
 	return router
 }
 
-// GraphQLServer creates a http.Server with created GraphQL router
-func GraphQLServer(mode string, port int, storage storage.Storage, searcher storage.Searcher, logger *zap.Logger) *http.Server {
+// GraphQLServer creates a http.Server with created GraphQL router, clientIPs finds the IPs of clients behind proxies
+func GraphQLServer(mode string, port int, resolver *graph.Resolver, clientIPs *auth.ClientIPResolver, logger *zap.Logger) *http.Server {
 	return &http.Server{
 		Addr:    fmt.Sprintf(":%d", port),
-		Handler: setupGraphQLRouter(mode, storage, searcher, logger),
+		Handler: setupGraphQLRouter(mode, resolver, clientIPs, logger),
 	}
 }
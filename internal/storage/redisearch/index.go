@@ -0,0 +1,637 @@
+package redisearch
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/RediSearch/redisearch-go/redisearch"
+	"github.com/gomodule/redigo/redis"
+	"github.com/moeen/redisearch-shopping/internal/storage"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+	"go.uber.org/zap"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxIdleConns is the maximum number of idle connections kept in the redis pool
+	maxIdleConns = 100
+
+	// reindexLockTTL is the time after which a reindex lock is released if its owner died,
+	// the owner renews it every reindexLockRenewal while it's rebuilding
+	reindexLockTTL     = time.Minute
+	reindexLockRenewal = reindexLockTTL / 3
+
+	// initPollInterval is how often Init checks for the index which another process is building
+	initPollInterval = time.Second
+
+	// schemaVersion must be bumped whenever schema changes, so Init rebuilds the indexes of older
+	// schemas. Indexes without a recorded version predate the first one.
+	schemaVersion = 3
+
+	// nameKeySchema is the first schema version which indexes the exact names of products
+	nameKeySchema = 2
+
+	// sortKeySchema is the first schema version which indexes the price and name sort keys
+	sortKeySchema = 3
+)
+
+// ErrReindexRunning is returned by Reindex when another reindex is populating a new version
+var ErrReindexRunning = errors.New("another reindex is running")
+
+// ErrReindexLockLost is returned by Reindex when its lock expired before the new version went live
+var ErrReindexLockLost = errors.New("reindex lock is lost")
+
+// releaseLockScript deletes the lock only if it's still owned by the given token
+var releaseLockScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// renewLockScript extends the lock and the building version record only if the lock is still
+// owned by the given token
+var renewLockScript = redis.NewScript(2, `
+if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+redis.call("PEXPIRE", KEYS[1], ARGV[2])
+redis.call("PEXPIRE", KEYS[2], ARGV[2])
+return 1
+`)
+
+// indexVersion is a single version of the products index along with its suggestions dictionary
+type indexVersion struct {
+	name   string
+	schema int
+	rs     *redisearch.Client
+	ac     *redisearch.Autocompleter
+}
+
+// newIndexVersion creates an indexVersion for the index with given name, its suggestions are kept
+// in a dictionary of its own until Reindex makes it live
+func (r *RediSearch) newIndexVersion(name string) *indexVersion {
+	return &indexVersion{
+		name:   name,
+		schema: schemaVersion,
+		rs:     redisearch.NewClientFromPool(r.pool, name),
+		ac:     redisearch.NewAutocompleterFromPool(r.pool, suggestionsKey(name)),
+	}
+}
+
+// add indexes the product in the version and adds its name to the suggestions. A name shared by
+// several products is suggested once, with the lowest ID of them as its payload.
+func (v *indexVersion) add(product *models.Product) error {
+	doc := redisearch.NewDocument(v.docID(product.ID), 1.0)
+	doc.Set("id", product.ID).
+		Set("name", product.Name).
+		Set("nameKey", nameKey(product.Name)).
+		Set("nameSort", nameSortKey(product)).
+		Set("price", product.Price).
+		Set("priceSort", priceSortKey(product)).
+		Set("stock", product.Stock).
+		Set("inStock", strconv.FormatBool(product.Stock > 0)).
+		Set("categories", strings.Join(categoryTags(product), ","))
+
+	if err := v.rs.IndexOptions(redisearch.IndexingOptions{Replace: true}, doc); err != nil {
+		return fmt.Errorf("failed to create doc: %w", err)
+	}
+
+	first, err := v.firstNamed(product.Name, product.ID)
+	if err != nil {
+		return err
+	}
+	if first != 0 && first < product.ID {
+		return nil
+	}
+
+	return v.suggest(product.Name, product.ID)
+}
+
+// suggest adds the name to the suggestions with the product ID as its payload
+func (v *indexVersion) suggest(name string, productID uint) error {
+	err := v.ac.AddTerms(redisearch.Suggestion{
+		Term:    name,
+		Score:   1.0,
+		Payload: strconv.Itoa(int(productID)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add suggestion: %w", err)
+	}
+
+	return nil
+}
+
+// get returns the indexed product with given ID, or nil if it's not indexed in the version
+func (v *indexVersion) get(id int) (*models.Product, error) {
+	doc, err := v.rs.Get(v.docID(uint(id)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get doc: %w", err)
+	}
+	if doc == nil {
+		return nil, nil
+	}
+
+	return docToProduct(*doc)
+}
+
+// update re-indexes the product and replaces its old name in the suggestions
+func (v *indexVersion) update(product *models.Product) error {
+	old, err := v.get(int(product.ID))
+	if err != nil {
+		return err
+	}
+
+	if err := v.add(product); err != nil {
+		return err
+	}
+
+	if old != nil && old.Name != product.Name {
+		return v.unsuggest(old.Name)
+	}
+
+	return nil
+}
+
+// remove deletes the product document and its suggestion from the version
+func (v *indexVersion) remove(id int) error {
+	old, err := v.get(id)
+	if err != nil {
+		return err
+	}
+	if old == nil {
+		return nil
+	}
+
+	if err := v.rs.DeleteDocument(v.docID(uint(id))); err != nil {
+		return fmt.Errorf("failed to delete doc: %w", err)
+	}
+
+	return v.unsuggest(old.Name)
+}
+
+// unsuggest deletes the name of a product which is renamed or removed from the suggestions, unless
+// other products in the version still have it, then the suggestion points to the first of them
+func (v *indexVersion) unsuggest(name string) error {
+	var first uint
+	if v.schema >= nameKeySchema {
+		var err error
+		if first, err = v.firstNamed(name, 0); err != nil {
+			return err
+		}
+	}
+
+	if first != 0 {
+		return v.suggest(name, first)
+	}
+
+	if err := v.ac.DeleteTerms(redisearch.Suggestion{Term: name}); err != nil {
+		return fmt.Errorf("failed to delete suggestion: %w", err)
+	}
+
+	return nil
+}
+
+// firstNamed returns the lowest ID of the products in the version with exactly given name other than
+// the excluded one, or zero if there's none. Versions of older schemas can't tell, so it's always zero.
+func (v *indexVersion) firstNamed(name string, exclude uint) (uint, error) {
+	if v.schema < nameKeySchema {
+		return 0, nil
+	}
+
+	q := redisearch.NewQuery(fmt.Sprintf("@nameKey:{%s} -@id:[%d %d]", nameKey(name), exclude, exclude)).
+		SetSortBy("id", true).
+		SetReturnFields("id").
+		Limit(0, 1)
+
+	docs, _, err := v.rs.Search(q)
+	if err != nil {
+		return 0, fmt.Errorf("failed to search products by name: %w", err)
+	}
+	if len(docs) == 0 {
+		return 0, nil
+	}
+
+	id, err := strconv.Atoi(fmt.Sprint(docs[0].Properties["id"]))
+	if err != nil {
+		return 0, fmt.Errorf("failed to convert id to str")
+	}
+
+	return uint(id), nil
+}
+
+// docID returns the document key of a product, documents are prefixed with
+// the version name so each version only indexes its own documents
+func (v *indexVersion) docID(productID uint) string {
+	return fmt.Sprintf("%s:product:%d", v.name, productID)
+}
+
+// Init makes sure the alias points to an index of the current schema. Without an index, the
+// first version is created and populated before returning, or the one which another process
+// is building is waited for. An index of an older schema keeps serving searches while a new
+// version is populated in the background.
+func (r *RediSearch) Init() error {
+	if _, err := r.rs.Info(); err != nil {
+		return r.waitForIndex()
+	}
+
+	version, err := r.liveSchemaVersion()
+	if err != nil {
+		return err
+	}
+	if version == schemaVersion {
+		return nil
+	}
+
+	go func() {
+		err := r.Reindex()
+		switch {
+		case errors.Is(err, ErrReindexRunning):
+			r.logger.Info("index schema is upgraded by another reindex")
+		case err != nil:
+			r.logger.Error("failed to upgrade index schema", zap.Error(err))
+		default:
+			r.logger.Info("index schema is upgraded", zap.Int("version", schemaVersion))
+		}
+	}()
+
+	return nil
+}
+
+// waitForIndex builds the first version of the index, if another process is already building it,
+// it waits until the alias points to it or builds it once the other process gives up
+func (r *RediSearch) waitForIndex() error {
+	for {
+		err := r.Reindex()
+		if !errors.Is(err, ErrReindexRunning) {
+			return err
+		}
+
+		time.Sleep(initPollInterval)
+
+		if _, err := r.rs.Info(); err == nil {
+			return nil
+		}
+	}
+}
+
+// Reindex builds a new version of the index from all the products in storage while
+// the live version keeps serving searches, then atomically points the alias to the
+// new version and drops the old one. Products added meanwhile are indexed in both, by
+// every process sharing the alias since the building version is recorded in redis.
+// The lock and the record are renewed until the swap, which is given up if they expired.
+func (r *RediSearch) Reindex() error {
+	token := strconv.FormatInt(time.Now().UnixNano(), 10)
+	release, err := r.lock(token)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	stop := r.keepLock(token)
+	defer stop()
+
+	conn := r.pool.Get()
+	n, err := redis.Int(conn.Do("INCR", fmt.Sprintf("%s:version", r.alias)))
+	conn.Close()
+	if err != nil {
+		return fmt.Errorf("failed to get next index version: %w", err)
+	}
+
+	v := r.newIndexVersion(fmt.Sprintf("%s_v%d", r.alias, n))
+	def := redisearch.NewIndexDefinition().AddPrefix(fmt.Sprintf("%s:", v.name))
+	if err := v.rs.CreateIndexWithIndexDefinition(schema(), def); err != nil {
+		return fmt.Errorf("failed to create index: %w", err)
+	}
+
+	// the version is recorded before the products are read from storage, so a product is
+	// either in the snapshot or written to the version by whoever changed it afterwards
+	if err := r.setBuilding(v.name); err != nil {
+		v.drop()
+		return err
+	}
+	defer r.clearBuilding()
+
+	products, _, err := r.storage.SearchProducts(storage.SearchOptions{})
+	if err != nil {
+		v.drop()
+		return fmt.Errorf("failed to get products from storage: %w", err)
+	}
+
+	for _, p := range products {
+		if err := v.add(p); err != nil {
+			v.drop()
+			return fmt.Errorf("failed to add product to searcher: %w", err)
+		}
+	}
+
+	// writes stop being mirrored to the version once its record expires, so it can't go live
+	if err := r.renewLock(token); err != nil {
+		v.drop()
+		return err
+	}
+
+	// the old version is found before swapping, so it can be dropped afterwards. Indexes which predate
+	// the versions are named like the alias, they aren't versions and the alias can't be created next
+	// to them, so they're dropped right before the swap instead.
+	var old *indexVersion
+	var unversioned bool
+	if info, err := r.rs.Info(); err == nil {
+		if info.Name == r.alias {
+			unversioned = true
+		} else {
+			old = r.newIndexVersion(info.Name)
+		}
+	}
+
+	// the suggestions are swapped first, since writes go to the live dictionary as soon as the alias
+	// points to the version. Until then they're written to both, and the ones written to the renamed
+	// dictionary of the version are dropped once the alias is updated.
+	if err := r.swapSuggestions(v); err != nil {
+		v.drop()
+		return err
+	}
+
+	// the documents of the unversioned index are kept, they were written without a prefix
+	if unversioned {
+		if err := r.rs.DropIndex(false); err != nil {
+			v.drop()
+			return fmt.Errorf("failed to drop unversioned index: %w", err)
+		}
+	}
+
+	if err := v.rs.AliasUpdate(r.alias); err != nil {
+		v.drop()
+		return fmt.Errorf("failed to update alias: %w", err)
+	}
+
+	if err := v.ac.Delete(); err != nil {
+		r.logger.Warn("failed to delete suggestions of the new index version", zap.Error(err))
+	}
+
+	if err := r.setLiveSchemaVersion(); err != nil {
+		return err
+	}
+
+	if old != nil && old.name != v.name {
+		old.drop()
+	}
+
+	return nil
+}
+
+// writeVersions returns the index versions which new products must be written to
+func (r *RediSearch) writeVersions() ([]*indexVersion, error) {
+	info, err := r.rs.Info()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get live index: %w", err)
+	}
+
+	// the suggestions of the live version are the ones SuggestProducts reads
+	live := r.newIndexVersion(info.Name)
+	live.ac = r.ac
+	if live.schema, err = r.liveSchemaVersion(); err != nil {
+		return nil, err
+	}
+
+	versions := []*indexVersion{live}
+
+	building, err := r.building()
+	if err != nil {
+		return nil, err
+	}
+	if building != "" && building != info.Name {
+		versions = append(versions, r.newIndexVersion(building))
+	}
+
+	return versions, nil
+}
+
+// buildingKey returns the key of the name of the version which Reindex is populating
+func (r *RediSearch) buildingKey() string {
+	return fmt.Sprintf("%s:building", r.alias)
+}
+
+// setBuilding records the version which Reindex is populating, it expires along with the reindex lock
+func (r *RediSearch) setBuilding(name string) error {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	if _, err := conn.Do("SET", r.buildingKey(), name, "PX", reindexLockTTL.Milliseconds()); err != nil {
+		return fmt.Errorf("failed to record building index version: %w", err)
+	}
+
+	return nil
+}
+
+// clearBuilding removes the record of the version which Reindex was populating
+func (r *RediSearch) clearBuilding() {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	conn.Do("DEL", r.buildingKey())
+}
+
+// building returns the name of the version which a Reindex of any process is populating, empty if there is none
+func (r *RediSearch) building() (string, error) {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	name, err := redis.String(conn.Do("GET", r.buildingKey()))
+	if err == redis.ErrNil {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get building index version: %w", err)
+	}
+
+	return name, nil
+}
+
+// schemaKey returns the key of the schema version of the live index
+func (r *RediSearch) schemaKey() string {
+	return fmt.Sprintf("%s:schema", r.alias)
+}
+
+// setLiveSchemaVersion records that the live index has the current schema
+func (r *RediSearch) setLiveSchemaVersion() error {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	if _, err := conn.Do("SET", r.schemaKey(), schemaVersion); err != nil {
+		return fmt.Errorf("failed to record schema version: %w", err)
+	}
+
+	return nil
+}
+
+// liveSchemaVersion returns the schema version of the live index, zero if it's not recorded
+func (r *RediSearch) liveSchemaVersion() (int, error) {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	version, err := redis.Int(conn.Do("GET", r.schemaKey()))
+	if err == redis.ErrNil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get schema version: %w", err)
+	}
+
+	return version, nil
+}
+
+// swapSuggestions replaces the live suggestions dictionary with the one of given version
+func (r *RediSearch) swapSuggestions(v *indexVersion) error {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	exists, err := redis.Bool(conn.Do("EXISTS", suggestionsKey(v.name)))
+	if err != nil {
+		return fmt.Errorf("failed to check suggestions: %w", err)
+	}
+
+	if !exists {
+		// there were no products to suggest
+		_, err = conn.Do("DEL", suggestionsKey(r.alias))
+	} else {
+		_, err = conn.Do("RENAME", suggestionsKey(v.name), suggestionsKey(r.alias))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to swap suggestions: %w", err)
+	}
+
+	return nil
+}
+
+// lockKey returns the key of the reindex lock
+func (r *RediSearch) lockKey() string {
+	return fmt.Sprintf("%s:reindex-lock", r.alias)
+}
+
+// renewLock extends the reindex lock owned by the token along with the building version record,
+// ErrReindexLockLost is returned if the lock expired meanwhile
+func (r *RediSearch) renewLock(token string) error {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	ok, err := redis.Bool(renewLockScript.Do(conn, r.lockKey(), r.buildingKey(), token, reindexLockTTL.Milliseconds()))
+	if err != nil {
+		return fmt.Errorf("failed to renew reindex lock: %w", err)
+	}
+	if !ok {
+		return ErrReindexLockLost
+	}
+
+	return nil
+}
+
+// keepLock renews the reindex lock owned by the token every reindexLockRenewal until the returned function is called
+func (r *RediSearch) keepLock(token string) func() {
+	done := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(reindexLockRenewal)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				// a lost lock is noticed by Reindex before the swap
+				if err := r.renewLock(token); err != nil {
+					r.logger.Warn("failed to renew reindex lock", zap.Error(err))
+				}
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// lock acquires the reindex lock with given token and returns the function which releases it
+func (r *RediSearch) lock(token string) (func(), error) {
+	key := r.lockKey()
+
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	_, err := redis.String(conn.Do("SET", key, token, "NX", "PX", reindexLockTTL.Milliseconds()))
+	if err == redis.ErrNil {
+		return nil, ErrReindexRunning
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire reindex lock: %w", err)
+	}
+
+	return func() {
+		conn := r.pool.Get()
+		defer conn.Close()
+		releaseLockScript.Do(conn, key, token)
+	}, nil
+}
+
+// drop deletes the index version along with its documents and suggestions
+func (v *indexVersion) drop() {
+	v.rs.DropIndex(true)
+	v.ac.Delete()
+}
+
+// schema returns the schema of the products index
+func schema() *redisearch.Schema {
+	return redisearch.NewSchema(redisearch.DefaultOptions).
+		AddField(redisearch.NewNumericFieldOptions("id", redisearch.NumericFieldOptions{Sortable: true})).
+		AddField(redisearch.NewTextFieldOptions("name", redisearch.TextFieldOptions{Sortable: true, NoIndex: false})).
+		AddField(redisearch.NewNumericFieldOptions("price", redisearch.NumericFieldOptions{Sortable: true})).
+		AddField(redisearch.NewNumericField("stock")).
+		AddField(redisearch.NewTagField("inStock")).
+		AddField(redisearch.NewTagField("categories")).
+		AddField(redisearch.NewTagField("nameKey")).
+		AddField(redisearch.NewTextFieldOptions("nameSort", redisearch.TextFieldOptions{Sortable: true, NoIndex: true})).
+		AddField(redisearch.NewTextFieldOptions("priceSort", redisearch.TextFieldOptions{Sortable: true, NoIndex: true}))
+}
+
+// nameKey returns the tag of the exact name of a product, names are hashed so they
+// don't need escaping and always make a single tag
+func nameKey(name string) string {
+	sum := sha1.Sum([]byte(name))
+	return hex.EncodeToString(sum[:])
+}
+
+// nameSortKey returns the key which products are sorted by name with, RediSearch only sorts by a
+// single field, so the ID is appended to keep the order of products with the same name
+func nameSortKey(product *models.Product) string {
+	return fmt.Sprintf("%s\x01%020d", strings.ToLower(product.Name), product.ID)
+}
+
+// priceSortKey returns the key which products are sorted by price with, like nameSortKey the ID is
+// appended, prices are never negative so the padded numbers sort the same as text
+func priceSortKey(product *models.Product) string {
+	return fmt.Sprintf("%020d\x01%020d", product.Price, product.ID)
+}
+
+// categoryTags returns the slugs of the categories of the product along with all their ancestors,
+// so filtering by a category also matches the products of its descendants
+func categoryTags(product *models.Product) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, c := range product.Categories {
+		for _, slug := range strings.Split(c.Path, models.CategoryPathSeparator) {
+			if slug != "" && !seen[slug] {
+				seen[slug] = true
+				tags = append(tags, slug)
+			}
+		}
+	}
+
+	return tags
+}
+
+// suggestionsKey returns the key of the suggestions dictionary of an index
+func suggestionsKey(index string) string {
+	return fmt.Sprintf("%s:suggestions", index)
+}
@@ -0,0 +1,159 @@
+// Package query builds RediSearch query strings out of user input, it escapes
+// every given value so user input can't change the meaning of the query
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Clause is a rendered part of a RediSearch query, an empty clause matches everything
+type Clause string
+
+// Tokenize splits the text into tokens the same way RediSearch tokenizes indexed
+// text, so all the punctuations and spaces are treated as separators
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !isTokenRune(r)
+	})
+}
+
+// Escape escapes all the characters RediSearch treats as separators or syntax
+func Escape(value string) string {
+	var b strings.Builder
+	for _, r := range value {
+		if !isTokenRune(r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// Terms matches documents having all the words of text in field,
+// if field is empty, all the text fields are searched
+func Terms(field, text string) Clause {
+	return words(field, text, "%s")
+}
+
+// Prefix matches documents having words in field which start with the words of text
+func Prefix(field, text string) Clause {
+	return words(field, text, "%s*")
+}
+
+// Fuzzy matches documents having words in field within one Levenshtein distance of the words of text
+func Fuzzy(field, text string) Clause {
+	return words(field, text, "%%%s%%")
+}
+
+// NumericRange matches documents which have the field value in the inclusive range,
+// nil bounds are treated as infinity
+func NumericRange(field string, min, max *int) Clause {
+	from, to := "-inf", "+inf"
+	if min != nil {
+		from = strconv.Itoa(*min)
+	}
+	if max != nil {
+		to = strconv.Itoa(*max)
+	}
+
+	return Clause(fmt.Sprintf("@%s:[%s %s]", field, from, to))
+}
+
+// Tag matches documents having at least one of the values in the tag field
+func Tag(field string, values ...string) Clause {
+	escaped := make([]string, 0, len(values))
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		escaped = append(escaped, Escape(v))
+	}
+
+	if len(escaped) == 0 {
+		return ""
+	}
+
+	return Clause(fmt.Sprintf("@%s:{%s}", field, strings.Join(escaped, " | ")))
+}
+
+// Not matches documents which don't match the clause
+func Not(c Clause) Clause {
+	if c == "" {
+		return ""
+	}
+
+	return Clause(fmt.Sprintf("-(%s)", c))
+}
+
+// And matches documents which match all the clauses
+func And(clauses ...Clause) Clause {
+	return join(clauses, " ")
+}
+
+// Or matches documents which match at least one of the clauses
+func Or(clauses ...Clause) Clause {
+	return join(clauses, " | ")
+}
+
+// Build renders the intersection of all the clauses as a RediSearch query
+func Build(clauses ...Clause) string {
+	var parts []string
+	for _, c := range clauses {
+		if c != "" {
+			parts = append(parts, string(c))
+		}
+	}
+
+	if len(parts) == 0 {
+		return "*"
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// words formats every token of the text with given format and groups them on the field
+func words(field, text, format string) Clause {
+	tokens := Tokenize(text)
+	if len(tokens) == 0 {
+		return ""
+	}
+
+	for i, t := range tokens {
+		tokens[i] = fmt.Sprintf(format, Escape(t))
+	}
+
+	group := fmt.Sprintf("(%s)", strings.Join(tokens, " "))
+	if field == "" {
+		return Clause(group)
+	}
+
+	return Clause(fmt.Sprintf("@%s:%s", field, group))
+}
+
+// join groups the non empty clauses with given separator
+func join(clauses []Clause, sep string) Clause {
+	var parts []string
+	for _, c := range clauses {
+		if c != "" {
+			parts = append(parts, string(c))
+		}
+	}
+
+	switch len(parts) {
+	case 0:
+		return ""
+	case 1:
+		return Clause(parts[0])
+	default:
+		return Clause(fmt.Sprintf("(%s)", strings.Join(parts, sep)))
+	}
+}
+
+// isTokenRune reports whether the rune is a part of a token and not a separator
+func isTokenRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
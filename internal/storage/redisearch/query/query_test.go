@@ -0,0 +1,181 @@
+package query
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	cases := []struct {
+		text   string
+		tokens []string
+	}{
+		{text: "", tokens: []string{}},
+		{text: "   ", tokens: []string{}},
+		{text: "tomato", tokens: []string{"tomato"}},
+		{text: "red  apple", tokens: []string{"red", "apple"}},
+		{text: "t-shirt", tokens: []string{"t", "shirt"}},
+		{text: "milk|bread", tokens: []string{"milk", "bread"}},
+		{text: "@price:[0 10]", tokens: []string{"price", "0", "10"}},
+		{text: "-(meat)", tokens: []string{"meat"}},
+		{text: `"eggs" 'rice'`, tokens: []string{"eggs", "rice"}},
+		{text: "snake_case", tokens: []string{"snake_case"}},
+		{text: "café crème", tokens: []string{"café", "crème"}},
+		{text: "*%$~", tokens: []string{}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.text, func(t *testing.T) {
+			tokens := Tokenize(tc.text)
+			if len(tc.tokens) == 0 {
+				assert.Empty(t, tokens)
+				return
+			}
+			assert.Equal(t, tc.tokens, tokens)
+		})
+	}
+}
+
+func TestEscape(t *testing.T) {
+	cases := []struct {
+		value   string
+		escaped string
+	}{
+		{value: "", escaped: ""},
+		{value: "tomato", escaped: "tomato"},
+		{value: "red apple", escaped: `red\ apple`},
+		{value: "t-shirt", escaped: `t\-shirt`},
+		{value: "a|b", escaped: `a\|b`},
+		{value: "@name", escaped: `\@name`},
+		{value: "(x)", escaped: `\(x\)`},
+		{value: `"quoted"`, escaped: `\"quoted\"`},
+		{value: "{tag}", escaped: `\{tag\}`},
+		{value: `back\slash`, escaped: `back\\slash`},
+		{value: "50%", escaped: `50\%`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.value, func(t *testing.T) {
+			assert.Equal(t, tc.escaped, Escape(tc.value))
+		})
+	}
+}
+
+func TestTextClauses(t *testing.T) {
+	cases := []struct {
+		name   string
+		clause Clause
+		query  string
+	}{
+		{name: "terms", clause: Terms("name", "red apple"), query: "@name:(red apple)"},
+		{name: "terms on all fields", clause: Terms("", "red apple"), query: "(red apple)"},
+		{name: "prefix", clause: Prefix("name", "tom"), query: "@name:(tom*)"},
+		{name: "prefix of multiple words", clause: Prefix("name", "red app"), query: "@name:(red* app*)"},
+		{name: "fuzzy", clause: Fuzzy("name", "tomatto"), query: "@name:(%tomatto%)"},
+		{name: "empty text", clause: Prefix("name", ""), query: ""},
+		{name: "only syntax", clause: Prefix("name", "-|@()"), query: ""},
+		{name: "field injection", clause: Prefix("name", "x @price:[0 0]"), query: "@name:(x* price* 0* 0*)"},
+		{name: "negation injection", clause: Prefix("name", "-meat"), query: "@name:(meat*)"},
+		{name: "union injection", clause: Terms("name", "milk | bread"), query: "@name:(milk bread)"},
+		{name: "quote injection", clause: Terms("name", `"eggs`), query: "@name:(eggs)"},
+		{name: "closing paren injection", clause: Prefix("name", "a) | (b"), query: "@name:(a* b*)"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, Clause(tc.query), tc.clause)
+		})
+	}
+}
+
+func TestNumericRange(t *testing.T) {
+	min, max := 5, 10
+	negative := -3
+
+	cases := []struct {
+		name  string
+		min   *int
+		max   *int
+		query string
+	}{
+		{name: "no bounds", query: "@price:[-inf +inf]"},
+		{name: "min only", min: &min, query: "@price:[5 +inf]"},
+		{name: "max only", max: &max, query: "@price:[-inf 10]"},
+		{name: "both bounds", min: &min, max: &max, query: "@price:[5 10]"},
+		{name: "negative bound", min: &negative, query: "@price:[-3 +inf]"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, Clause(tc.query), NumericRange("price", tc.min, tc.max))
+		})
+	}
+}
+
+func TestTag(t *testing.T) {
+	cases := []struct {
+		name   string
+		values []string
+		query  string
+	}{
+		{name: "no values", query: ""},
+		{name: "empty values", values: []string{"", ""}, query: ""},
+		{name: "single value", values: []string{"fruits"}, query: "@category:{fruits}"},
+		{name: "multiple values", values: []string{"fruits", "dairy"}, query: "@category:{fruits | dairy}"},
+		{name: "value with separators", values: []string{"food/fresh fruits"}, query: `@category:{food\/fresh\ fruits}`},
+		{name: "closing brace injection", values: []string{"a} | @price:[0 0] | {b"}, query: `@category:{a\}\ \|\ \@price\:\[0\ 0\]\ \|\ \{b}`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, Clause(tc.query), Tag("category", tc.values...))
+		})
+	}
+}
+
+func TestCombinators(t *testing.T) {
+	cases := []struct {
+		name   string
+		clause Clause
+		query  string
+	}{
+		{name: "not", clause: Not(Terms("name", "meat")), query: "-(@name:(meat))"},
+		{name: "not empty", clause: Not(""), query: ""},
+		{name: "and", clause: And(Terms("name", "milk"), NumericRange("price", nil, nil)), query: "(@name:(milk) @price:[-inf +inf])"},
+		{name: "and single", clause: And(Terms("name", "milk"), ""), query: "@name:(milk)"},
+		{name: "and empty", clause: And(), query: ""},
+		{name: "or", clause: Or(Terms("name", "milk"), Terms("name", "bread")), query: "(@name:(milk) | @name:(bread))"},
+		{name: "nested", clause: Or(And(Terms("name", "a"), Not(Terms("name", "b"))), Terms("name", "c")), query: "((@name:(a) -(@name:(b))) | @name:(c))"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, Clause(tc.query), tc.clause)
+		})
+	}
+}
+
+func TestBuild(t *testing.T) {
+	min := 5
+
+	cases := []struct {
+		name    string
+		clauses []Clause
+		query   string
+	}{
+		{name: "no clauses", query: "*"},
+		{name: "only empty clauses", clauses: []Clause{"", Prefix("name", "--")}, query: "*"},
+		{name: "single clause", clauses: []Clause{Prefix("name", "tom")}, query: "@name:(tom*)"},
+		{
+			name:    "multiple clauses",
+			clauses: []Clause{Prefix("name", "tom"), NumericRange("price", &min, nil), Not(Tag("category", "meat"))},
+			query:   "@name:(tom*) @price:[5 +inf] -(@category:{meat})",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.query, Build(tc.clauses...))
+		})
+	}
+}
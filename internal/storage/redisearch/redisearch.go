@@ -3,96 +3,343 @@ package redisearch
 import (
 	"fmt"
 	"github.com/RediSearch/redisearch-go/redisearch"
+	"github.com/gomodule/redigo/redis"
 	"github.com/moeen/redisearch-shopping/internal/storage"
+	"github.com/moeen/redisearch-shopping/internal/storage/redisearch/query"
 	"github.com/moeen/redisearch-shopping/pkg/models"
+	"go.uber.org/zap"
 	"gorm.io/gorm"
 	"strconv"
+	"strings"
 )
 
 // RediSearch is the RediSearch implementation of storage.Searcher
+//
+// Products are indexed in versioned indexes and searched through an alias which
+// points to the live version, see Reindex
 type RediSearch struct {
+	pool    *redis.Pool
+	alias   string
 	rs      *redisearch.Client
+	ac      *redisearch.Autocompleter
 	storage storage.Storage
+	logger  *zap.Logger
 }
 
-// NewRediSearch will create a new RediSearch with given required params
-func NewRediSearch(address, index string, s storage.Storage) *RediSearch {
-	c := redisearch.NewClient(address, index)
-	return &RediSearch{rs: c, storage: s}
+// NewRediSearch will create a new RediSearch with given required params, index
+// is the name of the alias which always points to the live version of the index
+func NewRediSearch(address, index string, s storage.Storage, logger *zap.Logger) *RediSearch {
+	pool := &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", address)
+		},
+		MaxIdle: maxIdleConns,
+	}
+
+	return &RediSearch{
+		pool:    pool,
+		alias:   index,
+		rs:      redisearch.NewClientFromPool(pool, index),
+		ac:      redisearch.NewAutocompleterFromPool(pool, suggestionsKey(index)),
+		storage: s,
+		logger:  logger,
+	}
 }
 
-// Init will create the schema and adds all products to RediSearch
-func (r *RediSearch) Init() error {
-	sc := redisearch.NewSchema(redisearch.DefaultOptions).
-		AddField(redisearch.NewNumericFieldOptions("id", redisearch.NumericFieldOptions{Sortable: true})).
-		AddField(redisearch.NewTextFieldOptions("name", redisearch.TextFieldOptions{Sortable: true, NoIndex: false})).
-		AddField(redisearch.NewNumericField("price"))
+func (r *RediSearch) SearchProducts(opts storage.SearchOptions) ([]*models.Product, int, error) {
+	raw := buildQuery(opts)
+
+	q := redisearch.NewQuery(raw).SetReturnFields("id", "name", "price", "stock")
+	sortBy, err := r.sortField(opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	if sortBy != "" {
+		q = q.SetSortBy(sortBy, !opts.Descending)
+	}
 
-	r.rs.Drop()
+	limit := opts.Limit
+	if limit == 0 {
+		// RediSearch always pages the result, so the total is needed to return everything
+		_, total, err := r.rs.Search(redisearch.NewQuery(raw).Limit(0, 0))
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to count: %w", err)
+		}
+		limit = total
+	}
+	q = q.Limit(opts.Offset, limit)
+
+	docs, total, err := r.rs.Search(q)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search: %w", err)
+	}
 
-	if err := r.rs.CreateIndex(sc); err != nil {
-		return fmt.Errorf("failed to create index: %w", err)
+	res := make([]*models.Product, len(docs))
+	for i, d := range docs {
+		p, err := docToProduct(d)
+		if err != nil {
+			return nil, 0, err
+		}
+		res[i] = p
 	}
 
-	products, err := r.storage.SearchProducts(nil)
+	return res, total, nil
+}
+
+func (r *RediSearch) AddProduct(product *models.Product) error {
+	versions, err := r.writeVersions()
 	if err != nil {
-		return fmt.Errorf("failed to get products from storage: %s", err)
+		return err
 	}
 
-	for _, p := range products {
-		if err := r.AddProduct(p); err != nil {
-			return fmt.Errorf("failed to add product to searcher: %w", err)
+	for _, v := range versions {
+		if err := v.add(product); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
-func (r *RediSearch) SearchProducts(name *string) ([]*models.Product, error) {
-	docs, total, err := r.rs.Search(redisearch.NewQuery(fmt.Sprintf("@name:%s*", *name)).
-		SetReturnFields("id", "name", "price"))
+func (r *RediSearch) GetProduct(id int) (*models.Product, error) {
+	info, err := r.rs.Info()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get live index: %w", err)
+	}
 
+	p, err := r.newIndexVersion(info.Name).get(id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to search: %w", err)
+		return nil, err
 	}
+	if p == nil {
+		return nil, fmt.Errorf("product %d is not indexed", id)
+	}
+
+	return p, nil
+}
 
-	if total == 0 {
-		return []*models.Product{}, nil
+func (r *RediSearch) UpdateProduct(product *models.Product) error {
+	versions, err := r.writeVersions()
+	if err != nil {
+		return err
 	}
 
-	res := make([]*models.Product, total)
-	for i, p := range docs {
-		id, err := strconv.Atoi(p.Properties["id"].(string))
+	for _, v := range versions {
+		if err := v.update(product); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *RediSearch) DeleteProduct(id int) error {
+	versions, err := r.writeVersions()
+	if err != nil {
+		return err
+	}
+
+	for _, v := range versions {
+		if err := v.remove(id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *RediSearch) SuggestProducts(prefix string, limit int, fuzzy bool) ([]*storage.Suggestion, error) {
+	suggestions, err := r.ac.SuggestOpts(prefix, redisearch.SuggestOptions{
+		Num:          limit,
+		Fuzzy:        fuzzy,
+		WithPayloads: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get suggestions: %w", err)
+	}
+
+	res := make([]*storage.Suggestion, len(suggestions))
+	for i, s := range suggestions {
+		id, err := strconv.Atoi(s.Payload)
 		if err != nil {
-			return nil, fmt.Errorf("failed to convert id to str")
+			return nil, fmt.Errorf("invalid suggestion payload: %s", s.Payload)
 		}
 
-		price, err := strconv.Atoi(p.Properties["price"].(string))
+		res[i] = &storage.Suggestion{
+			Term:      s.Term,
+			ProductID: id,
+		}
+	}
+
+	return res, nil
+}
+
+func (r *RediSearch) PriceFacets(opts storage.SearchOptions, boundaries []int) ([]*storage.PriceFacet, error) {
+	// every boundary which the price reaches adds one to the bucket index
+	bucket := make([]string, len(boundaries))
+	for i, b := range boundaries {
+		bucket[i] = fmt.Sprintf("(@price >= %d)", b)
+	}
+
+	expr := "0"
+	if len(bucket) > 0 {
+		expr = strings.Join(bucket, " + ")
+	}
+
+	q := redisearch.NewAggregateQuery().
+		SetQuery(redisearch.NewQuery(buildQuery(opts))).
+		Apply(*redisearch.NewProjection(expr, "bucket")).
+		GroupBy(*redisearch.NewGroupBy().
+			AddFields("@bucket").
+			Reduce(*redisearch.NewReducerAlias(redisearch.GroupByReducerCount, []string{}, "count")))
+
+	rows, _, err := r.rs.Aggregate(q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate: %w", err)
+	}
+
+	facets := make([]*storage.PriceFacet, len(boundaries)+1)
+	for i := range facets {
+		facets[i] = &storage.PriceFacet{}
+		if i > 0 {
+			facets[i].Min = &boundaries[i-1]
+		}
+		if i < len(boundaries) {
+			facets[i].Max = &boundaries[i]
+		}
+	}
+
+	for _, row := range rows {
+		values := make(map[string]string, len(row)/2)
+		for i := 0; i+1 < len(row); i += 2 {
+			values[row[i]] = row[i+1]
+		}
+
+		b, err := strconv.ParseFloat(values["bucket"], 64)
+		if err != nil || int(b) < 0 || int(b) >= len(facets) {
+			return nil, fmt.Errorf("invalid facet bucket: %s", values["bucket"])
+		}
+
+		count, err := strconv.Atoi(values["count"])
 		if err != nil {
-			return nil, fmt.Errorf("failed to convert price to str")
+			return nil, fmt.Errorf("invalid facet count: %s", values["count"])
 		}
 
-		res[i] = &models.Product{
-			Model: gorm.Model{
-				ID: uint(id),
-			},
-			Name:  p.Properties["name"].(string),
-			Price: price,
+		facets[int(b)].Count = count
+	}
+
+	return facets, nil
+}
+
+func (r *RediSearch) SpellCheck(text string, limit int) ([]string, error) {
+	words := query.Tokenize(text)
+	if len(words) == 0 {
+		return nil, nil
+	}
+
+	q := redisearch.NewQuery(query.Build(query.Terms("", text)))
+	terms, _, err := r.rs.SpellCheck(q, redisearch.NewSpellCheckOptionsDefaults())
+	if err != nil {
+		return nil, fmt.Errorf("failed to spell check: %w", err)
+	}
+
+	var res []string
+	for _, t := range terms {
+		t.Sort()
+		for _, s := range t.MisspelledSuggestionList {
+			if len(res) == limit {
+				return res, nil
+			}
+
+			corrected := make([]string, len(words))
+			for i, w := range words {
+				if strings.EqualFold(w, t.Term) {
+					w = s.Suggestion
+				}
+				corrected[i] = w
+			}
+			res = append(res, strings.Join(corrected, " "))
 		}
 	}
 
 	return res, nil
 }
 
-func (r *RediSearch) AddProduct(product *models.Product) error {
-	doc := redisearch.NewDocument(fmt.Sprintf("product:%d", product.ID), 1.0)
-	doc.Set("id", product.ID).
-		Set("name", product.Name).
-		Set("price", product.Price)
+// docToProduct converts an indexed document to a product
+func docToProduct(d redisearch.Document) (*models.Product, error) {
+	id, err := strconv.Atoi(fmt.Sprint(d.Properties["id"]))
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert id to str")
+	}
 
-	if err := r.rs.Index(doc); err != nil {
-		return fmt.Errorf("failed to create doc: %w", err)
+	price, err := strconv.Atoi(fmt.Sprint(d.Properties["price"]))
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert price to str")
 	}
 
-	return nil
+	// documents indexed before stock was tracked don't have it
+	var stock int
+	if v, ok := d.Properties["stock"]; ok {
+		if stock, err = strconv.Atoi(fmt.Sprint(v)); err != nil {
+			return nil, fmt.Errorf("failed to convert stock to str")
+		}
+	}
+
+	return &models.Product{
+		Model: gorm.Model{
+			ID: uint(id),
+		},
+		Name:  fmt.Sprint(d.Properties["name"]),
+		Price: price,
+		Stock: stock,
+	}, nil
+}
+
+// sortField returns the field which the result of given options is sorted by, empty for relevance.
+// Products matching everything have the same relevance, so they're sorted by their ID instead.
+func (r *RediSearch) sortField(opts storage.SearchOptions) (string, error) {
+	switch opts.SortBy {
+	case storage.SortByPrice, storage.SortByName:
+		version, err := r.liveSchemaVersion()
+		if err != nil {
+			return "", err
+		}
+
+		// an index of an older schema keeps serving searches while the new one is built
+		if version < sortKeySchema {
+			return string(opts.SortBy), nil
+		}
+		return string(opts.SortBy) + "Sort", nil
+	default:
+		if opts.Name == nil {
+			return "id", nil
+		}
+		return "", nil
+	}
+}
+
+// buildQuery creates the raw RediSearch query of given options
+func buildQuery(opts storage.SearchOptions) string {
+	var clauses []query.Clause
+	if opts.Name != nil {
+		if opts.Fuzzy {
+			clauses = append(clauses, query.Fuzzy("name", *opts.Name))
+		} else {
+			clauses = append(clauses, query.Prefix("name", *opts.Name))
+		}
+	}
+
+	for _, f := range opts.Filters {
+		clauses = append(clauses, query.NumericRange(string(f.Field), f.Min, f.Max))
+	}
+
+	if opts.InStock != nil {
+		clauses = append(clauses, query.Tag("inStock", strconv.FormatBool(*opts.InStock)))
+	}
+
+	if opts.Category != nil {
+		clauses = append(clauses, query.Tag("categories", *opts.Category))
+	}
+
+	return query.Build(clauses...)
 }
@@ -0,0 +1,375 @@
+package redisearch
+
+import (
+	"fmt"
+	"github.com/RediSearch/redisearch-go/redisearch"
+	"github.com/golang/mock/gomock"
+	"github.com/gomodule/redigo/redis"
+	"github.com/moeen/redisearch-shopping/internal/storage"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"os"
+	"testing"
+	"time"
+)
+
+// newTestRediSearch creates a RediSearch on the server of REDISEARCH_TEST_ADDR with an alias of its own,
+// which is dropped with all its keys when the test finishes. Tests are skipped without a server.
+func newTestRediSearch(t *testing.T, st storage.Storage) *RediSearch {
+	addr := os.Getenv("REDISEARCH_TEST_ADDR")
+	if addr == "" {
+		t.Skip("REDISEARCH_TEST_ADDR is not set")
+	}
+
+	r := NewRediSearch(addr, fmt.Sprintf("test_%d", time.Now().UnixNano()), st, zap.NewNop())
+	t.Cleanup(func() {
+		if info, err := r.rs.Info(); err == nil {
+			r.newIndexVersion(info.Name).drop()
+		}
+
+		conn := r.pool.Get()
+		defer conn.Close()
+
+		conn.Do("FT.ALIASDEL", r.alias)
+		keys, _ := redis.Strings(conn.Do("KEYS", r.alias+":*"))
+		for _, k := range keys {
+			conn.Do("DEL", k)
+		}
+	})
+
+	return r
+}
+
+// suggestionTerms returns the suggested product names of the prefix
+func suggestionTerms(t *testing.T, r *RediSearch, prefix string) []string {
+	suggestions, err := r.SuggestProducts(prefix, 10, false)
+	require.NoError(t, err)
+
+	terms := make([]string, len(suggestions))
+	for i, s := range suggestions {
+		terms[i] = s.Term
+	}
+	return terms
+}
+
+func TestRediSearch_InitUpgradesSchema(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	st := storage.NewMockStorage(c)
+	r := newTestRediSearch(t, st)
+
+	milk := &models.Product{Model: gorm.Model{ID: 1}, Name: "Milk", Price: 3}
+	st.EXPECT().SearchProducts(storage.SearchOptions{}).AnyTimes().Return([]*models.Product{milk}, 1, nil)
+
+	liveIndex := func(t *testing.T) string {
+		info, err := r.rs.Info()
+		require.NoError(t, err)
+		return info.Name
+	}
+
+	require.NoError(t, r.Init())
+	first := liveIndex(t)
+
+	version, err := r.liveSchemaVersion()
+	require.NoError(t, err)
+	assert.Equal(t, schemaVersion, version)
+
+	t.Run("test current schema is kept", func(t *testing.T) {
+		require.NoError(t, r.Init())
+		assert.Equal(t, first, liveIndex(t))
+	})
+
+	t.Run("test older schema is rebuilt", func(t *testing.T) {
+		conn := r.pool.Get()
+		_, err := conn.Do("DEL", r.schemaKey())
+		conn.Close()
+		require.NoError(t, err)
+
+		// the new version is built in the background
+		require.NoError(t, r.Init())
+		assert.Eventually(t, func() bool {
+			version, err := r.liveSchemaVersion()
+			return err == nil && version == schemaVersion
+		}, 10*time.Second, 50*time.Millisecond)
+		assert.NotEqual(t, first, liveIndex(t))
+
+		products, total, err := r.SearchProducts(storage.SearchOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, 1, total)
+		assert.Equal(t, milk.ID, products[0].ID)
+	})
+}
+
+func TestRediSearch_InitUpgradesUnversionedIndex(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	st := storage.NewMockStorage(c)
+	r := newTestRediSearch(t, st)
+
+	milk := &models.Product{Model: gorm.Model{ID: 1}, Name: "Milk", Price: 3}
+	st.EXPECT().SearchProducts(storage.SearchOptions{}).AnyTimes().Return([]*models.Product{milk}, 1, nil)
+
+	// indexes which predate the versions were created with the name of the alias
+	legacy := redisearch.NewClientFromPool(r.pool, r.alias)
+	require.NoError(t, legacy.CreateIndex(redisearch.NewSchema(redisearch.DefaultOptions).
+		AddField(redisearch.NewNumericFieldOptions("id", redisearch.NumericFieldOptions{Sortable: true})).
+		AddField(redisearch.NewTextFieldOptions("name", redisearch.TextFieldOptions{Sortable: true})).
+		AddField(redisearch.NewNumericFieldOptions("price", redisearch.NumericFieldOptions{Sortable: true}))))
+
+	legacyDoc := r.alias + ":product:1"
+	conn := r.pool.Get()
+	_, err := conn.Do("HSET", legacyDoc, "id", 1, "name", "Milk", "price", 3)
+	conn.Close()
+	require.NoError(t, err)
+
+	require.NoError(t, r.Init())
+	assert.Eventually(t, func() bool {
+		version, err := r.liveSchemaVersion()
+		return err == nil && version == schemaVersion
+	}, 10*time.Second, 50*time.Millisecond)
+
+	info, err := r.rs.Info()
+	require.NoError(t, err)
+	assert.NotEqual(t, r.alias, info.Name)
+
+	products, total, err := r.SearchProducts(storage.SearchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, milk.ID, products[0].ID)
+
+	// the documents of the unversioned index are kept
+	conn = r.pool.Get()
+	exists, err := redis.Bool(conn.Do("EXISTS", legacyDoc))
+	conn.Close()
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestRediSearch_InitWaitsForReindex(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	st := storage.NewMockStorage(c)
+	r := newTestRediSearch(t, st)
+
+	st.EXPECT().SearchProducts(storage.SearchOptions{}).AnyTimes().Return(nil, 0, nil)
+
+	// another process holds the lock and gives up without building the index
+	conn := r.pool.Get()
+	_, err := conn.Do("SET", r.lockKey(), "other", "PX", 2*initPollInterval.Milliseconds())
+	conn.Close()
+	require.NoError(t, err)
+
+	require.NoError(t, r.Init())
+
+	_, err = r.rs.Info()
+	assert.NoError(t, err)
+}
+
+func TestRediSearch_ReindexLosingLock(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	st := storage.NewMockStorage(c)
+	r := newTestRediSearch(t, st)
+
+	st.EXPECT().SearchProducts(storage.SearchOptions{}).Times(1).Return(nil, 0, nil)
+	require.NoError(t, r.Init())
+
+	info, err := r.rs.Info()
+	require.NoError(t, err)
+
+	// the lock expires while the products are indexed
+	st.EXPECT().SearchProducts(storage.SearchOptions{}).Times(1).DoAndReturn(func(storage.SearchOptions) ([]*models.Product, int, error) {
+		conn := r.pool.Get()
+		defer conn.Close()
+
+		_, err := conn.Do("DEL", r.lockKey())
+		return nil, 0, err
+	})
+
+	assert.Equal(t, ErrReindexLockLost, r.Reindex())
+
+	live, err := r.rs.Info()
+	require.NoError(t, err)
+	assert.Equal(t, info.Name, live.Name)
+}
+
+func TestRediSearch_SuggestionsAfterReindex(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	st := storage.NewMockStorage(c)
+	r := newTestRediSearch(t, st)
+
+	milk := &models.Product{Model: gorm.Model{ID: 1}, Name: "Milk", Price: 3}
+	st.EXPECT().SearchProducts(storage.SearchOptions{}).AnyTimes().Return([]*models.Product{milk}, 1, nil)
+
+	require.NoError(t, r.Init())
+	require.NoError(t, r.Reindex())
+	assert.Equal(t, []string{"Milk"}, suggestionTerms(t, r, "mil"))
+
+	t.Run("test the dictionary of the new version is moved to the alias", func(t *testing.T) {
+		info, err := r.rs.Info()
+		require.NoError(t, err)
+
+		conn := r.pool.Get()
+		defer conn.Close()
+
+		exists, err := redis.Bool(conn.Do("EXISTS", suggestionsKey(info.Name)))
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("test added products are suggested", func(t *testing.T) {
+		require.NoError(t, r.AddProduct(&models.Product{Model: gorm.Model{ID: 2}, Name: "Bread", Price: 4}))
+		assert.Equal(t, []string{"Bread"}, suggestionTerms(t, r, "bre"))
+	})
+
+	t.Run("test renamed products are suggested by their new name", func(t *testing.T) {
+		require.NoError(t, r.UpdateProduct(&models.Product{Model: gorm.Model{ID: 1}, Name: "Oat Milk", Price: 3}))
+		assert.Empty(t, suggestionTerms(t, r, "mil"))
+		assert.Equal(t, []string{"Oat Milk"}, suggestionTerms(t, r, "oat"))
+	})
+
+	t.Run("test deleted products are not suggested", func(t *testing.T) {
+		require.NoError(t, r.DeleteProduct(2))
+		assert.Empty(t, suggestionTerms(t, r, "bre"))
+	})
+}
+
+func TestRediSearch_SharedSuggestions(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	st := storage.NewMockStorage(c)
+	r := newTestRediSearch(t, st)
+
+	milk := &models.Product{Model: gorm.Model{ID: 1}, Name: "Milk", Price: 3}
+	st.EXPECT().SearchProducts(storage.SearchOptions{}).AnyTimes().Return([]*models.Product{milk}, 1, nil)
+	require.NoError(t, r.Init())
+
+	suggested := func(t *testing.T) []int {
+		suggestions, err := r.SuggestProducts("mil", 10, false)
+		require.NoError(t, err)
+
+		ids := make([]int, len(suggestions))
+		for i, s := range suggestions {
+			ids[i] = s.ProductID
+		}
+		return ids
+	}
+
+	require.NoError(t, r.AddProduct(&models.Product{Model: gorm.Model{ID: 2}, Name: "Milk", Price: 2}))
+	require.NoError(t, r.AddProduct(&models.Product{Model: gorm.Model{ID: 3}, Name: "Milk", Price: 1}))
+
+	t.Run("test a shared name suggests the first product", func(t *testing.T) {
+		assert.Equal(t, []int{1}, suggested(t))
+	})
+
+	t.Run("test renaming one of the products keeps the suggestion", func(t *testing.T) {
+		require.NoError(t, r.UpdateProduct(&models.Product{Model: gorm.Model{ID: 1}, Name: "Oat Milk", Price: 3}))
+		assert.Equal(t, []int{2}, suggested(t))
+	})
+
+	t.Run("test deleting one of the products keeps the suggestion", func(t *testing.T) {
+		require.NoError(t, r.DeleteProduct(2))
+		assert.Equal(t, []int{3}, suggested(t))
+	})
+
+	t.Run("test deleting the last product deletes the suggestion", func(t *testing.T) {
+		require.NoError(t, r.DeleteProduct(3))
+		assert.Empty(t, suggested(t))
+	})
+}
+
+func TestRediSearch_WritesDuringReindex(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	st := storage.NewMockStorage(c)
+	st.EXPECT().SearchProducts(storage.SearchOptions{}).AnyTimes().Return([]*models.Product{}, 0, nil)
+
+	serve := newTestRediSearch(t, st)
+	require.NoError(t, serve.Init())
+
+	// another process, like the reindex command, is populating a new version
+	reindex := NewRediSearch(os.Getenv("REDISEARCH_TEST_ADDR"), serve.alias, st, zap.NewNop())
+	v := reindex.newIndexVersion(serve.alias + "_building")
+	def := redisearch.NewIndexDefinition().AddPrefix(v.name + ":")
+	require.NoError(t, v.rs.CreateIndexWithIndexDefinition(schema(), def))
+	defer v.drop()
+	require.NoError(t, reindex.setBuilding(v.name))
+
+	bread := &models.Product{Model: gorm.Model{ID: 1}, Name: "Bread", Price: 4}
+	require.NoError(t, serve.AddProduct(bread))
+
+	p, err := v.get(1)
+	require.NoError(t, err)
+	require.NotNil(t, p)
+	assert.Equal(t, "Bread", p.Name)
+
+	reindex.clearBuilding()
+	require.NoError(t, serve.DeleteProduct(1))
+
+	// the version is not written to once it's not building anymore
+	p, err = v.get(1)
+	require.NoError(t, err)
+	assert.NotNil(t, p)
+}
+
+func TestSortKeys(t *testing.T) {
+	product := func(id uint, name string, price int) *models.Product {
+		return &models.Product{Model: gorm.Model{ID: id}, Name: name, Price: price}
+	}
+
+	// each product sorts before the next one
+	byPrice := []*models.Product{product(9, "a", 2), product(2, "a", 10), product(10, "a", 10), product(1, "a", 100)}
+	for i := 1; i < len(byPrice); i++ {
+		assert.Less(t, priceSortKey(byPrice[i-1]), priceSortKey(byPrice[i]))
+	}
+
+	byName := []*models.Product{product(9, "Bread", 1), product(2, "milk", 1), product(10, "Milk", 1), product(1, "Milk Tea", 1)}
+	for i := 1; i < len(byName); i++ {
+		assert.Less(t, nameSortKey(byName[i-1]), nameSortKey(byName[i]))
+	}
+}
+
+func TestRediSearch_SortTies(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	st := storage.NewMockStorage(c)
+	r := newTestRediSearch(t, st)
+
+	products := []*models.Product{
+		{Model: gorm.Model{ID: 1}, Name: "Milk", Price: 3},
+		{Model: gorm.Model{ID: 2}, Name: "Milk", Price: 3},
+		{Model: gorm.Model{ID: 3}, Name: "Milk", Price: 3},
+	}
+	st.EXPECT().SearchProducts(storage.SearchOptions{}).AnyTimes().Return(products, len(products), nil)
+	require.NoError(t, r.Init())
+
+	pages := func(t *testing.T, sortBy storage.SortField, descending bool) []uint {
+		var ids []uint
+		for offset := range products {
+			res, _, err := r.SearchProducts(storage.SearchOptions{
+				Offset: offset, Limit: 1, SortBy: sortBy, Descending: descending,
+			})
+			require.NoError(t, err)
+			require.Len(t, res, 1)
+			ids = append(ids, res[0].ID)
+		}
+		return ids
+	}
+
+	for _, sortBy := range []storage.SortField{storage.SortByRelevance, storage.SortByPrice, storage.SortByName} {
+		assert.Equal(t, []uint{1, 2, 3}, pages(t, sortBy, false))
+		assert.Equal(t, []uint{3, 2, 1}, pages(t, sortBy, true))
+	}
+}
@@ -0,0 +1,89 @@
+package storage
+
+// SortField is the field used to sort searched products
+type SortField string
+
+const (
+	// SortByRelevance sorts products by how well they match the search, when there is
+	// nothing to match against, products are sorted by their ID
+	SortByRelevance SortField = "relevance"
+
+	// SortByPrice sorts products by their price, then by their ID in the same direction
+	SortByPrice SortField = "price"
+
+	// SortByName sorts products by their name, then by their ID in the same direction
+	SortByName SortField = "name"
+)
+
+// NumericField is a numeric product field which search results can be filtered by
+type NumericField string
+
+const (
+	// PriceField is the price of the products
+	PriceField NumericField = "price"
+)
+
+// NumericFilter limits the search result to products which have the field value in range
+type NumericFilter struct {
+	Field NumericField
+
+	// Min is the inclusive lower bound of the range, nil means no lower bound
+	Min *int
+
+	// Max is the inclusive upper bound of the range, nil means no upper bound
+	Max *int
+}
+
+// SearchOptions holds all the params used to search products
+type SearchOptions struct {
+	// Name is searched in products name, if it's nil, all the products will match
+	Name *string
+
+	// Fuzzy matches the words of Name with one Levenshtein distance instead of by prefix,
+	// implementations which don't support it fall back to the normal matching
+	Fuzzy bool
+
+	// Filters are applied along with Name, a product must match all of them
+	Filters []NumericFilter
+
+	// InStock limits the result to products which are in stock when it's true and to the
+	// ones which are out of stock when it's false, nil means no limit
+	InStock *bool
+
+	// Category limits the result to products in the category with the slug or any of its
+	// descendants, nil means no limit
+	Category *string
+
+	// Offset is the number of matched products skipped from the start of the result
+	Offset int
+
+	// Limit is the maximum number of returned products, zero means no limit
+	Limit int
+
+	// SortBy is the field which products are sorted by, empty means SortByRelevance
+	SortBy SortField
+
+	// Descending reverses the sort order
+	Descending bool
+}
+
+// PriceFacet is the number of matched products which their price is in a range
+type PriceFacet struct {
+	// Min is the inclusive lower bound of the range, nil means no lower bound
+	Min *int
+
+	// Max is the exclusive upper bound of the range, nil means no upper bound
+	Max *int
+
+	// Count is the number of products in the range
+	Count int
+}
+
+// Suggestion is a product name completing a searched prefix
+type Suggestion struct {
+	// Term is the suggested product name
+	Term string
+
+	// ProductID is the ID of the suggested product
+	ProductID int
+}
@@ -4,10 +4,31 @@ import "github.com/moeen/redisearch-shopping/pkg/models"
 
 // Searcher is used to search products
 type Searcher interface {
-	// SearchProducts returns all products which has the name in it's name
-	// if name is nil, then it returns all the products
-	SearchProducts(name *string) ([]*models.Product, error)
+	// SearchProducts returns a page of the products matching given options
+	// along with the total number of matched products
+	SearchProducts(opts SearchOptions) ([]*models.Product, int, error)
+
+	// PriceFacets counts the products matching given options in each price range,
+	// boundaries must be sorted and n boundaries make n+1 ranges
+	PriceFacets(opts SearchOptions, boundaries []int) ([]*PriceFacet, error)
+
+	// SuggestProducts returns at most limit product names which start with the prefix,
+	// if fuzzy is set, prefixes in one Levenshtein distance from the given one also match
+	SuggestProducts(prefix string, limit int, fuzzy bool) ([]*Suggestion, error)
+
+	// SpellCheck returns at most limit corrections of the given text, each made
+	// by replacing one of its misspelled words with a known term
+	SpellCheck(text string, limit int) ([]string, error)
 
 	// AddProduct will create the given product in searcher and indexes it
 	AddProduct(product *models.Product) error
+
+	// GetProduct returns the indexed product with given ID
+	GetProduct(id int) (*models.Product, error)
+
+	// UpdateProduct re-indexes the given product with its new values
+	UpdateProduct(product *models.Product) error
+
+	// DeleteProduct removes the product with given ID from the index
+	DeleteProduct(id int) error
 }
@@ -48,17 +48,106 @@ func (mr *MockSearcherMockRecorder) AddProduct(product interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddProduct", reflect.TypeOf((*MockSearcher)(nil).AddProduct), product)
 }
 
+// DeleteProduct mocks base method.
+func (m *MockSearcher) DeleteProduct(id int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteProduct", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteProduct indicates an expected call of DeleteProduct.
+func (mr *MockSearcherMockRecorder) DeleteProduct(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteProduct", reflect.TypeOf((*MockSearcher)(nil).DeleteProduct), id)
+}
+
+// GetProduct mocks base method.
+func (m *MockSearcher) GetProduct(id int) (*models.Product, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetProduct", id)
+	ret0, _ := ret[0].(*models.Product)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetProduct indicates an expected call of GetProduct.
+func (mr *MockSearcherMockRecorder) GetProduct(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProduct", reflect.TypeOf((*MockSearcher)(nil).GetProduct), id)
+}
+
+// PriceFacets mocks base method.
+func (m *MockSearcher) PriceFacets(opts SearchOptions, boundaries []int) ([]*PriceFacet, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PriceFacets", opts, boundaries)
+	ret0, _ := ret[0].([]*PriceFacet)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PriceFacets indicates an expected call of PriceFacets.
+func (mr *MockSearcherMockRecorder) PriceFacets(opts, boundaries interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PriceFacets", reflect.TypeOf((*MockSearcher)(nil).PriceFacets), opts, boundaries)
+}
+
 // SearchProducts mocks base method.
-func (m *MockSearcher) SearchProducts(name *string) ([]*models.Product, error) {
+func (m *MockSearcher) SearchProducts(opts SearchOptions) ([]*models.Product, int, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SearchProducts", name)
+	ret := m.ctrl.Call(m, "SearchProducts", opts)
 	ret0, _ := ret[0].([]*models.Product)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// SearchProducts indicates an expected call of SearchProducts.
+func (mr *MockSearcherMockRecorder) SearchProducts(opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchProducts", reflect.TypeOf((*MockSearcher)(nil).SearchProducts), opts)
+}
+
+// SpellCheck mocks base method.
+func (m *MockSearcher) SpellCheck(text string, limit int) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SpellCheck", text, limit)
+	ret0, _ := ret[0].([]string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// SearchProducts indicates an expected call of SearchProducts.
-func (mr *MockSearcherMockRecorder) SearchProducts(name interface{}) *gomock.Call {
+// SpellCheck indicates an expected call of SpellCheck.
+func (mr *MockSearcherMockRecorder) SpellCheck(text, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SpellCheck", reflect.TypeOf((*MockSearcher)(nil).SpellCheck), text, limit)
+}
+
+// SuggestProducts mocks base method.
+func (m *MockSearcher) SuggestProducts(prefix string, limit int, fuzzy bool) ([]*Suggestion, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SuggestProducts", prefix, limit, fuzzy)
+	ret0, _ := ret[0].([]*Suggestion)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SuggestProducts indicates an expected call of SuggestProducts.
+func (mr *MockSearcherMockRecorder) SuggestProducts(prefix, limit, fuzzy interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SuggestProducts", reflect.TypeOf((*MockSearcher)(nil).SuggestProducts), prefix, limit, fuzzy)
+}
+
+// UpdateProduct mocks base method.
+func (m *MockSearcher) UpdateProduct(product *models.Product) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateProduct", product)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateProduct indicates an expected call of UpdateProduct.
+func (mr *MockSearcherMockRecorder) UpdateProduct(product interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchProducts", reflect.TypeOf((*MockSearcher)(nil).SearchProducts), name)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateProduct", reflect.TypeOf((*MockSearcher)(nil).UpdateProduct), product)
 }
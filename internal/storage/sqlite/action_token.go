@@ -0,0 +1,50 @@
+package sqlite
+
+import (
+	"errors"
+	"github.com/moeen/redisearch-shopping/internal/storage"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+	"gorm.io/gorm"
+	"time"
+)
+
+func (s *SQLiteDatabase) CreateActionToken(token *models.ActionToken) error {
+	if err := s.db.Create(token).Error; err != nil {
+		return dbError(err, "action token", "failed to create action token")
+	}
+
+	return nil
+}
+
+func (s *SQLiteDatabase) UseActionToken(hash, purpose string) (*models.ActionToken, error) {
+	var t models.ActionToken
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		err := tx.Where("token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", hash, purpose, now).
+			First(&t).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return storage.ErrInvalidActionToken
+		}
+		if err != nil {
+			return dbError(err, "action token", "failed to query action token")
+		}
+
+		// the used_at condition makes sure the token is only used once by concurrent requests
+		res := tx.Model(&t).Where("used_at IS NULL").Update("used_at", now)
+		if res.Error != nil {
+			return dbError(res.Error, "action token", "failed to update action token")
+		}
+		if res.RowsAffected == 0 {
+			return storage.ErrInvalidActionToken
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
@@ -0,0 +1,66 @@
+package sqlite
+
+import (
+	"github.com/moeen/redisearch-shopping/internal/storage"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestSQLiteDatabase_ActionTokensOfChangedEmail(t *testing.T) {
+	db, cID, _ := newTestDatabase(t)
+
+	newToken := func(t *testing.T, hash, purpose string) {
+		require.NoError(t, db.CreateActionToken(&models.ActionToken{
+			CustomerID: cID,
+			Purpose:    purpose,
+			TokenHash:  hash,
+			ExpiresAt:  time.Now().Add(time.Hour),
+		}))
+	}
+
+	emailVerified := func(t *testing.T, email string) bool {
+		c, err := db.GetCustomerByEmail(email)
+		require.NoError(t, err)
+		return c.EmailVerifiedAt != nil
+	}
+
+	t.Run("test tokens are kept when the email is not changed", func(t *testing.T) {
+		newToken(t, "same", models.PurposeEmailVerification)
+
+		require.NoError(t, db.UpdateCustomerProfile(cID, "new name", "test@test.com"))
+
+		_, err := db.UseActionToken("same", models.PurposeEmailVerification)
+		assert.NoError(t, err)
+	})
+
+	t.Run("test tokens mailed to the old email can't be used", func(t *testing.T) {
+		newToken(t, "verify", models.PurposeEmailVerification)
+		newToken(t, "reset", models.PurposePasswordReset)
+		newToken(t, "challenge", models.PurposeTotpChallenge)
+
+		require.NoError(t, db.UpdateCustomerProfile(cID, "test", "new@test.com"))
+
+		_, err := db.UseActionToken("verify", models.PurposeEmailVerification)
+		assert.ErrorIs(t, err, storage.ErrInvalidActionToken)
+		assert.False(t, emailVerified(t, "new@test.com"))
+
+		_, err = db.UseActionToken("reset", models.PurposePasswordReset)
+		assert.ErrorIs(t, err, storage.ErrInvalidActionToken)
+
+		// a login challenge has nothing to do with the email
+		_, err = db.UseActionToken("challenge", models.PurposeTotpChallenge)
+		assert.NoError(t, err)
+	})
+
+	t.Run("test tokens mailed to the new email can be used", func(t *testing.T) {
+		newToken(t, "new", models.PurposeEmailVerification)
+
+		tk, err := db.UseActionToken("new", models.PurposeEmailVerification)
+		require.NoError(t, err)
+		require.NoError(t, db.VerifyCustomerEmail(tk.CustomerID))
+		assert.True(t, emailVerified(t, "new@test.com"))
+	})
+}
@@ -0,0 +1,117 @@
+package sqlite
+
+import (
+	"fmt"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// upsertCartItem inserts the cart item or applies the quantity update to the existing one in a single statement,
+// the update can refer to the current quantity of the item so concurrent changes are never lost. The item is only
+// written while the product isn't deleted, so it can't slip in after DeleteProduct removes the product from carts.
+func upsertCartItem(db *gorm.DB, customerID, productID, quantity int, update clause.Expr) error {
+	now := time.Now()
+
+	res := db.Exec(`INSERT INTO cart_items (created_at, updated_at, customer_id, product_id, quantity)
+		SELECT ?, ?, ?, id, ? FROM products WHERE id = ? AND deleted_at IS NULL
+		ON CONFLICT (customer_id, product_id) DO UPDATE SET quantity = ?, updated_at = excluded.updated_at`,
+		now, now, customerID, quantity, productID, update)
+	if res.Error != nil {
+		return dbError(res.Error, "cart item", "failed to upsert cart item")
+	}
+	if res.RowsAffected == 0 {
+		return dbError(gorm.ErrRecordNotFound, "product", "failed to upsert cart item")
+	}
+
+	return nil
+}
+
+// mergeCartItems prepares the cart items created before the unique index for its migration,
+// soft deleted items are dropped and duplicate items of a product are merged into the oldest one
+func mergeCartItems(db *gorm.DB) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM cart_items WHERE deleted_at IS NOT NULL").Error; err != nil {
+			return err
+		}
+
+		err := tx.Exec(`UPDATE cart_items SET quantity = (
+			SELECT SUM(c.quantity) FROM cart_items c
+			WHERE c.customer_id = cart_items.customer_id AND c.product_id = cart_items.product_id
+		) WHERE id IN (
+			SELECT MIN(id) FROM cart_items GROUP BY customer_id, product_id HAVING COUNT(*) > 1
+		)`).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Exec(`DELETE FROM cart_items WHERE id NOT IN (
+			SELECT MIN(id) FROM cart_items GROUP BY customer_id, product_id
+		)`).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to merge cart items: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SQLiteDatabase) AddToCart(customerID, productID, quantity int) error {
+	return upsertCartItem(s.db, customerID, productID, quantity, gorm.Expr("quantity + ?", quantity))
+}
+
+func (s *SQLiteDatabase) RemoveFromCart(customerID, productID int) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.CartItem{}).
+			Where("customer_id = ? AND product_id = ? AND quantity > 1", customerID, productID).
+			Update("quantity", gorm.Expr("quantity - 1"))
+		if res.Error != nil {
+			return dbError(res.Error, "cart item", "failed to update cart item")
+		}
+		if res.RowsAffected > 0 {
+			return nil
+		}
+
+		res = tx.Unscoped().Where("customer_id = ? AND product_id = ?", customerID, productID).Delete(&models.CartItem{})
+		if res.Error != nil {
+			return dbError(res.Error, "cart item", "failed to delete cart item")
+		}
+		if res.RowsAffected == 0 {
+			return dbError(gorm.ErrRecordNotFound, "cart item", "failed to delete cart item")
+		}
+
+		return nil
+	})
+}
+
+func (s *SQLiteDatabase) SetCartItemQuantity(customerID, productID, quantity int) error {
+	if quantity > 0 {
+		return upsertCartItem(s.db, customerID, productID, quantity, gorm.Expr("excluded.quantity"))
+	}
+
+	err := s.db.Unscoped().Where("customer_id = ? AND product_id = ?", customerID, productID).Delete(&models.CartItem{}).Error
+	if err != nil {
+		return dbError(err, "cart item", "failed to delete cart item")
+	}
+
+	return nil
+}
+
+func (s *SQLiteDatabase) ClearCart(customerID int) error {
+	if err := s.db.Unscoped().Where("customer_id = ?", customerID).Delete(&models.CartItem{}).Error; err != nil {
+		return dbError(err, "cart item", "failed to clear cart")
+	}
+
+	return nil
+}
+
+func (s *SQLiteDatabase) GetCartItems(customerID int) ([]*models.CartItem, error) {
+	var cartItems []*models.CartItem
+
+	if err := s.db.Preload("Product").Where("customer_id = ?", customerID).Find(&cartItems).Error; err != nil {
+		return nil, dbError(err, "cart item", "failed to query cart items")
+	}
+
+	return cartItems, nil
+}
@@ -0,0 +1,228 @@
+package sqlite
+
+import (
+	"github.com/moeen/redisearch-shopping/internal/apperr"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// newTestDatabase creates a migrated database with a customer and a product with 10 units in stock to put in its cart
+func newTestDatabase(t *testing.T) (*SQLiteDatabase, int, int) {
+	db, err := NewSQLiteDatabase(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	require.NoError(t, db.Init())
+
+	c, err := db.CreateCustomer("test@test.com", "test", "test")
+	require.NoError(t, err)
+
+	p := &models.Product{Name: "Milk", Price: 3, Stock: 10}
+	require.NoError(t, db.AddProduct(p))
+
+	return db, int(c.ID), int(p.ID)
+}
+
+func TestSQLiteDatabase_Cart(t *testing.T) {
+	db, cID, pID := newTestDatabase(t)
+
+	quantityOf := func(t *testing.T) int {
+		items, err := db.GetCartItems(cID)
+		require.NoError(t, err)
+		if len(items) == 0 {
+			return 0
+		}
+
+		assert.Len(t, items, 1)
+		return items[0].Quantity
+	}
+
+	t.Run("test add to cart", func(t *testing.T) {
+		assert.NoError(t, db.AddToCart(cID, pID, 2))
+		assert.NoError(t, db.AddToCart(cID, pID, 3))
+		assert.Equal(t, 5, quantityOf(t))
+	})
+
+	t.Run("test remove from cart", func(t *testing.T) {
+		assert.NoError(t, db.RemoveFromCart(cID, pID))
+		assert.Equal(t, 4, quantityOf(t))
+	})
+
+	t.Run("test set quantity", func(t *testing.T) {
+		assert.NoError(t, db.SetCartItemQuantity(cID, pID, 1))
+		assert.Equal(t, 1, quantityOf(t))
+	})
+
+	t.Run("test remove last one", func(t *testing.T) {
+		assert.NoError(t, db.RemoveFromCart(cID, pID))
+		assert.Equal(t, 0, quantityOf(t))
+
+		err := db.RemoveFromCart(cID, pID)
+		assert.Equal(t, apperr.CodeNotFound, apperr.CodeOf(err))
+	})
+
+	t.Run("test add after remove", func(t *testing.T) {
+		assert.NoError(t, db.AddToCart(cID, pID, 2))
+		assert.Equal(t, 2, quantityOf(t))
+	})
+
+	t.Run("test set zero quantity", func(t *testing.T) {
+		assert.NoError(t, db.SetCartItemQuantity(cID, pID, 0))
+		assert.Equal(t, 0, quantityOf(t))
+
+		assert.NoError(t, db.SetCartItemQuantity(cID, pID, 3))
+		assert.Equal(t, 3, quantityOf(t))
+	})
+
+	t.Run("test clear cart", func(t *testing.T) {
+		assert.NoError(t, db.ClearCart(cID))
+		assert.Equal(t, 0, quantityOf(t))
+	})
+
+	t.Run("test unknown product", func(t *testing.T) {
+		err := db.AddToCart(cID, 1000, 1)
+		assert.Equal(t, apperr.CodeNotFound, apperr.CodeOf(err))
+
+		err = db.SetCartItemQuantity(cID, 1000, 1)
+		assert.Equal(t, apperr.CodeNotFound, apperr.CodeOf(err))
+
+		items, err := db.GetCartItems(cID)
+		require.NoError(t, err)
+		assert.Empty(t, items)
+	})
+}
+
+func TestSQLiteDatabase_CartDeletedProduct(t *testing.T) {
+	db, cID, pID := newTestDatabase(t)
+
+	require.NoError(t, db.AddToCart(cID, pID, 1))
+	require.NoError(t, db.DeleteProduct(pID))
+
+	// neither a new item nor an update of a stale one is written for a deleted product
+	require.NoError(t, db.db.Create(&models.CartItem{CustomerID: cID, ProductID: pID, Quantity: 1}).Error)
+
+	err := db.AddToCart(cID, pID, 1)
+	assert.Equal(t, apperr.CodeNotFound, apperr.CodeOf(err))
+
+	err = db.SetCartItemQuantity(cID, pID, 3)
+	assert.Equal(t, apperr.CodeNotFound, apperr.CodeOf(err))
+
+	var item models.CartItem
+	require.NoError(t, db.db.Where("customer_id = ? AND product_id = ?", cID, pID).First(&item).Error)
+	assert.Equal(t, 1, item.Quantity)
+
+	// removing it still works
+	assert.NoError(t, db.SetCartItemQuantity(cID, pID, 0))
+}
+
+func TestSQLiteDatabase_CartConcurrency(t *testing.T) {
+	const (
+		workers = 20
+		calls   = 25
+	)
+
+	db, cID, pID := newTestDatabase(t)
+
+	run := func(f func() error) []error {
+		var wg sync.WaitGroup
+		errs := make(chan error, workers*calls)
+
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < calls; j++ {
+					if err := f(); err != nil {
+						errs <- err
+					}
+				}
+			}()
+		}
+
+		wg.Wait()
+		close(errs)
+
+		var ret []error
+		for err := range errs {
+			ret = append(ret, err)
+		}
+		return ret
+	}
+
+	t.Run("test concurrent adds", func(t *testing.T) {
+		errs := run(func() error {
+			return db.AddToCart(cID, pID, 2)
+		})
+		assert.Empty(t, errs)
+
+		items, err := db.GetCartItems(cID)
+		require.NoError(t, err)
+		require.Len(t, items, 1)
+		assert.Equal(t, workers*calls*2, items[0].Quantity)
+	})
+
+	t.Run("test concurrent removes", func(t *testing.T) {
+		require.NoError(t, db.SetCartItemQuantity(cID, pID, workers*calls-1))
+
+		// one more remove than the quantity, only the last one finds nothing to remove
+		errs := run(func() error {
+			return db.RemoveFromCart(cID, pID)
+		})
+		require.Len(t, errs, 1)
+		assert.Equal(t, apperr.CodeNotFound, apperr.CodeOf(errs[0]))
+
+		items, err := db.GetCartItems(cID)
+		require.NoError(t, err)
+		assert.Empty(t, items)
+	})
+
+	t.Run("test concurrent adds and removes", func(t *testing.T) {
+		require.NoError(t, db.SetCartItemQuantity(cID, pID, workers*calls))
+
+		var mu sync.Mutex
+		n := 0
+		errs := run(func() error {
+			mu.Lock()
+			n++
+			add := n%2 == 0
+			mu.Unlock()
+
+			if add {
+				return db.AddToCart(cID, pID, 1)
+			}
+			return db.RemoveFromCart(cID, pID)
+		})
+		assert.Empty(t, errs)
+
+		items, err := db.GetCartItems(cID)
+		require.NoError(t, err)
+		require.Len(t, items, 1)
+		assert.Equal(t, workers*calls, items[0].Quantity)
+	})
+}
+
+func TestSQLiteDatabase_InitMergesCartItems(t *testing.T) {
+	db, cID, pID := newTestDatabase(t)
+
+	// cart items created before the unique index could be duplicated or soft deleted
+	require.NoError(t, db.db.Exec("DROP INDEX idx_cart_items_customer_product").Error)
+	for _, q := range []int{1, 2, 3} {
+		require.NoError(t, db.db.Create(&models.CartItem{CustomerID: cID, ProductID: pID, Quantity: q}).Error)
+	}
+	require.NoError(t, db.db.Exec("UPDATE cart_items SET deleted_at = CURRENT_TIMESTAMP WHERE quantity = 3").Error)
+
+	require.NoError(t, db.Init())
+
+	items, err := db.GetCartItems(cID)
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, 3, items[0].Quantity)
+
+	assert.NoError(t, db.AddToCart(cID, pID, 1))
+	items, err = db.GetCartItems(cID)
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, 4, items[0].Quantity)
+}
@@ -0,0 +1,99 @@
+package sqlite
+
+import (
+	"github.com/moeen/redisearch-shopping/internal/storage"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+	"gorm.io/gorm"
+)
+
+func (s *SQLiteDatabase) CreateCategory(category *models.Category) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		category.Path = category.Slug
+		if category.ParentID != nil {
+			var parent models.Category
+			if err := tx.Where("id = ?", *category.ParentID).First(&parent).Error; err != nil {
+				return dbError(err, "parent category", "failed to query parent category")
+			}
+
+			category.Path = parent.Path + models.CategoryPathSeparator + category.Slug
+		}
+
+		if err := tx.Create(category).Error; err != nil {
+			if isUniqueConstraintError(err) {
+				return storage.ErrCategorySlugTaken
+			}
+			return dbError(err, "category", "failed to create category")
+		}
+
+		return nil
+	})
+}
+
+func (s *SQLiteDatabase) GetCategories() ([]*models.Category, error) {
+	var c []*models.Category
+	if err := s.db.Order("path").Find(&c).Error; err != nil {
+		return nil, dbError(err, "category", "failed to query categories")
+	}
+
+	return c, nil
+}
+
+func (s *SQLiteDatabase) GetProductCategories(productID int) ([]*models.Category, error) {
+	var c []*models.Category
+	err := s.db.Joins("JOIN product_categories ON product_categories.category_id = categories.id").
+		Where("product_categories.product_id = ?", productID).
+		Order("categories.path").
+		Find(&c).Error
+	if err != nil {
+		return nil, dbError(err, "category", "failed to query product categories")
+	}
+
+	return c, nil
+}
+
+func (s *SQLiteDatabase) SetProductCategories(productID int, categoryIDs []int) (*models.Product, error) {
+	var p models.Product
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ?", productID).First(&p).Error; err != nil {
+			return dbError(err, "product", "failed to query product")
+		}
+
+		unique := make(map[int]bool, len(categoryIDs))
+		for _, id := range categoryIDs {
+			unique[id] = true
+		}
+
+		var categories []models.Category
+		if len(unique) > 0 {
+			if err := tx.Where("id IN ?", categoryIDs).Find(&categories).Error; err != nil {
+				return dbError(err, "category", "failed to query categories")
+			}
+		}
+		if len(categories) != len(unique) {
+			return dbError(gorm.ErrRecordNotFound, "category", "failed to query categories")
+		}
+
+		if err := tx.Model(&p).Association("Categories").Replace(categories); err != nil {
+			return dbError(err, "category", "failed to set product categories")
+		}
+
+		return addOutboxEvent(tx, models.OutboxProductUpserted, &p)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// categoryProducts returns the query of the IDs of the products in the category with
+// the slug or any of its descendants
+func categoryProducts(tx *gorm.DB, slug string) *gorm.DB {
+	return tx.Table("product_categories").
+		Select("product_categories.product_id").
+		Joins("JOIN categories ON categories.id = product_categories.category_id").
+		Joins("JOIN categories AS parents ON categories.path = parents.path OR categories.path LIKE parents.path || ?",
+			models.CategoryPathSeparator+"%").
+		Where("parents.slug = ?", slug)
+}
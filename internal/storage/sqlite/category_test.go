@@ -0,0 +1,134 @@
+package sqlite
+
+import (
+	"encoding/json"
+	"github.com/moeen/redisearch-shopping/internal/apperr"
+	"github.com/moeen/redisearch-shopping/internal/storage"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestSQLiteDatabase_Categories(t *testing.T) {
+	db, _, pID := newTestDatabase(t)
+
+	food := &models.Category{Name: "Food", Slug: "food"}
+	dairy := &models.Category{Name: "Dairy", Slug: "dairy"}
+	cheese := &models.Category{Name: "Cheese", Slug: "cheese"}
+	drinks := &models.Category{Name: "Drinks", Slug: "drinks"}
+
+	t.Run("test create categories", func(t *testing.T) {
+		require.NoError(t, db.CreateCategory(food))
+		assert.Equal(t, "food", food.Path)
+
+		dairy.ParentID = &food.ID
+		require.NoError(t, db.CreateCategory(dairy))
+		assert.Equal(t, "food/dairy", dairy.Path)
+
+		cheese.ParentID = &dairy.ID
+		require.NoError(t, db.CreateCategory(cheese))
+		assert.Equal(t, "food/dairy/cheese", cheese.Path)
+
+		require.NoError(t, db.CreateCategory(drinks))
+
+		err := db.CreateCategory(&models.Category{Name: "Dairy", Slug: "dairy"})
+		assert.Equal(t, storage.ErrCategorySlugTaken, err)
+
+		unknown := uint(1000)
+		err = db.CreateCategory(&models.Category{Name: "Fish", Slug: "fish", ParentID: &unknown})
+		assert.Equal(t, apperr.CodeNotFound, apperr.CodeOf(err))
+
+		categories, err := db.GetCategories()
+		require.NoError(t, err)
+
+		paths := make([]string, len(categories))
+		for i, c := range categories {
+			paths[i] = c.Path
+		}
+		assert.Equal(t, []string{"drinks", "food", "food/dairy", "food/dairy/cheese"}, paths)
+	})
+
+	t.Run("test set product categories", func(t *testing.T) {
+		_, err := db.SetProductCategories(pID+1, []int{int(dairy.ID)})
+		assert.Equal(t, apperr.CodeNotFound, apperr.CodeOf(err))
+
+		_, err = db.SetProductCategories(pID, []int{int(dairy.ID), 1000})
+		assert.Equal(t, apperr.CodeNotFound, apperr.CodeOf(err))
+
+		p, err := db.SetProductCategories(pID, []int{int(drinks.ID), int(dairy.ID), int(dairy.ID)})
+		require.NoError(t, err)
+		require.Len(t, p.Categories, 2)
+		assert.Equal(t, "drinks", p.Categories[0].Slug)
+		assert.Equal(t, "dairy", p.Categories[1].Slug)
+
+		categories, err := db.GetProductCategories(pID)
+		require.NoError(t, err)
+		require.Len(t, categories, 2)
+		assert.Equal(t, drinks.ID, categories[0].ID)
+		assert.Equal(t, dairy.ID, categories[1].ID)
+
+		// categories are replaced and not added
+		_, err = db.SetProductCategories(pID, []int{int(dairy.ID)})
+		require.NoError(t, err)
+
+		categories, err = db.GetProductCategories(pID)
+		require.NoError(t, err)
+		require.Len(t, categories, 1)
+		assert.Equal(t, dairy.ID, categories[0].ID)
+	})
+
+	t.Run("test search by category", func(t *testing.T) {
+		other := &models.Product{Name: "Cheddar", Price: 5}
+		require.NoError(t, db.AddProduct(other))
+		_, err := db.SetProductCategories(int(other.ID), []int{int(cheese.ID)})
+		require.NoError(t, err)
+
+		search := func(slug string) []uint {
+			products, total, err := db.SearchProducts(storage.SearchOptions{Category: &slug})
+			require.NoError(t, err)
+			assert.Equal(t, len(products), total)
+
+			ids := make([]uint, len(products))
+			for i, p := range products {
+				ids[i] = p.ID
+			}
+			return ids
+		}
+
+		// products of the descendants are in the category too
+		assert.Equal(t, []uint{uint(pID), other.ID}, search("food"))
+		assert.Equal(t, []uint{uint(pID), other.ID}, search("dairy"))
+		assert.Equal(t, []uint{other.ID}, search("cheese"))
+		assert.Empty(t, search("drinks"))
+		assert.Empty(t, search("unknown"))
+
+		products, _, err := db.SearchProducts(storage.SearchOptions{})
+		require.NoError(t, err)
+		require.Len(t, products, 2)
+		assert.Equal(t, "food/dairy", products[0].Categories[0].Path)
+	})
+
+	t.Run("test categories are sent to the searcher", func(t *testing.T) {
+		// stock changes keep the categories of the product
+		_, err := db.AdjustProductStock(pID, 1)
+		require.NoError(t, err)
+
+		events, err := db.ClaimOutboxEvents("test", time.Now(), time.Minute, 1000)
+		require.NoError(t, err)
+
+		var last *models.OutboxEvent
+		for _, e := range events {
+			if e.ProductID == pID {
+				last = e
+			}
+		}
+		require.NotNil(t, last)
+
+		var p models.Product
+		require.NoError(t, json.Unmarshal([]byte(last.Payload), &p))
+		require.Len(t, p.Categories, 1)
+		assert.Equal(t, "food/dairy", p.Categories[0].Path)
+	})
+}
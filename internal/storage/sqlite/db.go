@@ -1,10 +1,15 @@
 package sqlite
 
 import (
+	"encoding/json"
 	"fmt"
+	"github.com/moeen/redisearch-shopping/internal/storage"
 	"github.com/moeen/redisearch-shopping/pkg/models"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
+	"time"
 )
 
 // SQLiteDatabase is the SQLite implementation of storage.Storage
@@ -14,7 +19,14 @@ type SQLiteDatabase struct {
 
 // NewSQLiteDatabase will create a new SQLiteDatabase with given database address
 func NewSQLiteDatabase(addr string) (*SQLiteDatabase, error) {
-	db, err := gorm.Open(sqlite.Open(addr), &gorm.Config{})
+	// transactions take the write lock when they begin, otherwise two transactions which read
+	// before writing deadlock on upgrading their locks and fail without waiting for each other
+	sep := "?"
+	if strings.Contains(addr, "?") {
+		sep = "&"
+	}
+
+	db, err := gorm.Open(sqlite.Open(addr+sep+"_txlock=immediate"), &gorm.Config{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to open db: %w", err)
 	}
@@ -24,7 +36,23 @@ func NewSQLiteDatabase(addr string) (*SQLiteDatabase, error) {
 
 // Init will migrate all models needed
 func (s *SQLiteDatabase) Init() error {
-	err := s.db.AutoMigrate(&models.Customer{}, &models.Product{}, &models.CartItem{})
+	// emails registered before they were normalized must be lowercased before the unique
+	// index is created, duplicates among them fail the migration and must be merged by hand
+	if s.db.Migrator().HasTable(&models.Customer{}) {
+		if err := s.db.Exec("UPDATE customers SET email = LOWER(TRIM(email))").Error; err != nil {
+			return fmt.Errorf("failed to normalize customer emails: %w", err)
+		}
+	}
+
+	if s.db.Migrator().HasTable(&models.CartItem{}) {
+		if err := mergeCartItems(s.db); err != nil {
+			return err
+		}
+	}
+
+	err := s.db.AutoMigrate(&models.Customer{}, &models.Category{}, &models.Product{}, &models.CartItem{}, &models.OutboxEvent{},
+		&models.RefreshToken{}, &models.ActionToken{}, &models.RecoveryCode{}, &models.Order{}, &models.OrderItem{}, &models.OrderHistory{},
+		&models.Payment{}, &models.StockReservation{})
 	if err != nil {
 		return fmt.Errorf("failed to migrate models: %w", err)
 	}
@@ -35,7 +63,7 @@ func (s *SQLiteDatabase) Init() error {
 func (s *SQLiteDatabase) GetCustomer(id int) (*models.Customer, error) {
 	var c models.Customer
 	if err := s.db.Where("id = ?", id).First(&c).Error; err != nil {
-		return nil, fmt.Errorf("failed to query customer: %w", err)
+		return nil, dbError(err, "customer", "failed to query customer")
 	}
 
 	return &c, nil
@@ -44,7 +72,7 @@ func (s *SQLiteDatabase) GetCustomer(id int) (*models.Customer, error) {
 func (s *SQLiteDatabase) GetCustomerByEmail(email string) (*models.Customer, error) {
 	var c models.Customer
 	if err := s.db.Where("email = ?", email).First(&c).Error; err != nil {
-		return nil, fmt.Errorf("failed to query customer: %w", err)
+		return nil, dbError(err, "customer", "failed to query customer")
 	}
 
 	return &c, nil
@@ -55,96 +83,350 @@ func (s *SQLiteDatabase) CreateCustomer(email, name, hash string) (*models.Custo
 		Email:    email,
 		Password: hash,
 		Name:     name,
+		Role:     models.RoleCustomer,
 	}
 
 	if err := s.db.Create(&c).Error; err != nil {
-		return nil, fmt.Errorf("failed to create customer: %w", err)
+		if isUniqueConstraintError(err) {
+			return nil, storage.ErrEmailTaken
+		}
+		return nil, dbError(err, "customer", "failed to create customer")
 	}
 
 	return &c, nil
 }
 
-func (s *SQLiteDatabase) AddToCart(customerID, productID, quantity int) error {
-	var cartItem models.CartItem
-	err := s.db.Where("customer_id = ? AND product_id = ?", customerID, productID).First(&cartItem).Error
+func (s *SQLiteDatabase) UpdateCustomerProfile(id int, name, email string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var c models.Customer
+		if err := tx.Select("id", "email").First(&c, id).Error; err != nil {
+			return dbError(err, "customer", "failed to update customer profile")
+		}
 
-	if err != nil && err != gorm.ErrRecordNotFound {
-		return fmt.Errorf("failed to query cart item: %w", err)
-	}
+		// the verification is only kept when the email is not changed
+		updates := map[string]interface{}{
+			"name":  name,
+			"email": email,
+		}
+		if email != c.Email {
+			updates["email_verified_at"] = nil
+		}
 
-	if err != gorm.ErrRecordNotFound {
-		cartItem.Quantity += quantity
-		if err := s.db.Save(&cartItem).Error; err != nil {
-			return fmt.Errorf("failed to update cart item: %w", err)
+		res := tx.Model(&models.Customer{}).Where("id = ?", id).Updates(updates)
+		if res.Error != nil {
+			if isUniqueConstraintError(res.Error) {
+				return storage.ErrEmailTaken
+			}
+			return dbError(res.Error, "customer", "failed to update customer profile")
 		}
+		if res.RowsAffected == 0 {
+			return dbError(gorm.ErrRecordNotFound, "customer", "failed to update customer profile")
+		}
+
+		if email == c.Email {
+			return nil
+		}
+
+		// the tokens were mailed to the old email, they must not verify or reset the new one
+		err := tx.Model(&models.ActionToken{}).
+			Where("customer_id = ? AND purpose IN ? AND used_at IS NULL", id,
+				[]string{models.PurposeEmailVerification, models.PurposePasswordReset}).
+			Update("used_at", time.Now()).Error
+		if err != nil {
+			return dbError(err, "action token", "failed to revoke action tokens")
+		}
+
 		return nil
+	})
+}
+
+func (s *SQLiteDatabase) SetCustomerRole(id int, role models.Role) error {
+	res := s.db.Model(&models.Customer{}).Where("id = ?", id).Update("role", role)
+	if res.Error != nil {
+		return dbError(res.Error, "customer", "failed to update customer role")
+	}
+	if res.RowsAffected == 0 {
+		return dbError(gorm.ErrRecordNotFound, "customer", "failed to update customer role")
 	}
 
-	cartItem = models.CartItem{
-		CustomerID: customerID,
-		Quantity:   quantity,
-		ProductID:  productID,
+	return nil
+}
+
+func (s *SQLiteDatabase) SetCustomerPassword(id int, hash string) error {
+	res := s.db.Model(&models.Customer{}).Where("id = ?", id).Update("password", hash)
+	if res.Error != nil {
+		return dbError(res.Error, "customer", "failed to update customer password")
+	}
+	if res.RowsAffected == 0 {
+		return dbError(gorm.ErrRecordNotFound, "customer", "failed to update customer password")
 	}
 
-	if err := s.db.Create(&cartItem).Error; err != nil {
-		return fmt.Errorf("failed to insert cart item: %w", err)
+	return nil
+}
+
+func (s *SQLiteDatabase) VerifyCustomerEmail(id int) error {
+	res := s.db.Model(&models.Customer{}).Where("id = ? AND email_verified_at IS NULL", id).
+		Update("email_verified_at", time.Now())
+	if res.Error != nil {
+		return dbError(res.Error, "customer", "failed to verify customer email")
 	}
 
 	return nil
 }
 
-func (s *SQLiteDatabase) RemoveFromCart(customerID, productID int) error {
-	var cartItem models.CartItem
-	if err := s.db.Where("customer_id = ? AND product_id = ?", customerID, productID).First(&cartItem).Error; err != nil {
-		return fmt.Errorf("failed to query cart item: %w", err)
+func (s *SQLiteDatabase) AddProduct(product *models.Product) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(product).Error; err != nil {
+			return dbError(err, "product", "failed to add product")
+		}
+
+		return addOutboxEvent(tx, models.OutboxProductUpserted, product)
+	})
+}
+
+func (s *SQLiteDatabase) GetProduct(id int) (*models.Product, error) {
+	var p models.Product
+	if err := s.db.Where("id = ?", id).First(&p).Error; err != nil {
+		return nil, dbError(err, "product", "failed to query product")
 	}
 
-	if cartItem.Quantity == 1 {
-		if err := s.db.Delete(&cartItem).Error; err != nil {
-			return fmt.Errorf("failed to delete cart item: %w", err)
+	return &p, nil
+}
+
+func (s *SQLiteDatabase) UpdateProduct(product *models.Product) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.Product{}).Where("id = ?", product.ID).Updates(map[string]interface{}{
+			"name":  product.Name,
+			"price": product.Price,
+		})
+		if res.Error != nil {
+			return dbError(res.Error, "product", "failed to update product")
+		}
+		if res.RowsAffected == 0 {
+			return dbError(gorm.ErrRecordNotFound, "product", "failed to update product")
 		}
 
-		return nil
+		if err := tx.Where("id = ?", product.ID).First(product).Error; err != nil {
+			return dbError(err, "product", "failed to query product")
+		}
+
+		return addOutboxEvent(tx, models.OutboxProductUpserted, product)
+	})
+}
+
+func (s *SQLiteDatabase) DeleteProduct(id int) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var p models.Product
+		if err := tx.Where("id = ?", id).First(&p).Error; err != nil {
+			return dbError(err, "product", "failed to query product")
+		}
+
+		if err := tx.Delete(&p).Error; err != nil {
+			return dbError(err, "product", "failed to delete product")
+		}
+
+		if err := tx.Unscoped().Where("product_id = ?", id).Delete(&models.CartItem{}).Error; err != nil {
+			return dbError(err, "cart item", "failed to delete cart items")
+		}
+
+		return addOutboxEvent(tx, models.OutboxProductDeleted, &p)
+	})
+}
+
+func (s *SQLiteDatabase) SearchProducts(opts storage.SearchOptions) ([]*models.Product, int, error) {
+	query := s.db.Model(&models.Product{})
+	if opts.Name != nil {
+		query = query.Where("name LIKE ?", fmt.Sprintf("%%%s%%", *opts.Name))
+	}
+
+	for _, f := range opts.Filters {
+		column, err := numericColumn(f.Field)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if f.Min != nil {
+			query = query.Where(fmt.Sprintf("%s >= ?", column), *f.Min)
+		}
+		if f.Max != nil {
+			query = query.Where(fmt.Sprintf("%s <= ?", column), *f.Max)
+		}
 	}
 
-	cartItem.Quantity -= 1
-	if err := s.db.Save(&cartItem).Error; err != nil {
-		return fmt.Errorf("failed to update cart item: %w", err)
+	if opts.InStock != nil {
+		if *opts.InStock {
+			query = query.Where("stock > 0")
+		} else {
+			query = query.Where("stock = 0")
+		}
 	}
 
-	return nil
+	if opts.Category != nil {
+		query = query.Where("id IN (?)", categoryProducts(s.db, *opts.Category))
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, dbError(err, "product", "failed to count products")
+	}
+
+	column := sortColumn(opts.SortBy)
+	query = query.Order(clause.OrderByColumn{
+		Column: clause.Column{Name: column},
+		Desc:   opts.Descending,
+	})
+	// products with the same price or name must keep their order between pages
+	if column != "id" {
+		query = query.Order(clause.OrderByColumn{Column: clause.Column{Name: "id"}, Desc: opts.Descending})
+	}
+
+	if opts.Offset > 0 {
+		query = query.Offset(opts.Offset)
+	}
+	if opts.Limit > 0 {
+		query = query.Limit(opts.Limit)
+	}
+
+	var p []*models.Product
+	if err := query.Preload("Categories").Find(&p).Error; err != nil {
+		return nil, 0, dbError(err, "product", "failed to query products")
+	}
+
+	return p, int(total), nil
 }
 
-func (s *SQLiteDatabase) GetCartItems(customerID int) ([]*models.CartItem, error) {
-	var cartItems []*models.CartItem
+// sortColumn returns the products column used for sorting by given field,
+// SQLite has no relevance score, so products are sorted by their ID instead
+func sortColumn(field storage.SortField) string {
+	switch field {
+	case storage.SortByPrice:
+		return "price"
+	case storage.SortByName:
+		return "name"
+	default:
+		return "id"
+	}
+}
+
+// numericColumn returns the products column of given numeric field
+func numericColumn(field storage.NumericField) (string, error) {
+	switch field {
+	case storage.PriceField:
+		return "price", nil
+	default:
+		return "", fmt.Errorf("unknown numeric field: %s", field)
+	}
+}
+
+func (s *SQLiteDatabase) ClaimOutboxEvents(owner string, now time.Time, lease time.Duration, limit int) ([]*models.OutboxEvent, error) {
+	var events []*models.OutboxEvent
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// dead events don't block the later ones, a later upsert replaces what they failed to apply
+		waiting := tx.Table("outbox_events AS earlier").Select("1").Where(
+			"earlier.product_id = outbox_events.product_id AND earlier.id < outbox_events.id AND "+
+				"earlier.processed_at IS NULL AND earlier.dead_at IS NULL AND "+
+				"(earlier.next_attempt_at > ? OR (earlier.claimed_by <> ? AND earlier.claimed_until > ?))", now, owner, now)
+
+		err := tx.Where("processed_at IS NULL AND dead_at IS NULL AND next_attempt_at <= ?", now).
+			Where("claimed_until IS NULL OR claimed_until <= ? OR claimed_by = ?", now, owner).
+			Where("NOT EXISTS (?)", waiting).
+			Order("id").Limit(limit).Find(&events).Error
+		if err != nil || len(events) == 0 {
+			return err
+		}
+
+		ids := make([]uint, len(events))
+		until := now.Add(lease)
+		for i, e := range events {
+			ids[i] = e.ID
+			e.ClaimedBy = owner
+			e.ClaimedUntil = &until
+		}
 
-	if err := s.db.Preload("Product").Where("customer_id = ?", customerID).Find(&cartItems).Error; err != nil {
-		return nil, fmt.Errorf("failed to query cart items: %w", err)
+		return tx.Model(&models.OutboxEvent{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+			"claimed_by":    owner,
+			"claimed_until": until,
+		}).Error
+	})
+	if err != nil {
+		return nil, dbError(err, "outbox event", "failed to claim outbox events")
 	}
 
-	return cartItems, nil
+	return events, nil
+}
 
+func (s *SQLiteDatabase) MarkOutboxEventProcessed(id int) error {
+	err := s.db.Model(&models.OutboxEvent{}).Where("id = ?", id).
+		Update("processed_at", time.Now()).Error
+	if err != nil {
+		return dbError(err, "outbox event", "failed to update outbox event")
+	}
+
+	return nil
 }
 
-func (s *SQLiteDatabase) AddProduct(product *models.Product) error {
-	if err := s.db.Create(product).Error; err != nil {
-		return fmt.Errorf("failed to add product: %w", err)
+func (s *SQLiteDatabase) MarkOutboxEventFailed(id int, reason string, retryAt time.Time) error {
+	err := s.db.Model(&models.OutboxEvent{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"attempts":        gorm.Expr("attempts + 1"),
+		"last_error":      reason,
+		"next_attempt_at": retryAt,
+		"claimed_by":      "",
+		"claimed_until":   nil,
+	}).Error
+	if err != nil {
+		return dbError(err, "outbox event", "failed to update outbox event")
 	}
 
 	return nil
 }
 
-func (s *SQLiteDatabase) SearchProducts(name *string) ([]*models.Product, error) {
-	var p []*models.Product
+func (s *SQLiteDatabase) MarkOutboxEventDead(id int, reason string) error {
+	err := s.db.Model(&models.OutboxEvent{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"attempts":   gorm.Expr("attempts + 1"),
+		"last_error": reason,
+		"dead_at":    time.Now(),
+	}).Error
+	if err != nil {
+		return dbError(err, "outbox event", "failed to update outbox event")
+	}
+
+	return nil
+}
 
-	query := s.db
-	if name != nil {
-		query = query.Where("name LIKE ?", fmt.Sprintf("%%%s%%", *name))
+func (s *SQLiteDatabase) PruneOutboxEvents(before time.Time) (int, error) {
+	res := s.db.Unscoped().Where("processed_at < ?", before).Delete(&models.OutboxEvent{})
+	if res.Error != nil {
+		return 0, dbError(res.Error, "outbox event", "failed to prune outbox events")
 	}
 
-	if err := query.Find(&p).Error; err != nil {
-		return nil, fmt.Errorf("failed to query products: %w", err)
+	return int(res.RowsAffected), nil
+}
+
+// addOutboxEvent records a change of the product in the outbox inside the given transaction, the
+// categories of upserted products are loaded first so the searcher indexes them along with the product
+func addOutboxEvent(tx *gorm.DB, eventType string, product *models.Product) error {
+	if eventType == models.OutboxProductUpserted {
+		product.Categories = nil
+		if err := tx.Model(product).Order("path").Association("Categories").Find(&product.Categories); err != nil {
+			return dbError(err, "category", "failed to query product categories")
+		}
 	}
 
-	return p, nil
+	payload, err := json.Marshal(product)
+	if err != nil {
+		return fmt.Errorf("failed to encode product: %w", err)
+	}
+
+	event := models.OutboxEvent{
+		Type:          eventType,
+		ProductID:     int(product.ID),
+		Payload:       string(payload),
+		NextAttemptAt: time.Now(),
+	}
+
+	if err := tx.Create(&event).Error; err != nil {
+		return dbError(err, "outbox event", "failed to add outbox event")
+	}
+
+	return nil
 }
@@ -0,0 +1,54 @@
+package sqlite
+
+import (
+	"github.com/moeen/redisearch-shopping/internal/storage"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestSQLiteDatabase_SearchProductsTies(t *testing.T) {
+	db, _, pID := newTestDatabase(t)
+
+	// the test product is Milk priced 3
+	ids := []uint{uint(pID)}
+	for _, name := range []string{"Milk", "Milk", "Bread"} {
+		p := &models.Product{Name: name, Price: 3}
+		require.NoError(t, db.AddProduct(p))
+		ids = append(ids, p.ID)
+	}
+
+	reversed := func(ids []uint) []uint {
+		res := make([]uint, len(ids))
+		for i, id := range ids {
+			res[len(ids)-1-i] = id
+		}
+		return res
+	}
+
+	pages := func(t *testing.T, sortBy storage.SortField, descending bool) []uint {
+		var res []uint
+		for offset := 0; offset < len(ids); offset++ {
+			products, total, err := db.SearchProducts(storage.SearchOptions{
+				Offset: offset, Limit: 1, SortBy: sortBy, Descending: descending,
+			})
+			require.NoError(t, err)
+			require.Equal(t, len(ids), total)
+			require.Len(t, products, 1)
+			res = append(res, products[0].ID)
+		}
+		return res
+	}
+
+	t.Run("test products with the same price are paged by id in the same direction", func(t *testing.T) {
+		assert.Equal(t, ids, pages(t, storage.SortByPrice, false))
+		assert.Equal(t, reversed(ids), pages(t, storage.SortByPrice, true))
+	})
+
+	t.Run("test products with the same name are paged by id in the same direction", func(t *testing.T) {
+		milks := []uint{ids[0], ids[1], ids[2]}
+		assert.Equal(t, append([]uint{ids[3]}, milks...), pages(t, storage.SortByName, false))
+		assert.Equal(t, append(reversed(milks), ids[3]), pages(t, storage.SortByName, true))
+	})
+}
@@ -0,0 +1,38 @@
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mattn/go-sqlite3"
+	"github.com/moeen/redisearch-shopping/internal/apperr"
+	"gorm.io/gorm"
+)
+
+// dbError translates errors of the database into domain errors, missing records and constraint
+// failures are told apart by their codes while msg and the sqlite error are only kept as the cause
+func dbError(err error, entity, msg string) error {
+	wrapped := fmt.Errorf("%s: %w", msg, err)
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return apperr.Wrap(apperr.CodeNotFound, entity+" not found", wrapped)
+	case isUniqueConstraintError(err):
+		return apperr.Wrap(apperr.CodeConflict, entity+" already exists", wrapped)
+	case isConstraintError(err):
+		return apperr.Wrap(apperr.CodeConflict, entity+" conflicts with existing data", wrapped)
+	}
+
+	return wrapped
+}
+
+// isUniqueConstraintError reports whether the error is caused by violating a unique index
+func isUniqueConstraintError(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
+
+// isConstraintError reports whether the error is caused by violating any constraint
+func isConstraintError(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrConstraint
+}
@@ -0,0 +1,117 @@
+package sqlite
+
+import (
+	"github.com/moeen/redisearch-shopping/internal/storage"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+	"gorm.io/gorm"
+	"time"
+)
+
+// preloadOrder loads the items and history of orders in the order they were added
+func preloadOrder(db *gorm.DB) *gorm.DB {
+	byID := func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}
+
+	return db.Preload("Items", byID).Preload("History", byID)
+}
+
+func (s *SQLiteDatabase) Checkout(customerID int, reserveUntil time.Time, newOrder func(items []*models.CartItem) *models.Order) (*models.Order, error) {
+	var order *models.Order
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var cartItems []*models.CartItem
+		if err := tx.Preload("Product").Where("customer_id = ?", customerID).Order("id").Find(&cartItems).Error; err != nil {
+			return dbError(err, "cart item", "failed to query cart items")
+		}
+
+		if len(cartItems) == 0 {
+			return storage.ErrEmptyCart
+		}
+
+		order = newOrder(cartItems)
+		order.CustomerID = customerID
+
+		if err := tx.Create(order).Error; err != nil {
+			return dbError(err, "order", "failed to create order")
+		}
+
+		for _, ci := range cartItems {
+			if err := reserveStock(tx, int(order.ID), ci.ProductID, ci.Quantity, reserveUntil); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Unscoped().Where("customer_id = ?", customerID).Delete(&models.CartItem{}).Error; err != nil {
+			return dbError(err, "cart item", "failed to clear cart")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+func (s *SQLiteDatabase) GetCustomerOrders(customerID int) ([]*models.Order, error) {
+	var orders []*models.Order
+	if err := preloadOrder(s.db).Where("customer_id = ?", customerID).Order("id DESC").Find(&orders).Error; err != nil {
+		return nil, dbError(err, "order", "failed to query orders")
+	}
+
+	return orders, nil
+}
+
+func (s *SQLiteDatabase) GetCustomerOrder(customerID, id int) (*models.Order, error) {
+	var o models.Order
+	if err := preloadOrder(s.db).Where("customer_id = ? AND id = ?", customerID, id).First(&o).Error; err != nil {
+		return nil, dbError(err, "order", "failed to query order")
+	}
+
+	return &o, nil
+}
+
+func (s *SQLiteDatabase) GetOrder(id int) (*models.Order, error) {
+	var o models.Order
+	if err := preloadOrder(s.db).Where("id = ?", id).First(&o).Error; err != nil {
+		return nil, dbError(err, "order", "failed to query order")
+	}
+
+	return &o, nil
+}
+
+func (s *SQLiteDatabase) UpdateOrderStatus(entry *models.OrderHistory) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.Order{}).Where("id = ? AND status = ?", entry.OrderID, entry.FromStatus).
+			Update("status", entry.ToStatus)
+		if res.Error != nil {
+			return dbError(res.Error, "order", "failed to update order status")
+		}
+		if res.RowsAffected == 0 {
+			var n int64
+			if err := tx.Model(&models.Order{}).Where("id = ?", entry.OrderID).Count(&n).Error; err != nil {
+				return dbError(err, "order", "failed to query order")
+			}
+			if n == 0 {
+				return dbError(gorm.ErrRecordNotFound, "order", "failed to update order status")
+			}
+
+			return storage.ErrOrderStatusChanged
+		}
+
+		if err := tx.Create(entry).Error; err != nil {
+			return dbError(err, "order history", "failed to add order history")
+		}
+
+		switch entry.ToStatus {
+		case models.OrderPaid:
+			return commitStock(tx, entry.OrderID)
+		case models.OrderCancelled:
+			return releaseStock(tx, entry.OrderID)
+		}
+
+		return nil
+	})
+}
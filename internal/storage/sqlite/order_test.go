@@ -0,0 +1,146 @@
+package sqlite
+
+import (
+	"github.com/moeen/redisearch-shopping/internal/apperr"
+	"github.com/moeen/redisearch-shopping/internal/storage"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+func TestSQLiteDatabase_Checkout(t *testing.T) {
+	db, cID, pID := newTestDatabase(t)
+
+	newOrder := func(items []*models.CartItem) *models.Order {
+		o := &models.Order{}
+		for _, ci := range items {
+			o.Items = append(o.Items, models.OrderItem{
+				ProductID: ci.ProductID,
+				Name:      ci.Product.Name,
+				UnitPrice: ci.Product.Price,
+				Quantity:  ci.Quantity,
+				LineTotal: ci.Product.Price * ci.Quantity,
+			})
+			o.GrandTotal += ci.Product.Price * ci.Quantity
+		}
+		return o
+	}
+
+	t.Run("test with empty cart", func(t *testing.T) {
+		order, err := db.Checkout(cID, time.Now().Add(time.Hour), newOrder)
+		assert.Equal(t, storage.ErrEmptyCart, err)
+		assert.Nil(t, order)
+	})
+
+	t.Run("test successful checkout", func(t *testing.T) {
+		require.NoError(t, db.AddToCart(cID, pID, 2))
+
+		order, err := db.Checkout(cID, time.Now().Add(time.Hour), newOrder)
+		require.NoError(t, err)
+		assert.NotZero(t, order.ID)
+		assert.Equal(t, cID, order.CustomerID)
+		assert.Equal(t, 6, order.GrandTotal)
+
+		items, err := db.GetCartItems(cID)
+		require.NoError(t, err)
+		assert.Empty(t, items)
+	})
+
+	t.Run("test prices are snapshotted", func(t *testing.T) {
+		require.NoError(t, db.UpdateProduct(&models.Product{Model: gorm.Model{ID: uint(pID)}, Name: "Milk", Price: 30}))
+
+		orders, err := db.GetCustomerOrders(cID)
+		require.NoError(t, err)
+		require.Len(t, orders, 1)
+		require.Len(t, orders[0].Items, 1)
+		assert.Equal(t, models.OrderItem{
+			Model:     orders[0].Items[0].Model,
+			OrderID:   int(orders[0].ID),
+			ProductID: pID,
+			Name:      "Milk",
+			UnitPrice: 3,
+			Quantity:  2,
+			LineTotal: 6,
+		}, orders[0].Items[0])
+	})
+
+	t.Run("test get order", func(t *testing.T) {
+		require.NoError(t, db.AddToCart(cID, pID, 1))
+		second, err := db.Checkout(cID, time.Now().Add(time.Hour), newOrder)
+		require.NoError(t, err)
+
+		orders, err := db.GetCustomerOrders(cID)
+		require.NoError(t, err)
+		require.Len(t, orders, 2)
+		assert.Equal(t, second.ID, orders[0].ID)
+
+		order, err := db.GetCustomerOrder(cID, int(second.ID))
+		require.NoError(t, err)
+		assert.Len(t, order.Items, 1)
+		assert.Equal(t, 30, order.GrandTotal)
+
+		_, err = db.GetCustomerOrder(cID+1, int(second.ID))
+		assert.Equal(t, apperr.CodeNotFound, apperr.CodeOf(err))
+	})
+}
+
+func TestSQLiteDatabase_UpdateOrderStatus(t *testing.T) {
+	db, cID, pID := newTestDatabase(t)
+
+	require.NoError(t, db.AddToCart(cID, pID, 1))
+	order, err := db.Checkout(cID, time.Now().Add(time.Hour), func(items []*models.CartItem) *models.Order {
+		return &models.Order{History: []models.OrderHistory{{ToStatus: models.OrderPending, ActorID: cID}}}
+	})
+	require.NoError(t, err)
+	assert.Equal(t, models.OrderPending, order.Status)
+
+	oID := int(order.ID)
+
+	t.Run("test successful update", func(t *testing.T) {
+		err := db.UpdateOrderStatus(&models.OrderHistory{
+			OrderID:    oID,
+			FromStatus: models.OrderPending,
+			ToStatus:   models.OrderPaid,
+			ActorID:    9,
+			Reason:     "paid by card",
+		})
+		require.NoError(t, err)
+
+		o, err := db.GetOrder(oID)
+		require.NoError(t, err)
+		assert.Equal(t, models.OrderPaid, o.Status)
+		require.Len(t, o.History, 2)
+		assert.Equal(t, models.OrderStatus(""), o.History[0].FromStatus)
+		assert.Equal(t, models.OrderPending, o.History[0].ToStatus)
+		assert.Equal(t, models.OrderPending, o.History[1].FromStatus)
+		assert.Equal(t, models.OrderPaid, o.History[1].ToStatus)
+		assert.Equal(t, 9, o.History[1].ActorID)
+		assert.Equal(t, "paid by card", o.History[1].Reason)
+	})
+
+	t.Run("test update from a stale status", func(t *testing.T) {
+		err := db.UpdateOrderStatus(&models.OrderHistory{
+			OrderID:    oID,
+			FromStatus: models.OrderPending,
+			ToStatus:   models.OrderCancelled,
+		})
+		assert.Equal(t, storage.ErrOrderStatusChanged, err)
+
+		o, err := db.GetOrder(oID)
+		require.NoError(t, err)
+		assert.Equal(t, models.OrderPaid, o.Status)
+		assert.Len(t, o.History, 2)
+	})
+
+	t.Run("test update of unknown order", func(t *testing.T) {
+		err := db.UpdateOrderStatus(&models.OrderHistory{
+			OrderID:    oID + 1,
+			FromStatus: models.OrderPending,
+			ToStatus:   models.OrderPaid,
+		})
+		assert.Equal(t, apperr.CodeNotFound, apperr.CodeOf(err))
+	})
+}
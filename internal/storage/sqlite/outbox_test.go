@@ -0,0 +1,122 @@
+package sqlite
+
+import (
+	"github.com/moeen/redisearch-shopping/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestSQLiteDatabase_Outbox(t *testing.T) {
+	db, _, pID := newTestDatabase(t)
+	now := time.Now()
+
+	// the event of adding the product of the test database
+	events, err := db.ClaimOutboxEvents("test", now, time.Minute, 100)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.NoError(t, db.MarkOutboxEventProcessed(int(events[0].ID)))
+
+	other := &models.Product{Name: "Bread", Price: 4}
+	require.NoError(t, db.AddProduct(other))
+
+	ids := func(t *testing.T, now time.Time) []uint {
+		events, err := db.ClaimOutboxEvents("test", now, time.Minute, 100)
+		require.NoError(t, err)
+
+		res := make([]uint, len(events))
+		for i, e := range events {
+			res[i] = e.ID
+		}
+		return res
+	}
+
+	_, err = db.AdjustProductStock(pID, 1)
+	require.NoError(t, err)
+	_, err = db.AdjustProductStock(pID, 1)
+	require.NoError(t, err)
+
+	due := ids(t, now.Add(time.Second))
+	require.Len(t, due, 3)
+
+	t.Run("test events waiting for retry block the later events of their product", func(t *testing.T) {
+		require.NoError(t, db.MarkOutboxEventFailed(int(due[1]), "failed", now.Add(time.Minute)))
+
+		assert.Equal(t, []uint{due[0]}, ids(t, now.Add(time.Second)))
+		assert.Equal(t, due, ids(t, now.Add(2*time.Minute)))
+	})
+
+	t.Run("test dead events are not returned or block others", func(t *testing.T) {
+		require.NoError(t, db.MarkOutboxEventDead(int(due[1]), "failed"))
+
+		assert.Equal(t, []uint{due[0], due[2]}, ids(t, now.Add(time.Second)))
+
+		var e models.OutboxEvent
+		require.NoError(t, db.db.Where("id = ?", due[1]).First(&e).Error)
+		assert.NotNil(t, e.DeadAt)
+		assert.Equal(t, 2, e.Attempts)
+	})
+
+	t.Run("test prune processed events", func(t *testing.T) {
+		require.NoError(t, db.MarkOutboxEventProcessed(int(due[0])))
+
+		n, err := db.PruneOutboxEvents(now.Add(-time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, 0, n)
+
+		n, err = db.PruneOutboxEvents(time.Now().Add(time.Second))
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+
+		// unprocessed and dead events are kept
+		var count int64
+		require.NoError(t, db.db.Model(&models.OutboxEvent{}).Count(&count).Error)
+		assert.Equal(t, int64(2), count)
+	})
+}
+
+func TestSQLiteDatabase_ClaimOutboxEvents(t *testing.T) {
+	db, _, pID := newTestDatabase(t)
+	now := time.Now().Add(time.Second)
+
+	ids := func(t *testing.T, owner string, now time.Time, limit int) []uint {
+		events, err := db.ClaimOutboxEvents(owner, now, time.Minute, limit)
+		require.NoError(t, err)
+
+		res := make([]uint, len(events))
+		for i, e := range events {
+			assert.Equal(t, owner, e.ClaimedBy)
+			res[i] = e.ID
+		}
+		return res
+	}
+
+	other := &models.Product{Name: "Bread", Price: 4}
+	require.NoError(t, db.AddProduct(other))
+	_, err := db.AdjustProductStock(pID, 1)
+	require.NoError(t, err)
+
+	// the first event of each product
+	first := ids(t, "a", now, 2)
+	require.Len(t, first, 2)
+
+	t.Run("test claimed events and the later events of their products are left out for other owners", func(t *testing.T) {
+		assert.Empty(t, ids(t, "b", now, 100))
+	})
+
+	t.Run("test owners keep their claimed events", func(t *testing.T) {
+		assert.Len(t, ids(t, "a", now, 100), 3)
+	})
+
+	t.Run("test expired claims are taken over", func(t *testing.T) {
+		assert.Len(t, ids(t, "b", now.Add(2*time.Minute), 100), 3)
+	})
+
+	t.Run("test failed events are released", func(t *testing.T) {
+		require.NoError(t, db.MarkOutboxEventFailed(int(first[0]), "failed", now))
+
+		claimed := ids(t, "a", now.Add(2*time.Minute), 100)
+		assert.Equal(t, []uint{first[0]}, claimed)
+	})
+}
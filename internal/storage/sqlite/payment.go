@@ -0,0 +1,46 @@
+package sqlite
+
+import (
+	"github.com/moeen/redisearch-shopping/pkg/models"
+	"gorm.io/gorm/clause"
+)
+
+func (s *SQLiteDatabase) SavePayment(payment *models.Payment) error {
+	err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "provider_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"status", "action_url", "updated_at"}),
+	}).Create(payment).Error
+	if err != nil {
+		return dbError(err, "payment", "failed to save payment")
+	}
+
+	return nil
+}
+
+func (s *SQLiteDatabase) GetPayment(providerID string) (*models.Payment, error) {
+	var p models.Payment
+	if err := s.db.Where("provider_id = ?", providerID).First(&p).Error; err != nil {
+		return nil, dbError(err, "payment", "failed to query payment")
+	}
+
+	return &p, nil
+}
+
+func (s *SQLiteDatabase) GetOrderPayment(orderID int) (*models.Payment, error) {
+	var p models.Payment
+	err := s.db.Where("order_id = ? AND status <> ?", orderID, models.PaymentDeclined).Order("id DESC").First(&p).Error
+	if err != nil {
+		return nil, dbError(err, "payment", "failed to query payment")
+	}
+
+	return &p, nil
+}
+
+func (s *SQLiteDatabase) CountOrderPayments(orderID int) (int, error) {
+	var n int64
+	if err := s.db.Model(&models.Payment{}).Where("order_id = ?", orderID).Count(&n).Error; err != nil {
+		return 0, dbError(err, "payment", "failed to count payments")
+	}
+
+	return int(n), nil
+}
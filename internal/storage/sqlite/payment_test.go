@@ -0,0 +1,72 @@
+package sqlite
+
+import (
+	"github.com/moeen/redisearch-shopping/internal/apperr"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestSQLiteDatabase_Payments(t *testing.T) {
+	db, _, _ := newTestDatabase(t)
+
+	t.Run("test missing payment", func(t *testing.T) {
+		p, err := db.GetPayment("pay_1")
+		assert.Equal(t, apperr.CodeNotFound, apperr.CodeOf(err))
+		assert.Nil(t, p)
+
+		p, err = db.GetOrderPayment(1)
+		assert.Equal(t, apperr.CodeNotFound, apperr.CodeOf(err))
+		assert.Nil(t, p)
+	})
+
+	t.Run("test save payment", func(t *testing.T) {
+		require.NoError(t, db.SavePayment(&models.Payment{
+			OrderID: 1, ProviderID: "pay_1", Status: models.PaymentPending, Amount: 100, ActionURL: "http://action",
+		}))
+
+		// saving the same provider ID again updates the payment
+		require.NoError(t, db.SavePayment(&models.Payment{
+			OrderID: 1, ProviderID: "pay_1", Status: models.PaymentAuthorized, Amount: 100,
+		}))
+
+		p, err := db.GetPayment("pay_1")
+		require.NoError(t, err)
+		assert.Equal(t, models.PaymentAuthorized, p.Status)
+		assert.Equal(t, 100, p.Amount)
+		assert.Empty(t, p.ActionURL)
+
+		var n int64
+		require.NoError(t, db.db.Model(&models.Payment{}).Count(&n).Error)
+		assert.Equal(t, int64(1), n)
+	})
+
+	t.Run("test order payment skips declined ones", func(t *testing.T) {
+		require.NoError(t, db.SavePayment(&models.Payment{
+			OrderID: 1, ProviderID: "pay_2", Status: models.PaymentDeclined, Amount: 100,
+		}))
+
+		p, err := db.GetOrderPayment(1)
+		require.NoError(t, err)
+		assert.Equal(t, "pay_1", p.ProviderID)
+
+		require.NoError(t, db.SavePayment(&models.Payment{
+			OrderID: 1, ProviderID: "pay_3", Status: models.PaymentCaptured, Amount: 100,
+		}))
+
+		p, err = db.GetOrderPayment(1)
+		require.NoError(t, err)
+		assert.Equal(t, "pay_3", p.ProviderID)
+	})
+
+	t.Run("test count order payments", func(t *testing.T) {
+		n, err := db.CountOrderPayments(1)
+		require.NoError(t, err)
+		assert.Equal(t, 3, n)
+
+		n, err = db.CountOrderPayments(2)
+		require.NoError(t, err)
+		assert.Equal(t, 0, n)
+	})
+}
@@ -0,0 +1,81 @@
+package sqlite
+
+import (
+	"github.com/moeen/redisearch-shopping/internal/storage"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+	"gorm.io/gorm"
+	"time"
+)
+
+func (s *SQLiteDatabase) CreateRefreshToken(token *models.RefreshToken) error {
+	if err := s.db.Create(token).Error; err != nil {
+		return dbError(err, "refresh token", "failed to create refresh token")
+	}
+
+	return nil
+}
+
+func (s *SQLiteDatabase) GetRefreshToken(hash string) (*models.RefreshToken, error) {
+	var t models.RefreshToken
+	if err := s.db.Where("token_hash = ?", hash).First(&t).Error; err != nil {
+		return nil, dbError(err, "refresh token", "failed to query refresh token")
+	}
+
+	return &t, nil
+}
+
+func (s *SQLiteDatabase) RotateRefreshToken(id int, next *models.RefreshToken) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		// the used_at condition makes sure only one of the concurrent rotations wins
+		res := tx.Model(&models.RefreshToken{}).Where("id = ? AND used_at IS NULL", id).
+			Update("used_at", time.Now())
+		if res.Error != nil {
+			return dbError(res.Error, "refresh token", "failed to update refresh token")
+		}
+		if res.RowsAffected == 0 {
+			return storage.ErrRefreshTokenUsed
+		}
+
+		if err := tx.Create(next).Error; err != nil {
+			return dbError(err, "refresh token", "failed to create refresh token")
+		}
+
+		return nil
+	})
+}
+
+func (s *SQLiteDatabase) RevokeRefreshTokenFamily(familyID string) error {
+	err := s.db.Model(&models.RefreshToken{}).Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+	if err != nil {
+		return dbError(err, "refresh token", "failed to revoke refresh tokens")
+	}
+
+	return nil
+}
+
+func (s *SQLiteDatabase) RevokeCustomerRefreshTokens(customerID int) ([]string, error) {
+	var families []string
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		active := tx.Model(&models.RefreshToken{}).
+			Where("customer_id = ? AND revoked_at IS NULL AND expires_at > ?", customerID, time.Now())
+
+		if err := active.Distinct().Pluck("family_id", &families).Error; err != nil {
+			return dbError(err, "refresh token", "failed to query refresh tokens")
+		}
+
+		err := tx.Model(&models.RefreshToken{}).Where("customer_id = ? AND revoked_at IS NULL", customerID).
+			Update("revoked_at", time.Now()).Error
+		if err != nil {
+			return dbError(err, "refresh token", "failed to revoke refresh tokens")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return families, nil
+}
@@ -0,0 +1,126 @@
+package sqlite
+
+import (
+	"github.com/moeen/redisearch-shopping/internal/storage"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+	"gorm.io/gorm"
+	"time"
+)
+
+// stockChanged records the current state of the product in the outbox, so the searcher sees its new stock
+func stockChanged(tx *gorm.DB, productID int) error {
+	var p models.Product
+	if err := tx.Where("id = ?", productID).First(&p).Error; err != nil {
+		return dbError(err, "product", "failed to query product")
+	}
+
+	return addOutboxEvent(tx, models.OutboxProductUpserted, &p)
+}
+
+// reserveStock takes the quantity out of the product stock for the order until expiresAt,
+// an OutOfStockError is returned when the product doesn't have enough stock
+func reserveStock(tx *gorm.DB, orderID, productID, quantity int, expiresAt time.Time) error {
+	res := tx.Model(&models.Product{}).Where("id = ? AND stock >= ? AND deleted_at IS NULL", productID, quantity).
+		Update("stock", gorm.Expr("stock - ?", quantity))
+	if res.Error != nil {
+		return dbError(res.Error, "product", "failed to reserve stock")
+	}
+	if res.RowsAffected == 0 {
+		var p models.Product
+		if err := tx.Where("id = ?", productID).First(&p).Error; err != nil {
+			return dbError(err, "product", "failed to query product")
+		}
+
+		return storage.OutOfStockError(productID, p.Stock)
+	}
+
+	err := tx.Create(&models.StockReservation{
+		OrderID:   orderID,
+		ProductID: productID,
+		Quantity:  quantity,
+		ExpiresAt: expiresAt,
+	}).Error
+	if err != nil {
+		return dbError(err, "stock reservation", "failed to add stock reservation")
+	}
+
+	return stockChanged(tx, productID)
+}
+
+// releaseStock puts the reserved stock of the order back into the products and deletes the reservations,
+// products which are deleted meanwhile are left alone
+func releaseStock(tx *gorm.DB, orderID int) error {
+	var reservations []*models.StockReservation
+	if err := tx.Where("order_id = ?", orderID).Order("id").Find(&reservations).Error; err != nil {
+		return dbError(err, "stock reservation", "failed to query stock reservations")
+	}
+
+	for _, r := range reservations {
+		// updates aren't scoped to the products which aren't deleted like queries are
+		res := tx.Model(&models.Product{}).Where("id = ? AND deleted_at IS NULL", r.ProductID).
+			Update("stock", gorm.Expr("stock + ?", r.Quantity))
+		if res.Error != nil {
+			return dbError(res.Error, "product", "failed to release stock")
+		}
+
+		if res.RowsAffected > 0 {
+			if err := stockChanged(tx, r.ProductID); err != nil {
+				return err
+			}
+		}
+	}
+
+	return commitStock(tx, orderID)
+}
+
+// commitStock deletes the reservations of the order, so their stock is sold for good
+func commitStock(tx *gorm.DB, orderID int) error {
+	if err := tx.Unscoped().Where("order_id = ?", orderID).Delete(&models.StockReservation{}).Error; err != nil {
+		return dbError(err, "stock reservation", "failed to delete stock reservations")
+	}
+
+	return nil
+}
+
+func (s *SQLiteDatabase) AdjustProductStock(id, delta int) (*models.Product, error) {
+	var p models.Product
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.Product{}).Where("id = ? AND stock + ? >= 0 AND deleted_at IS NULL", id, delta).
+			Update("stock", gorm.Expr("stock + ?", delta))
+		if res.Error != nil {
+			return dbError(res.Error, "product", "failed to adjust stock")
+		}
+
+		if err := tx.Where("id = ?", id).First(&p).Error; err != nil {
+			return dbError(err, "product", "failed to query product")
+		}
+
+		if res.RowsAffected == 0 {
+			return storage.ErrNegativeStock
+		}
+
+		return addOutboxEvent(tx, models.OutboxProductUpserted, &p)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+func (s *SQLiteDatabase) GetExpiredReservationOrders(now time.Time, limit int) ([]int, error) {
+	var ids []int
+	err := s.db.Model(&models.StockReservation{}).
+		Joins("JOIN orders ON orders.id = stock_reservations.order_id").
+		Where("stock_reservations.expires_at <= ? AND orders.status = ?", now, models.OrderPending).
+		Group("stock_reservations.order_id").
+		Order("stock_reservations.order_id").
+		Limit(limit).
+		Pluck("stock_reservations.order_id", &ids).Error
+	if err != nil {
+		return nil, dbError(err, "stock reservation", "failed to query expired stock reservations")
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,243 @@
+package sqlite
+
+import (
+	"fmt"
+	"github.com/moeen/redisearch-shopping/internal/apperr"
+	"github.com/moeen/redisearch-shopping/internal/storage"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestOrder creates the pending order which Checkout stores
+func newTestOrder([]*models.CartItem) *models.Order {
+	return &models.Order{Status: models.OrderPending}
+}
+
+func TestSQLiteDatabase_Stock(t *testing.T) {
+	db, cID, pID := newTestDatabase(t)
+	now := time.Now()
+
+	stock := func(t *testing.T) int {
+		p, err := db.GetProduct(pID)
+		require.NoError(t, err)
+		return p.Stock
+	}
+
+	checkout := func(t *testing.T, quantity int) *models.Order {
+		require.NoError(t, db.AddToCart(cID, pID, quantity))
+		order, err := db.Checkout(cID, now.Add(time.Minute), newTestOrder)
+		require.NoError(t, err)
+		return order
+	}
+
+	t.Run("test adjust stock", func(t *testing.T) {
+		p, err := db.AdjustProductStock(pID, 5)
+		require.NoError(t, err)
+		assert.Equal(t, 15, p.Stock)
+
+		p, err = db.AdjustProductStock(pID, -16)
+		assert.Equal(t, storage.ErrNegativeStock, err)
+		assert.Nil(t, p)
+		assert.Equal(t, 15, stock(t))
+
+		p, err = db.AdjustProductStock(pID+1, 1)
+		assert.Equal(t, apperr.CodeNotFound, apperr.CodeOf(err))
+		assert.Nil(t, p)
+	})
+
+	t.Run("test checkout reserves stock", func(t *testing.T) {
+		order := checkout(t, 5)
+		assert.Equal(t, 10, stock(t))
+
+		var reservations []*models.StockReservation
+		require.NoError(t, db.db.Where("order_id = ?", order.ID).Find(&reservations).Error)
+		require.Len(t, reservations, 1)
+		assert.Equal(t, 5, reservations[0].Quantity)
+		assert.WithinDuration(t, now.Add(time.Minute), reservations[0].ExpiresAt, time.Second)
+	})
+
+	t.Run("test checkout with not enough stock", func(t *testing.T) {
+		require.NoError(t, db.AddToCart(cID, pID, 11))
+
+		order, err := db.Checkout(cID, now.Add(time.Minute), newTestOrder)
+		assert.Equal(t, storage.OutOfStockError(pID, 10), err)
+		assert.Nil(t, order)
+
+		// nothing is changed, the customer can fix their cart
+		assert.Equal(t, 10, stock(t))
+		items, err := db.GetCartItems(cID)
+		require.NoError(t, err)
+		assert.Len(t, items, 1)
+
+		orders, err := db.GetCustomerOrders(cID)
+		require.NoError(t, err)
+		assert.Len(t, orders, 1)
+
+		require.NoError(t, db.ClearCart(cID))
+	})
+
+	t.Run("test paid order keeps its stock", func(t *testing.T) {
+		order := checkout(t, 2)
+		assert.Equal(t, 8, stock(t))
+
+		require.NoError(t, db.UpdateOrderStatus(&models.OrderHistory{
+			OrderID: int(order.ID), FromStatus: models.OrderPending, ToStatus: models.OrderPaid,
+		}))
+		assert.Equal(t, 8, stock(t))
+
+		var n int64
+		require.NoError(t, db.db.Model(&models.StockReservation{}).Where("order_id = ?", order.ID).Count(&n).Error)
+		assert.Zero(t, n)
+	})
+
+	t.Run("test cancelled order releases its stock", func(t *testing.T) {
+		order := checkout(t, 3)
+		assert.Equal(t, 5, stock(t))
+
+		require.NoError(t, db.UpdateOrderStatus(&models.OrderHistory{
+			OrderID: int(order.ID), FromStatus: models.OrderPending, ToStatus: models.OrderCancelled,
+		}))
+		assert.Equal(t, 8, stock(t))
+
+		var n int64
+		require.NoError(t, db.db.Model(&models.StockReservation{}).Where("order_id = ?", order.ID).Count(&n).Error)
+		assert.Zero(t, n)
+	})
+
+	t.Run("test expired reservations", func(t *testing.T) {
+		ids, err := db.GetExpiredReservationOrders(now, 10)
+		require.NoError(t, err)
+		assert.Empty(t, ids)
+
+		// only pending orders are returned, the first order is still pending
+		ids, err = db.GetExpiredReservationOrders(now.Add(time.Hour), 10)
+		require.NoError(t, err)
+		require.Len(t, ids, 1)
+
+		o, err := db.GetOrder(ids[0])
+		require.NoError(t, err)
+		assert.Equal(t, models.OrderPending, o.Status)
+	})
+
+	t.Run("test search by stock", func(t *testing.T) {
+		out := &models.Product{Name: "Bread", Price: 4}
+		require.NoError(t, db.AddProduct(out))
+
+		inStock, outOfStock := true, false
+
+		products, total, err := db.SearchProducts(storage.SearchOptions{InStock: &inStock})
+		require.NoError(t, err)
+		assert.Equal(t, 1, total)
+		assert.Equal(t, uint(pID), products[0].ID)
+
+		products, total, err = db.SearchProducts(storage.SearchOptions{InStock: &outOfStock})
+		require.NoError(t, err)
+		assert.Equal(t, 1, total)
+		assert.Equal(t, out.ID, products[0].ID)
+	})
+
+	t.Run("test stock changes are sent to the searcher", func(t *testing.T) {
+		events, err := db.ClaimOutboxEvents("test", time.Now(), time.Minute, 1000)
+		require.NoError(t, err)
+
+		var last *models.OutboxEvent
+		for _, e := range events {
+			if e.ProductID == pID {
+				last = e
+			}
+		}
+
+		require.NotNil(t, last)
+		assert.Equal(t, models.OutboxProductUpserted, last.Type)
+		assert.Contains(t, last.Payload, `"Stock":8`)
+	})
+}
+
+func TestSQLiteDatabase_StockOfDeletedProduct(t *testing.T) {
+	db, cID, pID := newTestDatabase(t)
+
+	require.NoError(t, db.AddToCart(cID, pID, 3))
+	order, err := db.Checkout(cID, time.Now().Add(time.Minute), newTestOrder)
+	require.NoError(t, err)
+
+	require.NoError(t, db.DeleteProduct(pID))
+
+	t.Run("test adjust stock", func(t *testing.T) {
+		p, err := db.AdjustProductStock(pID, 1)
+		assert.Equal(t, apperr.CodeNotFound, apperr.CodeOf(err))
+		assert.Nil(t, p)
+	})
+
+	t.Run("test cancelled order", func(t *testing.T) {
+		require.NoError(t, db.UpdateOrderStatus(&models.OrderHistory{
+			OrderID: int(order.ID), FromStatus: models.OrderPending, ToStatus: models.OrderCancelled,
+		}))
+
+		var n int64
+		require.NoError(t, db.db.Model(&models.StockReservation{}).Where("order_id = ?", order.ID).Count(&n).Error)
+		assert.Zero(t, n)
+
+		// the deleted product is left alone
+		var p models.Product
+		require.NoError(t, db.db.Unscoped().Where("id = ?", pID).First(&p).Error)
+		assert.Equal(t, 7, p.Stock)
+
+		events, err := db.ClaimOutboxEvents("test", time.Now(), time.Minute, 1000)
+		require.NoError(t, err)
+		require.NotEmpty(t, events)
+		assert.Equal(t, models.OutboxProductDeleted, events[len(events)-1].Type)
+	})
+}
+
+func TestSQLiteDatabase_CheckoutConcurrency(t *testing.T) {
+	const customers = 20
+
+	db, _, pID := newTestDatabase(t)
+
+	// 20 customers try to buy 10 units, one each
+	ids := make([]int, customers)
+	for i := range ids {
+		c, err := db.CreateCustomer(fmt.Sprintf("customer%d@test.com", i), "test", "test")
+		require.NoError(t, err)
+		require.NoError(t, db.AddToCart(int(c.ID), pID, 1))
+		ids[i] = int(c.ID)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		ordered  int
+		rejected int
+	)
+	for _, id := range ids {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+
+			_, err := db.Checkout(id, time.Now().Add(time.Minute), newTestOrder)
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				ordered++
+			case apperr.CodeOf(err) == apperr.CodeOutOfStock:
+				rejected++
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}(id)
+	}
+	wg.Wait()
+
+	assert.Equal(t, 10, ordered)
+	assert.Equal(t, 10, rejected)
+
+	p, err := db.GetProduct(pID)
+	require.NoError(t, err)
+	assert.Zero(t, p.Stock)
+}
@@ -0,0 +1,108 @@
+package sqlite
+
+import (
+	"github.com/moeen/redisearch-shopping/internal/storage"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+	"gorm.io/gorm"
+	"time"
+)
+
+func (s *SQLiteDatabase) SetCustomerTotp(id int, secret string, recoveryCodeHashes []string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.Customer{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"totp_secret":       secret,
+			"totp_confirmed_at": nil,
+			"totp_last_step":    0,
+		})
+		if res.Error != nil {
+			return dbError(res.Error, "customer", "failed to update customer totp")
+		}
+		if res.RowsAffected == 0 {
+			return dbError(gorm.ErrRecordNotFound, "customer", "failed to update customer totp")
+		}
+
+		if err := deleteRecoveryCodes(tx, id); err != nil {
+			return err
+		}
+
+		codes := make([]*models.RecoveryCode, len(recoveryCodeHashes))
+		for i, h := range recoveryCodeHashes {
+			codes[i] = &models.RecoveryCode{CustomerID: id, CodeHash: h}
+		}
+
+		if len(codes) > 0 {
+			if err := tx.Create(&codes).Error; err != nil {
+				return dbError(err, "recovery code", "failed to create recovery codes")
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *SQLiteDatabase) ConfirmCustomerTotp(id int, step int64) error {
+	res := s.db.Model(&models.Customer{}).Where("id = ? AND totp_secret <> ''", id).Updates(map[string]interface{}{
+		"totp_confirmed_at": time.Now(),
+		"totp_last_step":    step,
+	})
+	if res.Error != nil {
+		return dbError(res.Error, "customer", "failed to confirm customer totp")
+	}
+	if res.RowsAffected == 0 {
+		return dbError(gorm.ErrRecordNotFound, "customer", "failed to confirm customer totp")
+	}
+
+	return nil
+}
+
+func (s *SQLiteDatabase) DisableCustomerTotp(id int) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.Customer{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"totp_secret":       "",
+			"totp_confirmed_at": nil,
+			"totp_last_step":    0,
+		}).Error
+		if err != nil {
+			return dbError(err, "customer", "failed to disable customer totp")
+		}
+
+		return deleteRecoveryCodes(tx, id)
+	})
+}
+
+func (s *SQLiteDatabase) UseTotpStep(id int, step int64) error {
+	// the step condition makes sure each code is only accepted once by concurrent requests
+	res := s.db.Model(&models.Customer{}).Where("id = ? AND totp_last_step < ?", id, step).
+		Update("totp_last_step", step)
+	if res.Error != nil {
+		return dbError(res.Error, "customer", "failed to update customer totp step")
+	}
+	if res.RowsAffected == 0 {
+		return storage.ErrTotpCodeUsed
+	}
+
+	return nil
+}
+
+func (s *SQLiteDatabase) UseRecoveryCode(customerID int, hash string) error {
+	res := s.db.Model(&models.RecoveryCode{}).
+		Where("customer_id = ? AND code_hash = ? AND used_at IS NULL", customerID, hash).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return dbError(res.Error, "recovery code", "failed to update recovery code")
+	}
+	if res.RowsAffected == 0 {
+		return storage.ErrInvalidRecoveryCode
+	}
+
+	return nil
+}
+
+// deleteRecoveryCodes permanently deletes all the recovery codes of the customer
+func deleteRecoveryCodes(tx *gorm.DB, customerID int) error {
+	if err := tx.Unscoped().Where("customer_id = ?", customerID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return dbError(err, "recovery code", "failed to delete recovery codes")
+	}
+
+	return nil
+}
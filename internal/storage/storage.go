@@ -1,31 +1,217 @@
 package storage
 
-import "github.com/moeen/redisearch-shopping/pkg/models"
+import (
+	"github.com/moeen/redisearch-shopping/internal/apperr"
+	"github.com/moeen/redisearch-shopping/pkg/models"
+	"strconv"
+	"time"
+)
 
-// Storage is the interface used to store all needed data in application
+// ErrRefreshTokenUsed is returned when a refresh token which is already used is rotated again
+var ErrRefreshTokenUsed = apperr.Conflict("refresh token is already used")
+
+// ErrInvalidActionToken is returned when an action token doesn't exist, is expired or is already used
+var ErrInvalidActionToken = apperr.Validation("invalid or expired token")
+
+// ErrTotpCodeUsed is returned when a TOTP code of a time step which is already used is verified again
+var ErrTotpCodeUsed = apperr.Validation("totp code is already used")
+
+// ErrInvalidRecoveryCode is returned when a recovery code doesn't belong to the customer or is already used
+var ErrInvalidRecoveryCode = apperr.Validation("invalid recovery code")
+
+// ErrEmailTaken is returned when a customer is created with an email which is already registered
+var ErrEmailTaken = apperr.Conflict("email is already taken")
+
+// ErrEmptyCart is returned when a customer checks out a cart without any products
+var ErrEmptyCart = apperr.Validation("cart is empty")
+
+// ErrOrderStatusChanged is returned when the status of an order is updated but it's not in the expected status anymore
+var ErrOrderStatusChanged = apperr.Conflict("order status has changed")
+
+// ErrNegativeStock is returned when the stock of a product is adjusted below zero
+var ErrNegativeStock = apperr.Validation("stock can not be negative")
+
+// ErrCategorySlugTaken is returned when a category is created with a slug which another category has
+var ErrCategorySlugTaken = apperr.Conflict("category slug is already taken")
+
+// OutOfStockError returns the error of a product which has fewer units in stock than requested
+func OutOfStockError(productID, available int) *apperr.Error {
+	return apperr.OutOfStock("product is out of stock").
+		With("productId", strconv.Itoa(productID)).
+		With("available", available)
+}
+
+// Storage is the interface used to store all needed data in application, implementations
+// return apperr errors with CodeNotFound for missing records and CodeConflict for constraint failures
 type Storage interface {
 	// GetCustomer searches for a customer with an ID and returns it
 	GetCustomer(id int) (*models.Customer, error)
 
-	// GetCustomerByEmailAndPassword searches for a customer with an email and returns it
+	// GetCustomerByEmail searches for a customer with an email and returns it
 	GetCustomerByEmail(email string) (*models.Customer, error)
 
-	// CreateCustomer creates a new customer with given data
+	// CreateCustomer creates a new customer with given data, ErrEmailTaken is returned
+	// if there is already a customer with the email
 	CreateCustomer(email, name, hash string) (*models.Customer, error)
 
-	// AddToCart adds a product to a customer cart with given quantity
+	// UpdateCustomerProfile changes the name and email of the customer with given ID, if the email is
+	// changed it's marked as unverified and the unused email verification and password reset tokens
+	// are revoked, ErrEmailTaken is returned if another customer has the email
+	UpdateCustomerProfile(id int, name, email string) error
+
+	// SetCustomerRole changes the role of the customer with given ID
+	SetCustomerRole(id int, role models.Role) error
+
+	// SetCustomerPassword changes the password hash of the customer with given ID
+	SetCustomerPassword(id int, hash string) error
+
+	// VerifyCustomerEmail marks the email of the customer with given ID as verified
+	VerifyCustomerEmail(id int) error
+
+	// SetCustomerTotp stores a new unconfirmed TOTP secret for the customer with given ID
+	// and replaces their recovery codes with the ones of given hashes
+	SetCustomerTotp(id int, secret string, recoveryCodeHashes []string) error
+
+	// ConfirmCustomerTotp enables the TOTP secret of the customer with given ID, the step of the
+	// code which confirmed it is recorded as used
+	ConfirmCustomerTotp(id int, step int64) error
+
+	// DisableCustomerTotp removes the TOTP secret and recovery codes of the customer with given ID
+	DisableCustomerTotp(id int) error
+
+	// UseTotpStep records the time step of an accepted TOTP code of the customer with given ID,
+	// ErrTotpCodeUsed is returned if the step or a later one is already used
+	UseTotpStep(id int, step int64) error
+
+	// UseRecoveryCode marks the unused recovery code of the customer with given hash as used,
+	// ErrInvalidRecoveryCode is returned if there is no such code
+	UseRecoveryCode(customerID int, hash string) error
+
+	// CreateActionToken stores a new action token
+	CreateActionToken(token *models.ActionToken) error
+
+	// UseActionToken marks the unused and unexpired action token with given hash and purpose
+	// as used and returns it, ErrInvalidActionToken is returned if there is no such token
+	UseActionToken(hash, purpose string) (*models.ActionToken, error)
+
+	// CreateRefreshToken stores a new refresh token
+	CreateRefreshToken(token *models.RefreshToken) error
+
+	// GetRefreshToken searches for a refresh token with its hash and returns it
+	GetRefreshToken(hash string) (*models.RefreshToken, error)
+
+	// RotateRefreshToken marks the refresh token with given ID as used and stores the next one,
+	// ErrRefreshTokenUsed is returned if the token is already used
+	RotateRefreshToken(id int, next *models.RefreshToken) error
+
+	// RevokeRefreshTokenFamily revokes all the refresh tokens of a family
+	RevokeRefreshTokenFamily(familyID string) error
+
+	// RevokeCustomerRefreshTokens revokes all the refresh tokens of a customer and
+	// returns the families which had an active token
+	RevokeCustomerRefreshTokens(customerID int) ([]string, error)
+
+	// AddToCart adds a product to a customer cart with given quantity, a not found error is returned
+	// when the product doesn't exist or is deleted
 	AddToCart(customerID, productID, quantity int) error
 
 	// RemoveFromCart remove a single product from customer's cart
 	RemoveFromCart(customerID, productID int) error
 
+	// SetCartItemQuantity sets the quantity of a product in customer's cart, a zero quantity removes it.
+	// Like AddToCart, a not found error is returned when a product which doesn't exist is set.
+	SetCartItemQuantity(customerID, productID, quantity int) error
+
+	// ClearCart removes all the products from customer's cart
+	ClearCart(customerID int) error
+
 	// GetCartItems returns all items in customer cart
 	GetCartItems(customerID int) ([]*models.CartItem, error)
 
-	// AddProduct Will creates the product record in storage
+	// Checkout turns the cart items of a customer into the order created by newOrder, reserves their stock
+	// until reserveUntil and clears the cart, all in a single transaction. ErrEmptyCart is returned when the
+	// cart has no products and an OutOfStockError when a product doesn't have enough stock.
+	Checkout(customerID int, reserveUntil time.Time, newOrder func(items []*models.CartItem) *models.Order) (*models.Order, error)
+
+	// GetCustomerOrders returns all the orders of a customer with their items and history, newest first
+	GetCustomerOrders(customerID int) ([]*models.Order, error)
+
+	// GetCustomerOrder searches for an order of a customer with an ID and returns it with its items and history
+	GetCustomerOrder(customerID, id int) (*models.Order, error)
+
+	// GetOrder searches for an order of any customer with an ID and returns it with its items and history
+	GetOrder(id int) (*models.Order, error)
+
+	// UpdateOrderStatus moves the order of the history entry from its FromStatus to its ToStatus and records the entry,
+	// ErrOrderStatusChanged is returned when the order is not in FromStatus anymore. The stock reservations of the
+	// order are kept when it's paid and put back into stock when it's cancelled.
+	UpdateOrderStatus(entry *models.OrderHistory) error
+
+	// GetExpiredReservationOrders returns at most limit IDs of the pending orders which have stock reservations expired by now
+	GetExpiredReservationOrders(now time.Time, limit int) ([]int, error)
+
+	// SavePayment creates the payment or updates the status and action URL of the payment with the same provider ID
+	SavePayment(payment *models.Payment) error
+
+	// GetPayment searches for a payment with its provider ID and returns it
+	GetPayment(providerID string) (*models.Payment, error)
+
+	// GetOrderPayment returns the latest payment of an order which is not declined
+	GetOrderPayment(orderID int) (*models.Payment, error)
+
+	// CountOrderPayments returns how many payments the order has, declined ones included
+	CountOrderPayments(orderID int) (int, error)
+
+	// AddProduct Will creates the product record in storage along with its outbox event
 	AddProduct(product *models.Product) error
 
-	// SearchProducts returns all products which has the name in it's name
-	// if name is nil, then it returns all the products
-	SearchProducts(name *string) ([]*models.Product, error)
+	// GetProduct searches for a product with an ID and returns it
+	GetProduct(id int) (*models.Product, error)
+
+	// UpdateProduct updates the name and price of the product with the same ID along with its outbox event
+	UpdateProduct(product *models.Product) error
+
+	// AdjustProductStock adds delta to the stock of the product with given ID along with its outbox event
+	// and returns the product, ErrNegativeStock is returned when the stock would go below zero
+	AdjustProductStock(id, delta int) (*models.Product, error)
+
+	// CreateCategory creates the category under its parent and sets its path, ErrCategorySlugTaken
+	// is returned if there is already a category with the slug
+	CreateCategory(category *models.Category) error
+
+	// GetCategories returns all the categories ordered by their path, so parents come before their children
+	GetCategories() ([]*models.Category, error)
+
+	// GetProductCategories returns the categories the product with given ID is assigned to ordered by their path
+	GetProductCategories(productID int) ([]*models.Category, error)
+
+	// SetProductCategories replaces the categories of the product with given ID along with its outbox event
+	// and returns the product with its categories
+	SetProductCategories(productID int, categoryIDs []int) (*models.Product, error)
+
+	// DeleteProduct soft deletes the product, removes it from all carts and records its outbox event
+	DeleteProduct(id int) error
+
+	// SearchProducts returns a page of the products matching given options with their categories
+	// along with the total number of matched products
+	SearchProducts(opts SearchOptions) ([]*models.Product, int, error)
+
+	// ClaimOutboxEvents claims at most limit unprocessed outbox events which are due by now for the owner until
+	// the lease is over and returns them in the order they were created, events claimed by other owners are left
+	// out and so are events of products which have an earlier event waiting for retry or claimed by another owner,
+	// so they don't overtake it
+	ClaimOutboxEvents(owner string, now time.Time, lease time.Duration, limit int) ([]*models.OutboxEvent, error)
+
+	// MarkOutboxEventProcessed marks the outbox event as applied to the searcher
+	MarkOutboxEventProcessed(id int) error
+
+	// MarkOutboxEventFailed records a failed attempt of applying the outbox event and when to retry it,
+	// the claim of the event is released so any owner can retry it
+	MarkOutboxEventFailed(id int, reason string, retryAt time.Time) error
+
+	// MarkOutboxEventDead records the last failed attempt of the outbox event and gives up on it
+	MarkOutboxEventDead(id int, reason string) error
+
+	// PruneOutboxEvents deletes the outbox events processed before given time and returns how many were deleted
+	PruneOutboxEvents(before time.Time) (int, error)
 }
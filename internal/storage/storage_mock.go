@@ -6,6 +6,7 @@ package storage
 
 import (
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	models "github.com/moeen/redisearch-shopping/pkg/models"
@@ -62,6 +63,122 @@ func (mr *MockStorageMockRecorder) AddToCart(customerID, productID, quantity int
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddToCart", reflect.TypeOf((*MockStorage)(nil).AddToCart), customerID, productID, quantity)
 }
 
+// AdjustProductStock mocks base method.
+func (m *MockStorage) AdjustProductStock(id, delta int) (*models.Product, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AdjustProductStock", id, delta)
+	ret0, _ := ret[0].(*models.Product)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AdjustProductStock indicates an expected call of AdjustProductStock.
+func (mr *MockStorageMockRecorder) AdjustProductStock(id, delta interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AdjustProductStock", reflect.TypeOf((*MockStorage)(nil).AdjustProductStock), id, delta)
+}
+
+// Checkout mocks base method.
+func (m *MockStorage) Checkout(customerID int, reserveUntil time.Time, newOrder func([]*models.CartItem) *models.Order) (*models.Order, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Checkout", customerID, reserveUntil, newOrder)
+	ret0, _ := ret[0].(*models.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Checkout indicates an expected call of Checkout.
+func (mr *MockStorageMockRecorder) Checkout(customerID, reserveUntil, newOrder interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Checkout", reflect.TypeOf((*MockStorage)(nil).Checkout), customerID, reserveUntil, newOrder)
+}
+
+// ClaimOutboxEvents mocks base method.
+func (m *MockStorage) ClaimOutboxEvents(owner string, now time.Time, lease time.Duration, limit int) ([]*models.OutboxEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClaimOutboxEvents", owner, now, lease, limit)
+	ret0, _ := ret[0].([]*models.OutboxEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClaimOutboxEvents indicates an expected call of ClaimOutboxEvents.
+func (mr *MockStorageMockRecorder) ClaimOutboxEvents(owner, now, lease, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimOutboxEvents", reflect.TypeOf((*MockStorage)(nil).ClaimOutboxEvents), owner, now, lease, limit)
+}
+
+// ClearCart mocks base method.
+func (m *MockStorage) ClearCart(customerID int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClearCart", customerID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ClearCart indicates an expected call of ClearCart.
+func (mr *MockStorageMockRecorder) ClearCart(customerID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClearCart", reflect.TypeOf((*MockStorage)(nil).ClearCart), customerID)
+}
+
+// ConfirmCustomerTotp mocks base method.
+func (m *MockStorage) ConfirmCustomerTotp(id int, step int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConfirmCustomerTotp", id, step)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ConfirmCustomerTotp indicates an expected call of ConfirmCustomerTotp.
+func (mr *MockStorageMockRecorder) ConfirmCustomerTotp(id, step interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConfirmCustomerTotp", reflect.TypeOf((*MockStorage)(nil).ConfirmCustomerTotp), id, step)
+}
+
+// CountOrderPayments mocks base method.
+func (m *MockStorage) CountOrderPayments(orderID int) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountOrderPayments", orderID)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountOrderPayments indicates an expected call of CountOrderPayments.
+func (mr *MockStorageMockRecorder) CountOrderPayments(orderID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountOrderPayments", reflect.TypeOf((*MockStorage)(nil).CountOrderPayments), orderID)
+}
+
+// CreateActionToken mocks base method.
+func (m *MockStorage) CreateActionToken(token *models.ActionToken) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateActionToken", token)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateActionToken indicates an expected call of CreateActionToken.
+func (mr *MockStorageMockRecorder) CreateActionToken(token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateActionToken", reflect.TypeOf((*MockStorage)(nil).CreateActionToken), token)
+}
+
+// CreateCategory mocks base method.
+func (m *MockStorage) CreateCategory(category *models.Category) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateCategory", category)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateCategory indicates an expected call of CreateCategory.
+func (mr *MockStorageMockRecorder) CreateCategory(category interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateCategory", reflect.TypeOf((*MockStorage)(nil).CreateCategory), category)
+}
+
 // CreateCustomer mocks base method.
 func (m *MockStorage) CreateCustomer(email, name, hash string) (*models.Customer, error) {
 	m.ctrl.T.Helper()
@@ -77,6 +194,48 @@ func (mr *MockStorageMockRecorder) CreateCustomer(email, name, hash interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateCustomer", reflect.TypeOf((*MockStorage)(nil).CreateCustomer), email, name, hash)
 }
 
+// CreateRefreshToken mocks base method.
+func (m *MockStorage) CreateRefreshToken(token *models.RefreshToken) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateRefreshToken", token)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateRefreshToken indicates an expected call of CreateRefreshToken.
+func (mr *MockStorageMockRecorder) CreateRefreshToken(token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateRefreshToken", reflect.TypeOf((*MockStorage)(nil).CreateRefreshToken), token)
+}
+
+// DeleteProduct mocks base method.
+func (m *MockStorage) DeleteProduct(id int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteProduct", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteProduct indicates an expected call of DeleteProduct.
+func (mr *MockStorageMockRecorder) DeleteProduct(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteProduct", reflect.TypeOf((*MockStorage)(nil).DeleteProduct), id)
+}
+
+// DisableCustomerTotp mocks base method.
+func (m *MockStorage) DisableCustomerTotp(id int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DisableCustomerTotp", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DisableCustomerTotp indicates an expected call of DisableCustomerTotp.
+func (mr *MockStorageMockRecorder) DisableCustomerTotp(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DisableCustomerTotp", reflect.TypeOf((*MockStorage)(nil).DisableCustomerTotp), id)
+}
+
 // GetCartItems mocks base method.
 func (m *MockStorage) GetCartItems(customerID int) ([]*models.CartItem, error) {
 	m.ctrl.T.Helper()
@@ -92,6 +251,21 @@ func (mr *MockStorageMockRecorder) GetCartItems(customerID interface{}) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCartItems", reflect.TypeOf((*MockStorage)(nil).GetCartItems), customerID)
 }
 
+// GetCategories mocks base method.
+func (m *MockStorage) GetCategories() ([]*models.Category, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCategories")
+	ret0, _ := ret[0].([]*models.Category)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCategories indicates an expected call of GetCategories.
+func (mr *MockStorageMockRecorder) GetCategories() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCategories", reflect.TypeOf((*MockStorage)(nil).GetCategories))
+}
+
 // GetCustomer mocks base method.
 func (m *MockStorage) GetCustomer(id int) (*models.Customer, error) {
 	m.ctrl.T.Helper()
@@ -122,6 +296,198 @@ func (mr *MockStorageMockRecorder) GetCustomerByEmail(email interface{}) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCustomerByEmail", reflect.TypeOf((*MockStorage)(nil).GetCustomerByEmail), email)
 }
 
+// GetCustomerOrder mocks base method.
+func (m *MockStorage) GetCustomerOrder(customerID, id int) (*models.Order, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCustomerOrder", customerID, id)
+	ret0, _ := ret[0].(*models.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCustomerOrder indicates an expected call of GetCustomerOrder.
+func (mr *MockStorageMockRecorder) GetCustomerOrder(customerID, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCustomerOrder", reflect.TypeOf((*MockStorage)(nil).GetCustomerOrder), customerID, id)
+}
+
+// GetCustomerOrders mocks base method.
+func (m *MockStorage) GetCustomerOrders(customerID int) ([]*models.Order, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCustomerOrders", customerID)
+	ret0, _ := ret[0].([]*models.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCustomerOrders indicates an expected call of GetCustomerOrders.
+func (mr *MockStorageMockRecorder) GetCustomerOrders(customerID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCustomerOrders", reflect.TypeOf((*MockStorage)(nil).GetCustomerOrders), customerID)
+}
+
+// GetExpiredReservationOrders mocks base method.
+func (m *MockStorage) GetExpiredReservationOrders(now time.Time, limit int) ([]int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetExpiredReservationOrders", now, limit)
+	ret0, _ := ret[0].([]int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetExpiredReservationOrders indicates an expected call of GetExpiredReservationOrders.
+func (mr *MockStorageMockRecorder) GetExpiredReservationOrders(now, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetExpiredReservationOrders", reflect.TypeOf((*MockStorage)(nil).GetExpiredReservationOrders), now, limit)
+}
+
+// GetOrder mocks base method.
+func (m *MockStorage) GetOrder(id int) (*models.Order, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrder", id)
+	ret0, _ := ret[0].(*models.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOrder indicates an expected call of GetOrder.
+func (mr *MockStorageMockRecorder) GetOrder(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrder", reflect.TypeOf((*MockStorage)(nil).GetOrder), id)
+}
+
+// GetOrderPayment mocks base method.
+func (m *MockStorage) GetOrderPayment(orderID int) (*models.Payment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrderPayment", orderID)
+	ret0, _ := ret[0].(*models.Payment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOrderPayment indicates an expected call of GetOrderPayment.
+func (mr *MockStorageMockRecorder) GetOrderPayment(orderID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrderPayment", reflect.TypeOf((*MockStorage)(nil).GetOrderPayment), orderID)
+}
+
+// GetPayment mocks base method.
+func (m *MockStorage) GetPayment(providerID string) (*models.Payment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPayment", providerID)
+	ret0, _ := ret[0].(*models.Payment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPayment indicates an expected call of GetPayment.
+func (mr *MockStorageMockRecorder) GetPayment(providerID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPayment", reflect.TypeOf((*MockStorage)(nil).GetPayment), providerID)
+}
+
+// GetProduct mocks base method.
+func (m *MockStorage) GetProduct(id int) (*models.Product, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetProduct", id)
+	ret0, _ := ret[0].(*models.Product)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetProduct indicates an expected call of GetProduct.
+func (mr *MockStorageMockRecorder) GetProduct(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProduct", reflect.TypeOf((*MockStorage)(nil).GetProduct), id)
+}
+
+// GetProductCategories mocks base method.
+func (m *MockStorage) GetProductCategories(productID int) ([]*models.Category, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetProductCategories", productID)
+	ret0, _ := ret[0].([]*models.Category)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetProductCategories indicates an expected call of GetProductCategories.
+func (mr *MockStorageMockRecorder) GetProductCategories(productID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProductCategories", reflect.TypeOf((*MockStorage)(nil).GetProductCategories), productID)
+}
+
+// GetRefreshToken mocks base method.
+func (m *MockStorage) GetRefreshToken(hash string) (*models.RefreshToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRefreshToken", hash)
+	ret0, _ := ret[0].(*models.RefreshToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRefreshToken indicates an expected call of GetRefreshToken.
+func (mr *MockStorageMockRecorder) GetRefreshToken(hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRefreshToken", reflect.TypeOf((*MockStorage)(nil).GetRefreshToken), hash)
+}
+
+// MarkOutboxEventDead mocks base method.
+func (m *MockStorage) MarkOutboxEventDead(id int, reason string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkOutboxEventDead", id, reason)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkOutboxEventDead indicates an expected call of MarkOutboxEventDead.
+func (mr *MockStorageMockRecorder) MarkOutboxEventDead(id, reason interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkOutboxEventDead", reflect.TypeOf((*MockStorage)(nil).MarkOutboxEventDead), id, reason)
+}
+
+// MarkOutboxEventFailed mocks base method.
+func (m *MockStorage) MarkOutboxEventFailed(id int, reason string, retryAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkOutboxEventFailed", id, reason, retryAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkOutboxEventFailed indicates an expected call of MarkOutboxEventFailed.
+func (mr *MockStorageMockRecorder) MarkOutboxEventFailed(id, reason, retryAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkOutboxEventFailed", reflect.TypeOf((*MockStorage)(nil).MarkOutboxEventFailed), id, reason, retryAt)
+}
+
+// MarkOutboxEventProcessed mocks base method.
+func (m *MockStorage) MarkOutboxEventProcessed(id int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkOutboxEventProcessed", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkOutboxEventProcessed indicates an expected call of MarkOutboxEventProcessed.
+func (mr *MockStorageMockRecorder) MarkOutboxEventProcessed(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkOutboxEventProcessed", reflect.TypeOf((*MockStorage)(nil).MarkOutboxEventProcessed), id)
+}
+
+// PruneOutboxEvents mocks base method.
+func (m *MockStorage) PruneOutboxEvents(before time.Time) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PruneOutboxEvents", before)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PruneOutboxEvents indicates an expected call of PruneOutboxEvents.
+func (mr *MockStorageMockRecorder) PruneOutboxEvents(before interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PruneOutboxEvents", reflect.TypeOf((*MockStorage)(nil).PruneOutboxEvents), before)
+}
+
 // RemoveFromCart mocks base method.
 func (m *MockStorage) RemoveFromCart(customerID, productID int) error {
 	m.ctrl.T.Helper()
@@ -136,17 +502,245 @@ func (mr *MockStorageMockRecorder) RemoveFromCart(customerID, productID interfac
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveFromCart", reflect.TypeOf((*MockStorage)(nil).RemoveFromCart), customerID, productID)
 }
 
+// RevokeCustomerRefreshTokens mocks base method.
+func (m *MockStorage) RevokeCustomerRefreshTokens(customerID int) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeCustomerRefreshTokens", customerID)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RevokeCustomerRefreshTokens indicates an expected call of RevokeCustomerRefreshTokens.
+func (mr *MockStorageMockRecorder) RevokeCustomerRefreshTokens(customerID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeCustomerRefreshTokens", reflect.TypeOf((*MockStorage)(nil).RevokeCustomerRefreshTokens), customerID)
+}
+
+// RevokeRefreshTokenFamily mocks base method.
+func (m *MockStorage) RevokeRefreshTokenFamily(familyID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeRefreshTokenFamily", familyID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeRefreshTokenFamily indicates an expected call of RevokeRefreshTokenFamily.
+func (mr *MockStorageMockRecorder) RevokeRefreshTokenFamily(familyID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeRefreshTokenFamily", reflect.TypeOf((*MockStorage)(nil).RevokeRefreshTokenFamily), familyID)
+}
+
+// RotateRefreshToken mocks base method.
+func (m *MockStorage) RotateRefreshToken(id int, next *models.RefreshToken) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RotateRefreshToken", id, next)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RotateRefreshToken indicates an expected call of RotateRefreshToken.
+func (mr *MockStorageMockRecorder) RotateRefreshToken(id, next interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RotateRefreshToken", reflect.TypeOf((*MockStorage)(nil).RotateRefreshToken), id, next)
+}
+
+// SavePayment mocks base method.
+func (m *MockStorage) SavePayment(payment *models.Payment) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SavePayment", payment)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SavePayment indicates an expected call of SavePayment.
+func (mr *MockStorageMockRecorder) SavePayment(payment interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SavePayment", reflect.TypeOf((*MockStorage)(nil).SavePayment), payment)
+}
+
 // SearchProducts mocks base method.
-func (m *MockStorage) SearchProducts(name *string) ([]*models.Product, error) {
+func (m *MockStorage) SearchProducts(opts SearchOptions) ([]*models.Product, int, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SearchProducts", name)
+	ret := m.ctrl.Call(m, "SearchProducts", opts)
 	ret0, _ := ret[0].([]*models.Product)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// SearchProducts indicates an expected call of SearchProducts.
+func (mr *MockStorageMockRecorder) SearchProducts(opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchProducts", reflect.TypeOf((*MockStorage)(nil).SearchProducts), opts)
+}
+
+// SetCartItemQuantity mocks base method.
+func (m *MockStorage) SetCartItemQuantity(customerID, productID, quantity int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetCartItemQuantity", customerID, productID, quantity)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetCartItemQuantity indicates an expected call of SetCartItemQuantity.
+func (mr *MockStorageMockRecorder) SetCartItemQuantity(customerID, productID, quantity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetCartItemQuantity", reflect.TypeOf((*MockStorage)(nil).SetCartItemQuantity), customerID, productID, quantity)
+}
+
+// SetCustomerPassword mocks base method.
+func (m *MockStorage) SetCustomerPassword(id int, hash string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetCustomerPassword", id, hash)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetCustomerPassword indicates an expected call of SetCustomerPassword.
+func (mr *MockStorageMockRecorder) SetCustomerPassword(id, hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetCustomerPassword", reflect.TypeOf((*MockStorage)(nil).SetCustomerPassword), id, hash)
+}
+
+// SetCustomerRole mocks base method.
+func (m *MockStorage) SetCustomerRole(id int, role models.Role) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetCustomerRole", id, role)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetCustomerRole indicates an expected call of SetCustomerRole.
+func (mr *MockStorageMockRecorder) SetCustomerRole(id, role interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetCustomerRole", reflect.TypeOf((*MockStorage)(nil).SetCustomerRole), id, role)
+}
+
+// SetCustomerTotp mocks base method.
+func (m *MockStorage) SetCustomerTotp(id int, secret string, recoveryCodeHashes []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetCustomerTotp", id, secret, recoveryCodeHashes)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetCustomerTotp indicates an expected call of SetCustomerTotp.
+func (mr *MockStorageMockRecorder) SetCustomerTotp(id, secret, recoveryCodeHashes interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetCustomerTotp", reflect.TypeOf((*MockStorage)(nil).SetCustomerTotp), id, secret, recoveryCodeHashes)
+}
+
+// SetProductCategories mocks base method.
+func (m *MockStorage) SetProductCategories(productID int, categoryIDs []int) (*models.Product, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetProductCategories", productID, categoryIDs)
+	ret0, _ := ret[0].(*models.Product)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// SearchProducts indicates an expected call of SearchProducts.
-func (mr *MockStorageMockRecorder) SearchProducts(name interface{}) *gomock.Call {
+// SetProductCategories indicates an expected call of SetProductCategories.
+func (mr *MockStorageMockRecorder) SetProductCategories(productID, categoryIDs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetProductCategories", reflect.TypeOf((*MockStorage)(nil).SetProductCategories), productID, categoryIDs)
+}
+
+// UpdateCustomerProfile mocks base method.
+func (m *MockStorage) UpdateCustomerProfile(id int, name, email string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateCustomerProfile", id, name, email)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateCustomerProfile indicates an expected call of UpdateCustomerProfile.
+func (mr *MockStorageMockRecorder) UpdateCustomerProfile(id, name, email interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateCustomerProfile", reflect.TypeOf((*MockStorage)(nil).UpdateCustomerProfile), id, name, email)
+}
+
+// UpdateOrderStatus mocks base method.
+func (m *MockStorage) UpdateOrderStatus(entry *models.OrderHistory) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateOrderStatus", entry)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateOrderStatus indicates an expected call of UpdateOrderStatus.
+func (mr *MockStorageMockRecorder) UpdateOrderStatus(entry interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOrderStatus", reflect.TypeOf((*MockStorage)(nil).UpdateOrderStatus), entry)
+}
+
+// UpdateProduct mocks base method.
+func (m *MockStorage) UpdateProduct(product *models.Product) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateProduct", product)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateProduct indicates an expected call of UpdateProduct.
+func (mr *MockStorageMockRecorder) UpdateProduct(product interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateProduct", reflect.TypeOf((*MockStorage)(nil).UpdateProduct), product)
+}
+
+// UseActionToken mocks base method.
+func (m *MockStorage) UseActionToken(hash, purpose string) (*models.ActionToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseActionToken", hash, purpose)
+	ret0, _ := ret[0].(*models.ActionToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseActionToken indicates an expected call of UseActionToken.
+func (mr *MockStorageMockRecorder) UseActionToken(hash, purpose interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseActionToken", reflect.TypeOf((*MockStorage)(nil).UseActionToken), hash, purpose)
+}
+
+// UseRecoveryCode mocks base method.
+func (m *MockStorage) UseRecoveryCode(customerID int, hash string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseRecoveryCode", customerID, hash)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UseRecoveryCode indicates an expected call of UseRecoveryCode.
+func (mr *MockStorageMockRecorder) UseRecoveryCode(customerID, hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseRecoveryCode", reflect.TypeOf((*MockStorage)(nil).UseRecoveryCode), customerID, hash)
+}
+
+// UseTotpStep mocks base method.
+func (m *MockStorage) UseTotpStep(id int, step int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseTotpStep", id, step)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UseTotpStep indicates an expected call of UseTotpStep.
+func (mr *MockStorageMockRecorder) UseTotpStep(id, step interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseTotpStep", reflect.TypeOf((*MockStorage)(nil).UseTotpStep), id, step)
+}
+
+// VerifyCustomerEmail mocks base method.
+func (m *MockStorage) VerifyCustomerEmail(id int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifyCustomerEmail", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// VerifyCustomerEmail indicates an expected call of VerifyCustomerEmail.
+func (mr *MockStorageMockRecorder) VerifyCustomerEmail(id interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchProducts", reflect.TypeOf((*MockStorage)(nil).SearchProducts), name)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyCustomerEmail", reflect.TypeOf((*MockStorage)(nil).VerifyCustomerEmail), id)
 }
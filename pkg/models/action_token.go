@@ -0,0 +1,28 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+const (
+	// PurposePasswordReset is the purpose of the tokens which reset the customer password
+	PurposePasswordReset = "password_reset"
+
+	// PurposeEmailVerification is the purpose of the tokens which verify the customer email
+	PurposeEmailVerification = "email_verification"
+
+	// PurposeTotpChallenge is the purpose of the tokens which let a customer who passed the
+	// password check of a login verify their TOTP code
+	PurposeTotpChallenge = "totp_challenge"
+)
+
+// ActionToken is a single use token given to a customer to confirm an action
+type ActionToken struct {
+	gorm.Model
+	CustomerID int `gorm:"index"`
+	Purpose    string
+	TokenHash  string `gorm:"uniqueIndex"`
+	ExpiresAt  time.Time
+	UsedAt     *time.Time
+}
@@ -2,11 +2,13 @@ package models
 
 import "gorm.io/gorm"
 
+// CartItem is a product in a customer cart, each product has a single item per cart which
+// is deleted for real when it's removed so it never collides with the unique index
 type CartItem struct {
 	gorm.Model
-	CustomerID int
+	CustomerID int `gorm:"uniqueIndex:idx_cart_items_customer_product"`
 	Customer   Customer
 	Quantity   int
-	ProductID  int
+	ProductID  int `gorm:"uniqueIndex:idx_cart_items_customer_product"`
 	Product    Product
 }
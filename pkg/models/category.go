@@ -0,0 +1,21 @@
+package models
+
+import "gorm.io/gorm"
+
+// CategoryPathSeparator separates the slugs of the categories in a category path
+const CategoryPathSeparator = "/"
+
+// Category is a node of the product category tree, a product in a category
+// is also in all the ancestors of the category
+type Category struct {
+	gorm.Model
+	Name string
+	Slug string `gorm:"not null;uniqueIndex"`
+
+	// ParentID is the ID of the parent category, nil for the root categories
+	ParentID *uint `gorm:"index"`
+
+	// Path is the slugs of the ancestors of the category followed by its own slug,
+	// joined by CategoryPathSeparator
+	Path string `gorm:"not null;index"`
+}
@@ -1,10 +1,62 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// Role is the access level of a customer
+type Role string
+
+const (
+	RoleCustomer Role = "customer"
+	RoleStaff    Role = "staff"
+	RoleAdmin    Role = "admin"
+)
+
+// roleRanks orders roles by their access level, each role has all the accesses of lower ones
+var roleRanks = map[Role]int{
+	RoleCustomer: 1,
+	RoleStaff:    2,
+	RoleAdmin:    3,
+}
+
+// Valid reports whether the role is one of the known roles
+func (r Role) Valid() bool {
+	_, ok := roleRanks[r]
+	return ok
+}
+
+// RequiresMFA reports whether the role can only be used by sessions started with a second factor
+func (r Role) RequiresMFA() bool {
+	return r == RoleAdmin
+}
+
+// Includes reports whether the role has all the accesses of the other role
+func (r Role) Includes(other Role) bool {
+	return r.Valid() && other.Valid() && roleRanks[r] >= roleRanks[other]
+}
 
 type Customer struct {
 	gorm.Model
-	Email    string
+	Email    string `gorm:"uniqueIndex"`
 	Password string
 	Name     string
+	Role     Role `gorm:"default:customer"`
+
+	// EmailVerifiedAt is nil until the customer verifies their email
+	EmailVerifiedAt *time.Time
+
+	// TotpSecret is the base32 secret of the customer's authenticator, it's only used to verify
+	// logins once TotpConfirmedAt is set by confirming a code of it
+	TotpSecret      string
+	TotpConfirmedAt *time.Time
+
+	// TotpLastStep is the time step of the last accepted TOTP code so codes can't be replayed
+	TotpLastStep int64
+}
+
+// TotpEnabled reports whether the customer must verify a TOTP code to login
+func (c *Customer) TotpEnabled() bool {
+	return c.TotpSecret != "" && c.TotpConfirmedAt != nil
 }
@@ -0,0 +1,56 @@
+package models
+
+import "gorm.io/gorm"
+
+// OrderStatus is the state of an order in its lifecycle
+type OrderStatus string
+
+const (
+	OrderPending   OrderStatus = "pending"
+	OrderPaid      OrderStatus = "paid"
+	OrderFulfilled OrderStatus = "fulfilled"
+	OrderShipped   OrderStatus = "shipped"
+	OrderDelivered OrderStatus = "delivered"
+	OrderCancelled OrderStatus = "cancelled"
+	OrderRefunded  OrderStatus = "refunded"
+)
+
+// Order is a purchase of the products which were in a customer cart, the prices and totals
+// are snapshotted at checkout so later product changes don't change the order
+type Order struct {
+	gorm.Model
+	CustomerID    int         `gorm:"index"`
+	Status        OrderStatus `gorm:"index;default:pending"`
+	Items         []OrderItem
+	History       []OrderHistory
+	ItemCount     int
+	Subtotal      int
+	DiscountTotal int
+	TaxTotal      int
+	GrandTotal    int
+}
+
+// OrderItem is a product of an order with its name and price at checkout
+type OrderItem struct {
+	gorm.Model
+	OrderID   int `gorm:"index"`
+	ProductID int
+	Name      string
+	UnitPrice int
+	Quantity  int
+	LineTotal int
+}
+
+// OrderHistory is a status change of an order, CreatedAt is when it happened
+type OrderHistory struct {
+	gorm.Model
+	OrderID int `gorm:"index"`
+
+	// FromStatus is empty for the entry which created the order
+	FromStatus OrderStatus
+	ToStatus   OrderStatus
+
+	// ActorID is the customer who changed the status, it's zero for changes made by the system
+	ActorID int
+	Reason  string
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+const (
+	// OutboxProductUpserted is the type of events created when a product is created or updated
+	OutboxProductUpserted = "product_upserted"
+
+	// OutboxProductDeleted is the type of events created when a product is deleted
+	OutboxProductDeleted = "product_deleted"
+)
+
+type OutboxEvent struct {
+	gorm.Model
+	Type          string
+	ProductID     int
+	Payload       string
+	Attempts      int
+	LastError     string
+	NextAttemptAt time.Time
+	ProcessedAt   *time.Time `gorm:"index"`
+
+	// DeadAt is when the event was given up on after failing too many times, it's kept for inspection
+	DeadAt *time.Time `gorm:"index"`
+
+	// ClaimedBy is the worker which is applying the event until ClaimedUntil, other workers leave it
+	// and the later events of its product alone until then
+	ClaimedBy    string
+	ClaimedUntil *time.Time
+}
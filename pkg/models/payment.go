@@ -0,0 +1,44 @@
+package models
+
+import "gorm.io/gorm"
+
+// PaymentStatus is the state of a payment at the payment provider
+type PaymentStatus string
+
+const (
+	// PaymentPending payments are waiting for the customer to complete an action like 3-D Secure
+	PaymentPending    PaymentStatus = "pending"
+	PaymentAuthorized PaymentStatus = "authorized"
+	PaymentCaptured   PaymentStatus = "captured"
+	PaymentDeclined   PaymentStatus = "declined"
+	PaymentVoided     PaymentStatus = "voided"
+	PaymentRefunded   PaymentStatus = "refunded"
+)
+
+// paymentStatusRanks orders payment statuses by how far payments are in their lifecycle
+var paymentStatusRanks = map[PaymentStatus]int{
+	PaymentPending:    1,
+	PaymentAuthorized: 2,
+	PaymentCaptured:   3,
+	PaymentDeclined:   3,
+	PaymentVoided:     3,
+	PaymentRefunded:   4,
+}
+
+// Advances reports whether a payment in the other status can move to this status, so
+// updates which arrive late or more than once are told apart
+func (s PaymentStatus) Advances(other PaymentStatus) bool {
+	return paymentStatusRanks[s] > paymentStatusRanks[other]
+}
+
+// Payment is a payment of an order at the payment provider
+type Payment struct {
+	gorm.Model
+	OrderID    int    `gorm:"index"`
+	ProviderID string `gorm:"uniqueIndex"`
+	Status     PaymentStatus
+	Amount     int
+
+	// ActionURL is where the customer completes the action of pending payments
+	ActionURL string
+}
@@ -6,4 +6,10 @@ type Product struct {
 	gorm.Model
 	Name  string
 	Price int
+
+	// Stock is the number of units which can still be sold, units reserved by orders are already taken out
+	Stock int `gorm:"not null;default:0"`
+
+	// Categories are the categories the product is assigned to, they are only loaded when it's needed
+	Categories []Category `gorm:"many2many:product_categories"`
 }
@@ -0,0 +1,14 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// RecoveryCode is a single use code which a customer can use instead of a TOTP code
+type RecoveryCode struct {
+	gorm.Model
+	CustomerID int    `gorm:"index"`
+	CodeHash   string `gorm:"index"`
+	UsedAt     *time.Time
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// RefreshToken is a single use token which is exchanged for a new access token and refresh token,
+// all the tokens rotated from the same login share a FamilyID
+type RefreshToken struct {
+	gorm.Model
+	CustomerID int    `gorm:"index"`
+	FamilyID   string `gorm:"index"`
+	TokenHash  string `gorm:"uniqueIndex"`
+	ExpiresAt  time.Time
+	UsedAt     *time.Time
+	RevokedAt  *time.Time
+
+	// MFA tells whether the session was started by a second factor, it's carried over by rotations
+	MFA bool
+}
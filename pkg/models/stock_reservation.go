@@ -0,0 +1,18 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// StockReservation is the stock of a product taken out for a pending order, it's deleted for real
+// when the order is paid and put back into the product stock when the order is cancelled
+type StockReservation struct {
+	gorm.Model
+	OrderID   int `gorm:"index"`
+	ProductID int
+	Quantity  int
+
+	// ExpiresAt is when the order is cancelled if it's not paid yet
+	ExpiresAt time.Time `gorm:"index"`
+}